@@ -0,0 +1,507 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/lawrencegripper/azurefrontdooringress/controller"
+	"github.com/lawrencegripper/azurefrontdooringress/metrics"
+	"github.com/lawrencegripper/azurefrontdooringress/sync"
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+)
+
+// command is a mode the binary can be run in, selected by the first argument
+type command struct {
+	name        string
+	description string
+	setFlags    func(*flag.FlagSet, *utils.Config)
+	run         func(ctx context.Context, config utils.Config, args []string)
+	// withoutConfig commands run before the configuration is validated, they don't need a valid one
+	withoutConfig bool
+}
+
+var commands = []command{
+	{
+		name:        "run",
+		description: "Run the controller, syncing annotated ingresses to Frontdoor (default)",
+		run:         runController,
+	},
+	{
+		name:        "validate",
+		description: "Check the configuration and that Frontdoor is reachable and correctly set up",
+		setFlags:    setInteractiveAuthFlags,
+		run:         runValidate,
+	},
+	{
+		name:        "export",
+		description: "Write the current Frontdoor configuration as JSON to stdout",
+		setFlags:    setInteractiveAuthFlags,
+		run:         runExport,
+	},
+	{
+		name:        "migrate",
+		description: "Write an ARM template for a Front Door Standard profile equivalent to the controller's routing rules",
+		setFlags:    setInteractiveAuthFlags,
+		run:         runMigrate,
+	},
+	{
+		name:        "plan",
+		description: "Write the changes a sync of the annotated ingresses would make to Frontdoor as JSON, nothing is changed",
+		setFlags:    setPlanFlags,
+		run:         runPlan,
+	},
+	{
+		name:        "simulate",
+		description: "Write the plan for the ingresses in the manifests in --fixtures instead of those in the cluster, nothing is changed",
+		setFlags:    setSimulateFlags,
+		run:         runSimulate,
+	},
+	{
+		name:        "restore",
+		description: "Replace the Frontdoor configuration with a snapshot taken before an update, lists snapshots if none is given",
+		setFlags:    setRestoreFlags,
+		run:         runRestore,
+	},
+	{
+		name:        "locks",
+		description: "List the locks in the storage account, with 'clean' delete those not used for --unused-for, or with 'break' break a held lock",
+		setFlags:    setLocksFlags,
+		run:         runLocks,
+	},
+	{
+		name:        "support-bundle",
+		description: "Write a zip of the redacted config, Frontdoor, plan, locks and optionally the controller's logs and state to attach to an issue",
+		setFlags:    setSupportBundleFlags,
+		run:         runSupportBundle,
+	},
+	{
+		name:          "manifest",
+		description:   "Write the least privileged RBAC manifests for the ServiceAccount with the features configured as YAML",
+		setFlags:      setManifestFlags,
+		run:           runManifest,
+		withoutConfig: true,
+	},
+	{
+		name:          "version",
+		description:   "Write the version, commit and build date of the controller as JSON to stdout",
+		run:           runVersion,
+		withoutConfig: true,
+	},
+}
+
+// Exit codes of the commands, so pipelines can branch on the result without parsing the logs
+const (
+	// exitFailed is any failure without a more specific code
+	exitFailed = 1
+	// exitUsage is an unknown command, action or flag
+	exitUsage = 2
+	// exitConfigError is invalid configuration, or a Frontdoor without the resources the controller requires
+	exitConfigError = 3
+	// exitAuthError is failing to sign in to Azure, or Azure refusing the credentials
+	exitAuthError = 4
+	// exitDriftDetected is returned by plan with --detailed-exitcode when Frontdoor isn't up to date
+	exitDriftDetected = 5
+	// exitApplyFailed is a change to Frontdoor, such as a restore, which failed
+	exitApplyFailed = 6
+)
+
+// exitCode returns the code to exit with for the error, exitAuthError if it's from Azure
+// authentication otherwise the code given
+func exitCode(err error, code int) int {
+	if sync.IsAuthError(err) {
+		return exitAuthError
+	}
+	return code
+}
+
+const (
+	// controllerStartAttempts is how many times creating the controller is tried, for failures such as
+	// its RBAC not having been applied yet
+	controllerStartAttempts = 5
+	// controllerStartRetryDelay is doubled after each attempt to create the controller
+	controllerStartRetryDelay = 2 * time.Second
+)
+
+// restoreSnapshotID is the snapshot selected by the restore command's flags
+var restoreSnapshotID string
+
+// planOutput is the file the plan command writes to, stdout if empty
+var planOutput string
+
+// simulateFixtures is the directory of ingress manifests the simulate command plans
+var simulateFixtures string
+
+// manifestServiceAccount is the 'namespace/name' of the ServiceAccount the manifest command binds the roles to
+var manifestServiceAccount string
+
+// planDetailedExitCode makes the plan command exit with exitDriftDetected when there are changes
+var planDetailedExitCode bool
+
+// defaultLockGCAfter is how long a lock must be unused before the locks command deletes it, unless LOCK_GC_AFTER is set
+const defaultLockGCAfter = 7 * 24 * time.Hour
+
+// locksUnusedFor is how long a lock must be unused before the locks command considers it stale
+var locksUnusedFor time.Duration
+
+func findCommand(name string) *command {
+	for i := range commands {
+		if commands[i].name == name {
+			return &commands[i]
+		}
+	}
+	return nil
+}
+
+// setInteractiveAuthFlags adds flags for commands which operators may run from their own machine
+func setInteractiveAuthFlags(flags *flag.FlagSet, config *utils.Config) {
+	flags.BoolVar(&config.UseDeviceCode, "device-code", false, "Sign in to Azure interactively using a device code")
+}
+
+func setRestoreFlags(flags *flag.FlagSet, config *utils.Config) {
+	setInteractiveAuthFlags(flags, config)
+	flags.StringVar(&restoreSnapshotID, "snapshot", "", "ID of the snapshot to restore")
+}
+
+func setPlanFlags(flags *flag.FlagSet, config *utils.Config) {
+	setInteractiveAuthFlags(flags, config)
+	flags.StringVar(&planOutput, "output", "", "File to write the plan to instead of stdout")
+	flags.BoolVar(&planDetailedExitCode, "detailed-exitcode", false, "Exit with 5 when applying the plan would change Frontdoor")
+}
+
+func setSimulateFlags(flags *flag.FlagSet, config *utils.Config) {
+	setPlanFlags(flags, config)
+	flags.StringVar(&simulateFixtures, "fixtures", "", "Directory of YAML or JSON manifests with the ingresses to plan")
+}
+
+func setLocksFlags(flags *flag.FlagSet, config *utils.Config) {
+	unusedFor := config.LockGCAfter
+	if unusedFor == 0 {
+		unusedFor = defaultLockGCAfter
+	}
+	flags.DurationVar(&locksUnusedFor, "unused-for", unusedFor, "How long a lock must be unused to be stale, defaults to LOCK_GC_AFTER or 7 days")
+}
+
+func runController(ctx context.Context, syncConfig utils.Config, args []string) {
+	logger := utils.GetLogger(ctx)
+	build := utils.GetBuildInfo()
+	logger.WithField("version", build.Version).WithField("commit", build.Commit).WithField("buildDate", build.BuildDate).
+		Info("Starting controller")
+
+	health := controller.NewHealth()
+	go func() {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.Handler())
+		mux.HandleFunc("/version", handleVersion)
+		mux.Handle("/healthz", health)
+		err := http.ListenAndServe(syncConfig.MetricsAddress, mux)
+		logger.WithError(err).Error("Metrics server stopped")
+	}()
+
+	provider, err := sync.NewProvider(ctx, syncConfig)
+	if err != nil {
+		logger.WithError(err).Error("Failed to create a provider for any Front Door")
+		os.Exit(exitFailed)
+	}
+
+	ctrl, err := startController(ctx, syncConfig, provider, health)
+	if err != nil {
+		logger.WithError(err).Error("Failed to create controller")
+		os.Exit(exitFailed)
+	}
+	// Run waits for the caches too, they're synced first so the controller is only healthy once they are
+	err = ctrl.WaitForCacheSync(ctx)
+	if err != nil {
+		health.Set(err)
+		logger.WithError(err).Error("Failed to start controller")
+		os.Exit(exitFailed)
+	}
+	health.Set(nil)
+
+	if syncConfig.AdminAddress != "" {
+		go func() {
+			err := http.ListenAndServe(syncConfig.AdminAddress, ctrl.AdminHandler())
+			logger.WithError(err).Error("Admin API server stopped")
+		}()
+	}
+
+	err = ctrl.Run(ctx)
+	if err != nil {
+		panic(fmt.Errorf("Failed running controller: %+v", err))
+	}
+}
+
+// startController creates the controller, retrying with backoff, the health reports the last failure
+func startController(ctx context.Context, syncConfig utils.Config, provider sync.Provider, health *controller.Health) (*controller.Controller, error) {
+	logger := utils.GetLogger(ctx)
+	delay := controllerStartRetryDelay
+	for attempt := 1; ; attempt++ {
+		ctrl, err := controller.New(ctx, syncConfig, provider)
+		if err == nil {
+			return ctrl, nil
+		}
+		health.Set(err)
+		if attempt == controllerStartAttempts {
+			return nil, err
+		}
+		logger.WithError(err).WithField("attempt", attempt).WithField("retryIn", delay).Warn("Failed to start controller, retrying")
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+func setManifestFlags(flags *flag.FlagSet, config *utils.Config) {
+	flags.StringVar(&manifestServiceAccount, "service-account", "default/azurefrontdoor-ingress", "ServiceAccount the controller runs as, 'namespace/name'")
+}
+
+func runManifest(ctx context.Context, syncConfig utils.Config, args []string) {
+	parts := strings.SplitN(manifestServiceAccount, "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		fmt.Fprintf(os.Stderr, "--service-account %q must be 'namespace/name'\n", manifestServiceAccount)
+		os.Exit(exitUsage)
+	}
+	for i, object := range controller.RBACManifests(syncConfig, parts[0], parts[1]) {
+		data, err := yaml.Marshal(object)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write manifest: %v\n", err)
+			os.Exit(exitFailed)
+		}
+		if i > 0 {
+			fmt.Println("---")
+		}
+		fmt.Print(string(data))
+	}
+}
+
+func runVersion(ctx context.Context, syncConfig utils.Config, args []string) {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(utils.GetBuildInfo()) //nolint: errcheck
+}
+
+// handleVersion responds with the build information so operators can tell which build is running
+func handleVersion(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(utils.GetBuildInfo()) //nolint: errcheck
+}
+
+func runValidate(ctx context.Context, syncConfig utils.Config, args []string) {
+	logger := utils.GetLogger(ctx)
+
+	err := sync.Validate(ctx, syncConfig)
+	if err != nil {
+		logger.WithError(err).Error("Frontdoor validation failed")
+		os.Exit(exitCode(err, exitConfigError))
+	}
+	logger.Info("Configuration and Frontdoor are valid")
+}
+
+func runExport(ctx context.Context, syncConfig utils.Config, args []string) {
+	logger := utils.GetLogger(ctx)
+
+	fd, err := sync.Export(ctx, syncConfig)
+	if err != nil {
+		logger.WithError(err).Error("Failed to export Frontdoor")
+		os.Exit(exitCode(err, exitFailed))
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	err = encoder.Encode(fd)
+	if err != nil {
+		logger.WithError(err).Error("Failed to write Frontdoor")
+		os.Exit(exitFailed)
+	}
+}
+
+func runMigrate(ctx context.Context, syncConfig utils.Config, args []string) {
+	logger := utils.GetLogger(ctx)
+
+	profileName := syncConfig.FrontDoorName + "-standard"
+	if len(args) > 0 {
+		profileName = args[0]
+	}
+
+	template, warnings, err := sync.Migrate(ctx, syncConfig, profileName)
+	if err != nil {
+		logger.WithError(err).Error("Failed to create migration template")
+		os.Exit(exitCode(err, exitFailed))
+	}
+	for _, warning := range warnings {
+		logger.Warn(warning)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	err = encoder.Encode(template)
+	if err != nil {
+		logger.WithError(err).Error("Failed to write migration template")
+		os.Exit(exitFailed)
+	}
+}
+
+func runPlan(ctx context.Context, syncConfig utils.Config, args []string) {
+	logger := utils.GetLogger(ctx)
+
+	ingresses, err := controller.ListAnnotatedIngresses(ctx, syncConfig)
+	if err != nil {
+		logger.WithError(err).Error("Failed to list ingresses")
+		os.Exit(exitFailed)
+	}
+
+	writePlan(ctx, syncConfig, ingresses)
+}
+
+func runSimulate(ctx context.Context, syncConfig utils.Config, args []string) {
+	logger := utils.GetLogger(ctx)
+
+	if simulateFixtures == "" {
+		logger.Error("simulate requires --fixtures with the directory of ingress manifests")
+		os.Exit(exitUsage)
+	}
+	ingresses, err := controller.LoadIngressFixtures(ctx, syncConfig, simulateFixtures)
+	if err != nil {
+		logger.WithError(err).Error("Failed to load ingress fixtures")
+		os.Exit(exitFailed)
+	}
+	logger.WithField("ingresses", len(ingresses)).Info("Loaded ingress fixtures")
+
+	writePlan(ctx, syncConfig, ingresses)
+}
+
+// writePlan plans syncing the ingresses and writes the plan as the plan command's flags select
+func writePlan(ctx context.Context, syncConfig utils.Config, ingresses []*v1beta1.Ingress) {
+	logger := utils.GetLogger(ctx)
+
+	plan, err := sync.Plan(ctx, syncConfig, ingresses)
+	if err != nil {
+		logger.WithError(err).Error("Failed to plan sync")
+		os.Exit(exitCode(err, exitFailed))
+	}
+
+	output := os.Stdout
+	if planOutput != "" {
+		output, err = os.Create(planOutput)
+		if err != nil {
+			logger.WithError(err).Error("Failed to create plan file")
+			os.Exit(exitFailed)
+		}
+		defer output.Close() //nolint: errcheck
+	}
+
+	encoder := json.NewEncoder(output)
+	encoder.SetIndent("", "  ")
+	err = encoder.Encode(plan)
+	if err != nil {
+		logger.WithError(err).Error("Failed to write plan")
+		os.Exit(exitFailed)
+	}
+	if planDetailedExitCode && plan.Changes {
+		os.Exit(exitDriftDetected)
+	}
+}
+
+func runRestore(ctx context.Context, syncConfig utils.Config, args []string) {
+	logger := utils.GetLogger(ctx)
+
+	if restoreSnapshotID == "" {
+		ids, err := sync.Snapshots(ctx, syncConfig)
+		if err != nil {
+			logger.WithError(err).Error("Failed to list snapshots")
+			os.Exit(exitCode(err, exitFailed))
+		}
+		for _, id := range ids {
+			fmt.Println(id)
+		}
+		return
+	}
+
+	err := sync.Restore(ctx, syncConfig, restoreSnapshotID)
+	if err != nil {
+		logger.WithError(err).Error("Failed to restore snapshot")
+		os.Exit(exitCode(err, exitApplyFailed))
+	}
+	logger.WithField("snapshot", restoreSnapshotID).Info("Restored Frontdoor from snapshot")
+}
+
+// runBreakLock breaks the lease on a Frontdoor's lock, which is only done with --confirm as the controller
+// holding it may still be updating the Frontdoor
+func runBreakLock(ctx context.Context, syncConfig utils.Config, args []string) {
+	logger := utils.GetLogger(ctx)
+	flags := flag.NewFlagSet("locks break", flag.ExitOnError)
+	frontDoorName := flags.String("frontdoor", "", "Name of the Frontdoor whose lock is broken")
+	confirm := flags.Bool("confirm", false, "Confirm the lock should be broken even though its holder may still be updating the Frontdoor")
+	flags.Parse(args) //nolint: errcheck
+
+	if *frontDoorName == "" {
+		logger.Error("--frontdoor is required to break a lock")
+		os.Exit(exitUsage)
+	}
+	if !*confirm {
+		logger.WithField("frontdoor", *frontDoorName).
+			Error("Not breaking the lock without --confirm, check no controller is still updating the Frontdoor first")
+		os.Exit(exitUsage)
+	}
+	if err := sync.BreakLock(ctx, syncConfig, *frontDoorName); err != nil {
+		logger.WithError(err).Error("Failed to break lock")
+		os.Exit(exitCode(err, exitFailed))
+	}
+	logger.WithField("frontdoor", *frontDoorName).Info("Broke the lock, the next controller waiting for it can now take it")
+}
+
+func runLocks(ctx context.Context, syncConfig utils.Config, args []string) {
+	logger := utils.GetLogger(ctx)
+	if syncConfig.LockingMode == utils.LockingModeNone {
+		logger.Error("No locks are kept in the storage account when LOCKING_MODE is none")
+		os.Exit(exitUsage)
+	}
+
+	action := "list"
+	if len(args) > 0 {
+		action = args[0]
+	}
+
+	switch action {
+	case "list":
+		locks, err := sync.Locks(ctx, syncConfig)
+		if err != nil {
+			logger.WithError(err).Error("Failed to list locks")
+			os.Exit(exitCode(err, exitFailed))
+		}
+		for _, lock := range locks {
+			state := "unused"
+			if lock.Held {
+				state = "held"
+			} else if time.Since(lock.LastUsed) >= locksUnusedFor {
+				state = "stale"
+			}
+			fmt.Printf("%-58s %s %s\n", lock.Name, lock.LastUsed.UTC().Format(time.RFC3339), state)
+		}
+	case "clean":
+		deleted, err := sync.CleanLocks(ctx, syncConfig, locksUnusedFor)
+		if err != nil {
+			logger.WithError(err).Error("Failed to clean up locks")
+			os.Exit(exitCode(err, exitFailed))
+		}
+		for _, name := range deleted {
+			fmt.Println(name)
+		}
+		logger.WithField("deleted", len(deleted)).Info("Deleted stale locks")
+	case "break":
+		runBreakLock(ctx, syncConfig, args[1:])
+	default:
+		logger.Errorf("Unknown locks action %q, use 'list', 'clean' or 'break'", action)
+		os.Exit(exitUsage)
+	}
+}
@@ -0,0 +1,77 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// frontdoorIDAnnotation publishes the ID Frontdoor sends in the X-Azure-FDID header
+	frontdoorIDAnnotation = "azure/frontdoor-id"
+	// serverSnippetKey is the nginx-ingress ConfigMap key holding config added to every server block
+	serverSnippetKey = "server-snippet"
+	// Markers around the part of the server snippet maintained by the controller
+	snippetBegin = "# BEGIN azurefrontdooringress access restriction"
+	snippetEnd   = "# END azurefrontdooringress access restriction"
+)
+
+// withAccessRestriction returns the nginx server snippet with a block rejecting requests that don't
+// carry the Frontdoor's ID in the X-Azure-FDID header, replacing any block added previously and
+// keeping the rest of the snippet
+func withAccessRestriction(snippet, frontdoorID string) string {
+	block := fmt.Sprintf("%s\nif ($http_x_azure_fdid !~* \"%s\") {\n  return 403;\n}\n%s", snippetBegin, frontdoorID, snippetEnd)
+
+	begin := strings.Index(snippet, snippetBegin)
+	end := strings.Index(snippet, snippetEnd)
+	if begin >= 0 && end > begin {
+		return snippet[:begin] + block + snippet[end+len(snippetEnd):]
+	}
+	if snippet == "" {
+		return block + "\n"
+	}
+	return strings.TrimSuffix(snippet, "\n") + "\n" + block + "\n"
+}
+
+// ensureAccessRestriction updates the configured nginx-ingress ConfigMap so traffic reaching
+// the cluster without going through this Frontdoor is rejected. It's a no-op when not configured.
+func (c *Controller) ensureAccessRestriction(ctx context.Context) error {
+	if c.accessRestrictionConfigMap == "" {
+		return nil
+	}
+	parts := strings.SplitN(c.accessRestrictionConfigMap, "/", 2)
+	namespace, name := parts[0], parts[1]
+
+	configMaps := c.client.CoreV1().ConfigMaps(namespace)
+	configMap, err := configMaps.Get(name, metav1.GetOptions{})
+	if err != nil {
+		return fmt.Errorf("failed to get nginx-ingress ConfigMap %s: %v", c.accessRestrictionConfigMap, err)
+	}
+
+	snippet := withAccessRestriction(configMap.Data[serverSnippetKey], c.frontdoorID)
+	if configMap.Data[serverSnippetKey] == snippet && configMap.Annotations[frontdoorIDAnnotation] == c.frontdoorID {
+		return nil
+	}
+
+	if configMap.Data == nil {
+		configMap.Data = map[string]string{}
+	}
+	configMap.Data[serverSnippetKey] = snippet
+	if configMap.Annotations == nil {
+		configMap.Annotations = map[string]string{}
+	}
+	configMap.Annotations[frontdoorIDAnnotation] = c.frontdoorID
+
+	_, err = configMaps.Update(configMap)
+	if err != nil {
+		return fmt.Errorf("failed to update nginx-ingress ConfigMap %s: %v", c.accessRestrictionConfigMap, err)
+	}
+	utils.GetLogger(ctx).
+		WithField("configMap", c.accessRestrictionConfigMap).
+		WithField("frontdoorID", c.frontdoorID).
+		Info("Updated nginx-ingress ConfigMap to only accept traffic from Frontdoor")
+	return nil
+}
@@ -0,0 +1,31 @@
+package controller
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWithAccessRestriction(t *testing.T) {
+	const id = "10a1b2c3-0000-4000-8000-000000000001"
+
+	added := withAccessRestriction("", id)
+	if !strings.Contains(added, `if ($http_x_azure_fdid !~* "`+id+`")`) {
+		t.Errorf("Expected snippet to check the Frontdoor ID got %q", added)
+	}
+
+	existing := "more_set_headers \"X-Frame-Options: DENY\";\n"
+	withExisting := withAccessRestriction(existing, id)
+	if !strings.HasPrefix(withExisting, existing) {
+		t.Errorf("Expected existing snippet to be kept got %q", withExisting)
+	}
+
+	// Updating the ID replaces the block rather than adding another
+	const newID = "10a1b2c3-0000-4000-8000-000000000002"
+	updated := withAccessRestriction(withExisting, newID)
+	if strings.Count(updated, snippetBegin) != 1 || strings.Contains(updated, id) || !strings.Contains(updated, newID) {
+		t.Errorf("Expected block to be replaced got %q", updated)
+	}
+	if withAccessRestriction(updated, newID) != updated {
+		t.Error("Expected applying the same ID to leave the snippet unchanged")
+	}
+}
@@ -0,0 +1,178 @@
+package controller
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strings"
+	gosync "sync"
+	"time"
+
+	"github.com/lawrencegripper/azurefrontdooringress/sync"
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+)
+
+// AdminState is the controller's state reported by the admin API
+type AdminState struct {
+	Paused bool `json:"paused"`
+	// LastReconcile is when the last reconcile finished, successful or not
+	LastReconcile      time.Time `json:"lastReconcile"`
+	LastSuccessfulSync time.Time `json:"lastSuccessfulSync"`
+	LastError          string    `json:"lastError,omitempty"`
+	// Desired holds the hash of the routing rules of each ingress synced by the last reconcile,
+	// keyed by 'namespace/name'
+	Desired map[string]string `json:"desired"`
+	// LastDiff describes the changes the last successful sync made to the provider
+	LastDiff AdminDiff `json:"lastDiff"`
+}
+
+// AdminDiff describes the changes a sync made
+type AdminDiff struct {
+	RulesCreated int `json:"rulesCreated"`
+	RulesUpdated int `json:"rulesUpdated"`
+	// Failed holds the error of each ingress which wasn't synced keyed by 'namespace/name'
+	Failed map[string]string `json:"failed"`
+	// Diverged holds the differences found reading back each ingress's rules keyed by 'namespace/name'
+	Diverged  map[string][]string   `json:"diverged"`
+	Providers []sync.ProviderReport `json:"providers,omitempty"`
+}
+
+// adminAPI serves the admin API and holds the state it reports and changes
+type adminAPI struct {
+	token string
+	mutex gosync.Mutex
+	state AdminState
+	// syncNow is signalled to reconcile without waiting for the debounce period
+	syncNow chan struct{}
+}
+
+func newAdminAPI(token string) *adminAPI {
+	return &adminAPI{
+		token:   token,
+		state:   AdminState{Desired: map[string]string{}},
+		syncNow: make(chan struct{}, 1),
+	}
+}
+
+// AdminHandler returns the admin API, every request must have the admin token as a bearer token
+//
+//	GET /api/v1/state    the desired state and changes made by the last sync
+//	POST /api/v1/sync    reconcile now, without waiting for a change or the debounce period
+//	POST /api/v1/pause   stop syncing until DELETE /api/v1/pause
+func (c *Controller) AdminHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/state", c.admin.handleState)
+	mux.HandleFunc("/api/v1/sync", c.admin.handleSync)
+	mux.HandleFunc("/api/v1/pause", c.admin.handlePause)
+	return c.admin.authenticate(mux)
+}
+
+// authenticate rejects requests which don't have the admin token, or all requests if there's no token
+func (a *adminAPI) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if a.token == "" || subtle.ConstantTimeCompare([]byte(token), []byte(a.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (a *adminAPI) handleState(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	a.writeState(w, http.StatusOK)
+}
+
+func (a *adminAPI) handleSync(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if a.isPaused() {
+		http.Error(w, "syncing is paused", http.StatusConflict)
+		return
+	}
+	select {
+	case a.syncNow <- struct{}{}:
+	default:
+	}
+	a.writeState(w, http.StatusAccepted)
+}
+
+func (a *adminAPI) handlePause(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		a.setPaused(true)
+	case http.MethodDelete:
+		a.setPaused(false)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	a.writeState(w, http.StatusOK)
+}
+
+func (a *adminAPI) writeState(w http.ResponseWriter, status int) {
+	a.mutex.Lock()
+	data, err := json.Marshal(a.state)
+	a.mutex.Unlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(data) //nolint: errcheck
+}
+
+func (a *adminAPI) isPaused() bool {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	return a.state.Paused
+}
+
+func (a *adminAPI) setPaused(paused bool) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.state.Paused = paused
+}
+
+// recordSync updates the state reported with the result of syncing the ingresses
+func (a *adminAPI) recordSync(synced []*v1beta1.Ingress, result *sync.SyncResult) {
+	diff := AdminDiff{
+		RulesCreated: result.RulesCreated,
+		RulesUpdated: result.RulesUpdated,
+		Failed:       map[string]string{},
+		Diverged:     result.Diverged,
+		Providers:    result.Providers,
+	}
+	for key, err := range result.Failed {
+		diff.Failed[key] = err.Error()
+	}
+	desired := map[string]string{}
+	for _, ingress := range synced {
+		key := ingressKey(ingress)
+		desired[key] = result.RulesHash[key]
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.state.LastReconcile = time.Now()
+	a.state.LastSuccessfulSync = result.Time
+	a.state.LastError = ""
+	a.state.Desired = desired
+	a.state.LastDiff = diff
+}
+
+// recordError updates the state reported after a reconcile failed
+func (a *adminAPI) recordError(err error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	a.state.LastReconcile = time.Now()
+	a.state.LastError = err.Error()
+}
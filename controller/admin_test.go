@@ -0,0 +1,97 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/lawrencegripper/azurefrontdooringress/sync"
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func adminRequest(t *testing.T, c *Controller, method, path, token string) (*httptest.ResponseRecorder, AdminState) {
+	request := httptest.NewRequest(method, path, nil)
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	response := httptest.NewRecorder()
+	c.AdminHandler().ServeHTTP(response, request)
+
+	state := AdminState{}
+	if response.Code < 300 {
+		if err := json.Unmarshal(response.Body.Bytes(), &state); err != nil {
+			t.Fatalf("Failed to read state: %v", err)
+		}
+	}
+	return response, state
+}
+
+func TestAdminAPIRequiresToken(t *testing.T) {
+	c := &Controller{admin: newAdminAPI("secret")}
+	for _, token := range []string{"", "wrong"} {
+		response, _ := adminRequest(t, c, http.MethodGet, "/api/v1/state", token)
+		if response.Code != http.StatusUnauthorized {
+			t.Errorf("Expected token %q to be rejected, got %d", token, response.Code)
+		}
+	}
+
+	c = &Controller{admin: newAdminAPI("")}
+	response, _ := adminRequest(t, c, http.MethodGet, "/api/v1/state", "")
+	if response.Code != http.StatusUnauthorized {
+		t.Errorf("Expected every request to be rejected without a configured token, got %d", response.Code)
+	}
+}
+
+func TestAdminAPIReportsLastSync(t *testing.T) {
+	c := &Controller{admin: newAdminAPI("secret")}
+	app := &v1beta1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"}}
+	c.admin.recordSync([]*v1beta1.Ingress{app}, &sync.SyncResult{
+		Time:         time.Now(),
+		RulesHash:    map[string]string{"default/app": "hash"},
+		Failed:       map[string]error{"default/broken": errors.New("invalid path")},
+		RulesCreated: 1,
+	})
+
+	response, state := adminRequest(t, c, http.MethodGet, "/api/v1/state", "secret")
+
+	if response.Code != http.StatusOK {
+		t.Fatalf("Expected state, got %d: %s", response.Code, response.Body.String())
+	}
+	if state.Desired["default/app"] != "hash" || state.LastDiff.RulesCreated != 1 || state.LastDiff.Failed["default/broken"] != "invalid path" {
+		t.Errorf("Unexpected state: %+v", state)
+	}
+
+	c.admin.recordError(errors.New("lock unavailable"))
+	_, state = adminRequest(t, c, http.MethodGet, "/api/v1/state", "secret")
+	if state.LastError != "lock unavailable" || state.Desired["default/app"] != "hash" {
+		t.Errorf("Expected the error to be reported along with the last synced state, got %+v", state)
+	}
+}
+
+func TestAdminAPIPausesAndTriggersSyncs(t *testing.T) {
+	c := &Controller{admin: newAdminAPI("secret")}
+
+	response, _ := adminRequest(t, c, http.MethodPost, "/api/v1/sync", "secret")
+	if response.Code != http.StatusAccepted || len(c.admin.syncNow) != 1 {
+		t.Errorf("Expected a sync to be queued, got %d", response.Code)
+	}
+	<-c.admin.syncNow
+
+	_, state := adminRequest(t, c, http.MethodPost, "/api/v1/pause", "secret")
+	if !state.Paused || !c.admin.isPaused() {
+		t.Error("Expected syncing to be paused")
+	}
+	response, _ = adminRequest(t, c, http.MethodPost, "/api/v1/sync", "secret")
+	if response.Code != http.StatusConflict || len(c.admin.syncNow) != 0 {
+		t.Errorf("Expected sync to be refused while paused, got %d", response.Code)
+	}
+
+	_, state = adminRequest(t, c, http.MethodDelete, "/api/v1/pause", "secret")
+	if state.Paused || c.admin.isPaused() {
+		t.Error("Expected syncing to be resumed")
+	}
+}
@@ -0,0 +1,54 @@
+package controller
+
+import (
+	"sort"
+	"strings"
+
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+)
+
+// frontdoorAnnotationPrefix starts the name of the frontdoor annotations set on ingresses
+const frontdoorAnnotationPrefix = frontdoorAnnotation + "-"
+
+// newAnnotationAllowlist returns the set of frontdoor annotations ingresses may use, nil allows them all
+func newAnnotationAllowlist(allowed []string) map[string]bool {
+	if len(allowed) == 0 {
+		return nil
+	}
+	allowlist := map[string]bool{}
+	for _, name := range allowed {
+		allowlist[name] = true
+	}
+	return allowlist
+}
+
+// filterAnnotations returns the ingress without the frontdoor annotations which aren't in the
+// allowlist, and the sorted names of those removed. The ingress is owned by the informer cache so
+// it's copied if anything is removed. The enable annotation and the controller's status annotations
+// are never removed.
+func filterAnnotations(ingress *v1beta1.Ingress, allowlist map[string]bool) (*v1beta1.Ingress, []string) {
+	if allowlist == nil {
+		return ingress, nil
+	}
+	status := map[string]bool{}
+	for _, name := range statusAnnotations {
+		status[name] = true
+	}
+
+	disallowed := []string{}
+	for name := range ingress.Annotations {
+		if strings.HasPrefix(name, frontdoorAnnotationPrefix) && !status[name] && !allowlist[name] {
+			disallowed = append(disallowed, name)
+		}
+	}
+	if len(disallowed) == 0 {
+		return ingress, nil
+	}
+	sort.Strings(disallowed)
+
+	filtered := ingress.DeepCopy()
+	for _, name := range disallowed {
+		delete(filtered.Annotations, name)
+	}
+	return filtered, disallowed
+}
@@ -0,0 +1,48 @@
+package controller
+
+import (
+	"reflect"
+	"testing"
+
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestFilterAnnotationsRemovesDisallowedAnnotations(t *testing.T) {
+	ingress := &v1beta1.Ingress{ObjectMeta: metav1.ObjectMeta{
+		Name: "app",
+		Annotations: map[string]string{
+			frontdoorAnnotation:                    "enabled",
+			"azure/frontdoor-exclude-paths":        "/internal",
+			"azure/frontdoor-dynamic-compression":  "enabled",
+			"azure/frontdoor-query-string-caching": "StripAll",
+			rulesHashAnnotation:                    "hash",
+			"kubernetes.io/ingress.class":          "nginx",
+		},
+	}}
+	allowlist := newAnnotationAllowlist([]string{"azure/frontdoor-exclude-paths"})
+
+	filtered, disallowed := filterAnnotations(ingress, allowlist)
+
+	if !reflect.DeepEqual(disallowed, []string{"azure/frontdoor-dynamic-compression", "azure/frontdoor-query-string-caching"}) {
+		t.Errorf("Expected the caching annotations to be disallowed, got %v", disallowed)
+	}
+	expected := map[string]string{
+		frontdoorAnnotation:             "enabled",
+		"azure/frontdoor-exclude-paths": "/internal",
+		rulesHashAnnotation:             "hash",
+		"kubernetes.io/ingress.class":   "nginx",
+	}
+	if !reflect.DeepEqual(filtered.Annotations, expected) {
+		t.Errorf("Expected %v, got %v", expected, filtered.Annotations)
+	}
+	if len(ingress.Annotations) != 6 {
+		t.Error("Expected the cached ingress to be unchanged")
+	}
+
+	// Without an allowlist every annotation is used
+	unfiltered, disallowed := filterAnnotations(ingress, newAnnotationAllowlist(nil))
+	if unfiltered != ingress || len(disallowed) != 0 {
+		t.Errorf("Expected the ingress to be unchanged without an allowlist, got %v", disallowed)
+	}
+}
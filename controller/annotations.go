@@ -0,0 +1,113 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lawrencegripper/azurefrontdooringress/sync"
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// frontdoorAnnotation marks ingresses and services to be used by the controller
+	frontdoorAnnotation = "azure/frontdoor"
+	// lastSyncAnnotation records when the ingress was last synced to Frontdoor
+	lastSyncAnnotation = "azure/frontdoor-last-sync"
+	// rulesHashAnnotation records a hash of the routing rules last applied for the ingress
+	rulesHashAnnotation = "azure/frontdoor-rules-hash"
+	// syncFailuresAnnotation records the number of consecutive failed syncs for the ingress
+	syncFailuresAnnotation = "azure/frontdoor-sync-failures"
+	// syncErrorAnnotation records the error from the last failed sync for the ingress
+	syncErrorAnnotation = "azure/frontdoor-sync-error"
+	// ownerClusterAnnotation names the only cluster which syncs the ingress when several clusters share
+	// a Frontdoor, so an app can be moved between clusters one ingress at a time
+	ownerClusterAnnotation = "azure/frontdoor-owner-cluster"
+)
+
+// ownedByOtherCluster returns true if the ingress is annotated to be synced by a different cluster,
+// ingresses without the annotation are synced by every cluster
+func ownedByOtherCluster(ingress *v1beta1.Ingress, clusterName string) bool {
+	owner, ok := ingress.Annotations[ownerClusterAnnotation]
+	return ok && strings.TrimSpace(owner) != clusterName
+}
+
+// stampSyncAnnotations records the sync time and applied rules hash on each synced ingress
+// and clears any previous failure
+func stampSyncAnnotations(ctx context.Context, client kubernetes.Interface, ingresses []*v1beta1.Ingress, result *sync.SyncResult) {
+	syncTime := result.Time.UTC().Format(time.RFC3339)
+	for _, ingress := range ingresses {
+		rulesHash := result.RulesHash[ingressKey(ingress)]
+		patchIngressAnnotations(ctx, client, ingress, map[string]*string{
+			lastSyncAnnotation:     &syncTime,
+			rulesHashAnnotation:    &rulesHash,
+			syncFailuresAnnotation: nil,
+			syncErrorAnnotation:    nil,
+		})
+	}
+}
+
+// stampFailureAnnotations records the consecutive failure count and last error on the ingress
+func stampFailureAnnotations(ctx context.Context, client kubernetes.Interface, ingress *v1beta1.Ingress, failure *ingressFailure) {
+	count := strconv.Itoa(failure.count)
+	patchIngressAnnotations(ctx, client, ingress, map[string]*string{
+		syncFailuresAnnotation: &count,
+		syncErrorAnnotation:    &failure.lastError,
+	})
+}
+
+// isOwnedAnnotation returns true for the annotations the controller writes to ingresses, others
+// may be owned by another ingress controller, such as nginx-ingress or AGIC, managing the same ingress
+func isOwnedAnnotation(name string) bool {
+	return strings.HasPrefix(name, frontdoorAnnotation+"-")
+}
+
+// ownedAnnotations returns the annotations the controller owns, dropping any others
+func ownedAnnotations(annotations map[string]*string) map[string]*string {
+	owned := map[string]*string{}
+	for name, value := range annotations {
+		if isOwnedAnnotation(name) {
+			owned[name] = value
+		}
+	}
+	return owned
+}
+
+// patchIngressAnnotations sets the annotations on the ingress, nil values remove the annotation.
+// Only the controller's own annotations are patched and the ingress's status is never changed,
+// so other ingress controllers managing the ingress aren't affected.
+func patchIngressAnnotations(ctx context.Context, client kubernetes.Interface, ingress *v1beta1.Ingress, annotations map[string]*string) {
+	log := utils.GetLogger(ctx)
+
+	owned := ownedAnnotations(annotations)
+	if len(owned) != len(annotations) {
+		log.WithField("ingressName", ingress.Name).Error("Refusing to patch ingress annotations not owned by the controller")
+	}
+
+	patch := map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": owned,
+		},
+	}
+	data, err := json.Marshal(patch)
+	if err != nil {
+		log.WithError(err).Error("Failed to create ingress annotation patch")
+		return
+	}
+
+	_, err = client.ExtensionsV1beta1().Ingresses(ingress.Namespace).Patch(ingress.Name, types.MergePatchType, data)
+	if err != nil {
+		// Failing to annotate shouldn't fail the sync as Frontdoor has already been updated
+		log.WithError(err).WithField("ingressName", ingress.Name).Warn("Failed to annotate ingress with sync status")
+	}
+}
+
+// ingressKey returns the 'namespace/name' key used for the ingress in sync results
+func ingressKey(ingress *v1beta1.Ingress) string {
+	return ingress.Namespace + "/" + ingress.Name
+}
@@ -0,0 +1,42 @@
+package controller
+
+import (
+	"testing"
+
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestOwnedAnnotationsDropsOtherControllersAnnotations(t *testing.T) {
+	syncTime := "2019-01-01T00:00:00Z"
+	owned := ownedAnnotations(map[string]*string{
+		lastSyncAnnotation:                                &syncTime,
+		syncErrorAnnotation:                               nil,
+		frontdoorAnnotation:                               &syncTime,
+		"nginx.ingress.kubernetes.io/ssl-redirect":        &syncTime,
+		"appgw.ingress.kubernetes.io/backend-path-prefix": nil,
+	})
+
+	if len(owned) != 2 {
+		t.Errorf("Expected only the sync status annotations, got %v", owned)
+	}
+	if _, exists := owned[syncErrorAnnotation]; !exists {
+		t.Error("Expected annotations being removed to be kept")
+	}
+}
+
+func TestOwnedByOtherCluster(t *testing.T) {
+	ingress := func(annotations map[string]string) *v1beta1.Ingress {
+		return &v1beta1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: "app", Annotations: annotations}}
+	}
+
+	if ownedByOtherCluster(ingress(map[string]string{frontdoorAnnotation: "enabled"}), "east") {
+		t.Error("Expected an ingress without an owner to be synced by every cluster")
+	}
+	if ownedByOtherCluster(ingress(map[string]string{ownerClusterAnnotation: "east"}), "east") {
+		t.Error("Expected the owner cluster to sync the ingress")
+	}
+	if !ownedByOtherCluster(ingress(map[string]string{ownerClusterAnnotation: "east"}), "west") {
+		t.Error("Expected other clusters to skip the ingress")
+	}
+}
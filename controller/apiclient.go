@@ -0,0 +1,92 @@
+package controller
+
+import (
+	"net/http"
+	"strconv"
+	gosync "sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// apiBackoffInitial is how long requests to the API server are delayed after it first fails,
+	// doubling for each consecutive failure up to apiBackoffMax
+	apiBackoffInitial = time.Second
+	apiBackoffMax     = time.Minute
+)
+
+// apiBackoffTransport counts the requests the API server fails and, while it's failing, delays
+// requests with exponential backoff. Reflectors reconnect a dropped watch every second so without it
+// an overloaded or throttling API server is retried at the same rate it's failing at.
+type apiBackoffTransport struct {
+	next   http.RoundTripper
+	logger *log.Entry
+
+	mutex gosync.Mutex
+	// failures is how many requests have failed since one last succeeded
+	failures int
+	after    func(time.Duration) <-chan time.Time
+}
+
+func newAPIBackoffTransport(next http.RoundTripper, logger *log.Entry) *apiBackoffTransport {
+	return &apiBackoffTransport{next: next, logger: logger, after: time.After}
+}
+
+// RoundTrip sends the request once any backoff has passed
+func (t *apiBackoffTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if delay := t.backoff(); delay > 0 {
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-t.after(delay):
+		}
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	switch {
+	case err != nil:
+		t.failed("connection", err)
+	case resp.StatusCode >= http.StatusInternalServerError || resp.StatusCode == http.StatusTooManyRequests:
+		t.failed(strconv.Itoa(resp.StatusCode), nil)
+	default:
+		t.succeeded()
+	}
+	return resp, err
+}
+
+// backoff returns how long to wait before sending a request
+func (t *apiBackoffTransport) backoff() time.Duration {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.failures == 0 {
+		return 0
+	}
+	delay := apiBackoffInitial
+	for i := 1; i < t.failures && delay < apiBackoffMax; i++ {
+		delay *= 2
+	}
+	if delay > apiBackoffMax {
+		delay = apiBackoffMax
+	}
+	return delay
+}
+
+func (t *apiBackoffTransport) failed(code string, err error) {
+	apiServerErrors.Inc(code)
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.failures++
+	if t.failures == 1 {
+		t.logger.WithError(err).WithField("code", code).Warn("Kubernetes API server request failed, backing off until it recovers")
+	}
+}
+
+func (t *apiBackoffTransport) succeeded() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.failures > 0 {
+		t.logger.WithField("failures", t.failures).Info("Kubernetes API server recovered")
+	}
+	t.failures = 0
+}
@@ -0,0 +1,61 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// roundTripFunc sends requests with the function
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+func TestAPIBackoffTransport(t *testing.T) {
+	responses := []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, 0, http.StatusOK, http.StatusNotFound}
+	next := roundTripFunc(func(*http.Request) (*http.Response, error) {
+		code := responses[0]
+		responses = responses[1:]
+		if code == 0 {
+			return nil, errors.New("connection refused")
+		}
+		return &http.Response{StatusCode: code}, nil
+	})
+	transport := newAPIBackoffTransport(next, log.WithField("test", t.Name()))
+	delays := []time.Duration{}
+	transport.after = func(delay time.Duration) <-chan time.Time {
+		delays = append(delays, delay)
+		ch := make(chan time.Time, 1)
+		ch <- time.Now()
+		return ch
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, "https://kubernetes/api", nil)
+	for i := 0; i < 5; i++ {
+		transport.RoundTrip(req) //nolint: errcheck
+	}
+
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second}
+	if len(delays) != len(expected) {
+		t.Fatalf("Expected delays %v got %v", expected, delays)
+	}
+	for i := range expected {
+		if delays[i] != expected[i] {
+			t.Errorf("Expected delays %v got %v", expected, delays)
+		}
+	}
+	if transport.backoff() != 0 {
+		t.Error("Expected no backoff once the API server has recovered")
+	}
+}
+
+func TestAPIBackoffTransportCapsDelay(t *testing.T) {
+	transport := newAPIBackoffTransport(nil, log.WithField("test", t.Name()))
+	transport.failures = 20
+	if delay := transport.backoff(); delay != apiBackoffMax {
+		t.Errorf("Expected the delay to be capped at %v got %v", apiBackoffMax, delay)
+	}
+}
@@ -0,0 +1,86 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+	v1 "k8s.io/api/core/v1"
+)
+
+// unhealthyBelowPercent is the share of Frontdoor's health probes which must succeed for a backend pool
+// to be reported healthy, below it Frontdoor is likely to be sending traffic to other clusters
+const unhealthyBelowPercent = 50
+
+// reportBackendHealth reads Frontdoor's view of the health of the cluster's backend pools every
+// backendHealthInterval until the context is cancelled, exposing it as a metric and recording an
+// Event on the annotated services when a pool becomes unhealthy or recovers
+func (c *Controller) reportBackendHealth(ctx context.Context) {
+	if c.backendHealthInterval <= 0 {
+		return
+	}
+	log := utils.GetLogger(ctx)
+
+	ticker := time.NewTicker(c.backendHealthInterval)
+	defer ticker.Stop()
+	for {
+		health, err := c.fetchBackendHealth(ctx)
+		if err != nil {
+			log.WithError(err).Warn("Failed to read backend health from Frontdoor, will retry")
+		} else {
+			c.updateBackendHealth(ctx, health)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// updateBackendHealth records the health of each backend pool, an Event is only recorded when
+// a pool's health changes, or when it's first seen unhealthy
+func (c *Controller) updateBackendHealth(ctx context.Context, health map[string]float64) {
+	log := utils.GetLogger(ctx)
+
+	for pool, percent := range health {
+		backendHealthPercentage.Set(percent, pool)
+		healthy := percent >= unhealthyBelowPercent
+		previous, seen := c.backendHealthy[pool]
+		c.backendHealthy[pool] = healthy
+		if seen && previous == healthy || !seen && healthy {
+			continue
+		}
+
+		logger := log.WithField("backendPool", pool).WithField("healthPercentage", percent)
+		if healthy {
+			logger.Info("Frontdoor reports the cluster's backend pool is healthy again")
+			c.recordAnnotatedServiceEvents(ctx, v1.EventTypeNormal, "FrontdoorBackendHealthy",
+				fmt.Sprintf("Frontdoor reports %.0f%% of health probes to backend pool %s succeed", percent, pool))
+		} else {
+			logger.Warn("Frontdoor reports the cluster's backend pool is unhealthy")
+			c.recordAnnotatedServiceEvents(ctx, v1.EventTypeWarning, "FrontdoorBackendUnhealthy",
+				fmt.Sprintf("Frontdoor reports only %.0f%% of health probes to backend pool %s succeed, it may be sending traffic elsewhere", percent, pool))
+		}
+	}
+}
+
+// recordAnnotatedServiceEvents records an Event on every service with the frontdoor annotation,
+// the services Frontdoor sends the cluster's traffic to
+func (c *Controller) recordAnnotatedServiceEvents(ctx context.Context, eventType, reason, message string) {
+	for _, obj := range c.listServices() {
+		service := obj.(*v1.Service)
+		if !hasFrontdoorEnabledAnnotation(service.Annotations) {
+			continue
+		}
+		recordEvent(ctx, c.client, service.Namespace, v1.ObjectReference{
+			Kind:            "Service",
+			APIVersion:      "v1",
+			Namespace:       service.Namespace,
+			Name:            service.Name,
+			UID:             service.UID,
+			ResourceVersion: service.ResourceVersion,
+		}, eventType, reason, message)
+	}
+}
@@ -0,0 +1,24 @@
+package controller
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestUpdateBackendHealth(t *testing.T) {
+	c := &Controller{backendHealthy: map[string]bool{}}
+
+	c.updateBackendHealth(context.Background(), map[string]float64{"cluster1": 100, "cluster1-team-a": 20})
+	expected := map[string]bool{"cluster1": true, "cluster1-team-a": false}
+	if !reflect.DeepEqual(c.backendHealthy, expected) {
+		t.Errorf("Expected health %v got %v", expected, c.backendHealthy)
+	}
+
+	// Pools missing from a report keep their last health
+	c.updateBackendHealth(context.Background(), map[string]float64{"cluster1-team-a": unhealthyBelowPercent})
+	expected = map[string]bool{"cluster1": true, "cluster1-team-a": true}
+	if !reflect.DeepEqual(c.backendHealthy, expected) {
+		t.Errorf("Expected health %v got %v", expected, c.backendHealthy)
+	}
+}
@@ -0,0 +1,149 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+
+	"github.com/lawrencegripper/azurefrontdooringress/sync"
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+	v1 "k8s.io/api/core/v1"
+)
+
+const (
+	// backendWeightAnnotation sets the share of the cluster's traffic sent to an annotated service
+	// relative to the cluster's other annotated services
+	backendWeightAnnotation = "azure/frontdoor-backend-weight"
+	// minBackendWeight and maxBackendWeight are the weights Frontdoor accepts for a backend
+	minBackendWeight = 1
+	maxBackendWeight = 1000
+	// backendHTTPPortAnnotation and backendHTTPSPortAnnotation set the ports of an annotated service
+	// Frontdoor connects to, as a port number or the name of one of the service's ports
+	backendHTTPPortAnnotation  = "azure/frontdoor-backend-http-port"
+	backendHTTPSPortAnnotation = "azure/frontdoor-backend-https-port"
+)
+
+// lookupHost resolves the hostname reported by a load balancer
+var lookupHost = net.LookupHost
+
+// getServiceBackends returns a backend for the load balancer of each annotated service, such as one for each
+// of the cluster's ingress controllers, ordered by service. A load balancer's IP is used or, for load balancers
+// which only report one, its hostname once it's checked to resolve. Services whose load balancer hasn't been
+// provisioned yet are left out. An invalid weight is logged, once per version of the service, and the default
+// used. Services whose port annotations don't name a port they expose are logged and left out.
+func getServiceBackends(ctx context.Context, services []interface{}, logs *logSampler) ([]sync.ClusterBackend, error) {
+	log := utils.GetLogger(ctx)
+
+	annotated := []*v1.Service{}
+	for _, serviceObj := range services {
+		service := serviceObj.(*v1.Service)
+		if hasFrontdoorEnabledAnnotation(service.Annotations) && len(service.Status.LoadBalancer.Ingress) > 0 {
+			annotated = append(annotated, service)
+		}
+	}
+	sort.Slice(annotated, func(i, j int) bool {
+		if annotated[i].Namespace != annotated[j].Namespace {
+			return annotated[i].Namespace < annotated[j].Namespace
+		}
+		return annotated[i].Name < annotated[j].Name
+	})
+
+	backends := []sync.ClusterBackend{}
+	seen := map[string]bool{}
+	for _, service := range annotated {
+		lbIngress := service.Status.LoadBalancer.Ingress[0]
+		address := lbIngress.IP
+		if address == "" && lbIngress.Hostname != "" {
+			if _, err := lookupHost(lbIngress.Hostname); err != nil {
+				return nil, fmt.Errorf("load balancer hostname %q of service %s/%s doesn't resolve: %v", lbIngress.Hostname, service.Namespace, service.Name, err)
+			}
+			address = lbIngress.Hostname
+		}
+		// Services can share a load balancer, Frontdoor only allows each address once in a pool
+		if address == "" || seen[address] {
+			continue
+		}
+		seen[address] = true
+
+		key := service.Namespace + "/" + service.Name
+		httpPort, httpsPort, err := backendPorts(service)
+		if err != nil {
+			if logs.shouldLog("Skipping service as its ports aren't exposed", key, service.ResourceVersion) {
+				log.WithError(err).WithField("serviceName", service.Name).Warn("Skipping service as its ports aren't exposed")
+			}
+			continue
+		}
+		weight, err := backendWeight(service)
+		if err != nil {
+			if logs.shouldLog("Ignoring invalid backend weight", key, service.ResourceVersion) {
+				log.WithError(err).WithField("serviceName", service.Name).Warn("Ignoring invalid backend weight")
+			}
+		}
+		log.
+			WithField("serviceName", service.Name).
+			WithField("ip", address).
+			WithField("weight", weight).
+			WithField("httpPort", httpPort).
+			WithField("httpsPort", httpsPort).
+			Debug("Found service for Frontdoor to use")
+		backends = append(backends, sync.ClusterBackend{Address: address, Weight: weight, HTTPPort: httpPort, HTTPSPort: httpsPort})
+	}
+	if len(backends) == 0 {
+		return nil, fmt.Errorf("no service found with annotation 'azure/frontdoor:enabled' found")
+	}
+
+	return backends, nil
+}
+
+// backendPorts returns the HTTP and HTTPS ports of the service's load balancer set by its annotations, which
+// must be ports the service exposes. Without an annotation the service's port named 'http' or 'https' is
+// used, zero is returned for the default port if the service has no port with that name.
+func backendPorts(service *v1.Service) (int32, int32, error) {
+	httpPort, err := servicePort(service, backendHTTPPortAnnotation, "http")
+	if err != nil {
+		return 0, 0, err
+	}
+	httpsPort, err := servicePort(service, backendHTTPSPortAnnotation, "https")
+	if err != nil {
+		return 0, 0, err
+	}
+	return httpPort, httpsPort, nil
+}
+
+// servicePort returns the port exposed by the service which is named, or numbered, by the annotation,
+// or named defaultName if the annotation isn't set
+func servicePort(service *v1.Service, annotation, defaultName string) (int32, error) {
+	value, annotated := service.Annotations[annotation]
+	if !annotated {
+		value = defaultName
+	}
+	number, err := strconv.Atoi(value)
+	for _, port := range service.Spec.Ports {
+		if port.Protocol != "" && port.Protocol != v1.ProtocolTCP {
+			continue
+		}
+		if port.Name == value || err == nil && int(port.Port) == number {
+			return port.Port, nil
+		}
+	}
+	if !annotated {
+		return 0, nil
+	}
+	return 0, fmt.Errorf("%s: %q isn't a TCP port exposed by the service's load balancer", annotation, value)
+}
+
+// backendWeight returns the weight from the service's annotation, the default weight is returned
+// with an error if the annotation isn't valid
+func backendWeight(service *v1.Service) (int32, error) {
+	value, ok := service.Annotations[backendWeightAnnotation]
+	if !ok {
+		return sync.DefaultBackendWeight, nil
+	}
+	weight, err := strconv.Atoi(value)
+	if err != nil || weight < minBackendWeight || weight > maxBackendWeight {
+		return sync.DefaultBackendWeight, fmt.Errorf("%s: %q must be a number from %d to %d", backendWeightAnnotation, value, minBackendWeight, maxBackendWeight)
+	}
+	return int32(weight), nil
+}
@@ -0,0 +1,119 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/lawrencegripper/azurefrontdooringress/sync"
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+	log "github.com/sirupsen/logrus"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func annotatedService(name string, annotations map[string]string, lbIngress ...v1.LoadBalancerIngress) *v1.Service {
+	allAnnotations := map[string]string{frontdoorAnnotation: "enabled"}
+	for k, v := range annotations {
+		allAnnotations[k] = v
+	}
+	return &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "ingress", Annotations: allAnnotations},
+		Status:     v1.ServiceStatus{LoadBalancer: v1.LoadBalancerStatus{Ingress: lbIngress}},
+	}
+}
+
+func TestGetServiceBackendsUsesLoadBalancerHostname(t *testing.T) {
+	ctx := utils.WithLogger(context.Background(), log.WithField("test", t.Name()))
+	defer func(lookup func(string) ([]string, error)) { lookupHost = lookup }(lookupHost)
+	lookupHost = func(host string) ([]string, error) {
+		if host == "lb.example.com" {
+			return []string{"52.1.2.3"}, nil
+		}
+		return nil, errors.New("no such host")
+	}
+	address := func(lbIngress v1.LoadBalancerIngress) (string, error) {
+		backends, err := getServiceBackends(ctx, []interface{}{annotatedService("nginx", nil, lbIngress)}, newLogSampler())
+		if err != nil {
+			return "", err
+		}
+		return backends[0].Address, nil
+	}
+
+	if ip, err := address(v1.LoadBalancerIngress{IP: "10.0.0.1", Hostname: "lb.example.com"}); err != nil || ip != "10.0.0.1" {
+		t.Errorf("Expected the IP to be preferred, got %q error %v", ip, err)
+	}
+	if hostname, err := address(v1.LoadBalancerIngress{Hostname: "lb.example.com"}); err != nil || hostname != "lb.example.com" {
+		t.Errorf("Expected the hostname when there's no IP, got %q error %v", hostname, err)
+	}
+	if _, err := address(v1.LoadBalancerIngress{Hostname: "missing.example.com"}); err == nil {
+		t.Error("Expected an error when the hostname doesn't resolve")
+	}
+}
+
+func TestGetServiceBackendsIncludesEveryAnnotatedService(t *testing.T) {
+	ctx := utils.WithLogger(context.Background(), log.WithField("test", t.Name()))
+	services := []interface{}{
+		annotatedService("traefik", map[string]string{backendWeightAnnotation: "25"}, v1.LoadBalancerIngress{IP: "10.0.0.2"}),
+		annotatedService("nginx", nil, v1.LoadBalancerIngress{IP: "10.0.0.1"}),
+		annotatedService("nginx-internal", map[string]string{backendWeightAnnotation: "0"}, v1.LoadBalancerIngress{IP: "10.0.0.3"}),
+		// Pending load balancers and addresses already used are left out
+		annotatedService("pending", nil),
+		annotatedService("nginx-shared", nil, v1.LoadBalancerIngress{IP: "10.0.0.1"}),
+		&v1.Service{ObjectMeta: metav1.ObjectMeta{Name: "not-annotated", Namespace: "ingress"}},
+	}
+
+	backends, err := getServiceBackends(ctx, services, newLogSampler())
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	expected := []sync.ClusterBackend{
+		{Address: "10.0.0.1", Weight: sync.DefaultBackendWeight},
+		{Address: "10.0.0.3", Weight: sync.DefaultBackendWeight},
+		{Address: "10.0.0.2", Weight: 25},
+	}
+	if !reflect.DeepEqual(backends, expected) {
+		t.Errorf("Expected backends %+v got %+v", expected, backends)
+	}
+
+	if _, err := getServiceBackends(ctx, services[3:4], newLogSampler()); err == nil {
+		t.Error("Expected an error when no annotated service has a load balancer")
+	}
+}
+
+func TestBackendPorts(t *testing.T) {
+	service := func(annotations map[string]string) *v1.Service {
+		s := annotatedService("nginx", annotations)
+		s.Spec.Ports = []v1.ServicePort{
+			{Name: "web", Port: 8080, Protocol: v1.ProtocolTCP},
+			{Name: "https", Port: 8443},
+			{Name: "dns", Port: 53, Protocol: v1.ProtocolUDP},
+		}
+		return s
+	}
+	testCases := []struct {
+		name        string
+		annotations map[string]string
+		httpPort    int32
+		httpsPort   int32
+		expectErr   bool
+	}{
+		{name: "ports named http and https", httpPort: 0, httpsPort: 8443},
+		{name: "named port", annotations: map[string]string{backendHTTPPortAnnotation: "web"}, httpPort: 8080, httpsPort: 8443},
+		{name: "port number", annotations: map[string]string{backendHTTPPortAnnotation: "8080", backendHTTPSPortAnnotation: "8443"}, httpPort: 8080, httpsPort: 8443},
+		{name: "port not exposed", annotations: map[string]string{backendHTTPPortAnnotation: "80"}, expectErr: true},
+		{name: "UDP port", annotations: map[string]string{backendHTTPSPortAnnotation: "dns"}, expectErr: true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			httpPort, httpsPort, err := backendPorts(service(tc.annotations))
+			if tc.expectErr != (err != nil) {
+				t.Fatalf("Expected error %v, got %v", tc.expectErr, err)
+			}
+			if httpPort != tc.httpPort || httpsPort != tc.httpsPort {
+				t.Errorf("Expected ports %d/%d got %d/%d", tc.httpPort, tc.httpsPort, httpPort, httpsPort)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package controller
+
+import (
+	"reflect"
+
+	v1 "k8s.io/api/core/v1"
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+)
+
+// statusAnnotations are written by the controller so changes to them don't require a reconcile
+var statusAnnotations = []string{lastSyncAnnotation, rulesHashAnnotation, syncFailuresAnnotation, syncErrorAnnotation}
+
+// ingressChanged returns true if an update to an ingress could change what is synced,
+// periodic resyncs and the controller's own status annotations are ignored
+func ingressChanged(oldIngress, newIngress *v1beta1.Ingress) bool {
+	if oldIngress.ResourceVersion == newIngress.ResourceVersion {
+		return false
+	}
+	return !reflect.DeepEqual(oldIngress.Spec, newIngress.Spec) ||
+		!reflect.DeepEqual(withoutStatusAnnotations(oldIngress.Annotations), withoutStatusAnnotations(newIngress.Annotations))
+}
+
+// serviceChanged returns true if an update to a service could change the backend used
+func serviceChanged(oldService, newService *v1.Service) bool {
+	if oldService.ResourceVersion == newService.ResourceVersion {
+		return false
+	}
+	return !reflect.DeepEqual(oldService.Annotations, newService.Annotations) ||
+		!reflect.DeepEqual(oldService.Spec.Ports, newService.Spec.Ports) ||
+		!reflect.DeepEqual(oldService.Status.LoadBalancer, newService.Status.LoadBalancer)
+}
+
+func withoutStatusAnnotations(annotations map[string]string) map[string]string {
+	filtered := make(map[string]string, len(annotations))
+	for k, v := range annotations {
+		filtered[k] = v
+	}
+	for _, k := range statusAnnotations {
+		delete(filtered, k)
+	}
+	return filtered
+}
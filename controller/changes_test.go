@@ -0,0 +1,36 @@
+package controller
+
+import (
+	"testing"
+
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestIngressChangedIgnoresStatusAnnotations(t *testing.T) {
+	oldIngress := &v1beta1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			ResourceVersion: "1",
+			Annotations:     map[string]string{frontdoorAnnotation: "enabled"},
+		},
+	}
+
+	resynced := oldIngress.DeepCopy()
+	if ingressChanged(oldIngress, resynced) {
+		t.Error("Expected resync with same resource version to be ignored")
+	}
+
+	stamped := oldIngress.DeepCopy()
+	stamped.ResourceVersion = "2"
+	stamped.Annotations[lastSyncAnnotation] = "2019-01-01T00:00:00Z"
+	if ingressChanged(oldIngress, stamped) {
+		t.Error("Expected change to status annotations to be ignored")
+	}
+
+	disabled := stamped.DeepCopy()
+	disabled.ResourceVersion = "3"
+	disabled.Annotations[frontdoorAnnotation] = "disabled"
+	if !ingressChanged(stamped, disabled) {
+		t.Error("Expected change to frontdoor annotation to be detected")
+	}
+}
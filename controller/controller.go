@@ -3,151 +3,612 @@ package controller
 import (
 	"context"
 	"fmt"
+	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/lawrencegripper/azurefrontdooringress/sync"
 	"github.com/lawrencegripper/azurefrontdooringress/utils"
 	v1 "k8s.io/api/core/v1"
 	v1beta1 "k8s.io/api/extensions/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/client-go/informers"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/clientcmd"
 )
 
-// Start starts the controller running, observing the K8s cluster for changes
-// to ingresses in the namespace
-func Start(ctx context.Context, namespace string, provider sync.Provider) ([]*v1beta1.Ingress, error) {
-	log := utils.GetLogger(ctx)
+const (
+	// cacheSyncTimeout is how long to wait for the informers to complete their initial list
+	cacheSyncTimeout = 2 * time.Minute
+	// resyncPeriod is how often a reconcile is run when nothing has changed in the cluster
+	resyncPeriod = 30 * time.Second
+	// maxDebounceFactor limits how long a sync is delayed by a continuous stream of changes
+	maxDebounceFactor = 10
+)
+
+// Controller observes the K8s cluster for changes to ingresses in the
+// namespace and syncs them with the provider
+type Controller struct {
+	debounce time.Duration
+	provider sync.Provider
+	client   kubernetes.Interface
+	// namespaces holds the informers of each namespace watched, namespaces the controller
+	// isn't allowed to watch are skipped
+	namespaces []*namespaceInformers
+	// changed is signalled when an ingress or service changes and a reconcile is needed
+	changed chan struct{}
+	// failures tracks ingresses which have failed to sync so their retries can be rate limited
+	failures *failureTracker
+	// accessRestrictionConfigMap is the 'namespace/name' of the nginx-ingress ConfigMap
+	// updated to reject traffic which doesn't carry frontdoorID in the X-Azure-FDID header
+	accessRestrictionConfigMap string
+	frontdoorID                string
+	// serviceTagsConfigMap is the 'namespace/name' of the ConfigMap the Frontdoor backend ranges are written to
+	serviceTagsConfigMap string
+	// serviceTagsSourceRanges restricts the load balancer of the annotated services to the Frontdoor backend ranges
+	serviceTagsSourceRanges bool
+	fetchBackendRanges      func(context.Context) ([]string, string, error)
+	// summary collects sync activity which is logged periodically
+	summary *syncSummary
+	// lockGCAfter is how long a lock must be unused before it's deleted, zero disables lock cleanup
+	lockGCAfter time.Duration
+	cleanLocks  func(context.Context, time.Duration) ([]string, error)
+	// authoritative is set if the cluster may delete state shared with other clusters
+	authoritative bool
+	// clusterName is compared with the owner annotation of ingresses
+	clusterName string
+	// writeStatus enables the sync status annotations on ingresses
+	writeStatus bool
+	// admin holds the state reported by the admin API and pauses or triggers syncs
+	admin *adminAPI
+	// annotationAllowlist holds the frontdoor annotations ingresses may use, nil allows them all
+	annotationAllowlist map[string]bool
+	// ignoredAnnotations holds the disallowed annotations last reported for each ingress
+	// keyed by 'namespace/name', so the warning Event is only recorded when they change
+	ignoredAnnotations map[string]string
+	// invalidAnnotations holds the invalid annotations last reported for each ingress, like ignoredAnnotations
+	invalidAnnotations map[string]string
+	// skipLogs stops the ingresses skipped being logged on every reconcile
+	skipLogs *logSampler
+	// publicIPProbe discovers the cluster's public IP when no service is annotated, nil if it's not configured
+	publicIPProbe *publicIPProbe
+	// backendHealthInterval is how often Frontdoor's view of the backend pools' health is read, zero disables it
+	backendHealthInterval time.Duration
+	fetchBackendHealth    func(context.Context) (map[string]float64, error)
+	// backendHealthy holds whether each backend pool was last reported healthy
+	backendHealthy map[string]bool
+	// queue holds the ingresses and services changed since they were last synced
+	queue *changeQueue
+	// waitForReadyEndpoints holds back new ingresses until their services have ready endpoints,
+	// routed holds the ingresses synced since the controller started, keyed by 'namespace/name',
+	// and endpointWaits the services last reported being waited for, like ignoredAnnotations
+	waitForReadyEndpoints bool
+	routed                map[string]bool
+	endpointWaits         map[string]string
+	// unready disables the routes to services which have had no ready endpoints for too long
+	unready *unreadyTracker
+	// routeVerifier requests the paths newly routed by each sync through Frontdoor, nil if it's disabled
+	routeVerifier *routeVerifier
+	// propagation waits for the paths newly routed by each sync to answer through Frontdoor before the
+	// sync is reported as successful, nil if it's disabled
+	propagation *routeVerifier
+}
+
+// New creates a controller for the configured namespaces, the informers it creates are
+// shared by every reconcile for the lifetime of the controller
+func New(ctx context.Context, config utils.Config, provider sync.Provider) (*Controller, error) {
+	client, err := getClientSet(ctx, config)
+	if err != nil {
+		return nil, err
+	}
 
-	resyncPeriod := 30 * time.Second
-	client, _ := getClientSet(ctx)
-	// create informers factory, enable and assign required informers
-	infFactory := informers.NewSharedInformerFactoryWithOptions(client, resyncPeriod,
-		informers.WithNamespace(namespace),
-		informers.WithTweakListOptions(func(*metav1.ListOptions) {}))
+	c := &Controller{
+		debounce:    config.SyncDebounce,
+		clusterName: config.ClusterName,
+		provider:    provider,
+		client:      client,
+		changed:     make(chan struct{}, 1),
+		failures:    newFailureTracker(),
+		summary:     newSyncSummary(time.Now()),
+		writeStatus: config.WriteIngressStatus,
+		admin:       newAdminAPI(config.AdminToken),
 
-	stopChan := make(chan struct{})
+		annotationAllowlist: newAnnotationAllowlist(config.AllowedAnnotations),
+		ignoredAnnotations:  map[string]string{},
+		invalidAnnotations:  map[string]string{},
+		publicIPProbe:       newPublicIPProbe(config.PublicIPProbeURL),
+		skipLogs:            newLogSampler(),
+		queue:               newChangeQueue(),
 
-	ingressInformer := infFactory.Extensions().V1beta1().Ingresses().Informer()
-	ingressStore := ingressInformer.GetStore()
+		waitForReadyEndpoints: config.WaitForReadyEndpoints,
+		routed:                map[string]bool{},
+		endpointWaits:         map[string]string{},
+		unready:               newUnreadyTracker(config.DisableUnreadyRoutesAfter),
+		routeVerifier:         newRouteVerifier(config.FrontDoorHostname, config.RouteVerificationWindow, client),
+		propagation:           newRouteVerifier(config.FrontDoorHostname, config.AwaitPropagationTimeout, client),
 
-	serviceInformer := infFactory.Core().V1().Services().Informer()
-	serviceStore := serviceInformer.GetStore()
+		accessRestrictionConfigMap: config.AccessRestrictionConfigMap,
+		frontdoorID:                config.FrontDoorID,
 
-	go ingressInformer.Run(stopChan)
-	go serviceInformer.Run(stopChan)
+		serviceTagsConfigMap:    config.ServiceTagsConfigMap,
+		serviceTagsSourceRanges: config.ServiceTagsLoadBalancerSourceRanges,
+		fetchBackendRanges: func(ctx context.Context) ([]string, string, error) {
+			return sync.FrontDoorBackendRanges(ctx, config)
+		},
 
-	time.Sleep(15 * time.Second)
+		lockGCAfter:   config.LockGCAfter,
+		authoritative: config.Authoritative(),
+		cleanLocks: func(ctx context.Context, unusedFor time.Duration) ([]string, error) {
+			return sync.CleanLocks(ctx, config, unusedFor)
+		},
+
+		backendHealthInterval: config.BackendHealthInterval,
+		backendHealthy:        map[string]bool{},
+		fetchBackendHealth: func(ctx context.Context) (map[string]float64, error) {
+			return sync.BackendHealth(ctx, config)
+		},
+	}
+
+	for _, namespace := range config.Namespaces() {
+		c.addNamespace(ctx, namespace)
+	}
+	if len(c.namespaces) == 0 {
+		return nil, fmt.Errorf("the controller isn't allowed to list and watch ingresses and services in any of the namespaces %q", config.Namespaces())
+	}
+
+	syncQueueDepth.SetFunc(func() float64 { return float64(c.queue.depth()) })
+	syncQueueOldestChangeAge.SetFunc(func() float64 { return c.queue.oldestAge().Seconds() })
+	return c, nil
+}
 
-	log.Info("Resyncing data store")
-	err := ingressStore.Resync()
+// Run starts the informers and reconciles whenever the cluster changes, or every
+// resyncPeriod, until the context is cancelled or a reconcile fails. Failing to acquire
+// the Frontdoor lock is retried by the next reconcile, so how long it's been failing,
+// which is alerted on, isn't lost by restarting.
+func (c *Controller) Run(ctx context.Context) error {
+	err := c.WaitForCacheSync(ctx)
 	if err != nil {
-		log.WithError(err).Error("Error eesyncing ingress store")
-		return nil, err
+		return err
 	}
 
-	serviceIP, err := getServiceIP(ctx, serviceStore)
+	go c.refreshServiceTags(ctx)
+	go c.collectStaleLocks(ctx)
+	go c.reportBackendHealth(ctx)
+
+	ticker := time.NewTicker(resyncPeriod)
+	defer ticker.Stop()
+
+	for {
+		// Every log line and Azure call in the cycle carries its ID so it can be followed end-to-end
+		syncCtx := utils.WithSyncID(ctx, utils.NewSyncID())
+		syncLog := utils.GetLogger(syncCtx)
+
+		if c.admin.isPaused() {
+			syncLog.Info("Syncing is paused through the admin API")
+		} else {
+			if err := c.ensureAccessRestriction(syncCtx); err != nil {
+				syncLog.WithError(err).Warn("Failed to update access restriction")
+			}
+
+			ingress, err := c.Reconcile(syncCtx)
+			switch {
+			case sync.IsLockError(err):
+				syncLog.WithError(err).Warn("Unable to acquire the Frontdoor lock, retrying on the next reconcile")
+			case err != nil:
+				return err
+			default:
+				syncLog.WithField("ingress", ingress).Debug("Update ingress in frontdoor")
+			}
+			c.summary.logIfDue(ctx, time.Now())
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-c.changed:
+			c.waitForQuietPeriod(ctx)
+		case <-c.admin.syncNow:
+			syncLog.Info("Sync requested through the admin API")
+		case <-ticker.C:
+		}
+	}
+}
+
+// waitForQuietPeriod waits until no changes have been seen for the debounce period so a burst
+// of changes, such as a deployment updating many ingresses, results in a single sync.
+// To avoid never syncing under constant change it waits at most maxDebounceFactor * debounce.
+func (c *Controller) waitForQuietPeriod(ctx context.Context) {
+	if c.debounce <= 0 {
+		return
+	}
+	log := utils.GetLogger(ctx)
+	log.WithField("debounce", c.debounce).Info("Change detected, waiting for changes to settle before syncing")
+
+	deadline := time.NewTimer(c.debounce * maxDebounceFactor)
+	defer deadline.Stop()
+	quiet := time.NewTimer(c.debounce)
+	defer func() { quiet.Stop() }()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-deadline.C:
+			log.Info("Changes still occurring after maximum debounce, syncing now")
+			return
+		case <-quiet.C:
+			return
+		case <-c.changed:
+			// Restart the quiet period
+			quiet.Stop()
+			quiet = time.NewTimer(c.debounce)
+		}
+	}
+}
+
+// WaitForCacheSync starts the informers, if not already running, and waits for them
+// to list the current state of the cluster. The informers stop when the context is cancelled.
+func (c *Controller) WaitForCacheSync(ctx context.Context) error {
+	log := utils.GetLogger(ctx)
+
+	hasSynced := []cache.InformerSynced{}
+	for _, ns := range c.namespaces {
+		ns.factory.Start(ctx.Done())
+		hasSynced = append(hasSynced, ns.ingresses.HasSynced, ns.services.HasSynced)
+		if ns.endpoints != nil {
+			hasSynced = append(hasSynced, ns.endpoints.HasSynced)
+		}
+	}
+
+	syncCtx, cancel := context.WithTimeout(ctx, cacheSyncTimeout)
+	defer cancel()
+	if !cache.WaitForCacheSync(syncCtx.Done(), hasSynced...) {
+		err := fmt.Errorf("timed out after %v waiting for ingress and service caches to sync", cacheSyncTimeout)
+		log.WithError(err).Error("Error waiting for informers")
+		return err
+	}
+	return nil
+}
+
+// Reconcile syncs the annotated ingresses currently in the informer cache with the provider
+func (c *Controller) Reconcile(ctx context.Context) ([]*v1beta1.Ingress, error) {
+	log := utils.GetLogger(ctx)
+	// Taken before the ingresses are listed so any change made after it is synced by the next reconcile
+	changes := c.queue.take()
+
+	backends, err := getServiceBackends(ctx, c.listServices(), c.skipLogs)
+	if err != nil && c.publicIPProbe != nil {
+		var publicIP string
+		publicIP, err = c.publicIPProbe.publicIP(ctx, time.Now())
+		backends = []sync.ClusterBackend{{Address: publicIP, Weight: sync.DefaultBackendWeight}}
+	}
 	if err != nil {
 		log.WithError(err).Error("Error getting service")
+		c.admin.recordError(err)
+		c.queue.requeue(changes)
 		return nil, err
 	}
 
-	log.WithField("PublicIngressIP", serviceIP).Info("Located annotated external service used by primary ingress controller")
-
 	ingressToSync := make([]*v1beta1.Ingress, 0)
+	waiting := 0
+	skipped := 0
+	ownedElsewhere := 0
+	ignoredAnnotations := map[string]string{}
+	invalidAnnotations := map[string]string{}
+	endpointWaits := map[string]string{}
+	// live holds every ingress routed by the cluster, including those not synced by this reconcile
+	live := map[types.UID]string{}
+	unreadyServices, endUnready := c.unready.reconcile(c.readyServices(), time.Now())
+	// Skipped ingresses are only logged when they change, the summary counts them
+	logSkip := func(ingress *v1beta1.Ingress, message string) {
+		if c.skipLogs.shouldLog(message, ingressKey(ingress), ingress.ResourceVersion) {
+			log.WithField("ingressName", ingress.Name).Debug(message)
+		}
+	}
 
-	for _, ingressObj := range ingressStore.List() {
+	for _, ingressObj := range c.listIngresses() {
 		ingress := ingressObj.(*v1beta1.Ingress)
 		if !hasFrontdoorEnabledAnnotation(ingress.Annotations) {
-			log.WithField("ingressName", ingress.Name).Info("Skipping ingress as isn't annotated")
+			skipped++
+			logSkip(ingress, "Skipping ingress as isn't annotated")
+			continue
+		}
+
+		if ownedByOtherCluster(ingress, c.clusterName) {
+			ownedElsewhere++
+			logSkip(ingress, "Skipping ingress as it's owned by another cluster")
+			continue
+		}
+		live[ingress.UID] = ingressKey(ingress)
+
+		if !c.failures.ready(ingressKey(ingress)) {
+			waiting++
+			logSkip(ingress, "Skipping ingress as waiting to retry after previous failures")
+			continue
+		}
+
+		if wait, err := c.waitingForEndpoints(ctx, ingress, endpointWaits); err != nil {
+			log.WithError(err).WithField("ingressName", ingress.Name).Warn("Unable to check the ingress's services have ready endpoints, syncing it anyway")
+		} else if wait {
+			waiting++
+			logSkip(ingress, "Skipping ingress as waiting for its services to have ready endpoints")
 			continue
 		}
 
-		log.WithField("ingressName", ingress.Name).Info("Found ingress for frontdoor to route")
+		ingress = c.ignoreDisallowedAnnotations(ctx, ingress, ignoredAnnotations)
+		ingress = c.ignoreInvalidAnnotations(ctx, ingress, invalidAnnotations)
+		// Always applied so an ingress can't set the annotation itself
+		ingress = sync.WithUnreadyServices(ingress, unreadyServices(ingress))
+
+		log.WithField("ingressName", ingress.Name).Debug("Found ingress for frontdoor to route")
 
 		ingressToSync = append(ingressToSync, ingress)
 	}
 
-	err = provider.Sync(ctx, ingressToSync)
+	c.ignoredAnnotations = ignoredAnnotations
+	c.invalidAnnotations = invalidAnnotations
+	c.endpointWaits = endpointWaits
+	endUnready(ctx)
+	c.skipLogs.endReconcile()
+
+	result, err := c.provider.Sync(sync.WithLiveIngresses(ctx, live), ingressToSync, backends)
 	if err != nil {
 		log.WithError(err).Error("Failed to sync ingress")
+		c.admin.recordError(err)
+		c.queue.requeue(changes)
+		if lockErr, unavailable := sync.AsLockUnavailable(err); unavailable {
+			for _, ingress := range ingressToSync {
+				recordIngressEvent(ctx, c.client, ingress, v1.EventTypeWarning, "LockUnavailable",
+					fmt.Sprintf("Not synced to Frontdoor as its lock couldn't be acquired: %v", lockErr))
+			}
+		}
 		return nil, err
 	}
+	propagated := c.awaitPropagation(ctx, ingressToSync, result)
+	c.queue.synced(changes, result.Failed)
+
+	if propagated {
+		lastSuccessfulSync.Set(float64(result.Time.Unix()))
+	}
+	logProviderReports(ctx, result.Providers)
+
+	synced := make([]*v1beta1.Ingress, 0, len(ingressToSync))
+	for _, ingress := range ingressToSync {
+		key := ingressKey(ingress)
+		syncErr, failed := result.Failed[key]
+		if !failed {
+			c.failures.recordSuccess(key)
+			c.routed[key] = true
+			synced = append(synced, ingress)
+			if diffs, diverged := result.Diverged[key]; diverged {
+				recordIngressEvent(ctx, c.client, ingress, v1.EventTypeWarning, "SyncDiverged",
+					fmt.Sprintf("Frontdoor accepted the update but the applied rules differ: %s", strings.Join(diffs, "; ")))
+			}
+			continue
+		}
+
+		failure := c.failures.recordFailure(key, syncErr)
+		log.WithError(syncErr).
+			WithField("ingressName", ingress.Name).
+			WithField("consecutiveFailures", failure.count).
+			Warn("Failed to sync ingress, will retry")
+		if c.writeStatus {
+			stampFailureAnnotations(ctx, c.client, ingress, failure)
+		}
+		reason := "SyncFailed"
+		if result.RolledBack {
+			reason = "SyncRolledBack"
+		} else if _, unavailable := sync.AsLockUnavailable(syncErr); unavailable {
+			reason = "LockUnavailable"
+		} else if _, timedOut := syncErr.(*PropagationError); timedOut {
+			reason = "PropagationTimeout"
+		}
+		recordIngressEvent(ctx, c.client, ingress, v1.EventTypeWarning, reason,
+			fmt.Sprintf("Failed to sync to Frontdoor (%d consecutive failures): %v", failure.count, syncErr))
+	}
+
+	if c.writeStatus {
+		stampSyncAnnotations(ctx, c.client, synced, result)
+	}
+	c.summary.record(len(ingressToSync)+waiting, waiting, skipped, ownedElsewhere, result)
+	c.admin.recordSync(synced, result)
+	c.routeVerifier.verify(ctx, synced)
 
-	return ingressToSync, nil
+	return synced, nil
 }
 
-func getServiceIP(ctx context.Context, serviceStore cache.Store) (string, error) {
-	log := utils.GetLogger(ctx)
+// awaitPropagation waits for the new paths of the ingresses which synced to answer through Frontdoor,
+// failing those which didn't in the result so they're retried. It returns false if any didn't answer.
+func (c *Controller) awaitPropagation(ctx context.Context, ingressToSync []*v1beta1.Ingress, result *sync.SyncResult) bool {
+	if c.propagation == nil {
+		return true
+	}
+	succeeded := make([]*v1beta1.Ingress, 0, len(ingressToSync))
+	for _, ingress := range ingressToSync {
+		if _, failed := result.Failed[ingressKey(ingress)]; !failed {
+			succeeded = append(succeeded, ingress)
+		}
+	}
+	errs := c.propagation.awaitPropagation(ctx, succeeded)
+	if len(errs) > 0 && result.Failed == nil {
+		result.Failed = map[string]error{}
+	}
+	for key, err := range errs {
+		result.Failed[key] = err
+	}
+	return len(errs) == 0
+}
 
-	services := serviceStore.List()
-
-	var serviceIP string
-	for _, serviceObj := range services {
-		service := serviceObj.(*v1.Service)
-		if hasFrontdoorEnabledAnnotation(service.Annotations) {
-			if len(service.Status.LoadBalancer.Ingress) > 0 {
-				serviceIP = service.Status.LoadBalancer.Ingress[0].IP
-				log.
-					WithField("serviceName", service.Name).
-					WithField("ip", serviceIP).
-					Info("Found service for Frontdoor to use")
+// ignoreDisallowedAnnotations returns the ingress without the annotations the allowlist doesn't permit,
+// recording a warning Event on the ingress when the annotations ignored change
+func (c *Controller) ignoreDisallowedAnnotations(ctx context.Context, ingress *v1beta1.Ingress, ignored map[string]string) *v1beta1.Ingress {
+	filtered, disallowed := filterAnnotations(ingress, c.annotationAllowlist)
+	if len(disallowed) == 0 {
+		return ingress
+	}
+	key := ingressKey(ingress)
+	names := strings.Join(disallowed, ", ")
+	ignored[key] = names
+	if c.ignoredAnnotations[key] != names {
+		utils.GetLogger(ctx).
+			WithField("ingressName", ingress.Name).
+			WithField("annotations", disallowed).
+			Warn("Ignoring annotations which aren't allowed")
+		recordIngressEvent(ctx, c.client, ingress, v1.EventTypeWarning, "AnnotationNotAllowed",
+			fmt.Sprintf("Ignoring annotations not allowed by the cluster administrator: %s", names))
+	}
+	return filtered
+}
+
+// ignoreInvalidAnnotations returns the ingress without the annotations whose values are invalid so their
+// defaults are used, recording a warning Event listing each with its expected format when they change
+func (c *Controller) ignoreInvalidAnnotations(ctx context.Context, ingress *v1beta1.Ingress, reported map[string]string) *v1beta1.Ingress {
+	filtered, invalid := sync.RemoveInvalidAnnotations(ingress)
+	if len(invalid) == 0 {
+		return ingress
+	}
+	key := ingressKey(ingress)
+	descriptions := make([]string, len(invalid))
+	names := make([]string, len(invalid))
+	for i, annotation := range invalid {
+		descriptions[i] = annotation.String()
+		names[i] = annotation.Name
+	}
+	message := strings.Join(descriptions, "; ")
+	reported[key] = message
+	if c.invalidAnnotations[key] != message {
+		utils.GetLogger(ctx).
+			WithField("ingressName", ingress.Name).
+			WithField("annotations", names).
+			Warn("Ignoring annotations with invalid values")
+		recordIngressEvent(ctx, c.client, ingress, v1.EventTypeWarning, "InvalidAnnotation",
+			fmt.Sprintf("Ignoring invalid annotations and using their defaults: %s", message))
+	}
+	return filtered
+}
+
+// objectChanged records the change to the ingress or service and queues a reconcile
+func (c *Controller) objectChanged(kind string, obj interface{}) {
+	c.queue.add(kind, obj)
+	c.signalChanged()
+}
+
+// signalChanged queues a reconcile, if one is already queued this is a no-op
+func (c *Controller) signalChanged() {
+	select {
+	case c.changed <- struct{}{}:
+	default:
+	}
+}
+
+// ListAnnotatedIngresses returns the ingresses in the configured namespaces which are annotated to be routed
+// by Frontdoor, namespaces the ingresses can't be listed in are skipped with a warning
+func ListAnnotatedIngresses(ctx context.Context, config utils.Config) ([]*v1beta1.Ingress, error) {
+	client, err := getClientSet(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	ingresses := []*v1beta1.Ingress{}
+	listed := 0
+	for _, namespace := range config.Namespaces() {
+		list, err := client.ExtensionsV1beta1().Ingresses(namespace).List(metav1.ListOptions{})
+		if apierrors.IsForbidden(err) {
+			utils.GetLogger(ctx).WithError(err).WithField("namespace", namespace).Warn("Skipping namespace as the ingresses can't be listed")
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to list ingresses: %v", err)
+		}
+		listed++
+		for i := range list.Items {
+			if hasFrontdoorEnabledAnnotation(list.Items[i].Annotations) {
+				ingresses = append(ingresses, &list.Items[i])
 			}
 		}
 	}
-	if serviceIP == "" {
-		return serviceIP, fmt.Errorf("no service found with annotation 'azure/frontdoor:enabled' found")
+	if listed == 0 {
+		return nil, fmt.Errorf("not allowed to list ingresses in any of the namespaces %q", config.Namespaces())
 	}
+	return ingresses, nil
+}
 
-	return serviceIP, nil
+// PodLogs returns the last lines logged by the pod, such as the controller's own for a support bundle
+func PodLogs(ctx context.Context, config utils.Config, namespace, name string, lines int64) ([]byte, error) {
+	client, err := getClientSet(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	logs, err := client.CoreV1().Pods(namespace).GetLogs(name, &v1.PodLogOptions{TailLines: &lines}).Do().Raw()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the logs of pod %s/%s: %v", namespace, name, err)
+	}
+	return logs, nil
 }
 
 func hasFrontdoorEnabledAnnotation(annotations map[string]string) bool {
-	annotation, exists := annotations["azure/frontdoor"]
+	annotation, exists := annotations[frontdoorAnnotation]
 	if exists && annotation == "enabled" {
 		return true
 	}
 	return false
 }
 
-func getClientSet(ctx context.Context) (*kubernetes.Clientset, error) {
+// getClientSet creates a client for the API server, rate limited as configured, whose requests back off
+// while the API server is failing
+func getClientSet(ctx context.Context, syncConfig utils.Config) (*kubernetes.Clientset, error) {
 	log := utils.GetLogger(ctx)
 
 	config, err := rest.InClusterConfig()
 	if err != nil {
-		log.WithError(err).Warn("failed getting in-cluster config attempting to use kubeconfig from homedir")
-		var kubeconfig string
-		if home := homeDir(); home != "" {
-			kubeconfig = filepath.Join(home, ".kube", "config")
+		log.WithError(err).Warn("failed getting in-cluster config attempting to use kubeconfig")
+		kubeconfig := kubeconfigPath()
+		if kubeconfig == "" {
+			return nil, fmt.Errorf("not running in a cluster, %v, and neither KUBECONFIG nor a home directory is set", err)
 		}
-
-		if _, err := os.Stat(kubeconfig); os.IsNotExist(err) {
-			log.WithError(err).Panic("kubeconfig not found in homedir")
+		if _, statErr := os.Stat(kubeconfig); os.IsNotExist(statErr) {
+			return nil, fmt.Errorf("not running in a cluster, %v, and kubeconfig %s not found", err, kubeconfig)
 		}
 
 		// use the current context in kubeconfig
 		config, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
 		if err != nil {
-			log.WithError(err).Panic("getting kubeconf from current context")
-			return nil, err
+			return nil, fmt.Errorf("failed to get config from the current context of %s: %v", kubeconfig, err)
 		}
 	}
 
+	// Zero leaves client-go's defaults
+	config.QPS = float32(syncConfig.KubernetesAPIQPS)
+	config.Burst = syncConfig.KubernetesAPIBurst
+	config.WrapTransport = func(rt http.RoundTripper) http.RoundTripper {
+		return newAPIBackoffTransport(rt, log)
+	}
+
 	// create the clientset
 	clientset, err := kubernetes.NewForConfig(config)
 	if err != nil {
-		log.WithError(err).Error("Getting clientset from config")
-		return nil, err
+		return nil, fmt.Errorf("failed to create clientset: %v", err)
 	}
 
 	return clientset, nil
 }
 
+// kubeconfigPath returns the kubeconfig set by KUBECONFIG, otherwise the one in the home directory, empty
+// if neither is set as when running as a user without a home directory in a distroless image
+func kubeconfigPath() string {
+	if kubeconfig := os.Getenv("KUBECONFIG"); kubeconfig != "" {
+		return kubeconfig
+	}
+	if home := homeDir(); home != "" {
+		return filepath.Join(home, ".kube", "config")
+	}
+	return ""
+}
+
 func homeDir() string {
 	if h := os.Getenv("HOME"); h != "" {
 		return h
@@ -2,19 +2,26 @@ package controller
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
 	"testing"
+	"time"
 
+	"github.com/lawrencegripper/azurefrontdooringress/sync"
 	"github.com/lawrencegripper/azurefrontdooringress/utils"
+	log "github.com/sirupsen/logrus"
 	v1beta1 "k8s.io/api/extensions/v1beta1"
 )
 
 type DummySyncProvider struct{}
 
 // Sync Acquire a lock and update Frontdoor with the ingress information provided
-func (p *DummySyncProvider) Sync(ctx context.Context, ingressToSync []*v1beta1.Ingress) error {
+func (p *DummySyncProvider) Sync(ctx context.Context, ingressToSync []*v1beta1.Ingress, backends []sync.ClusterBackend) (*sync.SyncResult, error) {
 	logger := utils.GetLogger(ctx)
 	logger.Warn("No sync logic currently present, blocked on bug: https://github.com/Azure/azure-rest-api-specs/issues/4221")
-	return nil
+	return &sync.SyncResult{Time: time.Now()}, nil
 }
 
 func TestControllerFindsAnnotatedService(t *testing.T) {
@@ -47,7 +54,19 @@ func TestControllerFindsAnnotatedService(t *testing.T) {
 	for _, test := range testCases {
 		test := test
 		t.Run("Namespace:"+test.name, func(t *testing.T) {
-			ingress, err := Start(context.Background(), test.name, &DummySyncProvider{})
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			ctrl, err := New(ctx, utils.Config{KubernetesNamespace: test.name}, &DummySyncProvider{})
+			if err != nil {
+				t.Fatalf("Failed creating controller: %+v", err)
+			}
+			err = ctrl.WaitForCacheSync(ctx)
+			if err != nil {
+				t.Fatalf("Failed waiting for caches: %+v", err)
+			}
+
+			ingress, err := ctrl.Reconcile(ctx)
 			if err != nil {
 				if test.expectedError {
 					t.Logf("Expected error and got error: %+v", err)
@@ -63,3 +82,81 @@ func TestControllerFindsAnnotatedService(t *testing.T) {
 		})
 	}
 }
+
+// LockedSyncProvider fails every sync to acquire the Frontdoor lock, as when another cluster is stuck holding it
+type LockedSyncProvider struct{}
+
+func (p *LockedSyncProvider) Sync(ctx context.Context, ingressToSync []*v1beta1.Ingress, backends []sync.ClusterBackend) (*sync.SyncResult, error) {
+	return nil, &sync.LockError{Err: errors.New("lease already present")}
+}
+
+func TestControllerAlertsWhenLockUnavailableAcrossReconciles(t *testing.T) {
+	ctx, cancel := context.WithCancel(utils.WithLogger(context.Background(), log.WithField("test", t.Name())))
+	defer cancel()
+
+	alerts := make(chan sync.LockAlert, 1)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		alert := sync.LockAlert{}
+		json.NewDecoder(r.Body).Decode(&alert) //nolint: errcheck
+		alerts <- alert
+	}))
+	defer webhook.Close()
+	// No service is annotated so the cluster's address is discovered from the probe
+	probe := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("52.1.2.3")) //nolint: errcheck
+	}))
+	defer probe.Close()
+
+	config := utils.Config{
+		FrontDoorName:       "frontdoor1",
+		ClusterName:         "cluster1",
+		LockAlertAfter:      50 * time.Millisecond,
+		LockAlertWebhookURL: webhook.URL,
+	}
+	c := &Controller{
+		provider:           sync.WithLockAlerts(&LockedSyncProvider{}, config),
+		changed:            make(chan struct{}, 1),
+		failures:           newFailureTracker(),
+		summary:            newSyncSummary(time.Now()),
+		admin:              newAdminAPI(""),
+		ignoredAnnotations: map[string]string{},
+		invalidAnnotations: map[string]string{},
+		publicIPProbe:      newPublicIPProbe(probe.URL),
+		skipLogs:           newLogSampler(),
+		queue:              newChangeQueue(),
+		routed:             map[string]bool{},
+		endpointWaits:      map[string]string{},
+		unready:            newUnreadyTracker(0),
+		backendHealthy:     map[string]bool{},
+	}
+	done := make(chan error, 1)
+	go func() { done <- c.Run(ctx) }()
+
+	// Reconciles keep failing to acquire the lock until it's been failing for longer than LOCK_ALERT_AFTER
+	reconcile := time.NewTicker(10 * time.Millisecond)
+	defer reconcile.Stop()
+	timeout := time.After(10 * time.Second)
+	for alerted := false; !alerted; {
+		select {
+		case err := <-done:
+			t.Fatalf("Expected failing to acquire the lock not to stop the controller, got %v", err)
+		case alert := <-alerts:
+			if alert.FrontDoor != "frontdoor1" || alert.Error != "lease already present" {
+				t.Errorf("Unexpected alert %+v", alert)
+			}
+			alerted = true
+		case <-reconcile.C:
+			select {
+			case c.admin.syncNow <- struct{}{}:
+			default:
+			}
+		case <-timeout:
+			t.Fatal("Expected an alert once the lock had been unavailable for longer than LOCK_ALERT_AFTER")
+		}
+	}
+
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Errorf("Expected the controller to run until cancelled, got %v", err)
+	}
+}
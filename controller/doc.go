@@ -0,0 +1,14 @@
+// Package controller watches the ingresses and services in a namespace and reconciles the
+// annotated ingresses with a sync.Provider.
+//
+// The controller is built directly on client-go shared informers: informer events signal a
+// reconcile, debounced by SYNC_DEBOUNCE, and a resync runs every resyncPeriod. Each reconcile
+// syncs every annotated ingress in the informer cache, with per-ingress failures rate limited
+// by the failureTracker rather than a workqueue.
+//
+// Moving to sigs.k8s.io/controller-runtime (manager, reconcilers, leader election and envtest)
+// isn't possible with the dependencies pinned in Gopkg.lock: client-go is held at a revision
+// which predates the informer and context APIs controller-runtime requires, and ingresses are
+// read from extensions/v1beta1. Upgrading client-go, k8s.io/api and k8s.io/apimachinery together
+// is a prerequisite, after which Reconcile maps onto a reconcile.Reconciler for the namespace.
+package controller
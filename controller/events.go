@@ -0,0 +1,64 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+	v1 "k8s.io/api/core/v1"
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// eventSource is the component recorded on Events created by the controller
+const eventSource = "azurefrontdooringress"
+
+// recordIngressEvent creates an Event on the ingress so it shows in `kubectl describe`
+func recordIngressEvent(ctx context.Context, client kubernetes.Interface, ingress *v1beta1.Ingress, eventType, reason, message string) {
+	recordEvent(ctx, client, ingress.Namespace, v1.ObjectReference{
+		Kind:            "Ingress",
+		APIVersion:      "extensions/v1beta1",
+		Namespace:       ingress.Namespace,
+		Name:            ingress.Name,
+		UID:             ingress.UID,
+		ResourceVersion: ingress.ResourceVersion,
+	}, eventType, reason, message)
+}
+
+// recordNamespaceEvent creates an Event on the namespace, as namespaces aren't namespaced
+// the Event is created in the default namespace like client-go's event recorder does
+func recordNamespaceEvent(ctx context.Context, client kubernetes.Interface, namespace, eventType, reason, message string) {
+	recordEvent(ctx, client, metav1.NamespaceDefault, v1.ObjectReference{
+		Kind:       "Namespace",
+		APIVersion: "v1",
+		Name:       namespace,
+	}, eventType, reason, message)
+}
+
+func recordEvent(ctx context.Context, client kubernetes.Interface, namespace string, involved v1.ObjectReference, eventType, reason, message string) {
+	log := utils.GetLogger(ctx)
+
+	now := metav1.NewTime(time.Now())
+	event := &v1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			// Follows the naming used by client-go's event recorder
+			Name:      fmt.Sprintf("%v.%x", involved.Name, now.UnixNano()),
+			Namespace: namespace,
+		},
+		InvolvedObject: involved,
+		Reason:         reason,
+		Message:        message,
+		Type:           eventType,
+		Source:         v1.EventSource{Component: eventSource},
+		FirstTimestamp: now,
+		LastTimestamp:  now,
+		Count:          1,
+	}
+
+	_, err := client.CoreV1().Events(namespace).Create(event)
+	if err != nil {
+		log.WithError(err).WithField("kind", involved.Kind).WithField("name", involved.Name).Warn("Failed to record event")
+	}
+}
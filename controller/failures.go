@@ -0,0 +1,67 @@
+package controller
+
+import (
+	"time"
+)
+
+const (
+	// failureBackoffBase is how long a failing ingress waits before its first retry
+	failureBackoffBase = 30 * time.Second
+	// failureBackoffMax caps how long a failing ingress waits between retries
+	failureBackoffMax = 10 * time.Minute
+)
+
+// ingressFailure is the failure history of a single ingress
+type ingressFailure struct {
+	count      int
+	lastError  string
+	retryAfter time.Time
+}
+
+// failureTracker tracks consecutive sync failures per ingress and rate limits
+// retries with an exponential backoff so a broken ingress doesn't hold up the others
+type failureTracker struct {
+	failures map[string]*ingressFailure
+	now      func() time.Time
+}
+
+func newFailureTracker() *failureTracker {
+	return &failureTracker{
+		failures: map[string]*ingressFailure{},
+		now:      time.Now,
+	}
+}
+
+// ready returns false if the ingress has failed and is waiting to be retried
+func (f *failureTracker) ready(key string) bool {
+	failure, exists := f.failures[key]
+	return !exists || !f.now().Before(failure.retryAfter)
+}
+
+// recordFailure increments the failure count for the ingress and schedules its retry
+func (f *failureTracker) recordFailure(key string, err error) *ingressFailure {
+	failure, exists := f.failures[key]
+	if !exists {
+		failure = &ingressFailure{}
+		f.failures[key] = failure
+	}
+
+	failure.count++
+	failure.lastError = err.Error()
+
+	backoff := failureBackoffBase
+	for i := 1; i < failure.count && backoff < failureBackoffMax; i++ {
+		backoff *= 2
+	}
+	if backoff > failureBackoffMax {
+		backoff = failureBackoffMax
+	}
+	failure.retryAfter = f.now().Add(backoff)
+
+	return failure
+}
+
+// recordSuccess clears the failure history of the ingress
+func (f *failureTracker) recordSuccess(key string) {
+	delete(f.failures, key)
+}
@@ -0,0 +1,44 @@
+package controller
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestFailureTrackerBacksOff(t *testing.T) {
+	now := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	tracker := newFailureTracker()
+	tracker.now = func() time.Time { return now }
+
+	key := "default/broken"
+	if !tracker.ready(key) {
+		t.Fatal("Expected ingress without failures to be ready")
+	}
+
+	expectedBackoffs := []time.Duration{30 * time.Second, time.Minute, 2 * time.Minute}
+	for i, expected := range expectedBackoffs {
+		failure := tracker.recordFailure(key, fmt.Errorf("failure %d", i))
+		if failure.count != i+1 {
+			t.Errorf("Expected count %d, got %d", i+1, failure.count)
+		}
+		if backoff := failure.retryAfter.Sub(now); backoff != expected {
+			t.Errorf("Expected backoff %v, got %v", expected, backoff)
+		}
+	}
+
+	for i := 0; i < 10; i++ {
+		tracker.recordFailure(key, fmt.Errorf("failure"))
+	}
+	if backoff := tracker.failures[key].retryAfter.Sub(now); backoff != failureBackoffMax {
+		t.Errorf("Expected backoff to be capped at %v, got %v", failureBackoffMax, backoff)
+	}
+
+	if tracker.ready(key) {
+		t.Error("Expected failing ingress not to be ready")
+	}
+	tracker.recordSuccess(key)
+	if !tracker.ready(key) {
+		t.Error("Expected ingress to be ready after success")
+	}
+}
@@ -0,0 +1,95 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+// fixtureExtensions are the manifest files read from a fixtures directory
+var fixtureExtensions = map[string]bool{".yaml": true, ".yml": true, ".json": true}
+
+// LoadIngressFixtures reads the annotated ingresses from the YAML or JSON manifests in the directory,
+// as ListAnnotatedIngresses would list them from the cluster, so their routing can be planned before
+// they're applied. Manifests can hold several documents, other kinds of object are skipped and an
+// ingress without a namespace is put in the default namespace.
+func LoadIngressFixtures(ctx context.Context, config utils.Config, dir string) ([]*v1beta1.Ingress, error) {
+	logger := utils.GetLogger(ctx)
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixtures directory: %v", err)
+	}
+
+	watched := map[string]bool{}
+	for _, namespace := range config.Namespaces() {
+		watched[namespace] = true
+	}
+	ingresses := []*v1beta1.Ingress{}
+	for _, file := range files {
+		if file.IsDir() || !fixtureExtensions[strings.ToLower(filepath.Ext(file.Name()))] {
+			continue
+		}
+		path := filepath.Join(dir, file.Name())
+		loaded, err := loadIngressManifest(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load %s: %v", path, err)
+		}
+		for _, ingress := range loaded {
+			if ingress.Namespace == "" {
+				ingress.Namespace = metav1.NamespaceDefault
+			}
+			ingressLogger := logger.WithField("file", path).WithField("ingress", ingressKey(ingress))
+			switch {
+			case !watched[""] && !watched[ingress.Namespace]:
+				ingressLogger.Warn("Skipping ingress fixture in a namespace the controller doesn't watch")
+			case !hasFrontdoorEnabledAnnotation(ingress.Annotations):
+				ingressLogger.Debug("Skipping ingress fixture without the Frontdoor annotation")
+			default:
+				ingresses = append(ingresses, ingress)
+			}
+		}
+	}
+	return ingresses, nil
+}
+
+// loadIngressManifest returns the ingresses in each document of the manifest
+func loadIngressManifest(path string) ([]*v1beta1.Ingress, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close() //nolint: errcheck
+
+	ingresses := []*v1beta1.Ingress{}
+	decoder := yaml.NewYAMLOrJSONDecoder(file, 4096)
+	for {
+		// The kind is checked first as other objects' fields may not fit an ingress
+		var document json.RawMessage
+		err := decoder.Decode(&document)
+		if err == io.EOF {
+			return ingresses, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		typeMeta := metav1.TypeMeta{}
+		if len(document) == 0 || json.Unmarshal(document, &typeMeta) != nil || typeMeta.Kind != "Ingress" {
+			continue
+		}
+		ingress := &v1beta1.Ingress{}
+		if err := json.Unmarshal(document, ingress); err != nil {
+			return nil, err
+		}
+		ingresses = append(ingresses, ingress)
+	}
+}
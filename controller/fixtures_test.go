@@ -0,0 +1,80 @@
+package controller
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+func TestLoadIngressFixtures(t *testing.T) {
+	ctx := utils.WithLogger(context.Background(), log.WithField("test", t.Name()))
+	dir, err := ioutil.TempDir("", "fixtures")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir) //nolint: errcheck
+
+	files := map[string]string{
+		"app.yaml": `apiVersion: apps/v1
+kind: Deployment
+metadata:
+  name: app
+spec:
+  replicas: 2
+---
+apiVersion: extensions/v1beta1
+kind: Ingress
+metadata:
+  name: app
+  annotations:
+    azure/frontdoor: enabled
+spec:
+  rules:
+  - host: app.contoso.com
+    http:
+      paths:
+      - path: /
+        backend:
+          serviceName: app
+          servicePort: 80
+---
+`,
+		"other.json": `{"apiVersion": "extensions/v1beta1", "kind": "Ingress",
+			"metadata": {"name": "other", "namespace": "web", "annotations": {"azure/frontdoor": "enabled"}}}`,
+		"unannotated.yml": "kind: Ingress\nmetadata:\n  name: internal\n",
+		"README.md":       "kind: Ingress\n",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ingresses, err := LoadIngressFixtures(ctx, utils.Config{}, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ingresses) != 2 || ingressKey(ingresses[0]) != "default/app" || ingressKey(ingresses[1]) != "web/other" {
+		t.Fatalf("Expected the annotated ingresses to be loaded got %v", ingresses)
+	}
+	if paths := ingresses[0].Spec.Rules[0].HTTP.Paths; len(paths) != 1 || paths[0].Backend.ServiceName != "app" {
+		t.Errorf("Expected the ingress's spec to be loaded got %v", ingresses[0].Spec)
+	}
+
+	ingresses, err = LoadIngressFixtures(ctx, utils.Config{KubernetesNamespace: "web"}, dir)
+	if err != nil || len(ingresses) != 1 || ingressKey(ingresses[0]) != "web/other" {
+		t.Errorf("Expected only the ingress in the watched namespace got %v, %v", ingresses, err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(dir, "broken.yaml"), []byte("kind: [Ingress"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadIngressFixtures(ctx, utils.Config{}, dir); err == nil {
+		t.Error("Expected an invalid manifest to fail")
+	}
+}
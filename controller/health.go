@@ -0,0 +1,40 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	gosync "sync"
+)
+
+// Health is whether the controller can sync, served on /healthz so probes can tell a controller which
+// is still starting, or can't reach the API server, from one which is working
+type Health struct {
+	mutex gosync.Mutex
+	err   error
+}
+
+// NewHealth returns a Health which is unhealthy until the controller has started
+func NewHealth() *Health {
+	return &Health{err: errors.New("controller is starting")}
+}
+
+// Set records the error stopping the controller syncing, nil once it's healthy
+func (h *Health) Set(err error) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.err = err
+}
+
+// ServeHTTP responds 200 when healthy, otherwise 503 with the error
+func (h *Health) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mutex.Lock()
+	err := h.err
+	h.mutex.Unlock()
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if err != nil {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte(err.Error() + "\n")) //nolint: errcheck
+		return
+	}
+	w.Write([]byte("ok\n")) //nolint: errcheck
+}
@@ -0,0 +1,30 @@
+package controller
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHealth(t *testing.T) {
+	health := NewHealth()
+	check := func() (int, string) {
+		recorder := httptest.NewRecorder()
+		health.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+		return recorder.Code, recorder.Body.String()
+	}
+
+	if code, _ := check(); code != http.StatusServiceUnavailable {
+		t.Errorf("Expected 503 while starting got %d", code)
+	}
+	health.Set(nil)
+	if code, _ := check(); code != http.StatusOK {
+		t.Errorf("Expected 200 once started got %d", code)
+	}
+	health.Set(errors.New("kubeconfig not found"))
+	if code, body := check(); code != http.StatusServiceUnavailable || !strings.Contains(body, "kubeconfig not found") {
+		t.Errorf("Expected 503 with the error got %d %q", code, body)
+	}
+}
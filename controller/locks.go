@@ -0,0 +1,41 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+)
+
+// lockGCPeriod is how often locks unused for longer than the configured period are deleted
+const lockGCPeriod = time.Hour
+
+// collectStaleLocks deletes locks which haven't been used for lockGCAfter every lockGCPeriod until the
+// context is cancelled. Every cluster sharing the storage account may run it unless an authoritative
+// cluster is configured, a lock taken while it's being deleted is left alone.
+func (c *Controller) collectStaleLocks(ctx context.Context) {
+	if c.lockGCAfter <= 0 {
+		return
+	}
+	log := utils.GetLogger(ctx)
+	if !c.authoritative {
+		log.Info("Stale locks are only cleaned up by the authoritative cluster")
+		return
+	}
+
+	ticker := time.NewTicker(lockGCPeriod)
+	defer ticker.Stop()
+	for {
+		deleted, err := c.cleanLocks(ctx, c.lockGCAfter)
+		if err != nil {
+			log.WithError(err).Warn("Failed to clean up stale locks, will retry")
+		} else if len(deleted) > 0 {
+			log.WithField("locks", deleted).Info("Deleted stale locks")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package controller
+
+// logSampler suppresses a repetitive message about an object, such as an ingress being skipped
+// on every reconcile, so it's only logged again once the object changes. Objects not seen in a
+// reconcile are forgotten so the message is logged if they reappear.
+type logSampler struct {
+	// logged holds the resource version each message was last logged for, keyed by message and object
+	logged map[string]string
+	seen   map[string]string
+}
+
+func newLogSampler() *logSampler {
+	return &logSampler{logged: map[string]string{}, seen: map[string]string{}}
+}
+
+// shouldLog returns true if the message hasn't been logged for this version of the object
+func (s *logSampler) shouldLog(message, key, resourceVersion string) bool {
+	id := message + "\x00" + key
+	s.seen[id] = resourceVersion
+	last, logged := s.logged[id]
+	return !logged || last != resourceVersion
+}
+
+// endReconcile forgets objects which weren't seen since the previous reconcile
+func (s *logSampler) endReconcile() {
+	s.logged = s.seen
+	s.seen = map[string]string{}
+}
@@ -0,0 +1,30 @@
+package controller
+
+import "testing"
+
+func TestLogSamplerLogsOncePerChange(t *testing.T) {
+	sampler := newLogSampler()
+	const message = "Skipping ingress as isn't annotated"
+
+	if !sampler.shouldLog(message, "default/app", "1") {
+		t.Error("Expected the first message to be logged")
+	}
+	sampler.endReconcile()
+	if sampler.shouldLog(message, "default/app", "1") {
+		t.Error("Expected the repeated message to be suppressed")
+	}
+	if !sampler.shouldLog("Skipping ingress as waiting to retry after previous failures", "default/app", "1") {
+		t.Error("Expected a different message for the ingress to be logged")
+	}
+	sampler.endReconcile()
+	if !sampler.shouldLog(message, "default/app", "2") {
+		t.Error("Expected the message to be logged once the ingress changes")
+	}
+
+	// An ingress missing from a reconcile is forgotten
+	sampler.endReconcile()
+	sampler.endReconcile()
+	if !sampler.shouldLog(message, "default/app", "2") {
+		t.Error("Expected the message to be logged for an ingress which reappeared")
+	}
+}
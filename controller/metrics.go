@@ -0,0 +1,35 @@
+package controller
+
+import (
+	"github.com/lawrencegripper/azurefrontdooringress/metrics"
+)
+
+var (
+	lastSuccessfulSync = metrics.NewGauge(
+		"frontdoor_last_successful_sync_timestamp_seconds",
+		"Unix timestamp of the last successful sync to Frontdoor")
+	namespaceAccessDenied = metrics.NewGauge(
+		"frontdoor_namespace_access_denied",
+		"1 if the namespace is skipped as the controller isn't allowed to list and watch its ingresses and services",
+		"namespace")
+	backendHealthPercentage = metrics.NewGauge(
+		"frontdoor_backend_health_percentage",
+		"Percentage of Frontdoor's health probes to the cluster's backend pool which succeeded, as reported by Azure Monitor",
+		"backend_pool")
+	apiServerErrors = metrics.NewCounter(
+		"frontdoor_kubernetes_api_errors_total",
+		"Requests to the Kubernetes API server which failed to connect, or were throttled or failed by it",
+		"code")
+	syncQueueDepth = metrics.NewGaugeFunc(
+		"frontdoor_sync_queue_depth",
+		"Ingresses and services changed since they were last synced to Frontdoor",
+		func() float64 { return 0 })
+	syncQueueOldestChangeAge = metrics.NewGaugeFunc(
+		"frontdoor_sync_queue_oldest_change_age_seconds",
+		"Seconds since the oldest change waiting to be synced to Frontdoor was made, 0 if none are waiting",
+		func() float64 { return 0 })
+	changePropagation = metrics.NewHistogram(
+		"frontdoor_change_propagation_seconds",
+		"Seconds from an ingress or service changing to the sync including it completing",
+		5, 15, 30, 60, 120, 300, 600, 1800)
+)
@@ -0,0 +1,139 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+	authorizationv1 "k8s.io/api/authorization/v1"
+	v1 "k8s.io/api/core/v1"
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	authorizationclient "k8s.io/client-go/kubernetes/typed/authorization/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// namespaceInformers are the informers for one of the namespaces watched, "" for every namespace
+type namespaceInformers struct {
+	namespace string
+	factory   informers.SharedInformerFactory
+	ingresses cache.SharedIndexInformer
+	services  cache.SharedIndexInformer
+	// endpoints is only watched when routes to unready services are disabled, otherwise it's nil
+	endpoints cache.SharedIndexInformer
+}
+
+// requiredAccess is what the informers need for the controller to sync a namespace
+var requiredAccess = []authorizationv1.ResourceAttributes{
+	{Verb: "list", Group: "extensions", Resource: "ingresses"},
+	{Verb: "watch", Group: "extensions", Resource: "ingresses"},
+	{Verb: "list", Resource: "services"},
+	{Verb: "watch", Resource: "services"},
+}
+
+// endpointsAccess is also needed when routes to unready services are disabled
+var endpointsAccess = []authorizationv1.ResourceAttributes{
+	{Verb: "list", Resource: "endpoints"},
+	{Verb: "watch", Resource: "endpoints"},
+}
+
+// checkNamespaceAccess asks the API server whether the controller has the access required in the
+// namespace, returning what it can't do as 'verb resource'. If the check itself fails access is
+// assumed so the informers report the real error.
+func checkNamespaceAccess(ctx context.Context, reviews authorizationclient.SelfSubjectAccessReviewInterface, namespace string, required []authorizationv1.ResourceAttributes) []string {
+	log := utils.GetLogger(ctx).WithField("namespace", namespace)
+
+	denied := []string{}
+	for _, attributes := range required {
+		attributes := attributes
+		attributes.Namespace = namespace
+		review, err := reviews.Create(&authorizationv1.SelfSubjectAccessReview{
+			Spec: authorizationv1.SelfSubjectAccessReviewSpec{ResourceAttributes: &attributes},
+		})
+		if err != nil {
+			log.WithError(err).Warn("Failed to check access to namespace, assuming it's allowed")
+			continue
+		}
+		if !review.Status.Allowed {
+			denied = append(denied, fmt.Sprintf("%s %s", attributes.Verb, attributes.Resource))
+		}
+	}
+	return denied
+}
+
+// addNamespace checks the controller has access to the namespace and creates its informers,
+// a namespace without access is skipped with a warning Event so the others are still synced
+func (c *Controller) addNamespace(ctx context.Context, namespace string) {
+	required := requiredAccess
+	if c.unready.disableAfter > 0 {
+		required = append(append([]authorizationv1.ResourceAttributes{}, requiredAccess...), endpointsAccess...)
+	}
+	denied := checkNamespaceAccess(ctx, c.client.AuthorizationV1().SelfSubjectAccessReviews(), namespace, required)
+	if len(denied) > 0 {
+		namespaceAccessDenied.Set(1, namespace)
+		utils.GetLogger(ctx).
+			WithField("namespace", namespace).
+			WithField("denied", denied).
+			Warn("Skipping namespace as the controller isn't allowed to watch it")
+		if namespace != "" {
+			recordNamespaceEvent(ctx, c.client, namespace, v1.EventTypeWarning, "NamespaceSkipped",
+				fmt.Sprintf("Ingresses in the namespace aren't synced to Frontdoor as the controller's ServiceAccount can't %s", strings.Join(denied, ", ")))
+		}
+		return
+	}
+	namespaceAccessDenied.Set(0, namespace)
+
+	factory := informers.NewSharedInformerFactoryWithOptions(c.client, resyncPeriod,
+		informers.WithNamespace(namespace),
+		informers.WithTweakListOptions(func(*metav1.ListOptions) {}))
+	ns := &namespaceInformers{
+		namespace: namespace,
+		factory:   factory,
+		ingresses: factory.Extensions().V1beta1().Ingresses().Informer(),
+		services:  addServiceInformer(factory, namespace),
+	}
+	if c.unready.disableAfter > 0 {
+		c.addEndpointsInformer(ns)
+	}
+
+	ns.ingresses.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { c.objectChanged("ingress", obj) },
+		DeleteFunc: func(obj interface{}) { c.objectChanged("ingress", obj) },
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			if ingressChanged(oldObj.(*v1beta1.Ingress), newObj.(*v1beta1.Ingress)) {
+				c.objectChanged("ingress", newObj)
+			}
+		},
+	})
+	ns.services.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(obj interface{}) { c.objectChanged("service", obj) },
+		DeleteFunc: func(obj interface{}) { c.objectChanged("service", obj) },
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			if serviceChanged(oldObj.(*v1.Service), newObj.(*v1.Service)) {
+				c.objectChanged("service", newObj)
+			}
+		},
+	})
+
+	c.namespaces = append(c.namespaces, ns)
+}
+
+// listIngresses returns the ingresses cached for every namespace watched
+func (c *Controller) listIngresses() []interface{} {
+	ingresses := []interface{}{}
+	for _, ns := range c.namespaces {
+		ingresses = append(ingresses, ns.ingresses.GetStore().List()...)
+	}
+	return ingresses
+}
+
+// listServices returns the services cached for every namespace watched
+func (c *Controller) listServices() []interface{} {
+	services := []interface{}{}
+	for _, ns := range c.namespaces {
+		services = append(services, ns.services.GetStore().List()...)
+	}
+	return services
+}
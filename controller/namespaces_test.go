@@ -0,0 +1,50 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+	log "github.com/sirupsen/logrus"
+	authorizationv1 "k8s.io/api/authorization/v1"
+)
+
+// fakeAccessReviews allows everything except the resources listed as denied for each namespace
+type fakeAccessReviews struct {
+	denied map[string][]string
+	err    error
+}
+
+func (f *fakeAccessReviews) Create(review *authorizationv1.SelfSubjectAccessReview) (*authorizationv1.SelfSubjectAccessReview, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	attributes := review.Spec.ResourceAttributes
+	review.Status.Allowed = true
+	for _, resource := range f.denied[attributes.Namespace] {
+		if resource == attributes.Resource {
+			review.Status.Allowed = false
+		}
+	}
+	return review, nil
+}
+
+func TestCheckNamespaceAccess(t *testing.T) {
+	ctx := utils.WithLogger(context.Background(), log.WithField("test", t.Name()))
+	reviews := &fakeAccessReviews{denied: map[string][]string{"restricted": {"services"}}}
+
+	if denied := checkNamespaceAccess(ctx, reviews, "default", requiredAccess); len(denied) != 0 {
+		t.Errorf("Expected full access to default, got %v denied", denied)
+	}
+	denied := checkNamespaceAccess(ctx, reviews, "restricted", requiredAccess)
+	if !reflect.DeepEqual(denied, []string{"list services", "watch services"}) {
+		t.Errorf("Expected services to be denied in restricted, got %v", denied)
+	}
+
+	reviews.err = errors.New("unavailable")
+	if denied := checkNamespaceAccess(ctx, reviews, "restricted", requiredAccess); len(denied) != 0 {
+		t.Errorf("Expected access to be assumed when it can't be checked, got %v denied", denied)
+	}
+}
@@ -0,0 +1,36 @@
+package controller
+
+import (
+	"context"
+
+	"github.com/lawrencegripper/azurefrontdooringress/sync"
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+)
+
+// logProviderReports logs the outcome for each provider when syncing to several,
+// so a provider failing is visible even though the others were synced
+func logProviderReports(ctx context.Context, reports []sync.ProviderReport) {
+	log := utils.GetLogger(ctx)
+
+	for _, report := range reports {
+		entry := log.
+			WithField("provider", report.Provider).
+			WithField("rulesCreated", report.RulesCreated).
+			WithField("rulesUpdated", report.RulesUpdated).
+			WithField("failedIngresses", report.Failed)
+		if !report.Healthy {
+			entry.WithField("error", report.Error).Warn("Failed to sync provider, other providers were still synced")
+			continue
+		}
+		entry.Debug("Synced provider")
+	}
+}
+
+// providerCause returns the error a provider returned for an ingress when syncing to
+// several providers, errors from a single provider are returned unchanged
+func providerCause(err error) error {
+	if providerErr, ok := err.(*sync.ProviderError); ok {
+		return providerErr.Err
+	}
+	return err
+}
@@ -0,0 +1,84 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+)
+
+const (
+	// publicIPProbeTimeout limits how long the public IP probe can take
+	publicIPProbeTimeout = 10 * time.Second
+	// publicIPRefreshPeriod is how long a discovered public IP is used before the probe is asked again
+	publicIPRefreshPeriod = 10 * time.Minute
+)
+
+// publicIPProbe discovers the cluster's public IP from a URL which responds with the caller's
+// address, used when no service is annotated
+type publicIPProbe struct {
+	url          string
+	client       *http.Client
+	discovered   string
+	discoveredAt time.Time
+}
+
+func newPublicIPProbe(url string) *publicIPProbe {
+	if url == "" {
+		return nil
+	}
+	return &publicIPProbe{url: url, client: &http.Client{Timeout: publicIPProbeTimeout}}
+}
+
+// publicIP returns the IP last discovered, asking the probe again once it's older than the refresh period.
+// If the probe fails the previous IP is kept as the cluster's address rarely changes.
+func (p *publicIPProbe) publicIP(ctx context.Context, now time.Time) (string, error) {
+	if p.discovered != "" && now.Sub(p.discoveredAt) < publicIPRefreshPeriod {
+		return p.discovered, nil
+	}
+	ip, err := p.probe(ctx)
+	if err != nil {
+		if p.discovered != "" {
+			utils.GetLogger(ctx).WithError(err).Warn("Failed to refresh public IP from probe, using the IP previously discovered")
+			return p.discovered, nil
+		}
+		return "", err
+	}
+	if ip != p.discovered {
+		utils.GetLogger(ctx).WithField("ip", ip).Info("Discovered cluster's public IP from probe as no service is annotated")
+	}
+	p.discovered = ip
+	p.discoveredAt = now
+	return ip, nil
+}
+
+// probe requests the probe URL and parses the IP address in the response body
+func (p *publicIPProbe) probe(ctx context.Context) (string, error) {
+	req, err := http.NewRequest(http.MethodGet, p.url, nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := p.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return "", fmt.Errorf("public IP probe failed: %v", err)
+	}
+	defer resp.Body.Close() //nolint: errcheck
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("public IP probe returned %s", resp.Status)
+	}
+	// An address is at most 45 characters so anything much longer isn't one
+	body, err := ioutil.ReadAll(http.MaxBytesReader(nil, resp.Body, 256))
+	if err != nil {
+		return "", fmt.Errorf("failed to read public IP probe response: %v", err)
+	}
+	value := strings.TrimSpace(string(body))
+	if net.ParseIP(value) == nil {
+		return "", fmt.Errorf("public IP probe returned %q which isn't an IP address", value)
+	}
+	return value, nil
+}
@@ -0,0 +1,57 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+func TestPublicIPProbe(t *testing.T) {
+	ctx := utils.WithLogger(context.Background(), log.WithField("test", t.Name()))
+	response := "52.1.2.3\n"
+	status := http.StatusOK
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(status)
+		w.Write([]byte(response)) //nolint: errcheck
+	}))
+	defer server.Close()
+	probe := newPublicIPProbe(server.URL)
+	now := time.Now()
+
+	ip, err := probe.publicIP(ctx, now)
+	if err != nil || ip != "52.1.2.3" {
+		t.Fatalf("Expected the probed IP, got %q error %v", ip, err)
+	}
+
+	// The IP is reused until the refresh period has passed
+	response = "52.4.5.6"
+	if ip, _ := probe.publicIP(ctx, now.Add(time.Minute)); ip != "52.1.2.3" || requests != 1 {
+		t.Errorf("Expected the discovered IP to be reused, got %q after %d requests", ip, requests)
+	}
+	if ip, _ := probe.publicIP(ctx, now.Add(publicIPRefreshPeriod)); ip != "52.4.5.6" {
+		t.Errorf("Expected the IP to be refreshed, got %q", ip)
+	}
+
+	// A failed refresh keeps the previous IP
+	status = http.StatusServiceUnavailable
+	if ip, err := probe.publicIP(ctx, now.Add(2*publicIPRefreshPeriod)); err != nil || ip != "52.4.5.6" {
+		t.Errorf("Expected the previous IP when the refresh fails, got %q error %v", ip, err)
+	}
+
+	status = http.StatusOK
+	response = "<html>not an address</html>"
+	if _, err := newPublicIPProbe(server.URL).publicIP(ctx, now); err == nil {
+		t.Error("Expected an error when the response isn't an IP address")
+	}
+
+	if newPublicIPProbe("") != nil {
+		t.Error("Expected no probe when the URL isn't set")
+	}
+}
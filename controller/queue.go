@@ -0,0 +1,102 @@
+package controller
+
+import (
+	"strings"
+	gosync "sync"
+	"time"
+
+	"k8s.io/client-go/tools/cache"
+)
+
+// ingressChangePrefix starts the queue key of a changed ingress, followed by its 'namespace/name'
+const ingressChangePrefix = "ingress/"
+
+// changeQueue tracks the ingresses and services changed since they were last synced so the sync queue,
+// and how long changes take to reach Frontdoor, can be measured. It's written by the informers' event
+// handlers while reconciles read it.
+type changeQueue struct {
+	mutex gosync.Mutex
+	// changes holds when each object first changed since it was last synced
+	changes map[string]time.Time
+	now     func() time.Time
+}
+
+func newChangeQueue() *changeQueue {
+	return &changeQueue{
+		changes: map[string]time.Time{},
+		now:     time.Now,
+	}
+}
+
+// add records the object, of the kind 'ingress' or 'service', as changed, keeping the time of
+// its earliest change which hasn't been synced
+func (q *changeQueue) add(kind string, obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		return
+	}
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.addLocked(kind+"/"+key, q.now())
+}
+
+// take empties the queue returning the changes in it, which are included in the reconcile starting
+func (q *changeQueue) take() map[string]time.Time {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	changes := q.changes
+	q.changes = map[string]time.Time{}
+	return changes
+}
+
+// synced records how long each of the changes took to be synced, except for the ingresses which failed
+// to sync, keyed by 'namespace/name', which are queued again with the time they first changed
+func (q *changeQueue) synced(changes map[string]time.Time, failed map[string]error) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	now := q.now()
+	for key, changed := range changes {
+		if _, failed := failed[strings.TrimPrefix(key, ingressChangePrefix)]; failed && strings.HasPrefix(key, ingressChangePrefix) {
+			q.addLocked(key, changed)
+			continue
+		}
+		changePropagation.Observe(now.Sub(changed).Seconds())
+	}
+}
+
+// requeue adds back the changes taken for a reconcile which failed
+func (q *changeQueue) requeue(changes map[string]time.Time) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	for key, changed := range changes {
+		q.addLocked(key, changed)
+	}
+}
+
+// addLocked queues the change unless the object has an earlier change queued, the mutex must be held
+func (q *changeQueue) addLocked(key string, changed time.Time) {
+	if queued, exists := q.changes[key]; !exists || changed.Before(queued) {
+		q.changes[key] = changed
+	}
+}
+
+// depth returns how many objects have changed and are waiting to be synced
+func (q *changeQueue) depth() int {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	return len(q.changes)
+}
+
+// oldestAge returns how long ago the oldest change waiting to be synced was made, zero if none are waiting
+func (q *changeQueue) oldestAge() time.Duration {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	var age time.Duration
+	now := q.now()
+	for _, changed := range q.changes {
+		if now.Sub(changed) > age {
+			age = now.Sub(changed)
+		}
+	}
+	return age
+}
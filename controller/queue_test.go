@@ -0,0 +1,43 @@
+package controller
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestChangeQueueKeepsEarliestChange(t *testing.T) {
+	now := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	queue := newChangeQueue()
+	queue.now = func() time.Time { return now }
+
+	ingress := &v1beta1.Ingress{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "app"}}
+	service := &v1.Service{ObjectMeta: metav1.ObjectMeta{Namespace: "ingress", Name: "nginx"}}
+	queue.add("ingress", ingress)
+	now = now.Add(time.Minute)
+	queue.add("ingress", ingress)
+	queue.add("service", service)
+
+	if depth := queue.depth(); depth != 2 {
+		t.Errorf("Expected 2 changes queued got %d", depth)
+	}
+	if age := queue.oldestAge(); age != time.Minute {
+		t.Errorf("Expected the oldest change to be 1m old got %v", age)
+	}
+
+	changes := queue.take()
+	if queue.depth() != 0 || queue.oldestAge() != 0 {
+		t.Error("Expected the queue to be empty once taken")
+	}
+	queue.synced(changes, map[string]error{"default/app": errors.New("failed")})
+	if _, requeued := queue.changes["ingress/default/app"]; !requeued || queue.depth() != 1 {
+		t.Errorf("Expected only the failed ingress to be queued again got %v", queue.changes)
+	}
+	if age := queue.oldestAge(); age != time.Minute {
+		t.Errorf("Expected the failed ingress to keep the time it first changed got age %v", age)
+	}
+}
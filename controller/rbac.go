@@ -0,0 +1,135 @@
+package controller
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+	rbacv1 "k8s.io/api/rbac/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// rbacName names the roles and bindings created for the controller's ServiceAccount
+const rbacName = "azurefrontdoor-ingress"
+
+// watchedNamespaceRules returns the access the controller needs in each namespace it watches with the
+// features enabled in the config, matching requiredAccess and the calls each feature makes
+func watchedNamespaceRules(config utils.Config) []rbacv1.PolicyRule {
+	ingressVerbs := []string{"list", "watch"}
+	if config.WriteIngressStatus {
+		// The sync annotations are written with a merge patch
+		ingressVerbs = append(ingressVerbs, "patch")
+	}
+	serviceVerbs := []string{"list", "watch"}
+	if config.ServiceTagsLoadBalancerSourceRanges {
+		serviceVerbs = append(serviceVerbs, "patch")
+	}
+	endpointVerbs := []string{}
+	if config.WaitForReadyEndpoints {
+		endpointVerbs = append(endpointVerbs, "get")
+	}
+	if config.DisableUnreadyRoutesAfter > 0 {
+		endpointVerbs = append(endpointVerbs, "list", "watch")
+	}
+
+	rules := []rbacv1.PolicyRule{
+		{APIGroups: []string{"extensions"}, Resources: []string{"ingresses"}, Verbs: ingressVerbs},
+		{APIGroups: []string{""}, Resources: []string{"services"}, Verbs: serviceVerbs},
+		// Events are recorded on ingresses, and on namespaces which can't be watched
+		{APIGroups: []string{""}, Resources: []string{"events"}, Verbs: []string{"create"}},
+	}
+	if len(endpointVerbs) > 0 {
+		rules = append(rules, rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"endpoints"}, Verbs: endpointVerbs})
+	}
+	return rules
+}
+
+// configMapRules returns the access the controller needs to the ConfigMaps it writes, keyed by their namespace
+func configMapRules(config utils.Config) map[string][]rbacv1.PolicyRule {
+	rules := map[string][]rbacv1.PolicyRule{}
+	if config.AccessRestrictionConfigMap != "" {
+		namespace, name := splitConfigMapName(config.AccessRestrictionConfigMap)
+		rules[namespace] = append(rules[namespace], rbacv1.PolicyRule{
+			APIGroups: []string{""}, Resources: []string{"configmaps"}, ResourceNames: []string{name}, Verbs: []string{"get", "update"},
+		})
+	}
+	if config.ServiceTagsConfigMap != "" {
+		namespace, name := splitConfigMapName(config.ServiceTagsConfigMap)
+		rules[namespace] = append(rules[namespace],
+			rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"configmaps"}, ResourceNames: []string{name}, Verbs: []string{"get", "update"}},
+			// Creating can't be limited to a name
+			rbacv1.PolicyRule{APIGroups: []string{""}, Resources: []string{"configmaps"}, Verbs: []string{"create"}},
+		)
+	}
+	return rules
+}
+
+func splitConfigMapName(namespacedName string) (string, string) {
+	parts := strings.SplitN(namespacedName, "/", 2)
+	if len(parts) != 2 {
+		return "default", namespacedName
+	}
+	return parts[0], parts[1]
+}
+
+// RBACManifests returns the least privileged roles, and their bindings to the ServiceAccount, the controller
+// needs with the features enabled in the config. The watched namespaces get a Role each when
+// KUBERNETES_NAMESPACE is set, otherwise a ClusterRole. Checking access to a namespace always needs a
+// ClusterRole as access reviews aren't namespaced.
+func RBACManifests(config utils.Config, serviceAccountNamespace, serviceAccount string) []runtime.Object {
+	subjects := []rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Namespace: serviceAccountNamespace, Name: serviceAccount}}
+	clusterRules := []rbacv1.PolicyRule{
+		{APIGroups: []string{"authorization.k8s.io"}, Resources: []string{"selfsubjectaccessreviews"}, Verbs: []string{"create"}},
+	}
+
+	roles := map[string][]rbacv1.PolicyRule{}
+	namespaces := config.Namespaces()
+	if len(namespaces) == 1 && namespaces[0] == "" {
+		clusterRules = append(clusterRules, watchedNamespaceRules(config)...)
+	} else {
+		for _, namespace := range namespaces {
+			roles[namespace] = append(roles[namespace], watchedNamespaceRules(config)...)
+		}
+	}
+	for namespace, rules := range configMapRules(config) {
+		roles[namespace] = append(roles[namespace], rules...)
+	}
+
+	objects := []runtime.Object{
+		&rbacv1.ClusterRole{
+			TypeMeta:   metav1.TypeMeta{APIVersion: rbacv1.SchemeGroupVersion.String(), Kind: "ClusterRole"},
+			ObjectMeta: metav1.ObjectMeta{Name: rbacName},
+			Rules:      clusterRules,
+		},
+		&rbacv1.ClusterRoleBinding{
+			TypeMeta:   metav1.TypeMeta{APIVersion: rbacv1.SchemeGroupVersion.String(), Kind: "ClusterRoleBinding"},
+			ObjectMeta: metav1.ObjectMeta{Name: rbacName},
+			RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "ClusterRole", Name: rbacName},
+			Subjects:   subjects,
+		},
+	}
+
+	// Sorted so the manifests are the same each time they're generated
+	roleNamespaces := make([]string, 0, len(roles))
+	for namespace := range roles {
+		roleNamespaces = append(roleNamespaces, namespace)
+	}
+	sort.Strings(roleNamespaces)
+	for _, namespace := range roleNamespaces {
+		objects = append(objects,
+			&rbacv1.Role{
+				TypeMeta:   metav1.TypeMeta{APIVersion: rbacv1.SchemeGroupVersion.String(), Kind: "Role"},
+				ObjectMeta: metav1.ObjectMeta{Name: rbacName, Namespace: namespace},
+				Rules:      roles[namespace],
+			},
+			&rbacv1.RoleBinding{
+				TypeMeta:   metav1.TypeMeta{APIVersion: rbacv1.SchemeGroupVersion.String(), Kind: "RoleBinding"},
+				ObjectMeta: metav1.ObjectMeta{Name: rbacName, Namespace: namespace},
+				RoleRef:    rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "Role", Name: rbacName},
+				Subjects:   subjects,
+			},
+		)
+	}
+	return objects
+}
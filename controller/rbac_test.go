@@ -0,0 +1,54 @@
+package controller
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+	rbacv1 "k8s.io/api/rbac/v1"
+)
+
+func TestRBACManifests(t *testing.T) {
+	objects := RBACManifests(utils.Config{}, "ingress", "controller")
+	if len(objects) != 2 {
+		t.Fatalf("Expected a ClusterRole and its binding when watching every namespace, got %d objects", len(objects))
+	}
+	clusterRole := objects[0].(*rbacv1.ClusterRole)
+	expected := []rbacv1.PolicyRule{
+		{APIGroups: []string{"authorization.k8s.io"}, Resources: []string{"selfsubjectaccessreviews"}, Verbs: []string{"create"}},
+		{APIGroups: []string{"extensions"}, Resources: []string{"ingresses"}, Verbs: []string{"list", "watch"}},
+		{APIGroups: []string{""}, Resources: []string{"services"}, Verbs: []string{"list", "watch"}},
+		{APIGroups: []string{""}, Resources: []string{"events"}, Verbs: []string{"create"}},
+	}
+	if !reflect.DeepEqual(clusterRole.Rules, expected) {
+		t.Errorf("Expected only read access and Events without optional features, got %+v", clusterRole.Rules)
+	}
+	binding := objects[1].(*rbacv1.ClusterRoleBinding)
+	if binding.Subjects[0].Namespace != "ingress" || binding.Subjects[0].Name != "controller" {
+		t.Errorf("Expected the ServiceAccount to be bound, got %+v", binding.Subjects)
+	}
+
+	config := utils.Config{
+		KubernetesNamespace:        "team-a",
+		WriteIngressStatus:         true,
+		DisableUnreadyRoutesAfter:  time.Minute,
+		AccessRestrictionConfigMap: "ingress/nginx-config",
+	}
+	objects = RBACManifests(config, "ingress", "controller")
+	if len(objects) != 6 {
+		t.Fatalf("Expected a Role and binding for the ConfigMap's and the watched namespace, got %d objects", len(objects))
+	}
+	if rules := objects[0].(*rbacv1.ClusterRole).Rules; len(rules) != 1 {
+		t.Errorf("Expected only access reviews cluster wide when namespaces are configured, got %+v", rules)
+	}
+	configMapRole := objects[2].(*rbacv1.Role)
+	if configMapRole.Namespace != "ingress" || configMapRole.Rules[0].ResourceNames[0] != "nginx-config" {
+		t.Errorf("Expected access to only the ConfigMap, got %+v", configMapRole)
+	}
+	watched := objects[4].(*rbacv1.Role)
+	if watched.Namespace != "team-a" || !reflect.DeepEqual(watched.Rules[0].Verbs, []string{"list", "watch", "patch"}) ||
+		!reflect.DeepEqual(watched.Rules[3].Verbs, []string{"list", "watch"}) {
+		t.Errorf("Expected to patch ingresses and watch endpoints in the namespace, got %+v", watched)
+	}
+}
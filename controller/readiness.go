@@ -0,0 +1,86 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	v1 "k8s.io/api/core/v1"
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ingressServiceNames returns the sorted names of the services the ingress routes to
+func ingressServiceNames(ingress *v1beta1.Ingress) []string {
+	services := map[string]bool{}
+	if ingress.Spec.Backend != nil && ingress.Spec.Backend.ServiceName != "" {
+		services[ingress.Spec.Backend.ServiceName] = true
+	}
+	for _, rule := range ingress.Spec.Rules {
+		if rule.HTTP == nil {
+			continue
+		}
+		for _, path := range rule.HTTP.Paths {
+			if path.Backend.ServiceName != "" {
+				services[path.Backend.ServiceName] = true
+			}
+		}
+	}
+	names := make([]string, 0, len(services))
+	for name := range services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// servicesWithoutReadyEndpoints returns the services the ingress routes to which have no ready endpoints,
+// including those which don't exist
+func (c *Controller) servicesWithoutReadyEndpoints(ingress *v1beta1.Ingress) ([]string, error) {
+	notReady := []string{}
+	for _, name := range ingressServiceNames(ingress) {
+		endpoints, err := c.client.CoreV1().Endpoints(ingress.Namespace).Get(name, metav1.GetOptions{})
+		if apierrors.IsNotFound(err) {
+			notReady = append(notReady, name)
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get endpoints of service %s: %v", name, err)
+		}
+		ready := false
+		for _, subset := range endpoints.Subsets {
+			if len(subset.Addresses) > 0 {
+				ready = true
+				break
+			}
+		}
+		if !ready {
+			notReady = append(notReady, name)
+		}
+	}
+	return notReady, nil
+}
+
+// waitingForEndpoints returns true if the ingress hasn't been routed through Frontdoor yet and one of
+// its services has no ready endpoints, so Frontdoor isn't sent traffic for it which would get 503s and
+// mark the cluster's backend unhealthy. Once routed an ingress is never held back. A warning Event is
+// recorded when the services being waited for change.
+func (c *Controller) waitingForEndpoints(ctx context.Context, ingress *v1beta1.Ingress, waiting map[string]string) (bool, error) {
+	key := ingressKey(ingress)
+	if !c.waitForReadyEndpoints || c.routed[key] || ingress.Annotations[lastSyncAnnotation] != "" {
+		return false, nil
+	}
+	notReady, err := c.servicesWithoutReadyEndpoints(ingress)
+	if err != nil || len(notReady) == 0 {
+		return false, err
+	}
+	names := strings.Join(notReady, ", ")
+	waiting[key] = names
+	if c.endpointWaits[key] != names {
+		recordIngressEvent(ctx, c.client, ingress, v1.EventTypeWarning, "WaitingForEndpoints",
+			fmt.Sprintf("Not routing through Frontdoor until these services have ready endpoints: %s", names))
+	}
+	return true, nil
+}
@@ -0,0 +1,33 @@
+package controller
+
+import (
+	"reflect"
+	"testing"
+
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+)
+
+func TestIngressServiceNames(t *testing.T) {
+	path := func(service string) v1beta1.HTTPIngressPath {
+		return v1beta1.HTTPIngressPath{Backend: v1beta1.IngressBackend{ServiceName: service}}
+	}
+	ingress := &v1beta1.Ingress{
+		Spec: v1beta1.IngressSpec{
+			Backend: &v1beta1.IngressBackend{ServiceName: "default"},
+			Rules: []v1beta1.IngressRule{
+				{IngressRuleValue: v1beta1.IngressRuleValue{HTTP: &v1beta1.HTTPIngressRuleValue{
+					Paths: []v1beta1.HTTPIngressPath{path("web"), path("api")},
+				}}},
+				{Host: "no-paths.example.com"},
+				{IngressRuleValue: v1beta1.IngressRuleValue{HTTP: &v1beta1.HTTPIngressRuleValue{
+					Paths: []v1beta1.HTTPIngressPath{path("web")},
+				}}},
+			},
+		},
+	}
+
+	expected := []string{"api", "default", "web"}
+	if names := ingressServiceNames(ingress); !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected services %v got %v", expected, names)
+	}
+}
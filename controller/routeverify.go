@@ -0,0 +1,282 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	gosync "sync"
+	"time"
+
+	"github.com/lawrencegripper/azurefrontdooringress/sync"
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+	v1 "k8s.io/api/core/v1"
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	// routeVerifyInterval is how often a path which hasn't answered through Frontdoor is requested again
+	routeVerifyInterval = 15 * time.Second
+	// routeVerifyTimeout limits how long a single request through Frontdoor can take
+	routeVerifyTimeout = 10 * time.Second
+)
+
+// routePath is a path of an ingress requested through Frontdoor, with the host it's routed for
+type routePath struct {
+	host string
+	path string
+}
+
+func (r routePath) String() string {
+	return r.host + r.path
+}
+
+// routeVerifier requests each path newly routed by a sync through the Frontdoor hostname, retrying until
+// it gets a 2xx or 3xx response or the window passes, and records the result as an Event on the ingress
+// so propagation delays and misrouting are caught early
+type routeVerifier struct {
+	hostname string
+	window   time.Duration
+	interval time.Duration
+	// get requests the URL with the host header, returning the response's status code
+	get func(ctx context.Context, url, host string) (int, error)
+	// record creates an Event on the ingress
+	record func(ctx context.Context, ingress *v1beta1.Ingress, eventType, reason, message string)
+
+	mutex gosync.Mutex
+	// verified holds the paths of each ingress already requested, keyed by 'namespace/name'
+	verified map[string]map[routePath]bool
+	// wg tracks the verifications running, for tests
+	wg gosync.WaitGroup
+}
+
+// newRouteVerifier returns a verifier for the Frontdoor hostname, nil if the window is zero
+func newRouteVerifier(hostname string, window time.Duration, client kubernetes.Interface) *routeVerifier {
+	if window <= 0 {
+		return nil
+	}
+	httpClient := &http.Client{
+		Timeout: routeVerifyTimeout,
+		// A redirect is a successful route, it isn't followed as it may leave Frontdoor
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	return &routeVerifier{
+		hostname: hostname,
+		window:   window,
+		interval: routeVerifyInterval,
+		verified: map[string]map[routePath]bool{},
+		get: func(ctx context.Context, url, host string) (int, error) {
+			req, err := http.NewRequest(http.MethodGet, url, nil)
+			if err != nil {
+				return 0, err
+			}
+			req.Host = host
+			resp, err := httpClient.Do(req.WithContext(ctx))
+			if err != nil {
+				return 0, err
+			}
+			resp.Body.Close() //nolint: errcheck
+			return resp.StatusCode, nil
+		},
+		record: func(ctx context.Context, ingress *v1beta1.Ingress, eventType, reason, message string) {
+			recordIngressEvent(ctx, client, ingress, eventType, reason, message)
+		},
+	}
+}
+
+// ingressRoutePaths returns the paths the ingress routes, leaving out those to services without
+// ready endpoints as their routes are disabled
+func ingressRoutePaths(ingress *v1beta1.Ingress) []routePath {
+	unready := map[string]bool{}
+	for _, service := range strings.Split(ingress.Annotations[sync.UnreadyServicesAnnotation], ",") {
+		unready[service] = true
+	}
+	paths := []routePath{}
+	for _, rule := range ingress.Spec.Rules {
+		if rule.HTTP == nil {
+			continue
+		}
+		for _, path := range rule.HTTP.Paths {
+			if unready[path.Backend.ServiceName] {
+				continue
+			}
+			// A wildcard path is requested at its prefix
+			requested := strings.TrimSuffix(path.Path, "*")
+			if requested == "" {
+				requested = "/"
+			}
+			paths = append(paths, routePath{host: rule.Host, path: requested})
+		}
+	}
+	return paths
+}
+
+// verify starts requesting the paths of the synced ingresses which weren't routed by earlier syncs,
+// ingresses which weren't synced are forgotten so their paths are requested again once they are
+func (v *routeVerifier) verify(ctx context.Context, synced []*v1beta1.Ingress) {
+	if v == nil {
+		return
+	}
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	current := make(map[string]map[routePath]bool, len(synced))
+	for _, ingress := range synced {
+		key := ingressKey(ingress)
+		current[key] = map[routePath]bool{}
+		added := []routePath{}
+		for _, path := range ingressRoutePaths(ingress) {
+			current[key][path] = true
+			if !v.verified[key][path] {
+				added = append(added, path)
+			}
+		}
+		if len(added) == 0 {
+			continue
+		}
+		v.wg.Add(1)
+		go func(ingress *v1beta1.Ingress, paths []routePath) {
+			defer v.wg.Done()
+			v.verifyIngress(ctx, ingress, paths)
+		}(ingress, added)
+	}
+	v.verified = current
+}
+
+// verifyIngress requests each of the ingress's paths until they answer or the window passes, then records
+// a Normal Event if they all answered or a Warning Event listing those which didn't
+func (v *routeVerifier) verifyIngress(ctx context.Context, ingress *v1beta1.Ingress, paths []routePath) {
+	logger := utils.GetLogger(ctx).WithField("ingressName", ingress.Name)
+	failures := v.poll(ctx, paths)
+	if ctx.Err() != nil {
+		return
+	}
+
+	if len(failures) == 0 {
+		logger.WithField("paths", len(paths)).Info("Verified new paths are routed through Frontdoor")
+		v.record(ctx, ingress, v1.EventTypeNormal, "RouteVerified",
+			fmt.Sprintf("Requests through Frontdoor to %d new paths were answered", len(paths)))
+		return
+	}
+	failed := describeRouteFailures(failures)
+	logger.WithField("failures", failed).Warn("New paths aren't routed through Frontdoor")
+	v.record(ctx, ingress, v1.EventTypeWarning, "RouteVerificationFailed",
+		fmt.Sprintf("Requests through Frontdoor didn't get a 2xx or 3xx response within %v: %s", v.window, strings.Join(failed, "; ")))
+}
+
+// PropagationError is the failure of an ingress whose new paths didn't answer through Frontdoor before
+// the propagation timeout
+type PropagationError struct {
+	Timeout time.Duration
+	// Failures describes each path which didn't answer
+	Failures []string
+}
+
+func (e *PropagationError) Error() string {
+	return fmt.Sprintf("Frontdoor accepted the update but it didn't propagate within %v: %s", e.Timeout, strings.Join(e.Failures, "; "))
+}
+
+// awaitPropagation requests the paths of the synced ingresses which haven't answered through Frontdoor
+// since they were routed, until they all answer or the window passes. It returns an error for each ingress
+// with paths which didn't answer keyed by 'namespace/name'. Paths are only remembered once they answer
+// so those which didn't are waited for again by the next sync.
+func (v *routeVerifier) awaitPropagation(ctx context.Context, synced []*v1beta1.Ingress) map[string]error {
+	if v == nil {
+		return nil
+	}
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	pending := map[string][]routePath{}
+	unique := map[routePath]bool{}
+	for _, ingress := range synced {
+		key := ingressKey(ingress)
+		for _, path := range ingressRoutePaths(ingress) {
+			if !v.verified[key][path] {
+				pending[key] = append(pending[key], path)
+				unique[path] = true
+			}
+		}
+	}
+	paths := make([]routePath, 0, len(unique))
+	for path := range unique {
+		paths = append(paths, path)
+	}
+	failures := map[routePath]string{}
+	if len(paths) > 0 {
+		utils.GetLogger(ctx).WithField("paths", len(paths)).WithField("timeout", v.window).Info("Waiting for new paths to propagate through Frontdoor")
+		failures = v.poll(ctx, paths)
+	}
+
+	errs := map[string]error{}
+	current := make(map[string]map[routePath]bool, len(synced))
+	for _, ingress := range synced {
+		key := ingressKey(ingress)
+		current[key] = map[routePath]bool{}
+		for path := range v.verified[key] {
+			current[key][path] = true
+		}
+		ingressFailures := map[routePath]string{}
+		for _, path := range pending[key] {
+			if failure, failed := failures[path]; failed {
+				ingressFailures[path] = failure
+				continue
+			}
+			current[key][path] = true
+		}
+		if len(ingressFailures) > 0 {
+			errs[key] = &PropagationError{Timeout: v.window, Failures: describeRouteFailures(ingressFailures)}
+		}
+	}
+	v.verified = current
+	return errs
+}
+
+// poll requests each path until they all get a 2xx or 3xx response or the window passes, returning
+// why each path which didn't answer failed
+func (v *routeVerifier) poll(ctx context.Context, paths []routePath) map[routePath]string {
+	deadline := time.Now().Add(v.window)
+	failures := map[routePath]string{}
+	for _, path := range paths {
+		failures[path] = "not requested"
+	}
+
+	for {
+		for path := range failures {
+			host := path.host
+			if host == "" {
+				host = v.hostname
+			}
+			status, err := v.get(ctx, fmt.Sprintf("https://%s%s", v.hostname, path.path), host)
+			switch {
+			case err != nil:
+				failures[path] = err.Error()
+			case status >= 400:
+				failures[path] = fmt.Sprintf("returned %d", status)
+			default:
+				delete(failures, path)
+			}
+		}
+		if len(failures) == 0 || !time.Now().Add(v.interval).Before(deadline) {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return failures
+		case <-time.After(v.interval):
+		}
+	}
+	return failures
+}
+
+// describeRouteFailures returns each path with why it failed, sorted
+func describeRouteFailures(failures map[routePath]string) []string {
+	failed := make([]string, 0, len(failures))
+	for path, failure := range failures {
+		failed = append(failed, fmt.Sprintf("%s %s", path, failure))
+	}
+	sort.Strings(failed)
+	return failed
+}
@@ -0,0 +1,132 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"strings"
+	gosync "sync"
+	"testing"
+	"time"
+
+	"github.com/lawrencegripper/azurefrontdooringress/sync"
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+	log "github.com/sirupsen/logrus"
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRouteVerifier(t *testing.T) {
+	ctx := utils.WithLogger(context.Background(), log.WithField("test", t.Name()))
+	path := func(path, service string) v1beta1.HTTPIngressPath {
+		return v1beta1.HTTPIngressPath{Path: path, Backend: v1beta1.IngressBackend{ServiceName: service}}
+	}
+	ingress := &v1beta1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+		Spec: v1beta1.IngressSpec{Rules: []v1beta1.IngressRule{
+			{Host: "app.contoso.com", IngressRuleValue: v1beta1.IngressRuleValue{HTTP: &v1beta1.HTTPIngressRuleValue{
+				Paths: []v1beta1.HTTPIngressPath{path("/api/*", "api"), path("/missing", "web")},
+			}}},
+		}},
+	}
+
+	mutex := gosync.Mutex{}
+	requests := []string{}
+	events := []string{}
+	v := newRouteVerifier("fd.azurefd.net", time.Minute, nil)
+	v.interval = time.Millisecond
+	v.window = 50 * time.Millisecond
+	v.get = func(_ context.Context, url, host string) (int, error) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		requests = append(requests, host+" "+url)
+		if strings.HasSuffix(url, "/missing") {
+			return 404, nil
+		}
+		return 200, nil
+	}
+	v.record = func(_ context.Context, _ *v1beta1.Ingress, eventType, reason, message string) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		events = append(events, reason+": "+message)
+	}
+
+	v.verify(ctx, []*v1beta1.Ingress{ingress})
+	v.wg.Wait()
+	if len(events) != 1 || !strings.HasPrefix(events[0], "RouteVerificationFailed") || !strings.Contains(events[0], "app.contoso.com/missing returned 404") {
+		t.Fatalf("Expected a warning Event for the path which isn't routed, got %v", events)
+	}
+	if requests[0] != "app.contoso.com https://fd.azurefd.net/api/" && requests[1] != "app.contoso.com https://fd.azurefd.net/api/" {
+		t.Errorf("Expected the wildcard path to be requested at its prefix with the rule's host, got %v", requests)
+	}
+
+	// Paths already requested aren't requested again, nor are those to unready services
+	requests, events = nil, nil
+	v.get = func(context.Context, string, string) (int, error) { return 0, errors.New("unexpected request") }
+	unready := sync.WithUnreadyServices(ingress, []string{"web"})
+	v.verify(ctx, []*v1beta1.Ingress{unready})
+	v.wg.Wait()
+	if len(events) != 0 {
+		t.Errorf("Expected no new paths to be verified, got %v", events)
+	}
+
+	// Once the ingress isn't synced its paths are forgotten
+	v.verify(ctx, nil)
+	v.get = func(context.Context, string, string) (int, error) { return 301, nil }
+	v.verify(ctx, []*v1beta1.Ingress{ingress})
+	v.wg.Wait()
+	if len(events) != 1 || !strings.HasPrefix(events[0], "RouteVerified") {
+		t.Errorf("Expected the paths to be verified again, got %v", events)
+	}
+
+	if newRouteVerifier("fd.azurefd.net", 0, nil) != nil {
+		t.Error("Expected verification to be disabled without a window")
+	}
+}
+
+func TestAwaitPropagation(t *testing.T) {
+	ctx := utils.WithLogger(context.Background(), log.WithField("test", t.Name()))
+	ingress := &v1beta1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+		Spec: v1beta1.IngressSpec{Rules: []v1beta1.IngressRule{
+			{Host: "app.contoso.com", IngressRuleValue: v1beta1.IngressRuleValue{HTTP: &v1beta1.HTTPIngressRuleValue{
+				Paths: []v1beta1.HTTPIngressPath{
+					{Path: "/", Backend: v1beta1.IngressBackend{ServiceName: "web"}},
+					{Path: "/new", Backend: v1beta1.IngressBackend{ServiceName: "web"}},
+				},
+			}}},
+		}},
+	}
+
+	requests := 0
+	v := newRouteVerifier("fd.azurefd.net", time.Minute, nil)
+	v.interval = time.Millisecond
+	v.window = 50 * time.Millisecond
+	v.get = func(_ context.Context, url, _ string) (int, error) {
+		requests++
+		// The new path answers once Frontdoor has propagated the change
+		if strings.HasSuffix(url, "/new") && requests < 5 {
+			return 404, nil
+		}
+		return 200, nil
+	}
+	if errs := v.awaitPropagation(ctx, []*v1beta1.Ingress{ingress}); len(errs) != 0 {
+		t.Fatalf("Expected the sync to wait for the paths to propagate, got %v", errs)
+	}
+
+	// Paths which answered aren't waited for again, those which didn't are
+	v.get = func(_ context.Context, url, _ string) (int, error) {
+		if !strings.HasSuffix(url, "/other") {
+			t.Errorf("Expected only the new path to be requested, got %s", url)
+		}
+		return 404, nil
+	}
+	ingress.Spec.Rules[0].HTTP.Paths = append(ingress.Spec.Rules[0].HTTP.Paths,
+		v1beta1.HTTPIngressPath{Path: "/other", Backend: v1beta1.IngressBackend{ServiceName: "web"}})
+	for i := 0; i < 2; i++ {
+		errs := v.awaitPropagation(ctx, []*v1beta1.Ingress{ingress})
+		propagationErr, timedOut := errs["default/app"].(*PropagationError)
+		if !timedOut || len(propagationErr.Failures) != 1 || propagationErr.Failures[0] != "app.contoso.com/other returned 404" {
+			t.Fatalf("Expected the path which didn't answer to fail the ingress, got %v", errs)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package controller
+
+import (
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// addServiceInformer registers an informer with the factory which only caches the parts of
+// each Service the controller reads. The vendored client-go doesn't support metadata-only
+// informers, and the annotated service can't be selected by label or field, so every Service
+// is still listed and watched but only its metadata is kept unless it's annotated.
+func addServiceInformer(factory informers.SharedInformerFactory, namespace string) cache.SharedIndexInformer {
+	return factory.InformerFor(&v1.Service{}, func(client kubernetes.Interface, resyncPeriod time.Duration) cache.SharedIndexInformer {
+		services := client.CoreV1().Services(namespace)
+		listWatch := &cache.ListWatch{
+			ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+				list, err := services.List(options)
+				if err != nil {
+					return nil, err
+				}
+				for i := range list.Items {
+					list.Items[i] = *slimService(&list.Items[i])
+				}
+				return list, nil
+			},
+			WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+				w, err := services.Watch(options)
+				if err != nil {
+					return nil, err
+				}
+				return watch.Filter(w, func(event watch.Event) (watch.Event, bool) {
+					if service, ok := event.Object.(*v1.Service); ok {
+						event.Object = slimService(service)
+					}
+					return event, true
+				}), nil
+			},
+		}
+		return cache.NewSharedIndexInformer(listWatch, &v1.Service{}, resyncPeriod,
+			cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	})
+}
+
+// slimService returns a copy of the Service with only the fields the controller reads. Services
+// without the frontdoor annotation keep only the metadata needed to track them in the cache.
+func slimService(service *v1.Service) *v1.Service {
+	slim := &v1.Service{
+		TypeMeta: service.TypeMeta,
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              service.Name,
+			Namespace:         service.Namespace,
+			UID:               service.UID,
+			ResourceVersion:   service.ResourceVersion,
+			DeletionTimestamp: service.DeletionTimestamp,
+		},
+	}
+	if !hasFrontdoorEnabledAnnotation(service.Annotations) {
+		return slim
+	}
+	slim.Annotations = map[string]string{frontdoorAnnotation: service.Annotations[frontdoorAnnotation]}
+	for _, annotation := range []string{backendWeightAnnotation, backendHTTPPortAnnotation, backendHTTPSPortAnnotation} {
+		if value, ok := service.Annotations[annotation]; ok {
+			slim.Annotations[annotation] = value
+		}
+	}
+	slim.Spec.Ports = service.Spec.Ports
+	slim.Spec.LoadBalancerSourceRanges = service.Spec.LoadBalancerSourceRanges
+	slim.Status.LoadBalancer = service.Status.LoadBalancer
+	return slim
+}
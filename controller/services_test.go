@@ -0,0 +1,53 @@
+package controller
+
+import (
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestSlimServiceKeepsOnlyFieldsRead(t *testing.T) {
+	service := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "nginx",
+			Namespace:       "ingress",
+			ResourceVersion: "5",
+			Labels:          map[string]string{"app": "nginx"},
+			Annotations: map[string]string{
+				frontdoorAnnotation: "enabled",
+				"kubectl.kubernetes.io/last-applied-configuration": "{}",
+			},
+		},
+		Spec: v1.ServiceSpec{
+			Type:                     v1.ServiceTypeLoadBalancer,
+			Ports:                    []v1.ServicePort{{Port: 80}},
+			LoadBalancerSourceRanges: []string{"147.243.0.0/16"},
+		},
+		Status: v1.ServiceStatus{
+			LoadBalancer: v1.LoadBalancerStatus{Ingress: []v1.LoadBalancerIngress{{IP: "10.0.0.1"}}},
+		},
+	}
+
+	slim := slimService(service)
+
+	if slim.Name != "nginx" || slim.Namespace != "ingress" || slim.ResourceVersion != "5" {
+		t.Errorf("Expected metadata used by the cache to be kept, got %+v", slim.ObjectMeta)
+	}
+	if len(slim.Annotations) != 1 || !hasFrontdoorEnabledAnnotation(slim.Annotations) {
+		t.Errorf("Expected only the frontdoor annotation to be kept, got %v", slim.Annotations)
+	}
+	if slim.Labels != nil || slim.Spec.Type != "" {
+		t.Errorf("Expected unused fields to be dropped, got %+v", slim)
+	}
+	if len(slim.Spec.LoadBalancerSourceRanges) != 1 || slim.Status.LoadBalancer.Ingress[0].IP != "10.0.0.1" || len(slim.Spec.Ports) != 1 {
+		t.Errorf("Expected load balancer fields of the annotated service to be kept, got %+v", slim)
+	}
+
+	other := service.DeepCopy()
+	other.Annotations = nil
+	slim = slimService(other)
+	if slim.Name != "nginx" || slim.Spec.LoadBalancerSourceRanges != nil || slim.Spec.Ports != nil || len(slim.Status.LoadBalancer.Ingress) != 0 {
+		t.Errorf("Expected only the metadata of services without the annotation to be kept, got %+v", slim)
+	}
+}
@@ -0,0 +1,123 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// serviceTagsRefreshPeriod is how often the Frontdoor backend ranges are fetched, Azure updates service tags weekly
+const serviceTagsRefreshPeriod = 12 * time.Hour
+
+// ipv4Prefixes returns the IPv4 address prefixes from the list
+func ipv4Prefixes(prefixes []string) []string {
+	ipv4 := []string{}
+	for _, prefix := range prefixes {
+		ip, _, err := net.ParseCIDR(prefix)
+		if err == nil && ip.To4() != nil {
+			ipv4 = append(ipv4, prefix)
+		}
+	}
+	return ipv4
+}
+
+// refreshServiceTags keeps the Frontdoor backend ranges allowlist up to date until the context is cancelled
+func (c *Controller) refreshServiceTags(ctx context.Context) {
+	if c.serviceTagsConfigMap == "" && !c.serviceTagsSourceRanges {
+		return
+	}
+	log := utils.GetLogger(ctx)
+
+	ticker := time.NewTicker(serviceTagsRefreshPeriod)
+	defer ticker.Stop()
+	for {
+		if err := c.updateServiceTagAllowlist(ctx); err != nil {
+			log.WithError(err).Warn("Failed to update allowlist of Frontdoor backend ranges, will retry")
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// updateServiceTagAllowlist fetches the Frontdoor backend ranges and writes them to the configured
+// ConfigMap and the load balancer source ranges of the annotated services
+func (c *Controller) updateServiceTagAllowlist(ctx context.Context) error {
+	log := utils.GetLogger(ctx)
+
+	prefixes, changeNumber, err := c.fetchBackendRanges(ctx)
+	if err != nil {
+		return err
+	}
+	ipv4 := ipv4Prefixes(prefixes)
+
+	if c.serviceTagsConfigMap != "" {
+		err = c.writeServiceTagsConfigMap(map[string]string{
+			"addressPrefixes":     strings.Join(prefixes, ","),
+			"ipv4AddressPrefixes": strings.Join(ipv4, ","),
+			"changeNumber":        changeNumber,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if c.serviceTagsSourceRanges {
+		for _, obj := range c.listServices() {
+			service := obj.(*v1.Service)
+			if !hasFrontdoorEnabledAnnotation(service.Annotations) || reflect.DeepEqual(service.Spec.LoadBalancerSourceRanges, ipv4) {
+				continue
+			}
+			// The informer only caches part of each service so it's patched rather than updated
+			patch, err := json.Marshal(map[string]interface{}{
+				"spec": map[string]interface{}{"loadBalancerSourceRanges": ipv4},
+			})
+			if err != nil {
+				return err
+			}
+			if _, err := c.client.CoreV1().Services(service.Namespace).Patch(service.Name, types.MergePatchType, patch); err != nil {
+				return err
+			}
+			log.WithField("serviceName", service.Name).Info("Restricted load balancer source ranges to Frontdoor backend ranges")
+		}
+	}
+
+	log.WithField("changeNumber", changeNumber).WithField("prefixes", len(prefixes)).Info("Updated allowlist of Frontdoor backend ranges")
+	return nil
+}
+
+// writeServiceTagsConfigMap creates or updates the ConfigMap holding the Frontdoor backend ranges
+func (c *Controller) writeServiceTagsConfigMap(data map[string]string) error {
+	parts := strings.SplitN(c.serviceTagsConfigMap, "/", 2)
+	namespace, name := parts[0], parts[1]
+	configMaps := c.client.CoreV1().ConfigMaps(namespace)
+
+	configMap, err := configMaps.Get(name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		_, err = configMaps.Create(&v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Data:       data,
+		})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+	if reflect.DeepEqual(configMap.Data, data) {
+		return nil
+	}
+	configMap.Data = data
+	_, err = configMaps.Update(configMap)
+	return err
+}
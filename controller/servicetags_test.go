@@ -0,0 +1,14 @@
+package controller
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestIPv4Prefixes(t *testing.T) {
+	prefixes := []string{"13.73.248.16/29", "2a01:111:2050::/44", "20.21.37.40/29", "not-a-prefix"}
+	expected := []string{"13.73.248.16/29", "20.21.37.40/29"}
+	if actual := ipv4Prefixes(prefixes); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected %v got %v", expected, actual)
+	}
+}
@@ -0,0 +1,75 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	"github.com/lawrencegripper/azurefrontdooringress/sync"
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+)
+
+// summaryInterval is how often a summary of sync activity is logged
+const summaryInterval = 5 * time.Minute
+
+// syncSummary accumulates sync activity between summaries so quiet clusters log once per
+// interval rather than for every ingress on every reconcile
+type syncSummary struct {
+	since      time.Time
+	reconciles int
+	// managed, waiting, skipped, ownedElsewhere, failed and diverged are ingress counts from the latest reconcile
+	managed        int
+	waiting        int
+	skipped        int
+	ownedElsewhere int
+	failed         int
+	diverged       int
+	// rulesCreated and rulesUpdated are totals since the last summary
+	rulesCreated int
+	rulesUpdated int
+	lastError    error
+}
+
+func newSyncSummary(now time.Time) *syncSummary {
+	return &syncSummary{since: now}
+}
+
+// record adds the outcome of a reconcile to the summary
+func (s *syncSummary) record(managed, waiting, skipped, ownedElsewhere int, result *sync.SyncResult) {
+	s.reconciles++
+	s.managed = managed
+	s.waiting = waiting
+	s.skipped = skipped
+	s.ownedElsewhere = ownedElsewhere
+	s.failed = len(result.Failed)
+	s.diverged = len(result.Diverged)
+	s.rulesCreated += result.RulesCreated
+	s.rulesUpdated += result.RulesUpdated
+	for _, err := range result.Failed {
+		s.lastError = err
+	}
+}
+
+// logIfDue logs the summary and starts a new one once summaryInterval has passed
+func (s *syncSummary) logIfDue(ctx context.Context, now time.Time) {
+	if now.Sub(s.since) < summaryInterval {
+		return
+	}
+	entry := utils.GetLogger(ctx).
+		WithField(utils.EventField, "SyncSummary").
+		WithField("interval", now.Sub(s.since).Round(time.Second).String()).
+		WithField("reconciles", s.reconciles).
+		WithField("ingressesManaged", s.managed).
+		WithField("ingressesWaitingToRetry", s.waiting).
+		WithField("ingressesNotAnnotated", s.skipped).
+		WithField("ingressesOwnedByOtherClusters", s.ownedElsewhere).
+		WithField("ingressesFailed", s.failed).
+		WithField("ingressesDiverged", s.diverged).
+		WithField("rulesCreated", s.rulesCreated).
+		WithField("rulesUpdated", s.rulesUpdated)
+	if s.lastError != nil {
+		entry = entry.WithField("lastError", s.lastError.Error())
+	}
+	entry.Info("Sync summary")
+
+	*s = syncSummary{since: now}
+}
@@ -0,0 +1,36 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lawrencegripper/azurefrontdooringress/sync"
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+func TestSyncSummary(t *testing.T) {
+	ctx := utils.WithLogger(context.Background(), log.WithField("test", t.Name()))
+	start := time.Now()
+	summary := newSyncSummary(start)
+
+	summary.record(3, 1, 4, 0, &sync.SyncResult{RulesCreated: 2, Failed: map[string]error{"default/a": errors.New("bad path")}})
+	summary.record(3, 0, 5, 2, &sync.SyncResult{RulesUpdated: 1, Failed: map[string]error{}})
+	if summary.reconciles != 2 || summary.rulesCreated != 2 || summary.rulesUpdated != 1 {
+		t.Errorf("Expected totals to accumulate got %+v", summary)
+	}
+	if summary.waiting != 0 || summary.skipped != 5 || summary.ownedElsewhere != 2 || summary.failed != 0 || summary.lastError == nil {
+		t.Errorf("Expected counts from the latest reconcile and the last error got %+v", summary)
+	}
+
+	summary.logIfDue(ctx, start.Add(time.Minute))
+	if summary.reconciles != 2 {
+		t.Error("Expected summary to be kept until the interval has passed")
+	}
+	summary.logIfDue(ctx, start.Add(summaryInterval))
+	if summary.reconciles != 0 || summary.lastError != nil || !summary.since.Equal(start.Add(summaryInterval)) {
+		t.Errorf("Expected summary to be reset after logging got %+v", summary)
+	}
+}
@@ -0,0 +1,120 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+	v1 "k8s.io/api/core/v1"
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+	"k8s.io/client-go/tools/cache"
+)
+
+// hasReadyEndpoints returns true if any subset of the endpoints has a ready address
+func hasReadyEndpoints(endpoints *v1.Endpoints) bool {
+	for _, subset := range endpoints.Subsets {
+		if len(subset.Addresses) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// addEndpointsInformer watches the endpoints in the namespace, queueing a reconcile whenever a service
+// gains its first ready endpoint or loses its last
+func (c *Controller) addEndpointsInformer(ns *namespaceInformers) {
+	ns.endpoints = ns.factory.Core().V1().Endpoints().Informer()
+	ns.endpoints.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(interface{}) { c.signalChanged() },
+		DeleteFunc: func(interface{}) { c.signalChanged() },
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			if hasReadyEndpoints(oldObj.(*v1.Endpoints)) != hasReadyEndpoints(newObj.(*v1.Endpoints)) {
+				c.signalChanged()
+			}
+		},
+	})
+}
+
+// readyServices returns the services, keyed by 'namespace/name', with ready endpoints in the cache
+func (c *Controller) readyServices() map[string]bool {
+	ready := map[string]bool{}
+	for _, ns := range c.namespaces {
+		if ns.endpoints == nil {
+			continue
+		}
+		for _, obj := range ns.endpoints.GetStore().List() {
+			endpoints := obj.(*v1.Endpoints)
+			if hasReadyEndpoints(endpoints) {
+				ready[endpoints.Namespace+"/"+endpoints.Name] = true
+			}
+		}
+	}
+	return ready
+}
+
+// unreadyTracker records how long the services behind the ingresses synced have had no ready endpoints,
+// so the routes to those unready for longer than disableAfter are disabled until they recover
+type unreadyTracker struct {
+	disableAfter time.Duration
+	// since holds when each service, keyed by 'namespace/name', was first seen without ready endpoints
+	since map[string]time.Time
+	// disabled holds the services whose routes were disabled by the last reconcile
+	disabled map[string]bool
+}
+
+func newUnreadyTracker(disableAfter time.Duration) *unreadyTracker {
+	return &unreadyTracker{
+		disableAfter: disableAfter,
+		since:        map[string]time.Time{},
+		disabled:     map[string]bool{},
+	}
+}
+
+// reconcile is called once per reconcile with the ready services and returns a function which gives
+// the names of an ingress's services whose routes are disabled. Services no longer routed to, or
+// which have recovered, are forgotten by end.
+func (t *unreadyTracker) reconcile(ready map[string]bool, now time.Time) (unready func(*v1beta1.Ingress) []string, end func(context.Context)) {
+	since := map[string]time.Time{}
+	disabled := map[string]bool{}
+	unready = func(ingress *v1beta1.Ingress) []string {
+		names := []string{}
+		if t.disableAfter <= 0 {
+			return names
+		}
+		for _, name := range ingressServiceNames(ingress) {
+			key := ingress.Namespace + "/" + name
+			if ready[key] {
+				continue
+			}
+			if _, seen := t.since[key]; !seen {
+				t.since[key] = now
+			}
+			since[key] = t.since[key]
+			if now.Sub(since[key]) >= t.disableAfter {
+				disabled[key] = true
+				names = append(names, name)
+			}
+		}
+		return names
+	}
+	end = func(ctx context.Context) {
+		log := utils.GetLogger(ctx)
+		for key := range disabled {
+			if !t.disabled[key] {
+				log.WithField("service", key).
+					WithField(utils.EventField, "UnreadyRoutesDisabled").
+					Warnf("Disabling routes to service which has had no ready endpoints for %v", t.disableAfter)
+			}
+		}
+		for key := range t.disabled {
+			if !disabled[key] {
+				log.WithField("service", key).
+					WithField(utils.EventField, "UnreadyRoutesEnabled").
+					Info("Enabling routes to service again")
+			}
+		}
+		t.since = since
+		t.disabled = disabled
+	}
+	return unready, end
+}
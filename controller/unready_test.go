@@ -0,0 +1,51 @@
+package controller
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+	log "github.com/sirupsen/logrus"
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestUnreadyTrackerDisablesAfterPeriod(t *testing.T) {
+	ctx := utils.WithLogger(context.Background(), log.WithField("test", t.Name()))
+	ingress := &v1beta1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default"},
+		Spec:       v1beta1.IngressSpec{Backend: &v1beta1.IngressBackend{ServiceName: "web"}},
+	}
+	tracker := newUnreadyTracker(time.Minute)
+	start := time.Now()
+
+	reconcile := func(ready map[string]bool, now time.Time) []string {
+		unready, end := tracker.reconcile(ready, now)
+		names := unready(ingress)
+		end(ctx)
+		return names
+	}
+
+	if names := reconcile(map[string]bool{}, start); len(names) != 0 {
+		t.Errorf("Expected routes to be kept until the period passes got %v", names)
+	}
+	if names := reconcile(map[string]bool{}, start.Add(time.Minute)); !reflect.DeepEqual(names, []string{"web"}) {
+		t.Errorf("Expected routes to the service to be disabled got %v", names)
+	}
+	if names := reconcile(map[string]bool{"default/web": true}, start.Add(2*time.Minute)); len(names) != 0 {
+		t.Errorf("Expected routes to be enabled once the service recovers got %v", names)
+	}
+	if names := reconcile(map[string]bool{}, start.Add(3*time.Minute)); len(names) != 0 {
+		t.Errorf("Expected the period to start again after recovering got %v", names)
+	}
+}
+
+func TestUnreadyTrackerDisabled(t *testing.T) {
+	ingress := &v1beta1.Ingress{Spec: v1beta1.IngressSpec{Backend: &v1beta1.IngressBackend{ServiceName: "web"}}}
+	unready, _ := newUnreadyTracker(0).reconcile(map[string]bool{}, time.Now())
+	if names := unready(ingress); len(names) != 0 {
+		t.Errorf("Expected no routes to be disabled got %v", names)
+	}
+}
@@ -2,51 +2,190 @@ package main
 
 import (
 	"context"
+	"flag"
 	"fmt"
 	"os"
 
-	"github.com/joho/godotenv"
-	"github.com/lawrencegripper/azurefrontdooringress/controller"
 	"github.com/lawrencegripper/azurefrontdooringress/sync"
 	"github.com/lawrencegripper/azurefrontdooringress/utils"
 	log "github.com/sirupsen/logrus"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
 )
 
 func main() {
-	err := godotenv.Load()
-	if err != nil {
-		log.Error("Error loading .env file")
+	envFile := os.Getenv("ENV_FILE")
+	if envFile == "" {
+		envFile = utils.DefaultEnvFile
+	}
+	if loaded, err := utils.LoadEnvFile(envFile); err != nil {
+		log.WithError(err).Error("Failed to load env file, continuing with the environment")
+	} else if loaded {
+		log.WithField("envFile", envFile).Info("Loaded env file")
 	}
 
+	env := &utils.EnvReader{}
+
+	debugAPICalls := env.Bool("DEBUG_API_CALLS", false)
+	flag.BoolVar(&debugAPICalls, "debug-api-calls", debugAPICalls, "Log redacted requests and responses to the Frontdoor API (env: DEBUG_API_CALLS)")
+	concurrentReconciles := env.Int("CONCURRENT_RECONCILES", 1)
+	flag.IntVar(&concurrentReconciles, "concurrent-reconciles", concurrentReconciles, "Number of namespaces whose routing rules are generated at once when KUBERNETES_NAMESPACE isn't set (env: CONCURRENT_RECONCILES)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [command]\n\nCommands:\n", os.Args[0])
+		for _, c := range commands {
+			fmt.Fprintf(flag.CommandLine.Output(), "  %-15s %s\n", c.name, c.description)
+		}
+		fmt.Fprintf(flag.CommandLine.Output(), "\nFlags:\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
 	syncConfig := utils.Config{
-		BackendPoolName:     os.Getenv("BACKENDPOOL_NAME"),
-		ResourceGroupName:   os.Getenv("AZURE_RESOURCE_GROUP_NAME"),
-		SubscriptionID:      os.Getenv("AZURE_SUBSCRIPTION_ID"),
-		ClusterName:         os.Getenv("CLUSTER_NAME"),
-		FrontDoorName:       os.Getenv("AZURE_FRONTDOOR_NAME"),
-		FrontDoorHostname:   os.Getenv("AZURE_FRONTDOOR_HOSTNAME"),
-		KubernetesNamespace: os.Getenv("KUBERNETES_NAMESPACE"),
-		StorageAccountURL:   os.Getenv("STORAGE_ACCOUNT_URL"),
-		StorageAccountKey:   os.Getenv("STORAGE_ACCOUNT_KEY"),
+		BackendPoolName:                     os.Getenv("BACKENDPOOL_NAME"),
+		ResourceGroupName:                   os.Getenv("AZURE_RESOURCE_GROUP_NAME"),
+		SubscriptionID:                      os.Getenv("AZURE_SUBSCRIPTION_ID"),
+		ClusterName:                         os.Getenv("CLUSTER_NAME"),
+		FrontDoorName:                       os.Getenv("AZURE_FRONTDOOR_NAME"),
+		FrontDoorHostname:                   os.Getenv("AZURE_FRONTDOOR_HOSTNAME"),
+		KubernetesNamespace:                 os.Getenv("KUBERNETES_NAMESPACE"),
+		StorageAccountURL:                   os.Getenv("STORAGE_ACCOUNT_URL"),
+		StorageAccountKey:                   os.Getenv("STORAGE_ACCOUNT_KEY"),
+		MetricsAddress:                      os.Getenv("METRICS_ADDRESS"),
+		DebugAPICalls:                       debugAPICalls,
+		AuthFileLocation:                    os.Getenv("AZURE_AUTH_LOCATION"),
+		SyncDebounce:                        env.Duration("SYNC_DEBOUNCE", 0),
+		OwnershipMode:                       os.Getenv("OWNERSHIP_MODE"),
+		BackendPoolPerNamespace:             env.Bool("BACKEND_POOL_PER_NAMESPACE", false),
+		SnapshotLocation:                    os.Getenv("SNAPSHOT_LOCATION"),
+		SnapshotRetention:                   env.Int("SNAPSHOT_RETENTION", utils.DefaultSnapshotRetention),
+		RollbackProbeWindow:                 env.Duration("ROLLBACK_PROBE_WINDOW", 0),
+		RollbackProbePath:                   os.Getenv("ROLLBACK_PROBE_PATH"),
+		CustomDomains:                       env.Bool("CUSTOM_DOMAINS", false),
+		MinimumTLSVersion:                   os.Getenv("MINIMUM_TLS_VERSION"),
+		FrontDoorID:                         os.Getenv("AZURE_FRONTDOOR_ID"),
+		AccessRestrictionConfigMap:          os.Getenv("ACCESS_RESTRICTION_CONFIGMAP"),
+		ServiceTagsConfigMap:                os.Getenv("SERVICE_TAGS_CONFIGMAP"),
+		ServiceTagsLoadBalancerSourceRanges: env.Bool("SERVICE_TAGS_LOADBALANCER_SOURCE_RANGES", false),
+		APIRecordMode:                       os.Getenv("API_RECORD_MODE"),
+		APIRecordingDir:                     os.Getenv("API_RECORDING_DIR"),
+		WriteIngressStatus:                  env.Bool("WRITE_INGRESS_STATUS", true),
+		BackendPriority:                     env.Int("BACKEND_PRIORITY", utils.MinBackendPriority),
+		LockHistory:                         env.Bool("LOCK_HISTORY", false),
+		LockGCAfter:                         env.Duration("LOCK_GC_AFTER", 0),
+		LockAlertAfter:                      env.Duration("LOCK_ALERT_AFTER", 0),
+		LockAlertWebhookURL:                 os.Getenv("LOCK_ALERT_WEBHOOK_URL"),
+		ConcurrentReconciles:                concurrentReconciles,
+		WebhookURL:                          os.Getenv("WEBHOOK_URL"),
+		AdminAddress:                        os.Getenv("ADMIN_ADDRESS"),
+		AdminToken:                          os.Getenv("ADMIN_TOKEN"),
+		AdditionalFrontDoors:                env.List("ADDITIONAL_FRONTDOORS"),
+		AllowedAnnotations:                  env.List("ALLOWED_ANNOTATIONS"),
+		IMDSResourceGroup:                   env.Bool("IMDS_RESOURCE_GROUP", false),
+		PublicIPProbeURL:                    os.Getenv("PUBLIC_IP_PROBE_URL"),
+		AuthoritativeCluster:                os.Getenv("AUTHORITATIVE_CLUSTER"),
+		StorageSubscriptionID:               os.Getenv("STORAGE_AZURE_SUBSCRIPTION_ID"),
+		StorageResourceGroupName:            os.Getenv("STORAGE_AZURE_RESOURCE_GROUP_NAME"),
+		StorageClientID:                     os.Getenv("STORAGE_AZURE_CLIENT_ID"),
+		StorageClientSecret:                 os.Getenv("STORAGE_AZURE_CLIENT_SECRET"),
+		StorageTenantID:                     os.Getenv("STORAGE_AZURE_TENANT_ID"),
+		FrontDoorSubscriptionID:             os.Getenv("FRONTDOOR_AZURE_SUBSCRIPTION_ID"),
+		FrontDoorClientID:                   os.Getenv("FRONTDOOR_AZURE_CLIENT_ID"),
+		FrontDoorClientSecret:               os.Getenv("FRONTDOOR_AZURE_CLIENT_SECRET"),
+		FrontDoorTenantID:                   os.Getenv("FRONTDOOR_AZURE_TENANT_ID"),
+		BackendHealthInterval:               env.Duration("BACKEND_HEALTH_INTERVAL", 0),
+		AppInsightsConnectionString:         os.Getenv("APPLICATIONINSIGHTS_CONNECTION_STRING"),
+		DefaultRoute:                        os.Getenv("DEFAULT_ROUTE"),
+		DifferentialUpdates:                 env.Bool("DIFFERENTIAL_UPDATES", false),
+		UnusedFrontendGracePeriod:           env.Duration("UNUSED_FRONTEND_GRACE_PERIOD", 0),
+		StaticRoutes:                        env.List("STATIC_ROUTES"),
+		WaitForReadyEndpoints:               env.Bool("WAIT_FOR_READY_ENDPOINTS", false),
+		DisableUnreadyRoutesAfter:           env.Duration("DISABLE_UNREADY_ROUTES_AFTER", 0),
+		KubernetesAPIQPS:                    env.Int("KUBERNETES_API_QPS", 0),
+		KubernetesAPIBurst:                  env.Int("KUBERNETES_API_BURST", 0),
+		RuleRegistry:                        env.Bool("RULE_REGISTRY", false),
+		SyncStrategy:                        os.Getenv("SYNC_STRATEGY"),
+		FrontendProtocols:                   env.List("FRONTEND_PROTOCOLS"),
+		RouteVerificationWindow:             env.Duration("ROUTE_VERIFICATION_WINDOW", 0),
+		AwaitPropagationTimeout:             env.Duration("AWAIT_PROPAGATION_TIMEOUT", 0),
+		PodName:                             os.Getenv("POD_NAME"),
+		LockingMode:                         os.Getenv("LOCKING_MODE"),
 	}
 
-	logger := log.WithField("config", syncConfig)
-	bgCtx := context.Background()
-	ctx := utils.WithLogger(bgCtx, logger)
+	if syncConfig.PodName == "" {
+		// A pod's hostname is its name
+		syncConfig.PodName, _ = os.Hostname() //nolint: errcheck
+	}
 
-	fdSyncer, err := sync.NewFontDoorSyncer(ctx, syncConfig)
-	if err != nil {
-		logger.WithError(err).Panic("Failed to create NewFrontDoorSyncer")
+	if syncConfig.OwnershipMode == "" {
+		syncConfig.OwnershipMode = utils.OwnershipModeStrict
 	}
 
-	// Todo: move controller logic loop into controller.
-	for {
-		ingress, err := controller.Start(ctx, syncConfig.KubernetesNamespace, fdSyncer)
+	if syncConfig.MinimumTLSVersion == "" {
+		syncConfig.MinimumTLSVersion = "1.2"
+	}
+
+	if syncConfig.RollbackProbePath == "" {
+		syncConfig.RollbackProbePath = "/"
+	}
+
+	if syncConfig.MetricsAddress == "" {
+		syncConfig.MetricsAddress = ":8080"
+	}
+
+	if syncConfig.DebugAPICalls {
+		// API calls are logged at debug level
+		log.SetLevel(log.DebugLevel)
+	}
+
+	// Default to running the controller when no command is given
+	commandName := "run"
+	var args []string
+	if flag.NArg() > 0 {
+		commandName = flag.Arg(0)
+		args = flag.Args()[1:]
+	}
+
+	cmd := findCommand(commandName)
+	if cmd == nil {
+		fmt.Fprintf(os.Stderr, "Unknown command %q\n\n", commandName)
+		flag.Usage()
+		os.Exit(exitUsage)
+	}
+
+	flags := flag.NewFlagSet(cmd.name, flag.ExitOnError)
+	if cmd.setFlags != nil {
+		cmd.setFlags(flags, &syncConfig)
+	}
+	flags.Parse(args) //nolint: errcheck
+
+	if cmd.withoutConfig {
+		cmd.run(context.Background(), syncConfig, flags.Args())
+		return
+	}
+
+	// On Azure VMs, such as AKS nodes, settings which aren't configured can be read from the VM's metadata
+	sync.DefaultFromInstanceMetadata(utils.WithLogger(context.Background(), log.NewEntry(log.StandardLogger())), &syncConfig)
+
+	logger := log.WithField("config", syncConfig)
+
+	if err := utilerrors.Flatten(utilerrors.NewAggregate([]error{env.Err(), syncConfig.Validate()})); err != nil {
+		logger.WithError(err).Error("Invalid configuration")
+		os.Exit(exitConfigError)
+	}
+	if syncConfig.AppInsightsConnectionString != "" {
+		hook, err := utils.NewAppInsightsHook(syncConfig.AppInsightsConnectionString)
 		if err != nil {
-			panic(fmt.Errorf("Failed running controller: %+v", err))
+			logger.WithError(err).Panic("Failed to send logs to Application Insights")
 		}
+		log.AddHook(hook)
+	}
+	bgCtx := context.Background()
+	ctx := utils.WithLogger(bgCtx, logger)
 
-		log.WithField("ingress", ingress).Info("Update ingress in frontdoor")
+	err := sync.ResolveStorageAccountKey(ctx, &syncConfig)
+	if err != nil {
+		logger.WithError(err).Error("Failed to get storage account key")
+		os.Exit(exitCode(err, exitConfigError))
 	}
 
+	cmd.run(ctx, syncConfig, flags.Args())
 }
@@ -0,0 +1,237 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// The vendored dependencies don't include the Prometheus client so this
+// package implements the small subset of the text exposition format
+// needed to expose gauges and counters on '/metrics'
+
+type (
+	// Gauge is a metric which can go up and down
+	Gauge struct {
+		metric
+	}
+
+	// Counter is a metric which only increases
+	Counter struct {
+		metric
+	}
+
+	// Histogram counts observations, such as latencies, in cumulative buckets
+	Histogram struct {
+		metric
+		buckets []float64
+	}
+
+	metric struct {
+		name       string
+		help       string
+		metricType string
+		labelNames []string
+		mutex      sync.Mutex
+		values     map[string]float64
+		// collect sets the value of a metric without labels when it's written, nil if it's set directly
+		collect func() float64
+		// order is the order the values are written in, they're sorted if it's empty
+		order []string
+	}
+)
+
+var (
+	registryMutex sync.Mutex
+	registry      = map[string]*metric{}
+)
+
+// NewGauge creates and registers a gauge with the given label names
+func NewGauge(name, help string, labelNames ...string) *Gauge {
+	g := &Gauge{metric: newMetric(name, help, "gauge", labelNames)}
+	register(&g.metric)
+	return g
+}
+
+// NewCounter creates and registers a counter with the given label names
+func NewCounter(name, help string, labelNames ...string) *Counter {
+	c := &Counter{metric: newMetric(name, help, "counter", labelNames)}
+	register(&c.metric)
+	return c
+}
+
+// NewGaugeFunc creates and registers a gauge without labels whose value is read from fn when metrics are
+// written, for values which change with time such as an age
+func NewGaugeFunc(name, help string, fn func() float64) *Gauge {
+	g := &Gauge{metric: newMetric(name, help, "gauge", nil)}
+	g.collect = fn
+	register(&g.metric)
+	return g
+}
+
+// NewHistogram creates and registers a histogram without labels with the given upper bounds of its buckets
+func NewHistogram(name, help string, buckets ...float64) *Histogram {
+	h := &Histogram{metric: newMetric(name, help, "histogram", nil), buckets: buckets}
+	for _, bucket := range buckets {
+		h.order = append(h.order, bucketKey(strconv.FormatFloat(bucket, 'f', -1, 64)))
+	}
+	h.order = append(h.order, bucketKey("+Inf"), "_sum", "_count")
+	for _, key := range h.order {
+		h.values[key] = 0
+	}
+	register(&h.metric)
+	return h
+}
+
+func bucketKey(le string) string {
+	return fmt.Sprintf(`_bucket{le="%s"}`, le)
+}
+
+// Observe adds the value to the buckets it's within
+func (h *Histogram) Observe(value float64) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for i, bucket := range h.buckets {
+		if value <= bucket {
+			h.values[h.order[i]]++
+		}
+	}
+	h.values[bucketKey("+Inf")]++
+	h.values["_sum"] += value
+	h.values["_count"]++
+}
+
+// Set sets the gauge for the provided label values
+func (g *Gauge) Set(value float64, labelValues ...string) {
+	g.update(labelValues, func(float64) float64 { return value })
+}
+
+// SetFunc sets fn to be read for the value of a gauge without labels when it's written, replacing the
+// function it was created with, for values owned by something created after the gauge is registered
+func (g *Gauge) SetFunc(fn func() float64) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.collect = fn
+}
+
+// Add adds to the gauge for the provided label values
+func (g *Gauge) Add(value float64, labelValues ...string) {
+	g.update(labelValues, func(current float64) float64 { return current + value })
+}
+
+// Inc increments the counter for the provided label values
+func (c *Counter) Inc(labelValues ...string) {
+	c.Add(1, labelValues...)
+}
+
+// Add adds a non-negative value to the counter for the provided label values
+func (c *Counter) Add(value float64, labelValues ...string) {
+	if value < 0 {
+		return
+	}
+	c.update(labelValues, func(current float64) float64 { return current + value })
+}
+
+// Handler returns a http.Handler which writes all registered metrics
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		Write(w) //nolint: errcheck
+	})
+}
+
+// Write writes all registered metrics in the Prometheus text format
+func Write(w io.Writer) error {
+	registryMutex.Lock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	registryMutex.Unlock()
+	sort.Strings(names)
+
+	for _, name := range names {
+		registryMutex.Lock()
+		m := registry[name]
+		registryMutex.Unlock()
+		if err := m.write(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func newMetric(name, help, metricType string, labelNames []string) metric {
+	return metric{
+		name:       name,
+		help:       help,
+		metricType: metricType,
+		labelNames: labelNames,
+		values:     map[string]float64{},
+	}
+}
+
+func register(m *metric) {
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+	if _, exists := registry[m.name]; exists {
+		panic(fmt.Sprintf("metric %s registered twice", m.name))
+	}
+	registry[m.name] = m
+}
+
+func (m *metric) update(labelValues []string, fn func(float64) float64) {
+	if len(labelValues) != len(m.labelNames) {
+		panic(fmt.Sprintf("metric %s expects %d label values, got %d", m.name, len(m.labelNames), len(labelValues)))
+	}
+	key := m.labelString(labelValues)
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.values[key] = fn(m.values[key])
+}
+
+func (m *metric) labelString(labelValues []string) string {
+	if len(labelValues) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(labelValues))
+	for i, value := range labelValues {
+		escaped := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+		pairs[i] = fmt.Sprintf(`%s="%s"`, m.labelNames[i], escaped)
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func (m *metric) write(w io.Writer) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if _, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.metricType); err != nil {
+		return err
+	}
+	if m.collect != nil {
+		m.values[""] = m.collect()
+	}
+
+	keys := m.order
+	if len(keys) == 0 {
+		keys = make([]string, 0, len(m.values))
+		for key := range m.values {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+	}
+
+	for _, key := range keys {
+		value := strconv.FormatFloat(m.values[key], 'f', -1, 64)
+		if _, err := fmt.Fprintf(w, "%s%s %s\n", m.name, key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteFormatsMetrics(t *testing.T) {
+	gauge := NewGauge("test_gauge", "A test gauge", "name")
+	gauge.Set(1547000000, `a"b`)
+	counter := NewCounter("test_counter", "A test counter")
+	counter.Inc()
+	counter.Add(-5)
+
+	var buf bytes.Buffer
+	if err := Write(&buf); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	expected := []string{
+		"# TYPE test_gauge gauge",
+		`test_gauge{name="a\"b"} 1547000000`,
+		"# TYPE test_counter counter",
+		"test_counter 1",
+	}
+	for _, line := range expected {
+		if !strings.Contains(buf.String(), line) {
+			t.Errorf("Expected output to contain %q, got:\n%s", line, buf.String())
+		}
+	}
+}
+
+func TestWriteFormatsHistogramsAndGaugeFuncs(t *testing.T) {
+	histogram := NewHistogram("test_histogram", "A test histogram", 1, 10)
+	histogram.Observe(0.5)
+	histogram.Observe(5)
+	histogram.Observe(50)
+	age := 0.0
+	NewGaugeFunc("test_gauge_func", "A test gauge func", func() float64 { return age })
+	age = 30
+	replaced := NewGaugeFunc("test_gauge_func_replaced", "A test gauge func which is replaced", func() float64 { return 1 })
+	replaced.SetFunc(func() float64 { return 2 })
+
+	var buf bytes.Buffer
+	if err := Write(&buf); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	expected := strings.Join([]string{
+		"# TYPE test_histogram histogram",
+		`test_histogram_bucket{le="1"} 1`,
+		`test_histogram_bucket{le="10"} 2`,
+		`test_histogram_bucket{le="+Inf"} 3`,
+		"test_histogram_sum 55.5",
+		"test_histogram_count 3",
+	}, "\n")
+	if !strings.Contains(buf.String(), expected) {
+		t.Errorf("Expected output to contain:\n%s\ngot:\n%s", expected, buf.String())
+	}
+	if !strings.Contains(buf.String(), "test_gauge_func 30\n") {
+		t.Errorf("Expected the gauge func to be read when written, got:\n%s", buf.String())
+	}
+	if !strings.Contains(buf.String(), "test_gauge_func_replaced 2\n") {
+		t.Errorf("Expected the replaced gauge func to be read when written, got:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/lawrencegripper/azurefrontdooringress/controller"
+	"github.com/lawrencegripper/azurefrontdooringress/sync"
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+)
+
+// supportBundleTimeout bounds each request made to collect the support bundle
+const supportBundleTimeout = 30 * time.Second
+
+// Flags of the support-bundle command
+var (
+	supportBundleOutput   string
+	supportBundlePod      string
+	supportBundleLogLines int64
+	supportBundleAdminURL string
+)
+
+func setSupportBundleFlags(flags *flag.FlagSet, config *utils.Config) {
+	setInteractiveAuthFlags(flags, config)
+	flags.StringVar(&supportBundleOutput, "output", "", "File to write the bundle to, defaults to support-bundle-<time>.zip")
+	flags.StringVar(&supportBundlePod, "pod", "", "Controller pod, 'namespace/name', whose recent logs are included")
+	flags.Int64Var(&supportBundleLogLines, "log-lines", 1000, "Number of the pod's most recent log lines to include")
+	flags.StringVar(&supportBundleAdminURL, "admin-url", "", "URL of the controller's admin API, for example 'http://localhost:8081', whose state is included")
+}
+
+// bundleFile is a file in the support bundle, or the error collecting it
+type bundleFile struct {
+	name string
+	data []byte
+	err  error
+}
+
+// runSupportBundle collects what's needed to debug a report into a zip archive to attach to an issue.
+// Each file is collected on its own so one failing, such as the cluster being unreachable, is recorded in
+// the bundle as '<name>.error.txt' rather than failing the command. Secrets are redacted.
+func runSupportBundle(ctx context.Context, syncConfig utils.Config, args []string) {
+	logger := utils.GetLogger(ctx)
+
+	output := supportBundleOutput
+	if output == "" {
+		output = fmt.Sprintf("support-bundle-%s.zip", time.Now().UTC().Format("20060102T150405Z"))
+	}
+
+	files := []bundleFile{
+		jsonBundleFile("version.json", utils.GetBuildInfo(), nil),
+		// Config is redacted when it's marshalled
+		jsonBundleFile("config.json", syncConfig, nil),
+	}
+	fd, err := sync.Export(ctx, syncConfig)
+	files = append(files, jsonBundleFile("frontdoor.json", fd, err))
+	files = append(files, collectPlan(ctx, syncConfig))
+	if syncConfig.LockingMode != utils.LockingModeNone {
+		locks, err := sync.Locks(ctx, syncConfig)
+		files = append(files, jsonBundleFile("locks.json", locks, err))
+	}
+	if supportBundlePod != "" {
+		files = append(files, collectPodLogs(ctx, syncConfig))
+	}
+	if supportBundleAdminURL != "" {
+		files = append(files, collectAdminState(ctx, syncConfig))
+	}
+
+	if err := writeSupportBundle(output, syncConfig, files); err != nil {
+		logger.WithError(err).Error("Failed to write support bundle")
+		os.Exit(exitFailed)
+	}
+	for _, file := range files {
+		if file.err != nil {
+			logger.WithError(file.err).WithField("file", file.name).Warn("Failed to collect file for support bundle, the error is included instead")
+		}
+	}
+	logger.WithField("output", output).Info("Wrote support bundle, check it before attaching it to an issue")
+}
+
+func jsonBundleFile(name string, value interface{}, err error) bundleFile {
+	if err != nil {
+		return bundleFile{name: name, err: err}
+	}
+	data, err := json.MarshalIndent(value, "", "  ")
+	return bundleFile{name: name, data: data, err: err}
+}
+
+// collectPlan returns the changes a sync of the annotated ingresses would make
+func collectPlan(ctx context.Context, syncConfig utils.Config) bundleFile {
+	ingresses, err := controller.ListAnnotatedIngresses(ctx, syncConfig)
+	if err != nil {
+		return bundleFile{name: "plan.json", err: err}
+	}
+	plan, err := sync.Plan(ctx, syncConfig, ingresses)
+	return jsonBundleFile("plan.json", plan, err)
+}
+
+func collectPodLogs(ctx context.Context, syncConfig utils.Config) bundleFile {
+	parts := strings.SplitN(supportBundlePod, "/", 2)
+	if len(parts) != 2 {
+		return bundleFile{name: "logs.txt", err: fmt.Errorf("--pod %q must be 'namespace/name'", supportBundlePod)}
+	}
+	logs, err := controller.PodLogs(ctx, syncConfig, parts[0], parts[1], supportBundleLogLines)
+	return bundleFile{name: "logs.txt", data: logs, err: err}
+}
+
+// collectAdminState returns the controller's state from its admin API
+func collectAdminState(ctx context.Context, syncConfig utils.Config) bundleFile {
+	const name = "state.json"
+	request, err := http.NewRequest(http.MethodGet, strings.TrimSuffix(supportBundleAdminURL, "/")+"/api/v1/state", nil)
+	if err != nil {
+		return bundleFile{name: name, err: err}
+	}
+	request.Header.Set("Authorization", "Bearer "+syncConfig.AdminToken)
+	ctx, cancel := context.WithTimeout(ctx, supportBundleTimeout)
+	defer cancel()
+	response, err := http.DefaultClient.Do(request.WithContext(ctx))
+	if err != nil {
+		return bundleFile{name: name, err: err}
+	}
+	defer response.Body.Close() //nolint: errcheck
+	data, err := ioutil.ReadAll(response.Body)
+	if err == nil && response.StatusCode != http.StatusOK {
+		err = fmt.Errorf("admin API returned %s", response.Status)
+	}
+	return bundleFile{name: name, data: data, err: err}
+}
+
+// writeSupportBundle writes the files to a zip archive, redacting the secrets in the config and those the
+// Azure SDK reads from the environment
+func writeSupportBundle(output string, syncConfig utils.Config, files []bundleFile) error {
+	archive, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	defer archive.Close() //nolint: errcheck
+
+	writer := zip.NewWriter(archive)
+	for _, file := range files {
+		name, data := file.name, file.data
+		if file.err != nil {
+			name, data = name+".error.txt", []byte(file.err.Error())
+		}
+		data = syncConfig.RedactSecrets(data)
+		for _, env := range []string{"AZURE_CLIENT_SECRET", "AZURE_PASSWORD", "AZURE_CERTIFICATE_PASSWORD"} {
+			if secret := os.Getenv(env); secret != "" {
+				data = []byte(strings.Replace(string(data), secret, "REDACTED", -1))
+			}
+		}
+		entry, err := writer.Create(name)
+		if err != nil {
+			return err
+		}
+		if _, err := entry.Write(data); err != nil {
+			return err
+		}
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+	return archive.Close()
+}
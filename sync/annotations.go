@@ -0,0 +1,35 @@
+package sync
+
+import (
+	"strings"
+
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+)
+
+const (
+	// excludePathsAnnotation is a comma separated list of paths which are never routed through Frontdoor
+	excludePathsAnnotation = "azure/frontdoor-exclude-paths"
+)
+
+// excludedPaths returns the paths listed in the exclude annotation of the ingress
+func excludedPaths(ingress *v1beta1.Ingress) []string {
+	paths := []string{}
+	for _, path := range strings.Split(ingress.Annotations[excludePathsAnnotation], ",") {
+		path = strings.TrimSpace(path)
+		if path != "" {
+			paths = append(paths, strings.TrimSuffix(path, "/"))
+		}
+	}
+	return paths
+}
+
+// isExcludedPath returns true if the path is, or is below, one of the excluded paths
+func isExcludedPath(path string, excluded []string) bool {
+	path = strings.TrimSuffix(path, "*")
+	for _, e := range excluded {
+		if path == e || strings.TrimSuffix(path, "/") == e || strings.HasPrefix(path, e+"/") {
+			return true
+		}
+	}
+	return false
+}
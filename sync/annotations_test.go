@@ -0,0 +1,33 @@
+package sync
+
+import (
+	"testing"
+
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestIsExcludedPath(t *testing.T) {
+	ingress := &v1beta1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Annotations: map[string]string{excludePathsAnnotation: " /internal/, /metrics"},
+		},
+	}
+	excluded := excludedPaths(ingress)
+
+	testCases := map[string]bool{
+		"/internal":        true,
+		"/internal/":       true,
+		"/internal/*":      true,
+		"/internal/health": true,
+		"/metrics":         true,
+		"/internalapi":     false,
+		"/api":             false,
+		"/":                false,
+	}
+	for path, expected := range testCases {
+		if isExcludedPath(path, excluded) != expected {
+			t.Errorf("Expected isExcludedPath(%q) to be %v", path, expected)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+package sync
+
+import (
+	"context"
+
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+)
+
+// Operations recorded in the audit log
+const (
+	mutationReplace        = "replace"
+	mutationCreateOrUpdate = "createOrUpdate"
+	mutationDelete         = "delete"
+)
+
+// auditMutation logs a change the controller made, or tried to make, to Frontdoor with the identity of
+// the instance making it, so the owners of a shared Frontdoor can attribute every change. The resource
+// is the Frontdoor's name or a child resource such as 'routingRules/<name>'.
+func auditMutation(ctx context.Context, config utils.Config, operation, resource string, err error) {
+	logger := utils.GetLogger(ctx).
+		WithField(utils.EventField, "FrontdoorMutation").
+		WithField("identity", config.Identity()).
+		WithField("frontdoor", config.FrontDoorName).
+		WithField("operation", operation).
+		WithField("resource", resource)
+	if err != nil {
+		logger.WithError(err).Warn("Failed to change Frontdoor")
+		return
+	}
+	logger.Info("Changed Frontdoor")
+}
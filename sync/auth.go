@@ -0,0 +1,160 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	gosync "sync"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/adal"
+	"github.com/Azure/go-autorest/autorest/azure"
+	"github.com/Azure/go-autorest/autorest/azure/auth"
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+)
+
+// Auth modes used to authenticate with Azure
+const (
+	authModeFile              = "auth-file"
+	authModeClientCredentials = "client-credentials"
+	authModeClientCertificate = "client-certificate"
+	authModeUsernamePassword  = "username-password"
+	authModeMSI               = "managed-identity"
+	authModeDeviceCode        = "device-code"
+
+	// azureCLIClientID is the public client used by the Azure CLI, used for device code
+	// auth when AZURE_CLIENT_ID isn't set
+	azureCLIClientID = "04b07795-8ddb-461a-bbee-02f9e1bf7b46"
+)
+
+// authorizers caches the authorizer of each identity, so its token is reused across syncs and refreshed
+// ahead of expiry rather than requested again for every client
+var (
+	authorizersMutex gosync.Mutex
+	authorizers      = map[string]autorest.Authorizer{}
+)
+
+// newAuthorizer creates an authorizer for the Azure management API using, in order of preference,
+// interactive device code sign in (when requested), an SDK auth file, service principal env vars,
+// username/password env vars or Managed Service Identity
+func newAuthorizer(ctx context.Context, config utils.Config, resource string) (autorest.Authorizer, error) {
+	logger := utils.GetLogger(ctx)
+
+	mode := authMode(config)
+	logger.WithField("authMode", mode).Info("Authenticating with Azure")
+
+	switch mode {
+	case authModeDeviceCode:
+		clientID := os.Getenv("AZURE_CLIENT_ID")
+		if clientID == "" {
+			clientID = azureCLIClientID
+		}
+		tenantID := os.Getenv("AZURE_TENANT_ID")
+		if tenantID == "" {
+			tenantID = "common"
+		}
+		// Prompts the user to sign in with a code, blocks until they have
+		return auth.NewDeviceFlowConfig(clientID, tenantID).Authorizer()
+	case authModeFile:
+		// The SDK reads the file location from AZURE_AUTH_LOCATION
+		return auth.NewAuthorizerFromFile(azure.PublicCloud.ResourceManagerEndpoint)
+	case authModeClientCredentials:
+		return newClientCredentialsAuthorizer(resource, os.Getenv("AZURE_CLIENT_ID"), os.Getenv("AZURE_CLIENT_SECRET"), os.Getenv("AZURE_TENANT_ID"))
+	case authModeMSI:
+		endpoint, err := adal.GetMSIVMEndpoint()
+		if err != nil {
+			return nil, err
+		}
+		token, err := adal.NewServicePrincipalTokenFromMSI(endpoint, azure.PublicCloud.ResourceManagerEndpoint)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get oauth token from MSI: %v", err)
+		}
+		return newRefreshingAuthorizer(resource, token), nil
+	default:
+		return auth.NewAuthorizerFromEnvironment()
+	}
+}
+
+// newClientCredentialsAuthorizer authenticates as the service principal
+func newClientCredentialsAuthorizer(resource, clientID, clientSecret, tenantID string) (autorest.Authorizer, error) {
+	oauthConfig, err := adal.NewOAuthConfig(azure.PublicCloud.ActiveDirectoryEndpoint, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	token, err := adal.NewServicePrincipalToken(*oauthConfig, clientID, clientSecret, azure.PublicCloud.ResourceManagerEndpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get oauth token from client credentials: %v", err)
+	}
+	return newRefreshingAuthorizer(resource, token), nil
+}
+
+// newServicePrincipalAuthorizer authenticates as the service principal if a client ID is given, used when a
+// resource is in a subscription or tenant the controller's own credentials can't access, otherwise as newAuthorizer.
+// The authorizer is cached for the identity.
+func newServicePrincipalAuthorizer(ctx context.Context, config utils.Config, resource, clientID, clientSecret, tenantID string) (autorest.Authorizer, error) {
+	key := strings.Join([]string{resource, authMode(config), config.AuthFileLocation, clientID, tenantID}, "|")
+	authorizersMutex.Lock()
+	defer authorizersMutex.Unlock()
+	if authorizer, cached := authorizers[key]; cached {
+		return authorizer, nil
+	}
+
+	var authorizer autorest.Authorizer
+	var err error
+	if clientID == "" {
+		authorizer, err = newAuthorizer(ctx, config, resource)
+	} else {
+		utils.GetLogger(ctx).
+			WithField("clientID", clientID).
+			WithField("tenantID", tenantID).
+			Infof("Authenticating with Azure for the %s", resource)
+		authorizer, err = newClientCredentialsAuthorizer(resource, clientID, clientSecret, tenantID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	authorizers[key] = authorizer
+	return authorizer, nil
+}
+
+// authError is returned when an authorizer for Azure can't be created
+type authError struct {
+	error
+}
+
+// IsAuthError returns true if the error is from signing in to Azure, or Azure refusing a request
+// as the credentials aren't valid or aren't allowed to make it
+func IsAuthError(err error) bool {
+	switch err := err.(type) {
+	case authError, adal.TokenRefreshError:
+		return true
+	case *azure.RequestError:
+		return IsAuthError(err.DetailedError)
+	case autorest.DetailedError:
+		if code, ok := err.StatusCode.(int); ok && (code == http.StatusUnauthorized || code == http.StatusForbidden) {
+			return true
+		}
+		return err.Original != nil && IsAuthError(err.Original)
+	}
+	return false
+}
+
+// authMode returns the auth mode which will be used based on the config and environment
+func authMode(config utils.Config) string {
+	switch {
+	case config.UseDeviceCode:
+		return authModeDeviceCode
+	case config.AuthFileLocation != "":
+		return authModeFile
+	case os.Getenv("AZURE_CLIENT_SECRET") != "":
+		return authModeClientCredentials
+	case os.Getenv("AZURE_CERTIFICATE_PATH") != "":
+		return authModeClientCertificate
+	case os.Getenv("AZURE_USERNAME") != "" && os.Getenv("AZURE_PASSWORD") != "":
+		return authModeUsernamePassword
+	default:
+		return authModeMSI
+	}
+}
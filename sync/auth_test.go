@@ -0,0 +1,34 @@
+package sync
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/azure"
+)
+
+func TestIsAuthError(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		expected bool
+	}{
+		{"authorizer", authError{errors.New("no credentials")}, true},
+		{"unauthorized", autorest.DetailedError{StatusCode: http.StatusUnauthorized}, true},
+		{"forbidden request", &azure.RequestError{DetailedError: autorest.DetailedError{StatusCode: http.StatusForbidden}}, true},
+		{"wrapped", autorest.DetailedError{Original: authError{errors.New("no credentials")}}, true},
+		{"not found", autorest.DetailedError{StatusCode: http.StatusNotFound}, false},
+		{"other", fmt.Errorf("failed"), false},
+		{"nil", nil, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if actual := IsAuthError(test.err); actual != test.expected {
+				t.Errorf("Expected %v got %v", test.expected, actual)
+			}
+		})
+	}
+}
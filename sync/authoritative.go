@@ -0,0 +1,60 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/services/preview/frontdoor/mgmt/2018-08-01-preview/frontdoor"
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+)
+
+// NotAuthoritativeError is returned when a cluster other than the authoritative cluster
+// attempts an operation which deletes state shared with other clusters
+type NotAuthoritativeError struct {
+	Operation     string
+	Cluster       string
+	Authoritative string
+}
+
+func (e *NotAuthoritativeError) Error() string {
+	return fmt.Sprintf("%s is only allowed from the authoritative cluster %q, this is cluster %q", e.Operation, e.Authoritative, e.Cluster)
+}
+
+// checkAuthoritative returns a NotAuthoritativeError if the configured cluster can't make destructive changes
+func checkAuthoritative(config utils.Config, operation string) error {
+	if config.Authoritative() {
+		return nil
+	}
+	return &NotAuthoritativeError{Operation: operation, Cluster: config.ClusterName, Authoritative: config.AuthoritativeCluster}
+}
+
+// keepSharedRoutingRules adds back any existing rule missing from the merged rules unless it was created for
+// one of the synced ingresses, so a cluster other than the authoritative cluster never deletes a rule which
+// may belong to another cluster, nor does the merge sync strategy. The legacy rules of this cluster's
+// ingresses are still renamed or removed.
+func (p *Synchronizer) keepSharedRoutingRules(ctx context.Context, fd frontdoor.FrontDoor, existing, merged []frontdoor.RoutingRule, ingresses []*v1beta1.Ingress, result *SyncResult) []frontdoor.RoutingRule {
+	if !p.keepsRoutingRules() {
+		return merged
+	}
+	logger := utils.GetLogger(ctx)
+
+	mergedNames := map[string]bool{}
+	for _, rule := range merged {
+		if rule.Name != nil {
+			mergedNames[*rule.Name] = true
+		}
+	}
+	kept := merged
+	for _, rule := range existing {
+		if rule.Name == nil || mergedNames[*rule.Name] {
+			continue
+		}
+		if rule.RoutingRuleProperties != nil && len(p.legacyRuleOwners(fd, rule, ingresses, result)) > 0 {
+			continue
+		}
+		logger.WithField("ruleName", *rule.Name).Warn(p.keptRuleMessage())
+		kept = append(kept, rule)
+	}
+	return kept
+}
@@ -0,0 +1,66 @@
+package sync
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/preview/frontdoor/mgmt/2018-08-01-preview/frontdoor"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+	log "github.com/sirupsen/logrus"
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+)
+
+func TestFollowerKeepsRoutingRulesOfOtherClusters(t *testing.T) {
+	ctx := utils.WithLogger(context.Background(), log.WithField("test", t.Name()))
+	pool := testBackendPool("cluster1", "10.0.0.1")
+	pool.ID = to.StringPtr("/frontDoors/fd1/backendPools/cluster1")
+	otherPool := testBackendPool("cluster2", "10.1.0.1")
+	otherPool.ID = to.StringPtr("/frontDoors/fd1/backendPools/cluster2")
+	fd := frontdoor.FrontDoor{
+		Properties: &frontdoor.Properties{BackendPools: &[]frontdoor.BackendPool{pool, otherPool}},
+	}
+	app := testIngress("app", "/app")
+	ingresses := []*v1beta1.Ingress{app}
+	result := &SyncResult{RulesHash: map[string]string{"default/app": "hash"}}
+	existing := []frontdoor.RoutingRule{
+		testRoutingRule("Ingress-app", *pool.ID, "/app"),
+		testRoutingRule("Ingress-remote", *otherPool.ID, "/remote"),
+	}
+	// A merge which dropped every existing rule, the legacy rule is this cluster's so can go
+	merged := []frontdoor.RoutingRule{testRoutingRule(routingRuleName(app), *pool.ID, "/app")}
+
+	names := func(rules []frontdoor.RoutingRule) string {
+		names := []string{}
+		for _, rule := range rules {
+			names = append(names, *rule.Name)
+		}
+		return strings.Join(names, ",")
+	}
+
+	follower := &Synchronizer{clusterName: "cluster1", follower: true}
+	kept := follower.keepSharedRoutingRules(ctx, fd, existing, merged, ingresses, result)
+	if expected := routingRuleName(app) + ",Ingress-remote"; names(kept) != expected {
+		t.Errorf("Expected the follower to keep the other cluster's rule, got %s", names(kept))
+	}
+
+	authoritative := &Synchronizer{clusterName: "cluster1"}
+	kept = authoritative.keepSharedRoutingRules(ctx, fd, existing, merged, ingresses, result)
+	if names(kept) != routingRuleName(app) {
+		t.Errorf("Expected the authoritative cluster's rules to be unchanged, got %s", names(kept))
+	}
+}
+
+func TestCheckAuthoritative(t *testing.T) {
+	if err := checkAuthoritative(utils.Config{ClusterName: "cluster1"}, "restoring a snapshot"); err != nil {
+		t.Errorf("Expected every cluster to be authoritative when none is configured, got %v", err)
+	}
+	if err := checkAuthoritative(utils.Config{ClusterName: "cluster1", AuthoritativeCluster: "cluster1"}, "restoring a snapshot"); err != nil {
+		t.Errorf("Expected the authoritative cluster to be allowed, got %v", err)
+	}
+	err := checkAuthoritative(utils.Config{ClusterName: "cluster2", AuthoritativeCluster: "cluster1"}, "restoring a snapshot")
+	if _, ok := err.(*NotAuthoritativeError); !ok {
+		t.Errorf("Expected a NotAuthoritativeError for another cluster, got %v", err)
+	}
+}
@@ -0,0 +1,118 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/azure"
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+)
+
+const (
+	// backendHealthMetric is the Azure Monitor metric with the percentage of successful health probes
+	// from Frontdoor to each backend pool, Frontdoor has no API reporting backend health directly
+	backendHealthMetric = "BackendHealthPercentage"
+	// backendHealthTimespan is how far back the metric is read, it's published every few minutes
+	backendHealthTimespan = 15 * time.Minute
+	metricsAPIVersion     = "2018-01-01"
+)
+
+// metricsResponse is the part of the Azure Monitor metrics response used by the controller
+type metricsResponse struct {
+	Value []struct {
+		Timeseries []struct {
+			Metadatavalues []struct {
+				Name struct {
+					Value string `json:"value"`
+				} `json:"name"`
+				Value string `json:"value"`
+			} `json:"metadatavalues"`
+			Data []struct {
+				TimeStamp string   `json:"timeStamp"`
+				Average   *float64 `json:"average"`
+			} `json:"data"`
+		} `json:"timeseries"`
+	} `json:"value"`
+}
+
+// BackendHealth returns the latest percentage of Frontdoor's health probes which succeeded for each of
+// the cluster's backend pools, read from Azure Monitor. Pools without recent probes are left out.
+func BackendHealth(ctx context.Context, config utils.Config) (map[string]float64, error) {
+	fdClient, err := newFrontDoorsClient(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	resourceID := fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Network/frontDoors/%s",
+		config.FrontDoorSubscription(), config.ResourceGroupName, config.FrontDoorName)
+
+	health, err := queryBackendHealth(ctx, fdClient.Client, fdClient.BaseURI, resourceID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	for pool := range health {
+		if pool != config.ClusterName && !strings.HasPrefix(pool, config.ClusterName+"-") {
+			delete(health, pool)
+		}
+	}
+	return health, nil
+}
+
+// queryBackendHealth reads the backend health metric of the Frontdoor split by backend pool,
+// returning the latest value reported for each
+func queryBackendHealth(ctx context.Context, client autorest.Client, baseURI, resourceID string, now time.Time) (map[string]float64, error) {
+	timespan := fmt.Sprintf("%s/%s", now.Add(-backendHealthTimespan).UTC().Format(time.RFC3339), now.UTC().Format(time.RFC3339))
+	req, err := autorest.Prepare((&http.Request{}).WithContext(ctx),
+		autorest.AsGet(),
+		autorest.WithBaseURL(baseURI),
+		autorest.WithPath(resourceID+"/providers/microsoft.insights/metrics"),
+		autorest.WithQueryParameters(map[string]interface{}{
+			"api-version": metricsAPIVersion,
+			"metricnames": backendHealthMetric,
+			"aggregation": "Average",
+			"timespan":    timespan,
+			// '*' returns a timeseries for each backend pool
+			"$filter": "BackendPool eq '*'",
+		}),
+		client.WithAuthorization())
+	if err != nil {
+		return nil, err
+	}
+	resp, err := autorest.SendWithSender(client, req, autorest.DoRetryForStatusCodes(client.RetryAttempts, client.RetryDuration, autorest.StatusCodesForRetry...))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backend health: %v", err)
+	}
+
+	metrics := metricsResponse{}
+	err = autorest.Respond(resp,
+		client.ByInspecting(),
+		azure.WithErrorUnlessStatusCode(http.StatusOK),
+		autorest.ByUnmarshallingJSON(&metrics),
+		autorest.ByClosing())
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backend health: %v", err)
+	}
+
+	health := map[string]float64{}
+	for _, metric := range metrics.Value {
+		for _, series := range metric.Timeseries {
+			pool := ""
+			for _, metadata := range series.Metadatavalues {
+				if strings.EqualFold(metadata.Name.Value, "BackendPool") {
+					pool = metadata.Value
+				}
+			}
+			// Data is in time order and the latest interval may not have been published yet
+			for i := len(series.Data) - 1; i >= 0; i-- {
+				if series.Data[i].Average != nil {
+					health[pool] = *series.Data[i].Average
+					break
+				}
+			}
+		}
+	}
+	return health, nil
+}
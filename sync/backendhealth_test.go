@@ -0,0 +1,49 @@
+package sync
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest"
+)
+
+func TestQueryBackendHealth(t *testing.T) {
+	var query url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/fd/providers/microsoft.insights/metrics" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		query = r.URL.Query()
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"value":[{"name":{"value":"BackendHealthPercentage"},"timeseries":[
+			{"metadatavalues":[{"name":{"value":"backendpool"},"value":"cluster1"}],"data":[{"timeStamp":"2019-05-01T10:00:00Z","average":100},{"timeStamp":"2019-05-01T10:05:00Z","average":25},{"timeStamp":"2019-05-01T10:10:00Z"}]},
+			{"metadatavalues":[{"name":{"value":"backendpool"},"value":"cluster2"}],"data":[{"timeStamp":"2019-05-01T10:10:00Z"}]}
+		]}]}`)) //nolint: errcheck
+	}))
+	defer server.Close()
+	client := autorest.NewClientWithUserAgent("test")
+	client.Authorizer = autorest.NullAuthorizer{}
+	client.RetryDuration = time.Millisecond
+
+	now := time.Date(2019, 5, 1, 10, 12, 0, 0, time.UTC)
+	health, err := queryBackendHealth(context.Background(), client, server.URL, "/fd", now)
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if expected := map[string]float64{"cluster1": 25}; !reflect.DeepEqual(health, expected) {
+		t.Errorf("Expected the latest health reported for each pool %v, got %v", expected, health)
+	}
+	if query.Get("metricnames") != backendHealthMetric || query.Get("timespan") != "2019-05-01T09:57:00Z/2019-05-01T10:12:00Z" {
+		t.Errorf("Unexpected metrics query %v", query)
+	}
+
+	if _, err := queryBackendHealth(context.Background(), client, server.URL, "/missing", now); err == nil {
+		t.Error("Expected an error when the Frontdoor isn't found")
+	}
+}
@@ -0,0 +1,77 @@
+package sync
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+)
+
+const (
+	// cacheDurationAnnotation sets how long Frontdoor caches responses for the ingress's routes, for example '1h'
+	cacheDurationAnnotation = "azure/frontdoor-cache-duration"
+	// dynamicCompressionAnnotation enables or disables compression of cached responses at the edge,
+	// setting it enables caching for the ingress's routes
+	dynamicCompressionAnnotation = "azure/frontdoor-dynamic-compression"
+	// queryStringCachingAnnotation sets whether the query string is part of the cache key, 'StripAll' or 'StripNone',
+	// setting it enables caching for the ingress's routes
+	queryStringCachingAnnotation = "azure/frontdoor-query-string-caching"
+	// frontdoorAPIVersion is the version of the Frontdoor API used by the controller
+	frontdoorAPIVersion = "2018-08-01-preview"
+)
+
+// routeCacheForIngress returns the caching of the ingress's routes from its annotations,
+// nil means the routes forward requests without caching
+func routeCacheForIngress(ingress *v1beta1.Ingress) (*RouteCache, error) {
+	if value, exists := ingress.Annotations[cacheDurationAnnotation]; exists {
+		duration, err := time.ParseDuration(value)
+		if err != nil || duration <= 0 {
+			return nil, fmt.Errorf("%s: %q must be a positive duration, for example '1h'", cacheDurationAnnotation, value)
+		}
+		// Fail the ingress rather than silently ignoring the setting
+		return nil, fmt.Errorf("%s: setting the cache duration isn't supported by Frontdoor API version %s, cached responses follow the Cache-Control headers sent by the backend", cacheDurationAnnotation, frontdoorAPIVersion)
+	}
+
+	compression, hasCompression := ingress.Annotations[dynamicCompressionAnnotation]
+	queryString, hasQueryString := ingress.Annotations[queryStringCachingAnnotation]
+	if !hasCompression && !hasQueryString {
+		return nil, nil
+	}
+	cache := &RouteCache{}
+
+	if hasCompression {
+		switch strings.ToLower(compression) {
+		case "enabled":
+			cache.DynamicCompression = true
+		case "disabled":
+			cache.DynamicCompression = false
+		default:
+			return nil, fmt.Errorf("%s: %q must be 'enabled' or 'disabled'", dynamicCompressionAnnotation, compression)
+		}
+	}
+
+	if hasQueryString {
+		ignore, err := ignoreQueryString(queryString)
+		if err != nil {
+			return nil, err
+		}
+		cache.IgnoreQueryString = ignore
+	}
+	return cache, nil
+}
+
+// ignoreQueryString parses the query string caching annotation, 'StripAll' ignores the query string
+func ignoreQueryString(value string) (bool, error) {
+	switch strings.ToLower(value) {
+	case "stripall":
+		return true, nil
+	case "stripnone":
+		return false, nil
+	}
+	// Later API versions add include and exclude lists of query parameters
+	if strings.HasPrefix(strings.ToLower(value), "include") || strings.HasPrefix(strings.ToLower(value), "exclude") {
+		return false, fmt.Errorf("%s: %q isn't supported by Frontdoor API version %s, use 'StripAll' or 'StripNone'", queryStringCachingAnnotation, value, frontdoorAPIVersion)
+	}
+	return false, fmt.Errorf("%s: %q must be 'StripAll' or 'StripNone'", queryStringCachingAnnotation, value)
+}
@@ -0,0 +1,66 @@
+package sync
+
+import (
+	"reflect"
+	"testing"
+
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRouteCacheForIngress(t *testing.T) {
+	testCases := []struct {
+		name        string
+		annotations map[string]string
+		expected    *RouteCache
+		expectErr   bool
+	}{
+		{name: "noAnnotations", annotations: map[string]string{}},
+		{name: "invalidDuration", annotations: map[string]string{cacheDurationAnnotation: "an hour"}, expectErr: true},
+		{name: "unsupportedDuration", annotations: map[string]string{cacheDurationAnnotation: "1h"}, expectErr: true},
+		{
+			name:        "compressionEnabled",
+			annotations: map[string]string{dynamicCompressionAnnotation: "Enabled"},
+			expected:    &RouteCache{DynamicCompression: true},
+		},
+		{
+			name:        "compressionDisabled",
+			annotations: map[string]string{dynamicCompressionAnnotation: "disabled"},
+			expected:    &RouteCache{},
+		},
+		{name: "invalidCompression", annotations: map[string]string{dynamicCompressionAnnotation: "yes"}, expectErr: true},
+		{
+			name:        "stripAll",
+			annotations: map[string]string{queryStringCachingAnnotation: "StripAll"},
+			expected:    &RouteCache{IgnoreQueryString: true},
+		},
+		{
+			name: "compressionAndStripNone",
+			annotations: map[string]string{
+				dynamicCompressionAnnotation: "enabled",
+				queryStringCachingAnnotation: "stripnone",
+			},
+			expected: &RouteCache{DynamicCompression: true},
+		},
+		{name: "unsupportedQueryStringList", annotations: map[string]string{queryStringCachingAnnotation: "IncludeSpecifiedQueryStrings"}, expectErr: true},
+		{name: "invalidQueryString", annotations: map[string]string{queryStringCachingAnnotation: "Strip"}, expectErr: true},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			ingress := &v1beta1.Ingress{ObjectMeta: metav1.ObjectMeta{Annotations: test.annotations}}
+			cache, err := routeCacheForIngress(ingress)
+			if test.expectErr {
+				if err == nil {
+					t.Errorf("Expected error got cache %+v", cache)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(cache, test.expected) {
+				t.Errorf("Expected cache %+v got %+v", test.expected, cache)
+			}
+		})
+	}
+}
@@ -0,0 +1,117 @@
+package sync
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/Azure/azure-sdk-for-go/services/preview/frontdoor/mgmt/2018-08-01-preview/frontdoor"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+)
+
+const (
+	// canaryPoolAnnotation names an existing backend pool whose backends receive canary traffic
+	canaryPoolAnnotation = "azure/frontdoor-canary-pool"
+	// canaryWeightAnnotation is the percentage, 1-99, of traffic sent to the canary pool
+	canaryWeightAnnotation = "azure/frontdoor-canary-weight"
+	// maxBackendWeight is the largest weight Frontdoor allows on a backend
+	maxBackendWeight = 1000
+	// canaryPrefix is the start of the name of the backend pool created to split traffic for an ingress
+	canaryPrefix = "Canary-"
+)
+
+// canaryBackendPoolName returns the name of the pool created to split traffic for the ingress,
+// 'Canary-<namespace>-<name>-<hash>'
+func canaryBackendPoolName(ingress *v1beta1.Ingress) string {
+	return ingressResourceName(canaryPrefix, ingress)
+}
+
+// legacyCanaryBackendPoolName returns the name earlier versions of the controller gave the ingress's canary pool
+func legacyCanaryBackendPoolName(ingress *v1beta1.Ingress) string {
+	return canaryPrefix + ingress.Name
+}
+
+// canarySettings returns the canary pool and weight from the ingress annotations,
+// an empty pool name means no canary is configured
+func canarySettings(ingress *v1beta1.Ingress) (string, int, error) {
+	pool := ingress.Annotations[canaryPoolAnnotation]
+	weightValue, hasWeight := ingress.Annotations[canaryWeightAnnotation]
+	if pool == "" {
+		if hasWeight {
+			return "", 0, fmt.Errorf("%s is set without %s", canaryWeightAnnotation, canaryPoolAnnotation)
+		}
+		return "", 0, nil
+	}
+	if !hasWeight {
+		return "", 0, fmt.Errorf("%s is set without %s", canaryPoolAnnotation, canaryWeightAnnotation)
+	}
+	weight, err := strconv.Atoi(weightValue)
+	if err != nil || weight < 1 || weight > 99 {
+		return "", 0, fmt.Errorf("%s: %q must be a percentage between 1 and 99", canaryWeightAnnotation, weightValue)
+	}
+	return pool, weight, nil
+}
+
+// ensureCanaryBackendPool adds or replaces a pool for the ingress containing the backends of the primary
+// pool and the canary pool, weighted so the canary pool's backends receive canaryWeight percent of traffic
+func (p *Synchronizer) ensureCanaryBackendPool(fd *frontdoor.FrontDoor, ingress *v1beta1.Ingress, primaryPoolName, canaryPoolName string, canaryWeight int) (*string, error) {
+	name := canaryBackendPoolName(ingress)
+	if err := utils.ValidateFrontDoorChildName(name); err != nil {
+		return nil, fmt.Errorf("canary backend pool name isn't valid in Frontdoor: %v", err)
+	}
+	if fd.ID == nil {
+		return nil, fmt.Errorf("Frontdoor has no ID, unable to reference backend pool %s", name)
+	}
+
+	primary := findBackendPool(*fd, primaryPoolName)
+	if primary == nil || primary.BackendPoolProperties == nil || primary.Backends == nil || len(*primary.Backends) == 0 {
+		return nil, fmt.Errorf("primary backend pool %s doesn't exist or has no backends", primaryPoolName)
+	}
+	canary := findBackendPool(*fd, canaryPoolName)
+	if canary == nil || canary.BackendPoolProperties == nil || canary.Backends == nil || len(*canary.Backends) == 0 {
+		return nil, fmt.Errorf("%s: backend pool %s doesn't exist or has no backends", canaryPoolAnnotation, canaryPoolName)
+	}
+
+	// Weights are relative across all backends so scale them by the number
+	// of backends in the other pool to keep the split at the requested percentage
+	primaryCount, canaryCount := len(*primary.Backends), len(*canary.Backends)
+	primaryWeight := (100 - canaryWeight) * canaryCount
+	canaryBackendWeight := canaryWeight * primaryCount
+	if primaryWeight > maxBackendWeight || canaryBackendWeight > maxBackendWeight {
+		return nil, fmt.Errorf("too many backends in pools %s and %s to split traffic with Frontdoor's maximum weight of %d", primaryPoolName, canaryPoolName, maxBackendWeight)
+	}
+
+	backends := make([]frontdoor.Backend, 0, primaryCount+canaryCount)
+	for _, backend := range *primary.Backends {
+		backend.Weight = to.Int32Ptr(int32(primaryWeight))
+		backends = append(backends, backend)
+	}
+	for _, backend := range *canary.Backends {
+		backend.Weight = to.Int32Ptr(int32(canaryBackendWeight))
+		backends = append(backends, backend)
+	}
+
+	pool := frontdoor.BackendPool{
+		Name: to.StringPtr(name),
+		BackendPoolProperties: &frontdoor.BackendPoolProperties{
+			Backends:              &backends,
+			LoadBalancingSettings: primary.LoadBalancingSettings,
+			HealthProbeSettings:   primary.HealthProbeSettings,
+		},
+	}
+
+	// The pool is owned by the controller so is replaced on every sync
+	pools := []frontdoor.BackendPool{}
+	for _, existing := range *fd.BackendPools {
+		if existing.Name != nil && *existing.Name == name {
+			continue
+		}
+		pools = append(pools, existing)
+	}
+	pools = append(pools, pool)
+	fd.BackendPools = &pools
+	p.recordIngressPool(name, ingress)
+
+	return to.StringPtr(fmt.Sprintf("%s/backendPools/%s", *fd.ID, name)), nil
+}
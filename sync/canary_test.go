@@ -0,0 +1,155 @@
+package sync
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/preview/frontdoor/mgmt/2018-08-01-preview/frontdoor"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+	log "github.com/sirupsen/logrus"
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func testBackendPool(name string, addresses ...string) frontdoor.BackendPool {
+	backends := []frontdoor.Backend{}
+	for _, address := range addresses {
+		backends = append(backends, frontdoor.Backend{Address: to.StringPtr(address), Weight: to.Int32Ptr(50)})
+	}
+	return frontdoor.BackendPool{
+		Name:                  to.StringPtr(name),
+		BackendPoolProperties: &frontdoor.BackendPoolProperties{Backends: &backends},
+	}
+}
+
+func TestEnsureCanaryBackendPoolWeightsBackends(t *testing.T) {
+	fd := frontdoor.FrontDoor{
+		ID: to.StringPtr("/frontDoors/fd1"),
+		Properties: &frontdoor.Properties{
+			BackendPools: &[]frontdoor.BackendPool{
+				testBackendPool("cluster1", "10.0.0.1", "10.0.0.2"),
+				testBackendPool("canary", "10.1.0.1"),
+			},
+		},
+	}
+	ingress := &v1beta1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name: "app",
+			Annotations: map[string]string{
+				canaryPoolAnnotation:   "canary",
+				canaryWeightAnnotation: "10",
+			},
+		},
+	}
+
+	pool, weight, err := canarySettings(ingress)
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	p := &Synchronizer{clusterName: "cluster1"}
+	id, err := p.ensureCanaryBackendPool(&fd, ingress, "cluster1", pool, weight)
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if *id != "/frontDoors/fd1/backendPools/"+canaryBackendPoolName(ingress) {
+		t.Errorf("Unexpected pool ID %s", *id)
+	}
+
+	canaryPool := findBackendPool(fd, canaryBackendPoolName(ingress))
+	if canaryPool == nil {
+		t.Fatal("Expected canary pool to be added")
+	}
+	var primaryTotal, canaryTotal int32
+	for _, backend := range *canaryPool.Backends {
+		if *backend.Address == "10.1.0.1" {
+			canaryTotal += *backend.Weight
+		} else {
+			primaryTotal += *backend.Weight
+		}
+	}
+	if share := float64(canaryTotal) / float64(primaryTotal+canaryTotal); share != 0.1 {
+		t.Errorf("Expected canary to receive 10%% of traffic, got %v", share)
+	}
+	if *(*findBackendPool(fd, "cluster1").Backends)[0].Weight != 50 {
+		t.Error("Expected primary pool to be unchanged")
+	}
+}
+
+func TestCanaryBackendPoolNameIsUniqueToNamespace(t *testing.T) {
+	app := testIngress("app", "/")
+	other := testIngress("app", "/")
+	other.Namespace = "other"
+	if canaryBackendPoolName(app) == canaryBackendPoolName(other) {
+		t.Errorf("Expected ingresses with the same name in different namespaces to have their own canary pool, got %s", canaryBackendPoolName(app))
+	}
+}
+
+func TestUnusedCanaryPoolsAreRemoved(t *testing.T) {
+	ctx := utils.WithLogger(context.Background(), log.WithField("test", t.Name()))
+	app := testIngress("app", "/app")
+	fd := frontdoor.FrontDoor{Properties: &frontdoor.Properties{BackendPools: &[]frontdoor.BackendPool{
+		testBackendPool("cluster1", "10.0.0.1"),
+		testBackendPool("canary", "10.0.1.1"),
+		testBackendPool(canaryBackendPoolName(app), "10.0.0.1", "10.0.1.1"),
+		testBackendPool("Canary-default-deleted-1a2b3c4d", "10.0.0.1", "10.0.1.1"),
+		testBackendPool("Canary-legacy", "10.0.0.1", "10.0.1.1"),
+	}}}
+	rules := []frontdoor.RoutingRule{
+		testRoutingRule(routingRuleName(app), "/frontDoors/fd1/backendPools/"+canaryBackendPoolName(app), "/app"),
+		// Bound to the pool earlier versions created, Frontdoor's IDs may differ in case
+		testRoutingRule("Ingress-default-legacy", "/frontDoors/fd1/backendPools/canary-legacy", "/legacy"),
+	}
+
+	p := &Synchronizer{clusterName: "cluster1", ingressPools: &ingressPools{pools: map[string]string{
+		canaryBackendPoolName(app):        "default/app",
+		"Canary-default-deleted-1a2b3c4d": "default/deleted",
+		"Canary-default-gone-1a2b3c4d":    "default/gone",
+	}}}
+	p.removeUnusedIngressPools(ctx, &fd, rules)
+	kept := []string{}
+	for _, pool := range *fd.BackendPools {
+		kept = append(kept, *pool.Name)
+	}
+	if len(kept) != 4 || findBackendPool(fd, "Canary-default-deleted-1a2b3c4d") != nil {
+		t.Errorf("Expected only the canary pool created for an ingress which no rule uses to be removed, got %v", kept)
+	}
+	// The removed pool is forgotten once the update has removed it
+	if !p.isIngressPool("Canary-default-deleted-1a2b3c4d") || p.isIngressPool("Canary-default-gone-1a2b3c4d") {
+		t.Errorf("Expected only the pool which no longer exists to be forgotten, got %v", p.ingressPools.pools)
+	}
+	p.removeUnusedIngressPools(ctx, &fd, rules)
+	if p.isIngressPool("Canary-default-deleted-1a2b3c4d") || !p.isIngressPool(canaryBackendPoolName(app)) {
+		t.Errorf("Expected the removed pool to be forgotten, got %v", p.ingressPools.pools)
+	}
+}
+
+func TestCanaryPoolsAddedByUsersAreKept(t *testing.T) {
+	ctx := utils.WithLogger(context.Background(), log.WithField("test", t.Name()))
+	fd := frontdoor.FrontDoor{
+		ID: to.StringPtr("/frontDoors/fd1"),
+		Properties: &frontdoor.Properties{BackendPools: &[]frontdoor.BackendPool{
+			testBackendPool("cluster1", "10.0.0.1"),
+			testBackendPool("Canary-shop", "10.0.1.1"),
+		}},
+	}
+	app := testIngress("app", "/app")
+	app.Annotations = map[string]string{canaryPoolAnnotation: "Canary-shop", canaryWeightAnnotation: "10"}
+
+	store := &fakeProtectedRulesStore{}
+	p := &Synchronizer{clusterName: "cluster1", ingressPools: &ingressPools{store: store, pools: map[string]string{}}}
+	poolID, err := p.ensureCanaryBackendPool(&fd, app, "cluster1", "Canary-shop", 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	rules := []frontdoor.RoutingRule{testRoutingRule(routingRuleName(app), *poolID, "/app")}
+	p.removeUnusedIngressPools(ctx, &fd, rules)
+	if findBackendPool(fd, "Canary-shop") == nil || findBackendPool(fd, canaryBackendPoolName(app)) == nil {
+		t.Error("Expected the pool the canary annotation names to be kept though no rule uses it")
+	}
+
+	p.commitIngressPools(ctx)
+	if store.saved[canaryBackendPoolName(app)] != "default/app" || len(store.saved) != 1 {
+		t.Errorf("Expected only the canary pool created for the ingress to be recorded, got %v", store.saved)
+	}
+}
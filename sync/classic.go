@@ -0,0 +1,111 @@
+package sync
+
+import (
+	"github.com/Azure/azure-sdk-for-go/services/preview/frontdoor/mgmt/2018-08-01-preview/frontdoor"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+// classicRoutingRule translates the route to a classic Frontdoor routing rule sending its traffic
+// from the frontend to the backend pool
+func classicRoutingRule(route Route, backendPoolID, frontendID *string) frontdoor.RoutingRule {
+	protocols := []frontdoor.Protocol{}
+	for _, protocol := range route.Protocols {
+		protocols = append(protocols, frontdoor.Protocol(protocol))
+	}
+	paths := append([]string{}, route.Paths...)
+	enabledState := frontdoor.EnabledStateEnumDisabled
+	if route.Enabled {
+		enabledState = frontdoor.EnabledStateEnumEnabled
+	}
+	return frontdoor.RoutingRule{
+		Name: to.StringPtr(route.Name),
+		RoutingRuleProperties: &frontdoor.RoutingRuleProperties{
+			AcceptedProtocols: &protocols,
+			BackendPool: &frontdoor.SubResource{
+				ID: backendPoolID,
+			},
+			PatternsToMatch:    &paths,
+			EnabledState:       enabledState,
+			CacheConfiguration: classicCacheConfiguration(route.Cache),
+			FrontendEndpoints: &[]frontdoor.SubResource{
+				{
+					ID: frontendID,
+				},
+			},
+		},
+	}
+}
+
+// classicCacheConfiguration translates the route's caching, nil forwards requests without caching.
+// Both settings are set explicitly so the rule read back from Frontdoor matches.
+func classicCacheConfiguration(cache *RouteCache) *frontdoor.CacheConfiguration {
+	if cache == nil {
+		return nil
+	}
+	config := &frontdoor.CacheConfiguration{
+		DynamicCompression:           frontdoor.DynamicCompressionEnabledDisabled,
+		QueryParameterStripDirective: frontdoor.StripNone,
+	}
+	if cache.DynamicCompression {
+		config.DynamicCompression = frontdoor.DynamicCompressionEnabledEnabled
+	}
+	if cache.IgnoreQueryString {
+		config.QueryParameterStripDirective = frontdoor.StripAll
+	}
+	return config
+}
+
+// classicBackend applies the cluster backend to a backend in a pool, the existing backend with the same
+// address if there is one so its other settings, such as its host header, are kept
+func classicBackend(existing *frontdoor.Backend, backend ClusterBackend, priority int32) frontdoor.Backend {
+	updated := frontdoor.Backend{
+		Address:      to.StringPtr(backend.Address),
+		EnabledState: frontdoor.EnabledStateEnumEnabled,
+	}
+	if existing != nil {
+		updated = *existing
+	}
+	updated.HTTPPort = to.Int32Ptr(DefaultHTTPPort)
+	if backend.HTTPPort != 0 {
+		updated.HTTPPort = to.Int32Ptr(backend.HTTPPort)
+	}
+	updated.HTTPSPort = to.Int32Ptr(DefaultHTTPSPort)
+	if backend.HTTPSPort != 0 {
+		updated.HTTPSPort = to.Int32Ptr(backend.HTTPSPort)
+	}
+	updated.Weight = to.Int32Ptr(backend.Weight)
+	updated.Priority = to.Int32Ptr(priority)
+	return updated
+}
+
+// classicFrontendEndpoint translates the frontend to a classic Frontdoor frontend endpoint
+func classicFrontendEndpoint(frontend Frontend, id *string) frontdoor.FrontendEndpoint {
+	return frontdoor.FrontendEndpoint{
+		ID:   id,
+		Name: to.StringPtr(frontend.Name),
+		FrontendEndpointProperties: &frontdoor.FrontendEndpointProperties{
+			HostName:                    to.StringPtr(frontend.HostName),
+			SessionAffinityEnabledState: frontdoor.SessionAffinityEnabledStateDisabled,
+			SessionAffinityTTLSeconds:   to.Int32Ptr(0),
+		},
+	}
+}
+
+// routeFromRoutingRule translates a classic routing rule back to a route, for rules read from Frontdoor.
+// The route's host isn't known as the rule only references its frontends.
+func routeFromRoutingRule(rule frontdoor.RoutingRule) Route {
+	route := Route{Name: to.String(rule.Name), Enabled: true}
+	if rule.RoutingRuleProperties == nil {
+		return route
+	}
+	route.Paths = sortedStrings(rule.PatternsToMatch)
+	route.Protocols = protocolStrings(rule.AcceptedProtocols)
+	route.Enabled = rule.EnabledState != frontdoor.EnabledStateEnumDisabled
+	if cache := rule.CacheConfiguration; cache != nil {
+		route.Cache = &RouteCache{
+			DynamicCompression: cache.DynamicCompression == frontdoor.DynamicCompressionEnabledEnabled,
+			IgnoreQueryString:  cache.QueryParameterStripDirective == frontdoor.StripAll,
+		}
+	}
+	return route
+}
@@ -0,0 +1,122 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/Azure/azure-sdk-for-go/services/preview/frontdoor/mgmt/2018-08-01-preview/frontdoor"
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/azure"
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+)
+
+// newFrontDoorsClient creates an authorized client for the Frontdoor API
+func newFrontDoorsClient(ctx context.Context, config utils.Config) (frontdoor.FrontDoorsClient, error) {
+	fdClient := frontdoor.NewFrontDoorsClient(config.FrontDoorSubscription())
+	fdClient.AddToUserAgent(utils.UserAgent()) //nolint: errcheck
+
+	fdClient.RequestInspector = withSyncClientID()
+	if config.DebugAPICalls {
+		// Log the request after the client request ID is set so it's in the dump
+		fdClient.RequestInspector = func(p autorest.Preparer) autorest.Preparer {
+			return logRequest()(withSyncClientID()(p))
+		}
+		fdClient.ResponseInspector = logResponse()
+	}
+
+	switch config.APIRecordMode {
+	case utils.APIRecordModeRecord:
+		if err := ensureRecordingDir(config.APIRecordingDir); err != nil {
+			return fdClient, err
+		}
+		record := recordResponse(config.APIRecordingDir)
+		if logged := fdClient.ResponseInspector; logged != nil {
+			fdClient.ResponseInspector = func(r autorest.Responder) autorest.Responder {
+				return logged(record(r))
+			}
+		} else {
+			fdClient.ResponseInspector = record
+		}
+	case utils.APIRecordModeReplay:
+		// Replayed responses don't need credentials
+		sender, err := newReplaySender(config.APIRecordingDir)
+		if err != nil {
+			return fdClient, err
+		}
+		fdClient.Sender = sender
+		fdClient.Authorizer = autorest.NullAuthorizer{}
+		return fdClient, nil
+	}
+
+	// create an authorizer from the Frontdoor's service principal, if it has its own, otherwise
+	// from an auth file, env vars or Azure Managed Service Idenity
+	authorizer, err := newServicePrincipalAuthorizer(ctx, config, "Frontdoor", config.FrontDoorClientID, config.FrontDoorClientSecret, config.FrontDoorTenantID)
+	if err != nil {
+		return fdClient, authError{fmt.Errorf("failed to create Azure authorizer: %+v", err)}
+	}
+	fdClient.Authorizer = authorizer
+
+	return fdClient, nil
+}
+
+// withSyncClientID sends the ID of the sync cycle the request is part of as its client request ID,
+// so Azure's logs for the request can be matched to the controller's logs for the cycle
+func withSyncClientID() autorest.PrepareDecorator {
+	return func(p autorest.Preparer) autorest.Preparer {
+		return autorest.PreparerFunc(func(r *http.Request) (*http.Request, error) {
+			r, err := p.Prepare(r)
+			if err != nil || r == nil {
+				return r, err
+			}
+			syncID := utils.GetSyncID(r.Context())
+			if syncID == "" {
+				return r, nil
+			}
+			if r.Header == nil {
+				r.Header = http.Header{}
+			}
+			r.Header.Set(azure.HeaderClientID, syncID)
+			r.Header.Set(azure.HeaderReturnClientID, "true")
+			return r, nil
+		})
+	}
+}
+
+// findBackendPool returns the backend pool with the given name or nil if it doesn't exist
+func findBackendPool(fd frontdoor.FrontDoor, name string) *frontdoor.BackendPool {
+	if fd.BackendPools == nil {
+		return nil
+	}
+	for i, pool := range *fd.BackendPools {
+		if pool.Name != nil && *pool.Name == name {
+			return &(*fd.BackendPools)[i]
+		}
+	}
+	return nil
+}
+
+// findFrontendEndpoint returns the frontend endpoint with the given hostname or nil if it doesn't exist
+func findFrontendEndpoint(fd frontdoor.FrontDoor, hostname string) *frontdoor.FrontendEndpoint {
+	if fd.FrontendEndpoints == nil {
+		return nil
+	}
+	for i, fe := range *fd.FrontendEndpoints {
+		if fe.HostName != nil && *fe.HostName == hostname {
+			return &(*fd.FrontendEndpoints)[i]
+		}
+	}
+	return nil
+}
+
+// checkRequiredResources ensures the Frontdoor has the backend pool and frontend endpoint
+// the controller requires, these aren't created by the controller
+func checkRequiredResources(fd frontdoor.FrontDoor, config utils.Config) error {
+	if findBackendPool(fd, config.ClusterName) == nil {
+		return fmt.Errorf("Frontdoor instance doesn't have a backendPool for cluster, require a configured pool named %s to exist", config.ClusterName)
+	}
+	if findFrontendEndpoint(fd, config.FrontDoorHostname) == nil {
+		return fmt.Errorf("Frontdoor instance doesn't have a frontend which matches the provided hostname, require a configured frontend named %s to exist", config.FrontDoorHostname)
+	}
+	return nil
+}
@@ -0,0 +1,32 @@
+package sync
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/azure"
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+)
+
+func TestWithSyncClientIDSendsSyncIDAsClientRequestID(t *testing.T) {
+	preparer := withSyncClientID()(autorest.CreatePreparer())
+
+	ctx := utils.WithSyncID(context.Background(), "0f39878c-5f76-4db8-a25d-61d2c193c3ca")
+	r, err := preparer.Prepare((&http.Request{}).WithContext(ctx))
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if id := r.Header.Get(azure.HeaderClientID); id != "0f39878c-5f76-4db8-a25d-61d2c193c3ca" {
+		t.Errorf("Expected the sync ID to be sent as the client request ID, got %q", id)
+	}
+
+	r, err = preparer.Prepare((&http.Request{}).WithContext(context.Background()))
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if id := r.Header.Get(azure.HeaderClientID); id != "" {
+		t.Errorf("Expected no client request ID outside a sync cycle, got %q", id)
+	}
+}
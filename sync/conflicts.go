@@ -0,0 +1,83 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	gosync "sync"
+
+	"github.com/Azure/azure-sdk-for-go/services/preview/frontdoor/mgmt/2018-08-01-preview/frontdoor"
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+	azlock "github.com/lawrencegripper/goazurelocking"
+)
+
+// newLocalLock returns a lock held within the process instead of in the storage account, for
+// LOCKING_MODE=none, so syncs from the same controller still don't overlap. It can't be lost.
+func newLocalLock() func() (*azlock.Lock, error) {
+	mutex := &gosync.Mutex{}
+	return func() (*azlock.Lock, error) {
+		mutex.Lock()
+		released := false
+		return &azlock.Lock{
+			Renew: func() error { return nil },
+			Unlock: func() error {
+				if released {
+					return errors.New("lock already released")
+				}
+				released = true
+				mutex.Unlock()
+				return nil
+			},
+		}, nil
+	}
+}
+
+// statusFields are the read-only fields Frontdoor reports the progress of changes in, which change while
+// an earlier update, such as the controller's own, is still being applied
+var statusFields = map[string]bool{
+	"provisioningState":               true,
+	"resourceState":                   true,
+	"customHttpsProvisioningState":    true,
+	"customHttpsProvisioningSubstate": true,
+}
+
+// withoutStatusFields removes the status fields from the JSON tree of a Frontdoor
+func withoutStatusFields(tree interface{}) interface{} {
+	switch value := tree.(type) {
+	case map[string]interface{}:
+		for key, child := range value {
+			if statusFields[key] {
+				delete(value, key)
+				continue
+			}
+			value[key] = withoutStatusFields(child)
+		}
+	case []interface{}:
+		for i, child := range value {
+			value[i] = withoutStatusFields(child)
+		}
+	}
+	return tree
+}
+
+// checkForConflicts reads the Frontdoor again and returns an error if it differs from the state the
+// sync started from, so an update made by someone else while the rules were generated isn't overwritten.
+// Frontdoor API version 2018-08-01-preview doesn't return an ETag so the whole configuration is compared,
+// other than the status fields.
+func (p *Synchronizer) checkForConflicts(ctx context.Context, read frontdoor.FrontDoor) error {
+	current, err := p.getCurrentState(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read Frontdoor to check it hasn't changed since the sync started: %v", err)
+	}
+	diff := Diff{}
+	diffTree("", withoutStatusFields(toJSONTree(read)), withoutStatusFields(toJSONTree(current)), &diff)
+	diffs := diff.Strings()
+	if len(diffs) == 0 {
+		return nil
+	}
+	updateConflicts.Inc()
+	utils.GetLogger(ctx).WithField(utils.EventField, "UpdateConflict").WithField("changes", diffs).
+		Warn("Frontdoor changed while the sync was running, not updating it")
+	return fmt.Errorf("Frontdoor changed while the sync was running, not updating it so the change isn't overwritten: %s", strings.Join(diffs, "; "))
+}
@@ -3,11 +3,34 @@ package sync
 import (
 	"net/http"
 	"net/http/httputil"
+	"regexp"
 
 	"github.com/Azure/go-autorest/autorest"
 	log "github.com/sirupsen/logrus"
 )
 
+const redacted = "REDACTED"
+
+var (
+	// secretHeaderRegex matches headers which carry credentials
+	secretHeaderRegex = regexp.MustCompile(`(?im)^(Authorization|x-ms-authorization-auxiliary|x-ms-copy-source-authorization):.*$`)
+	// sasSignatureRegex matches the signature of a SAS token in a URL or body
+	sasSignatureRegex = regexp.MustCompile(`(?i)([?&]sig=)[^&\s"']+`)
+	// tokenFieldRegex matches OAuth tokens and secrets in form or JSON bodies
+	tokenFieldRegex = regexp.MustCompile(`(?i)("?(?:access_token|refresh_token|client_secret|password)"?\s*[:=]\s*"?)[^&\s"]+`)
+	// storageKeyRegex matches Azure Storage account keys, 64 random bytes encoded as base64
+	storageKeyRegex = regexp.MustCompile(`[A-Za-z0-9+/]{86}==`)
+)
+
+// redactDump removes credentials from a dumped request or response so it can be logged
+func redactDump(dump []byte) string {
+	dump = secretHeaderRegex.ReplaceAll(dump, []byte("$1: "+redacted))
+	dump = sasSignatureRegex.ReplaceAll(dump, []byte("${1}"+redacted))
+	dump = tokenFieldRegex.ReplaceAll(dump, []byte("${1}"+redacted))
+	dump = storageKeyRegex.ReplaceAll(dump, []byte(redacted))
+	return string(dump)
+}
+
 func logRequest() autorest.PrepareDecorator {
 	return func(p autorest.Preparer) autorest.Preparer {
 		return autorest.PreparerFunc(func(r *http.Request) (*http.Request, error) {
@@ -16,7 +39,7 @@ func logRequest() autorest.PrepareDecorator {
 				log.Println(err)
 			}
 			dump, _ := httputil.DumpRequestOut(r, true)
-			log.WithField("Request", string(dump)).Debug("Request to AzureFD API")
+			log.WithField("Request", redactDump(dump)).Debug("Request to AzureFD API")
 			return r, err
 		})
 	}
@@ -30,7 +53,7 @@ func logResponse() autorest.RespondDecorator {
 				log.Println(err)
 			}
 			dump, _ := httputil.DumpResponse(r, true)
-			log.WithField("Response", string(dump)).Debug("Response to AzureFD API")
+			log.WithField("Response", redactDump(dump)).Debug("Response to AzureFD API")
 			return err
 		})
 	}
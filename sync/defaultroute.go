@@ -0,0 +1,66 @@
+package sync
+
+import (
+	"context"
+
+	"github.com/Azure/azure-sdk-for-go/services/preview/frontdoor/mgmt/2018-08-01-preview/frontdoor"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+)
+
+// defaultRoutePrefix starts the name of the catch-all routing rule to the cluster's pool
+const defaultRoutePrefix = "Default-"
+
+// defaultRouteName returns the name of the cluster's catch-all routing rule
+func defaultRouteName(clusterName string) string {
+	return defaultRoutePrefix + clusterName
+}
+
+// applyDefaultRoute adds or updates the catch-all '/*' routing rule to the cluster's pool when the
+// default route is enabled, or removes it when it's disabled, so paths no ingress routes are served by
+// the cluster rather than Frontdoor's 404. The rule is left alone if the default route isn't configured.
+func (p *Synchronizer) applyDefaultRoute(ctx context.Context, rules []frontdoor.RoutingRule) []frontdoor.RoutingRule {
+	if p.defaultRoute != utils.DefaultRouteEnabled && p.defaultRoute != utils.DefaultRouteDisabled {
+		return rules
+	}
+	logger := utils.GetLogger(ctx)
+	name := defaultRouteName(p.clusterName)
+
+	applied := make([]frontdoor.RoutingRule, 0, len(rules)+1)
+	exists := false
+	for _, rule := range rules {
+		if rule.Name == nil || *rule.Name != name {
+			applied = append(applied, rule)
+			continue
+		}
+		exists = true
+		if p.defaultRoute == utils.DefaultRouteDisabled {
+			logger.WithField("ruleName", name).Info("Removing default route as it's disabled")
+			continue
+		}
+		applied = append(applied, p.defaultRouteRule())
+	}
+	if !exists && p.defaultRoute == utils.DefaultRouteEnabled {
+		logger.WithField("ruleName", name).Info("Adding default route to the cluster's backend pool")
+		applied = append(applied, p.defaultRouteRule())
+	}
+	return applied
+}
+
+// defaultRouteRule builds the catch-all routing rule from the cluster's frontend to its backend pool
+func (p *Synchronizer) defaultRouteRule() frontdoor.RoutingRule {
+	protocols := []frontdoor.Protocol{}
+	for _, protocol := range p.acceptedProtocols() {
+		protocols = append(protocols, frontdoor.Protocol(protocol))
+	}
+	return frontdoor.RoutingRule{
+		Name: to.StringPtr(defaultRouteName(p.clusterName)),
+		RoutingRuleProperties: &frontdoor.RoutingRuleProperties{
+			AcceptedProtocols: &protocols,
+			BackendPool:       &frontdoor.SubResource{ID: p.backendPool.ID},
+			PatternsToMatch:   &[]string{"/*"},
+			EnabledState:      frontdoor.EnabledStateEnumEnabled,
+			FrontendEndpoints: &[]frontdoor.SubResource{{ID: p.endPoint.ID}},
+		},
+	}
+}
@@ -0,0 +1,72 @@
+package sync
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/preview/frontdoor/mgmt/2018-08-01-preview/frontdoor"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+func TestApplyDefaultRoute(t *testing.T) {
+	ctx := utils.WithLogger(context.Background(), log.WithField("test", t.Name()))
+	p := &Synchronizer{
+		clusterName: "cluster1",
+		backendPool: frontdoor.BackendPool{ID: to.StringPtr("/frontdoors/fd/backendPools/cluster1")},
+		endPoint:    frontdoor.FrontendEndpoint{ID: to.StringPtr("/frontdoors/fd/frontendEndpoints/fd")},
+	}
+	ingressRule := frontdoor.RoutingRule{Name: to.StringPtr("Ingress-default-app-1a2b3c4d")}
+
+	p.defaultRoute = ""
+	if rules := p.applyDefaultRoute(ctx, []frontdoor.RoutingRule{ingressRule}); len(rules) != 1 {
+		t.Errorf("Expected the rules to be unchanged when the default route isn't configured, got %+v", rules)
+	}
+
+	p.defaultRoute = utils.DefaultRouteEnabled
+	rules := p.applyDefaultRoute(ctx, []frontdoor.RoutingRule{ingressRule})
+	if len(rules) != 2 || *rules[1].Name != "Default-cluster1" || (*rules[1].PatternsToMatch)[0] != "/*" ||
+		*rules[1].BackendPool.ID != *p.backendPool.ID || *(*rules[1].FrontendEndpoints)[0].ID != *p.endPoint.ID {
+		t.Errorf("Expected a catch-all rule to the cluster's pool, got %+v", rules)
+	}
+
+	// A rule changed outside the controller is reverted
+	(*rules[1].PatternsToMatch)[0] = "/other/*"
+	rules = p.applyDefaultRoute(ctx, rules)
+	if len(rules) != 2 || (*rules[1].PatternsToMatch)[0] != "/*" {
+		t.Errorf("Expected the default route to be updated, got %+v", rules)
+	}
+
+	p.defaultRoute = utils.DefaultRouteDisabled
+	rules = p.applyDefaultRoute(ctx, rules)
+	if len(rules) != 1 || *rules[0].Name != *ingressRule.Name {
+		t.Errorf("Expected only the default route to be removed, got %+v", rules)
+	}
+}
+
+func TestAcceptedProtocols(t *testing.T) {
+	ctx := utils.WithLogger(context.Background(), log.WithField("test", t.Name()))
+	p := &Synchronizer{
+		clusterName:  "cluster1",
+		backendPool:  frontdoor.BackendPool{ID: to.StringPtr("/frontdoors/fd/backendPools/cluster1")},
+		endPoint:     frontdoor.FrontendEndpoint{ID: to.StringPtr("/frontdoors/fd/frontendEndpoints/fd")},
+		defaultRoute: utils.DefaultRouteEnabled,
+		protocols:    []string{ProtocolHTTPS},
+	}
+	rules, err := p.routingRulesForIngress(testIngress("app", "/app"), p.backendPool.ID, map[string]*string{"": p.endPoint.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules = p.applyDefaultRoute(ctx, rules)
+	for _, rule := range rules {
+		if protocols := *rule.AcceptedProtocols; len(protocols) != 1 || protocols[0] != frontdoor.HTTPS {
+			t.Errorf("Expected %s to only accept HTTPS, got %v", *rule.Name, protocols)
+		}
+	}
+
+	p.protocols = nil
+	if protocols := p.acceptedProtocols(); len(protocols) != 2 {
+		t.Errorf("Expected both protocols to be accepted by default, got %v", protocols)
+	}
+}
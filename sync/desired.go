@@ -0,0 +1,153 @@
+package sync
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	gosync "sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/preview/frontdoor/mgmt/2018-08-01-preview/frontdoor"
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+)
+
+// ruleAnnotations are the ingress annotations read when generating routing rules
+var ruleAnnotations = []string{
+	excludePathsAnnotation,
+	cacheDurationAnnotation,
+	dynamicCompressionAnnotation,
+	queryStringCachingAnnotation,
+	enabledScheduleAnnotation,
+	disabledScheduleAnnotation,
+	UnreadyServicesAnnotation,
+}
+
+// desiredRules holds the routing rules last generated for an ingress
+type desiredRules struct {
+	// fingerprint is a hash of the inputs the rules were generated from
+	fingerprint string
+	rules       []frontdoor.RoutingRule
+	hash        string
+	// verifiedHash is the hash of the rules sent for the ingress which were last
+	// read back from Frontdoor without differences
+	verifiedHash string
+}
+
+// ingressFingerprint returns a hash of everything routingRulesForIngress reads from the ingress
+// along with the backend pool and frontends the rules are bound to, and whether its schedule
+// currently enables them
+func ingressFingerprint(ingress *v1beta1.Ingress, backendPoolID *string, frontendIDs map[string]*string) string {
+	annotations := map[string]string{}
+	for _, name := range ruleAnnotations {
+		if value, exists := ingress.Annotations[name]; exists {
+			annotations[name] = value
+		}
+	}
+	// An invalid schedule fails generating the rules so it doesn't need to be in the fingerprint
+	enabled, _ := scheduledEnabled(ingress, time.Now()) //nolint: errcheck
+	// Errors are ignored as the inputs always marshal
+	data, _ := json.Marshal(struct { //nolint: errcheck
+		Name        string
+		Rules       []v1beta1.IngressRule
+		Annotations map[string]string
+		Pool        *string
+		Frontends   map[string]*string
+		Enabled     bool
+	}{ingress.Name, ingress.Spec.Rules, annotations, backendPoolID, frontendIDs, enabled})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// desiredRulesForIngress returns the routing rules for the ingress, reusing those generated
+// by an earlier sync when the ingress's rules and annotations haven't changed since.
+// It's safe to call concurrently for different ingresses.
+func (p *Synchronizer) desiredRulesForIngress(key string, ingress *v1beta1.Ingress, backendPoolID *string, frontendIDs map[string]*string) (*desiredRules, bool, error) {
+	fingerprint := ingressFingerprint(ingress, backendPoolID, frontendIDs)
+	p.desiredMutex.Lock()
+	cached, exists := p.desired[key]
+	p.desiredMutex.Unlock()
+	if exists && cached.fingerprint == fingerprint {
+		return cached, true, nil
+	}
+
+	rules, err := p.routingRulesForIngress(ingress, backendPoolID, frontendIDs)
+
+	p.desiredMutex.Lock()
+	defer p.desiredMutex.Unlock()
+	if err != nil {
+		delete(p.desired, key)
+		return nil, false, err
+	}
+	desired := &desiredRules{
+		fingerprint: fingerprint,
+		rules:       rules,
+		hash:        hashRoutingRules(rules),
+	}
+	if p.desired == nil {
+		p.desired = map[string]*desiredRules{}
+	}
+	p.desired[key] = desired
+	return desired, false, nil
+}
+
+// pendingIngress is an ingress whose backend pool and frontends have been added to the Frontdoor
+// and the outcome of generating its routing rules
+type pendingIngress struct {
+	key           string
+	ingress       *v1beta1.Ingress
+	backendPoolID *string
+	frontendIDs   map[string]*string
+	desired       *desiredRules
+	cached        bool
+	err           error
+}
+
+// generateDesiredRules generates the routing rules of the pending ingresses, the ingresses
+// of up to p.concurrency namespaces are generated at once
+func (p *Synchronizer) generateDesiredRules(pending []*pendingIngress) {
+	namespaces := []string{}
+	byNamespace := map[string][]*pendingIngress{}
+	for _, ingress := range pending {
+		namespace := ingress.ingress.Namespace
+		if _, exists := byNamespace[namespace]; !exists {
+			namespaces = append(namespaces, namespace)
+		}
+		byNamespace[namespace] = append(byNamespace[namespace], ingress)
+	}
+
+	workers := p.concurrency
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(namespaces) {
+		workers = len(namespaces)
+	}
+
+	queue := make(chan []*pendingIngress)
+	wg := gosync.WaitGroup{}
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for batch := range queue {
+				for _, ingress := range batch {
+					ingress.desired, ingress.cached, ingress.err = p.desiredRulesForIngress(ingress.key, ingress.ingress, ingress.backendPoolID, ingress.frontendIDs)
+				}
+			}
+		}()
+	}
+	for _, namespace := range namespaces {
+		queue <- byNamespace[namespace]
+	}
+	close(queue)
+	wg.Wait()
+}
+
+// forgetDesiredRules drops the cached rules of ingresses which weren't part of the sync
+func (p *Synchronizer) forgetDesiredRules(synced map[string]bool) {
+	for key := range p.desired {
+		if !synced[key] {
+			delete(p.desired, key)
+		}
+	}
+}
@@ -0,0 +1,85 @@
+package sync
+
+import (
+	"testing"
+
+	"github.com/Azure/go-autorest/autorest/to"
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestDesiredRulesForIngressReusesUnchangedRules(t *testing.T) {
+	ingress := &v1beta1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{Name: "app", Namespace: "default", ResourceVersion: "1"},
+		Spec: v1beta1.IngressSpec{
+			Rules: []v1beta1.IngressRule{{
+				IngressRuleValue: v1beta1.IngressRuleValue{HTTP: &v1beta1.HTTPIngressRuleValue{
+					Paths: []v1beta1.HTTPIngressPath{{Path: "/api"}, {Path: "/health"}},
+				}},
+			}},
+		},
+	}
+	poolID := to.StringPtr("/frontDoors/fd1/backendPools/cluster1")
+	frontends := map[string]*string{"": to.StringPtr("/frontDoors/fd1/frontendEndpoints/default")}
+	p := &Synchronizer{}
+
+	first, cached, err := p.desiredRulesForIngress("default/app", ingress, poolID, frontends)
+	if err != nil || cached {
+		t.Fatalf("Expected rules to be generated, cached %v error %+v", cached, err)
+	}
+
+	// Status annotations written after a sync bump the resource version but don't change the rules
+	ingress.ResourceVersion = "2"
+	ingress.Annotations = map[string]string{"azure/frontdoor-rules-hash": first.hash}
+	second, cached, err := p.desiredRulesForIngress("default/app", ingress, poolID, frontends)
+	if err != nil || !cached || second != first {
+		t.Errorf("Expected unchanged rules to be reused, cached %v error %+v", cached, err)
+	}
+
+	ingress.Annotations[excludePathsAnnotation] = "/health"
+	third, cached, err := p.desiredRulesForIngress("default/app", ingress, poolID, frontends)
+	if err != nil || cached || third.hash == first.hash {
+		t.Errorf("Expected rules to be regenerated after the annotations changed, cached %v error %+v", cached, err)
+	}
+
+	p.forgetDesiredRules(map[string]bool{})
+	if len(p.desired) != 0 {
+		t.Error("Expected rules of ingresses no longer synced to be forgotten")
+	}
+}
+
+func TestGenerateDesiredRulesAcrossNamespaces(t *testing.T) {
+	poolID := to.StringPtr("/frontDoors/fd1/backendPools/cluster1")
+	frontends := map[string]*string{"": to.StringPtr("/frontDoors/fd1/frontendEndpoints/default")}
+	p := &Synchronizer{concurrency: 3}
+
+	pending := []*pendingIngress{}
+	for _, namespace := range []string{"team1", "team2", "team3", "team4"} {
+		for _, name := range []string{"app", "broken"} {
+			ingress := testIngress(name, "/"+name)
+			ingress.Namespace = namespace
+			if name == "broken" {
+				ingress = testIngress(name, "no-slash")
+				ingress.Namespace = namespace
+			}
+			pending = append(pending, &pendingIngress{key: namespace + "/" + name, ingress: ingress, backendPoolID: poolID, frontendIDs: frontends})
+		}
+	}
+
+	p.generateDesiredRules(pending)
+
+	for _, ingress := range pending {
+		if ingress.ingress.Name == "broken" {
+			if ingress.err == nil {
+				t.Errorf("Expected %s to fail as its path doesn't start with '/'", ingress.key)
+			}
+			continue
+		}
+		if ingress.err != nil || ingress.desired == nil || p.desired[ingress.key] != ingress.desired {
+			t.Errorf("Expected rules to be generated and cached for %s, got error %+v", ingress.key, ingress.err)
+		}
+	}
+	if len(p.desired) != 4 {
+		t.Errorf("Expected rules to be cached for the 4 valid ingresses, got %d", len(p.desired))
+	}
+}
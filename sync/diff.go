@@ -0,0 +1,182 @@
+package sync
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/preview/frontdoor/mgmt/2018-08-01-preview/frontdoor"
+)
+
+// Kinds of change in a Diff
+const (
+	ChangeAdded    = "added"
+	ChangeRemoved  = "removed"
+	ChangeModified = "modified"
+)
+
+// Change is a single field which differs between two values
+type Change struct {
+	// Path locates the field, for example 'routingRules[Ingress-a].patternsToMatch'. Elements of lists
+	// of resources are identified by their name, ID or address, other elements by their index.
+	Path string      `json:"path"`
+	Kind string      `json:"kind"`
+	From interface{} `json:"from,omitempty"`
+	To   interface{} `json:"to,omitempty"`
+}
+
+// String describes the change on a single line, prefixed with '+', '-' or '~' as in a unified diff
+func (c Change) String() string {
+	switch c.Kind {
+	case ChangeAdded:
+		return fmt.Sprintf("+ %s: %s", c.Path, diffJSON(c.To))
+	case ChangeRemoved:
+		return fmt.Sprintf("- %s: %s", c.Path, diffJSON(c.From))
+	}
+	return fmt.Sprintf("~ %s: %s -> %s", c.Path, diffJSON(c.From), diffJSON(c.To))
+}
+
+// Diff is the changes from one value to another, ordered by path
+type Diff []Change
+
+// String describes each change on its own line
+func (d Diff) String() string {
+	return strings.Join(d.Strings(), "\n")
+}
+
+// Strings describes each change, for log fields and reports listing them separately
+func (d Diff) Strings() []string {
+	lines := make([]string, len(d))
+	for i, change := range d {
+		lines[i] = change.String()
+	}
+	return lines
+}
+
+// DiffFrontDoor returns the changes from one Frontdoor configuration to another
+func DiffFrontDoor(from, to frontdoor.FrontDoor) Diff {
+	return diffValues(from, to)
+}
+
+// diffValues compares the values field by field as they're sent to Azure, so fields the SDK
+// doesn't send are ignored and unset fields match omitted ones
+func diffValues(from, to interface{}) Diff {
+	diff := Diff{}
+	diffTree("", toJSONTree(from), toJSONTree(to), &diff)
+	return diff
+}
+
+func toJSONTree(value interface{}) interface{} {
+	// Errors are ignored as the values compared always marshal
+	data, _ := json.Marshal(value) //nolint: errcheck
+	var tree interface{}
+	json.Unmarshal(data, &tree) //nolint: errcheck
+	return tree
+}
+
+func diffTree(path string, from, to interface{}, diff *Diff) {
+	switch {
+	case reflect.DeepEqual(from, to):
+		return
+	case from == nil:
+		*diff = append(*diff, Change{Path: path, Kind: ChangeAdded, To: to})
+		return
+	case to == nil:
+		*diff = append(*diff, Change{Path: path, Kind: ChangeRemoved, From: from})
+		return
+	}
+
+	fromObject, fromIsObject := from.(map[string]interface{})
+	toObject, toIsObject := to.(map[string]interface{})
+	if fromIsObject && toIsObject {
+		keys := []string{}
+		for key := range fromObject {
+			keys = append(keys, key)
+		}
+		for key := range toObject {
+			if _, exists := fromObject[key]; !exists {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			diffTree(joinDiffPath(path, key), fromObject[key], toObject[key], diff)
+		}
+		return
+	}
+
+	fromList, fromIsList := from.([]interface{})
+	toList, toIsList := to.([]interface{})
+	if fromIsList && toIsList {
+		fromKeys, fromKeyed := listElementKeys(fromList)
+		toKeys, toKeyed := listElementKeys(toList)
+		if fromKeyed && toKeyed {
+			fromByKey, toByKey := map[string]interface{}{}, map[string]interface{}{}
+			keys := []string{}
+			for i, key := range fromKeys {
+				fromByKey[key] = fromList[i]
+				keys = append(keys, key)
+			}
+			for i, key := range toKeys {
+				toByKey[key] = toList[i]
+				if _, exists := fromByKey[key]; !exists {
+					keys = append(keys, key)
+				}
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				diffTree(fmt.Sprintf("%s[%s]", path, key), fromByKey[key], toByKey[key], diff)
+			}
+			return
+		}
+	}
+
+	// Lists of values, such as paths or protocols, are reported as a whole so they're readable
+	*diff = append(*diff, Change{Path: path, Kind: ChangeModified, From: from, To: to})
+}
+
+// joinDiffPath adds the field to the path, the SDK's 'properties' wrappers are left out
+func joinDiffPath(path, key string) string {
+	switch {
+	case key == "properties":
+		return path
+	case path == "":
+		return key
+	}
+	return path + "." + key
+}
+
+// listElementKeys returns a unique key for each element of a list of resources, from the first
+// of their name, ID or address which every element has. ok is false if there isn't one.
+func listElementKeys(list []interface{}) ([]string, bool) {
+	if len(list) == 0 {
+		return nil, true
+	}
+	for _, field := range []string{"name", "id", "address"} {
+		keys := make([]string, 0, len(list))
+		seen := map[string]bool{}
+		for _, element := range list {
+			object, isObject := element.(map[string]interface{})
+			if !isObject {
+				return nil, false
+			}
+			key, isString := object[field].(string)
+			if !isString || key == "" || seen[key] {
+				break
+			}
+			seen[key] = true
+			keys = append(keys, key)
+		}
+		if len(keys) == len(list) {
+			return keys, true
+		}
+	}
+	return nil, false
+}
+
+func diffJSON(value interface{}) string {
+	data, _ := json.Marshal(value) //nolint: errcheck
+	return string(data)
+}
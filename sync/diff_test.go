@@ -0,0 +1,44 @@
+package sync
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/preview/frontdoor/mgmt/2018-08-01-preview/frontdoor"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+func TestDiffFrontDoorDescribesEachChange(t *testing.T) {
+	before := testDifferentialFrontDoor()
+	after, _ := copyFrontDoor(before)
+	(*after.RoutingRules)[0].PatternsToMatch = &[]string{"/a/v2/*"}
+	(*after.BackendPools)[0].Backends = &[]frontdoor.Backend{{Address: to.StringPtr("10.0.0.1"), Weight: to.Int32Ptr(25)}}
+	*after.RoutingRules = (*after.RoutingRules)[:1]
+	*after.FrontendEndpoints = append(*after.FrontendEndpoints, frontdoor.FrontendEndpoint{Name: to.StringPtr("shop")})
+
+	diff := DiffFrontDoor(before, after)
+	expected := []string{
+		`~ backendPools[cluster1].backends[10.0.0.1].weight: 50 -> 25`,
+		`+ frontendEndpoints[shop]: {"name":"shop"}`,
+		`~ routingRules[Ingress-a].patternsToMatch: ["/a/*"] -> ["/a/v2/*"]`,
+		`- routingRules[Ingress-b]: {"name":"Ingress-b","properties":{"patternsToMatch":["/b/*"]}}`,
+	}
+	if len(diff) != len(expected) {
+		t.Fatalf("Expected %d changes, got\n%s", len(expected), diff)
+	}
+	for i, change := range diff.Strings() {
+		if change != expected[i] {
+			t.Errorf("Expected change %q got %q", expected[i], change)
+		}
+	}
+
+	if diff := DiffFrontDoor(before, before); len(diff) != 0 {
+		t.Errorf("Expected no changes comparing a Frontdoor with itself, got\n%s", diff)
+	}
+}
+
+func TestDiffValuesComparesListsWithoutKeysByValue(t *testing.T) {
+	diff := diffValues([]frontdoor.SubResource{{}, {}}, []frontdoor.SubResource{{}})
+	if len(diff) != 1 || diff[0].Path != "" || diff[0].Kind != ChangeModified {
+		t.Errorf("Expected the list to be reported as modified, got %+v", diff)
+	}
+}
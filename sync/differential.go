@@ -0,0 +1,180 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/services/preview/frontdoor/mgmt/2018-08-01-preview/frontdoor"
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+)
+
+// maxDifferentialChanges is the most child resources updated one at a time, each waits for Azure
+// to apply it so beyond this replacing the whole Frontdoor in one update is quicker
+const maxDifferentialChanges = 10
+
+// frontDoorChanges are the backend pools and routing rules which differ between two Frontdoor configurations
+type frontDoorChanges struct {
+	// pools and rules are added or changed
+	pools []frontdoor.BackendPool
+	rules []frontdoor.RoutingRule
+	// deletedRules are the names of rules which were removed
+	deletedRules []string
+}
+
+func (c frontDoorChanges) count() int {
+	return len(c.pools) + len(c.rules) + len(c.deletedRules)
+}
+
+// diffFrontDoor returns the backend pools and routing rules changed from the previous to the desired
+// configuration. ok is false if anything else changed, including a backend pool being removed, as
+// those can only be applied by replacing the whole Frontdoor.
+func diffFrontDoor(previous, desired frontdoor.FrontDoor, clusterName string) (changes frontDoorChanges, ok bool) {
+	if !sameFrontDoorSettings(previous, desired, clusterName) {
+		return frontDoorChanges{}, false
+	}
+
+	previousPools := map[string]frontdoor.BackendPool{}
+	if previous.BackendPools != nil {
+		for _, pool := range *previous.BackendPools {
+			previousPools[*pool.Name] = pool
+		}
+	}
+	if desired.BackendPools != nil {
+		for _, pool := range *desired.BackendPools {
+			if existing, exists := previousPools[*pool.Name]; !exists || len(diffValues(existing, pool)) > 0 {
+				changes.pools = append(changes.pools, pool)
+			}
+			delete(previousPools, *pool.Name)
+		}
+	}
+	if len(previousPools) > 0 {
+		return frontDoorChanges{}, false
+	}
+
+	previousRules := map[string]frontdoor.RoutingRule{}
+	if previous.RoutingRules != nil {
+		for _, rule := range *previous.RoutingRules {
+			previousRules[*rule.Name] = rule
+		}
+	}
+	if desired.RoutingRules != nil {
+		for _, rule := range *desired.RoutingRules {
+			if existing, exists := previousRules[*rule.Name]; !exists || len(diffValues(existing, rule)) > 0 {
+				changes.rules = append(changes.rules, rule)
+			}
+			delete(previousRules, *rule.Name)
+		}
+	}
+	if previous.RoutingRules != nil {
+		// Keep the order rules had in Frontdoor
+		for _, rule := range *previous.RoutingRules {
+			if _, deleted := previousRules[*rule.Name]; deleted {
+				changes.deletedRules = append(changes.deletedRules, *rule.Name)
+			}
+		}
+	}
+	return changes, true
+}
+
+// sameFrontDoorSettings compares everything but the backend pools and routing rules. The controller's
+// tags are set as they would be by a full update, except the cluster and instance tags, which are left
+// alone so clusters sharing a Frontdoor don't force each other into full updates.
+func sameFrontDoorSettings(previous, desired frontdoor.FrontDoor, clusterName string) bool {
+	strip := func(fd frontdoor.FrontDoor) frontdoor.FrontDoor {
+		if fd.Properties != nil {
+			properties := *fd.Properties
+			properties.BackendPools, properties.RoutingRules = nil, nil
+			fd.Properties = &properties
+		}
+		return fd
+	}
+	previous, desired = strip(previous), strip(desired)
+	setManagedTags(&desired, clusterName, "")
+	for _, tag := range []string{clusterTag, instanceTag} {
+		desired.Tags[tag] = previous.Tags[tag]
+		if previous.Tags[tag] == nil {
+			delete(desired.Tags, tag)
+		}
+	}
+	return len(diffValues(previous, desired)) == 0
+}
+
+// applyUpdate updates Frontdoor from the previous configuration, read at the start of the sync, to the
+// desired one. With differential updates only the changed backend pools and routing rules are sent,
+// so a bad change can't affect the rest of the Frontdoor, falling back to replacing the whole Frontdoor
+// when other settings changed, there are too many changes or a child resource update fails. Nothing is
+// sent if nothing changed, otherwise the previous configuration is snapshotted first. It returns true if
+// a change was sent.
+func (p *Synchronizer) applyUpdate(ctx context.Context, previous, desired frontdoor.FrontDoor) (bool, error) {
+	logger := utils.GetLogger(ctx)
+
+	changes, ok := diffFrontDoor(previous, desired, p.clusterName)
+	if ok && changes.count() == 0 {
+		logger.Debug("Nothing changed, not updating Frontdoor")
+		return false, nil
+	}
+	// The snapshot is only saved when there's a change to undo
+	if err := p.saveSnapshot(ctx, previous); err != nil {
+		return false, err
+	}
+
+	if p.updateChildResources != nil {
+		switch {
+		case !ok:
+			logger.Debug("Frontdoor settings other than backend pools and routing rules changed, replacing the whole Frontdoor")
+		case changes.count() > maxDifferentialChanges:
+			logger.WithField("changes", changes.count()).Debug("Too many changes to update backend pools and routing rules individually, replacing the whole Frontdoor")
+		default:
+			err := p.updateChildResources(ctx, changes)
+			if err == nil {
+				return true, nil
+			}
+			// Replacing the whole Frontdoor also applies any changes which were made
+			logger.WithError(err).Warn("Failed to update backend pools and routing rules individually, replacing the whole Frontdoor")
+		}
+	}
+
+	_, err := p.updateState(ctx, desired)
+	return true, err
+}
+
+// updateChildResources applies the changes with the backend pool and routing rule APIs, waiting
+// for each to complete. Pools are updated first as new rules may route to them.
+func updateChildResources(ctx context.Context, fdClient frontdoor.FrontDoorsClient, config utils.Config, changes frontDoorChanges) error {
+	poolsClient := frontdoor.NewBackendPoolsClientWithBaseURI(fdClient.BaseURI, fdClient.SubscriptionID)
+	poolsClient.Client = fdClient.Client
+	rulesClient := frontdoor.NewRoutingRulesClientWithBaseURI(fdClient.BaseURI, fdClient.SubscriptionID)
+	rulesClient.Client = fdClient.Client
+
+	for _, pool := range changes.pools {
+		future, err := poolsClient.CreateOrUpdate(ctx, config.ResourceGroupName, config.FrontDoorName, *pool.Name, pool)
+		if err == nil {
+			err = future.WaitForCompletion(ctx, poolsClient.Client)
+		}
+		auditMutation(ctx, config, mutationCreateOrUpdate, "backendPools/"+*pool.Name, err)
+		if err != nil {
+			return fmt.Errorf("failed to update backend pool %s: %v", *pool.Name, err)
+		}
+	}
+	for _, rule := range changes.rules {
+		future, err := rulesClient.CreateOrUpdate(ctx, config.ResourceGroupName, config.FrontDoorName, *rule.Name, rule)
+		if err == nil {
+			err = future.WaitForCompletion(ctx, rulesClient.Client)
+		}
+		auditMutation(ctx, config, mutationCreateOrUpdate, "routingRules/"+*rule.Name, err)
+		if err != nil {
+			return fmt.Errorf("failed to update routing rule %s: %v", *rule.Name, err)
+		}
+	}
+	for _, name := range changes.deletedRules {
+		future, err := rulesClient.Delete(ctx, config.ResourceGroupName, config.FrontDoorName, name)
+		if err == nil {
+			err = future.WaitForCompletion(ctx, rulesClient.Client)
+		}
+		auditMutation(ctx, config, mutationDelete, "routingRules/"+name, err)
+		if err != nil {
+			return fmt.Errorf("failed to delete routing rule %s: %v", name, err)
+		}
+	}
+	return nil
+}
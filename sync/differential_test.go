@@ -0,0 +1,104 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/preview/frontdoor/mgmt/2018-08-01-preview/frontdoor"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+func testDifferentialFrontDoor() frontdoor.FrontDoor {
+	fd := frontdoor.FrontDoor{Properties: &frontdoor.Properties{
+		BackendPools: &[]frontdoor.BackendPool{testBackendPool("cluster1", "10.0.0.1")},
+		RoutingRules: &[]frontdoor.RoutingRule{
+			{Name: to.StringPtr("Ingress-a"), RoutingRuleProperties: &frontdoor.RoutingRuleProperties{PatternsToMatch: &[]string{"/a/*"}}},
+			{Name: to.StringPtr("Ingress-b"), RoutingRuleProperties: &frontdoor.RoutingRuleProperties{PatternsToMatch: &[]string{"/b/*"}}},
+		},
+		FrontendEndpoints: &[]frontdoor.FrontendEndpoint{{Name: to.StringPtr("default")}},
+	}}
+	setManagedTags(&fd, "cluster2", "cluster2/pod1@dev")
+	return fd
+}
+
+func TestDiffFrontDoor(t *testing.T) {
+	previous := testDifferentialFrontDoor()
+
+	desired, _ := copyFrontDoor(previous)
+	(*desired.RoutingRules)[0].PatternsToMatch = &[]string{"/a/v2/*"}
+	*desired.RoutingRules = append((*desired.RoutingRules)[:1], frontdoor.RoutingRule{Name: to.StringPtr("Ingress-c")})
+	*desired.BackendPools = append(*desired.BackendPools, testBackendPool("cluster1-team-a", "10.0.0.1"))
+
+	changes, ok := diffFrontDoor(previous, desired, "cluster1")
+	if !ok {
+		t.Fatal("Expected only backend pools and routing rules to have changed")
+	}
+	if len(changes.pools) != 1 || *changes.pools[0].Name != "cluster1-team-a" {
+		t.Errorf("Expected the new pool to be changed, got %+v", changes.pools)
+	}
+	if len(changes.rules) != 2 || *changes.rules[0].Name != "Ingress-a" || *changes.rules[1].Name != "Ingress-c" {
+		t.Errorf("Expected the updated and added rules to be changed, got %+v", changes.rules)
+	}
+	if len(changes.deletedRules) != 1 || changes.deletedRules[0] != "Ingress-b" {
+		t.Errorf("Expected the removed rule to be deleted, got %v", changes.deletedRules)
+	}
+
+	unchanged, _ := copyFrontDoor(previous)
+	if changes, ok := diffFrontDoor(previous, unchanged, "cluster1"); !ok || changes.count() != 0 {
+		t.Errorf("Expected no changes from another cluster's tag, got %+v", changes)
+	}
+
+	frontendAdded, _ := copyFrontDoor(previous)
+	*frontendAdded.FrontendEndpoints = append(*frontendAdded.FrontendEndpoints, frontdoor.FrontendEndpoint{Name: to.StringPtr("shop")})
+	if _, ok := diffFrontDoor(previous, frontendAdded, "cluster1"); ok {
+		t.Error("Expected a new frontend to need the whole Frontdoor replaced")
+	}
+
+	poolRemoved, _ := copyFrontDoor(previous)
+	poolRemoved.BackendPools = &[]frontdoor.BackendPool{}
+	if _, ok := diffFrontDoor(previous, poolRemoved, "cluster1"); ok {
+		t.Error("Expected a removed pool to need the whole Frontdoor replaced")
+	}
+}
+
+func TestApplyUpdateFallsBackToFullUpdate(t *testing.T) {
+	ctx := context.Background()
+	previous := testDifferentialFrontDoor()
+	desired, _ := copyFrontDoor(previous)
+	(*desired.RoutingRules)[0].PatternsToMatch = &[]string{"/a/v2/*"}
+
+	fullUpdates, childUpdates := 0, 0
+	var childErr error
+	p := &Synchronizer{
+		clusterName: "cluster1",
+		updateState: func(_ context.Context, fd frontdoor.FrontDoor) (frontdoor.FrontDoor, error) {
+			fullUpdates++
+			return fd, nil
+		},
+		updateChildResources: func(context.Context, frontDoorChanges) error {
+			childUpdates++
+			return childErr
+		},
+	}
+
+	if _, err := p.applyUpdate(ctx, previous, desired); err != nil || fullUpdates != 0 || childUpdates != 1 {
+		t.Errorf("Expected only the changed rule to be updated, got %d full and %d child updates, err %v", fullUpdates, childUpdates, err)
+	}
+	if _, err := p.applyUpdate(ctx, previous, previous); err != nil || fullUpdates != 0 || childUpdates != 1 {
+		t.Errorf("Expected no update without changes, got %d full and %d child updates, err %v", fullUpdates, childUpdates, err)
+	}
+
+	childErr = errors.New("conflict")
+	if _, err := p.applyUpdate(ctx, previous, desired); err != nil || fullUpdates != 1 {
+		t.Errorf("Expected a full update after the child update failed, got %d full updates, err %v", fullUpdates, err)
+	}
+
+	p.updateChildResources = nil
+	if _, err := p.applyUpdate(ctx, previous, desired); err != nil || fullUpdates != 2 {
+		t.Errorf("Expected a full update when differential updates are disabled, got %d full updates, err %v", fullUpdates, err)
+	}
+	if _, err := p.applyUpdate(ctx, previous, previous); err != nil || fullUpdates != 2 {
+		t.Errorf("Expected no update without changes when differential updates are disabled, got %d full updates, err %v", fullUpdates, err)
+	}
+}
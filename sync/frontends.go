@@ -0,0 +1,235 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/preview/frontdoor/mgmt/2018-08-01-preview/frontdoor"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+)
+
+const (
+	// sessionAffinityAnnotation enables or disables session affinity on the frontend endpoints of the
+	// ingress's hosts which the controller manages
+	sessionAffinityAnnotation = "azure/frontdoor-session-affinity"
+	// sessionAffinityTTLAnnotation would set how long session affinity lasts, which isn't supported
+	sessionAffinityTTLAnnotation = "azure/frontdoor-session-affinity-ttl"
+)
+
+// sessionAffinityTTLUnsupported explains why the session affinity TTL annotation can't be used
+var sessionAffinityTTLUnsupported = fmt.Sprintf("setting the session affinity TTL isn't supported by Frontdoor API version %s, which ignores it", frontdoorAPIVersion)
+
+// sessionAffinityForIngress returns whether session affinity is enabled on the frontend endpoints of the
+// ingress's hosts from its annotations, set is false if the frontends' affinity is left as it is
+func sessionAffinityForIngress(ingress *v1beta1.Ingress) (enabled bool, set bool, err error) {
+	if _, exists := ingress.Annotations[sessionAffinityTTLAnnotation]; exists {
+		// Fail the ingress rather than silently ignoring the setting
+		return false, false, fmt.Errorf("%s: %s", sessionAffinityTTLAnnotation, sessionAffinityTTLUnsupported)
+	}
+	value, exists := ingress.Annotations[sessionAffinityAnnotation]
+	if !exists {
+		return false, false, nil
+	}
+	switch strings.ToLower(value) {
+	case "enabled":
+		return true, true, nil
+	case "disabled":
+		return false, true, nil
+	}
+	return false, false, fmt.Errorf("%s: %q must be 'enabled' or 'disabled'", sessionAffinityAnnotation, value)
+}
+
+// applySessionAffinity enables or disables session affinity on the frontend endpoint with the ID, if it's
+// one the controller created for a custom domain, returning true if it changed
+func (p *Synchronizer) applySessionAffinity(fd *frontdoor.FrontDoor, id *string, enabled bool) bool {
+	if id == nil || fd.Properties == nil || fd.FrontendEndpoints == nil {
+		return false
+	}
+	state := frontdoor.SessionAffinityEnabledStateDisabled
+	if enabled {
+		state = frontdoor.SessionAffinityEnabledStateEnabled
+	}
+	for i, frontend := range *fd.FrontendEndpoints {
+		if frontend.ID == nil || !strings.EqualFold(*frontend.ID, *id) {
+			continue
+		}
+		if !p.isCustomDomainFrontend(frontend) || frontend.SessionAffinityEnabledState == state {
+			return false
+		}
+		(*fd.FrontendEndpoints)[i].SessionAffinityEnabledState = state
+		return true
+	}
+	return false
+}
+
+// customDomainFrontendName returns the name of the frontend endpoint created for a custom domain
+func customDomainFrontendName(host string) string {
+	return strings.Replace(host, ".", "-", -1)
+}
+
+// frontendsForIngress returns the ID of the frontend endpoint to bind each host in the ingress's rules to.
+// With custom domains enabled a frontend is added for each host Frontdoor doesn't have one for, once
+// Frontdoor has validated the host's DNS points to it. Otherwise, or for rules without a host, the
+// configured frontend is used. The ingress's session affinity is applied to the frontends of its hosts
+// which the controller manages, it can't be set on the configured or wildcard frontends others share.
+func (p *Synchronizer) frontendsForIngress(ctx context.Context, fd *frontdoor.FrontDoor, ingress *v1beta1.Ingress) (map[string]*string, error) {
+	affinity, setAffinity, err := sessionAffinityForIngress(ingress)
+	if err != nil {
+		return nil, err
+	}
+	if setAffinity && !p.customDomains {
+		return nil, fmt.Errorf("%s requires CUSTOM_DOMAINS as session affinity is set on the frontend endpoints the controller manages for each host",
+			sessionAffinityAnnotation)
+	}
+
+	frontends := map[string]*string{"": p.endPoint.ID}
+	for _, rule := range ingress.Spec.Rules {
+		host := rule.Host
+		if _, exists := frontends[host]; exists {
+			continue
+		}
+		if !p.customDomains {
+			frontends[host] = p.endPoint.ID
+			continue
+		}
+		id, err := p.ensureCustomDomainFrontend(ctx, fd, host)
+		if err != nil {
+			return nil, err
+		}
+		frontends[host] = id
+		if setAffinity && p.applySessionAffinity(fd, id, affinity) {
+			utils.GetLogger(ctx).WithField("host", host).WithField("sessionAffinity", affinity).
+				Info("Setting session affinity of frontend endpoint")
+		}
+	}
+	return frontends, nil
+}
+
+// isWildcardHost returns true for an ingress host matching every subdomain, such as '*.apps.contoso.com'
+func isWildcardHost(host string) bool {
+	return strings.HasPrefix(host, "*.")
+}
+
+// findWildcardFrontendEndpoint returns the frontend endpoint with a wildcard hostname covering the host,
+// for example '*.apps.contoso.com' for 'shop.apps.contoso.com', or nil if there isn't one
+func findWildcardFrontendEndpoint(fd frontdoor.FrontDoor, host string) *frontdoor.FrontendEndpoint {
+	dot := strings.Index(host, ".")
+	if dot < 0 || isWildcardHost(host) {
+		return nil
+	}
+	return findFrontendEndpoint(fd, "*"+host[dot:])
+}
+
+// ensureCustomDomainFrontend returns the ID of the frontend endpoint for the host, adding one if the
+// Frontdoor doesn't have it. A host covered by a wildcard frontend is bound to it. DNS for the host is
+// validated first, as Frontdoor rejects the whole update if any frontend can't be validated.
+func (p *Synchronizer) ensureCustomDomainFrontend(ctx context.Context, fd *frontdoor.FrontDoor, host string) (*string, error) {
+	if existing := findFrontendEndpoint(*fd, host); existing != nil {
+		return existing.ID, nil
+	}
+	if wildcard := findWildcardFrontendEndpoint(*fd, host); wildcard != nil {
+		return wildcard.ID, nil
+	}
+	// Wildcard frontends need a newer Frontdoor API, or the Premium SKU, than the controller uses
+	if isWildcardHost(host) {
+		return nil, fmt.Errorf("wildcard host %s needs a frontend endpoint with hostname %s, which the controller can't create as the Frontdoor API version used (%s) doesn't support wildcard domains, add it to the Frontdoor with the Azure CLI or portal",
+			host, host, frontdoorAPIVersion)
+	}
+
+	name := customDomainFrontendName(host)
+	if err := utils.ValidateFrontDoorChildName(name); err != nil {
+		return nil, fmt.Errorf("frontend endpoint name for host %q isn't valid in Frontdoor: %v", host, err)
+	}
+	if fd.ID == nil {
+		return nil, fmt.Errorf("Frontdoor has no ID, unable to reference frontend endpoint %s", name)
+	}
+
+	validation, err := p.validateCustomDomain(ctx, host)
+	if err != nil {
+		return nil, fmt.Errorf("failed to validate custom domain %s: %v", host, err)
+	}
+	if validation.CustomDomainValidated == nil || !*validation.CustomDomainValidated {
+		return nil, fmt.Errorf("custom domain %s isn't valid for Frontdoor, check it has a CNAME record to %s: %s %s",
+			host, to.String(p.endPoint.HostName), to.String(validation.Reason), to.String(validation.Message))
+	}
+
+	utils.GetLogger(ctx).WithField("host", host).Info("Adding frontend endpoint for custom domain")
+	id := to.StringPtr(*fd.ID + "/frontendEndpoints/" + name)
+	frontend := classicFrontendEndpoint(Frontend{Name: name, HostName: host}, id)
+	if fd.Properties == nil {
+		fd.Properties = &frontdoor.Properties{}
+	}
+	frontends := []frontdoor.FrontendEndpoint{}
+	if fd.FrontendEndpoints != nil {
+		frontends = *fd.FrontendEndpoints
+	}
+	frontends = append(frontends, frontend)
+	fd.FrontendEndpoints = &frontends
+	return id, nil
+}
+
+// isCustomDomainFrontend returns true for a frontend endpoint created by the controller for a custom domain,
+// recognised by its name being the host with '.' replaced by '-'. The configured frontend is never one.
+func (p *Synchronizer) isCustomDomainFrontend(frontend frontdoor.FrontendEndpoint) bool {
+	if frontend.Name == nil || frontend.ID == nil || frontend.FrontendEndpointProperties == nil || frontend.HostName == nil {
+		return false
+	}
+	if p.endPoint.ID != nil && strings.EqualFold(*frontend.ID, *p.endPoint.ID) {
+		return false
+	}
+	return *frontend.Name == customDomainFrontendName(*frontend.HostName)
+}
+
+// removeUnusedFrontends removes the frontend endpoints created for custom domains once no routing rule has
+// been bound to them for the grace period, so the domains of deleted ingresses don't accumulate on the
+// Frontdoor. When each was first seen unused is held in memory so a restart starts its grace period again.
+// Only the authoritative cluster removes them as other clusters' ingresses may still use them.
+func (p *Synchronizer) removeUnusedFrontends(ctx context.Context, fd *frontdoor.FrontDoor, rules []frontdoor.RoutingRule, now time.Time) {
+	if p.unusedFrontendGracePeriod == 0 || p.follower || fd.Properties == nil || fd.FrontendEndpoints == nil {
+		return
+	}
+	logger := utils.GetLogger(ctx)
+
+	used := map[string]bool{}
+	for _, rule := range rules {
+		if rule.RoutingRuleProperties == nil || rule.FrontendEndpoints == nil {
+			continue
+		}
+		for _, frontend := range *rule.FrontendEndpoints {
+			if frontend.ID != nil {
+				used[strings.ToLower(*frontend.ID)] = true
+			}
+		}
+	}
+
+	unused := map[string]time.Time{}
+	kept := []frontdoor.FrontendEndpoint{}
+	for _, frontend := range *fd.FrontendEndpoints {
+		if !p.isCustomDomainFrontend(frontend) || used[strings.ToLower(*frontend.ID)] {
+			kept = append(kept, frontend)
+			continue
+		}
+		since, seen := p.unusedFrontends[*frontend.Name]
+		if !seen {
+			since = now
+			logger.WithField("frontendName", *frontend.Name).
+				WithField("gracePeriod", p.unusedFrontendGracePeriod).
+				Info("Frontend endpoint for custom domain is no longer used, removing it after the grace period")
+		}
+		if now.Sub(since) < p.unusedFrontendGracePeriod {
+			unused[*frontend.Name] = since
+			kept = append(kept, frontend)
+			continue
+		}
+		logger.WithField("frontendName", *frontend.Name).
+			WithField("host", *frontend.HostName).
+			WithField(utils.EventField, "FrontendRemoved").
+			Info("Removing frontend endpoint for custom domain no ingress has used for the grace period")
+	}
+	p.unusedFrontends = unused
+	fd.FrontendEndpoints = &kept
+}
@@ -0,0 +1,257 @@
+package sync
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/preview/frontdoor/mgmt/2018-08-01-preview/frontdoor"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+	log "github.com/sirupsen/logrus"
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestFrontendsForIngress(t *testing.T) {
+	ctx := utils.WithLogger(context.Background(), log.WithField("test", t.Name()))
+	defaultFrontend := frontdoor.FrontendEndpoint{
+		ID:                         to.StringPtr("/frontDoors/fd1/frontendEndpoints/default"),
+		FrontendEndpointProperties: &frontdoor.FrontendEndpointProperties{HostName: to.StringPtr("fd1.azurefd.net")},
+	}
+	validated := []string{}
+	p := &Synchronizer{
+		endPoint:      defaultFrontend,
+		customDomains: true,
+		validateCustomDomain: func(ctx context.Context, host string) (frontdoor.ValidateCustomDomainOutput, error) {
+			validated = append(validated, host)
+			return frontdoor.ValidateCustomDomainOutput{
+				CustomDomainValidated: to.BoolPtr(host != "wrong.example.com"),
+				Reason:                to.StringPtr("NoCnameRecord"),
+			}, nil
+		},
+	}
+	fd := frontdoor.FrontDoor{
+		ID: to.StringPtr("/frontDoors/fd1"),
+		Properties: &frontdoor.Properties{
+			FrontendEndpoints: &[]frontdoor.FrontendEndpoint{
+				defaultFrontend,
+				{
+					ID:                         to.StringPtr("/frontDoors/fd1/frontendEndpoints/existing"),
+					FrontendEndpointProperties: &frontdoor.FrontendEndpointProperties{HostName: to.StringPtr("existing.example.com")},
+				},
+			},
+		},
+	}
+
+	ingress := &v1beta1.Ingress{
+		Spec: v1beta1.IngressSpec{
+			Rules: []v1beta1.IngressRule{{Host: ""}, {Host: "existing.example.com"}, {Host: "new.example.com"}},
+		},
+	}
+	frontends, err := p.frontendsForIngress(ctx, &fd, ingress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"":                     "/frontDoors/fd1/frontendEndpoints/default",
+		"existing.example.com": "/frontDoors/fd1/frontendEndpoints/existing",
+		"new.example.com":      "/frontDoors/fd1/frontendEndpoints/new-example-com",
+	}
+	for host, id := range expected {
+		if to.String(frontends[host]) != id {
+			t.Errorf("Expected host %q to use frontend %s got %s", host, id, to.String(frontends[host]))
+		}
+	}
+	if len(validated) != 1 || validated[0] != "new.example.com" {
+		t.Errorf("Expected only the new host to be validated got %v", validated)
+	}
+	if findFrontendEndpoint(fd, "new.example.com") == nil {
+		t.Error("Expected frontend to be added for new host")
+	}
+
+	wrong := &v1beta1.Ingress{Spec: v1beta1.IngressSpec{Rules: []v1beta1.IngressRule{{Host: "wrong.example.com"}}}}
+	if _, err := p.frontendsForIngress(ctx, &fd, wrong); err == nil {
+		t.Error("Expected error for host which fails validation")
+	}
+	if findFrontendEndpoint(fd, "wrong.example.com") != nil {
+		t.Error("Expected no frontend to be added for host which fails validation")
+	}
+}
+
+func TestFrontendsForWildcardHosts(t *testing.T) {
+	ctx := utils.WithLogger(context.Background(), log.WithField("test", t.Name()))
+	wildcardFrontend := frontdoor.FrontendEndpoint{
+		ID:                         to.StringPtr("/frontDoors/fd1/frontendEndpoints/wildcard-apps"),
+		FrontendEndpointProperties: &frontdoor.FrontendEndpointProperties{HostName: to.StringPtr("*.apps.example.com")},
+	}
+	p := &Synchronizer{
+		endPoint:      frontdoor.FrontendEndpoint{ID: to.StringPtr("/frontDoors/fd1/frontendEndpoints/default")},
+		customDomains: true,
+		validateCustomDomain: func(ctx context.Context, host string) (frontdoor.ValidateCustomDomainOutput, error) {
+			t.Errorf("Expected hosts covered by the wildcard frontend not to be validated, got %s", host)
+			return frontdoor.ValidateCustomDomainOutput{}, nil
+		},
+	}
+	fd := frontdoor.FrontDoor{
+		ID:         to.StringPtr("/frontDoors/fd1"),
+		Properties: &frontdoor.Properties{FrontendEndpoints: &[]frontdoor.FrontendEndpoint{wildcardFrontend}},
+	}
+
+	ingress := &v1beta1.Ingress{
+		Spec: v1beta1.IngressSpec{
+			Rules: []v1beta1.IngressRule{{Host: "*.apps.example.com"}, {Host: "shop.apps.example.com"}},
+		},
+	}
+	frontends, err := p.frontendsForIngress(ctx, &fd, ingress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, host := range []string{"*.apps.example.com", "shop.apps.example.com"} {
+		if to.String(frontends[host]) != *wildcardFrontend.ID {
+			t.Errorf("Expected host %q to use the wildcard frontend got %s", host, to.String(frontends[host]))
+		}
+	}
+	if len(*fd.FrontendEndpoints) != 1 {
+		t.Errorf("Expected no frontend to be added, got %+v", *fd.FrontendEndpoints)
+	}
+
+	missing := &v1beta1.Ingress{Spec: v1beta1.IngressSpec{Rules: []v1beta1.IngressRule{{Host: "*.other.example.com"}}}}
+	if _, err := p.frontendsForIngress(ctx, &fd, missing); err == nil {
+		t.Error("Expected an error for a wildcard host without a wildcard frontend")
+	}
+}
+
+func TestRemoveUnusedFrontends(t *testing.T) {
+	ctx := utils.WithLogger(context.Background(), log.WithField("test", t.Name()))
+	frontend := func(name, host string) frontdoor.FrontendEndpoint {
+		return frontdoor.FrontendEndpoint{
+			ID:                         to.StringPtr("/frontDoors/fd1/frontendEndpoints/" + name),
+			Name:                       to.StringPtr(name),
+			FrontendEndpointProperties: &frontdoor.FrontendEndpointProperties{HostName: to.StringPtr(host)},
+		}
+	}
+	defaultFrontend := frontend("fd1-azurefd-net", "fd1.azurefd.net")
+	p := &Synchronizer{endPoint: defaultFrontend, customDomains: true, unusedFrontendGracePeriod: time.Hour}
+	fd := frontdoor.FrontDoor{
+		Properties: &frontdoor.Properties{
+			FrontendEndpoints: &[]frontdoor.FrontendEndpoint{
+				defaultFrontend,
+				frontend("used-example-com", "used.example.com"),
+				frontend("unused-example-com", "unused.example.com"),
+				frontend("manual", "manual.example.com"),
+			},
+		},
+	}
+	rules := []frontdoor.RoutingRule{{
+		Name: to.StringPtr("Ingress-default-used"),
+		RoutingRuleProperties: &frontdoor.RoutingRuleProperties{
+			FrontendEndpoints: &[]frontdoor.SubResource{{ID: to.StringPtr("/frontDoors/fd1/frontendEndpoints/USED-example-com")}},
+		},
+	}}
+	names := func() []string {
+		names := []string{}
+		for _, frontend := range *fd.FrontendEndpoints {
+			names = append(names, *frontend.Name)
+		}
+		return names
+	}
+
+	start := time.Now()
+	p.removeUnusedFrontends(ctx, &fd, rules, start)
+	p.removeUnusedFrontends(ctx, &fd, rules, start.Add(59*time.Minute))
+	if len(*fd.FrontendEndpoints) != 4 {
+		t.Errorf("Expected the unused frontend to be kept during the grace period got %v", names())
+	}
+
+	p.removeUnusedFrontends(ctx, &fd, rules, start.Add(time.Hour))
+	expected := []string{"fd1-azurefd-net", "used-example-com", "manual"}
+	if !reflect.DeepEqual(names(), expected) {
+		t.Errorf("Expected frontends %v got %v", expected, names())
+	}
+	if len(p.unusedFrontends) != 0 {
+		t.Errorf("Expected removed frontends to be forgotten got %v", p.unusedFrontends)
+	}
+}
+
+func TestRemoveUnusedFrontendsRestartsGracePeriodWhenUsedAgain(t *testing.T) {
+	ctx := utils.WithLogger(context.Background(), log.WithField("test", t.Name()))
+	unused := frontdoor.FrontendEndpoint{
+		ID:                         to.StringPtr("/frontDoors/fd1/frontendEndpoints/app-example-com"),
+		Name:                       to.StringPtr("app-example-com"),
+		FrontendEndpointProperties: &frontdoor.FrontendEndpointProperties{HostName: to.StringPtr("app.example.com")},
+	}
+	p := &Synchronizer{customDomains: true, unusedFrontendGracePeriod: time.Hour}
+	fd := frontdoor.FrontDoor{Properties: &frontdoor.Properties{FrontendEndpoints: &[]frontdoor.FrontendEndpoint{unused}}}
+	rule := frontdoor.RoutingRule{
+		RoutingRuleProperties: &frontdoor.RoutingRuleProperties{FrontendEndpoints: &[]frontdoor.SubResource{{ID: unused.ID}}},
+	}
+
+	start := time.Now()
+	p.removeUnusedFrontends(ctx, &fd, nil, start)
+	p.removeUnusedFrontends(ctx, &fd, []frontdoor.RoutingRule{rule}, start.Add(30*time.Minute))
+	p.removeUnusedFrontends(ctx, &fd, nil, start.Add(time.Hour))
+	if len(*fd.FrontendEndpoints) != 1 {
+		t.Error("Expected the grace period to restart once the frontend was used again")
+	}
+}
+
+func TestFrontendsForIngressSetsSessionAffinity(t *testing.T) {
+	ctx := utils.WithLogger(context.Background(), log.WithField("test", t.Name()))
+	p := &Synchronizer{
+		endPoint:      frontdoor.FrontendEndpoint{ID: to.StringPtr("/frontDoors/fd1/frontendEndpoints/default")},
+		customDomains: true,
+		validateCustomDomain: func(ctx context.Context, host string) (frontdoor.ValidateCustomDomainOutput, error) {
+			return frontdoor.ValidateCustomDomainOutput{CustomDomainValidated: to.BoolPtr(true)}, nil
+		},
+	}
+	fd := frontdoor.FrontDoor{
+		ID: to.StringPtr("/frontDoors/fd1"),
+		Properties: &frontdoor.Properties{FrontendEndpoints: &[]frontdoor.FrontendEndpoint{{
+			ID:                         to.StringPtr("/frontDoors/fd1/frontendEndpoints/existing"),
+			Name:                       to.StringPtr("existing"),
+			FrontendEndpointProperties: &frontdoor.FrontendEndpointProperties{HostName: to.StringPtr("existing.example.com")},
+		}}},
+	}
+	ingress := &v1beta1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{sessionAffinityAnnotation: "enabled"}},
+		Spec: v1beta1.IngressSpec{
+			Rules: []v1beta1.IngressRule{{Host: "existing.example.com"}, {Host: "new.example.com"}},
+		},
+	}
+
+	if _, err := p.frontendsForIngress(ctx, &fd, ingress); err != nil {
+		t.Fatal(err)
+	}
+	managed := findFrontendEndpoint(fd, "new.example.com")
+	if managed == nil || managed.SessionAffinityEnabledState != frontdoor.SessionAffinityEnabledStateEnabled {
+		t.Errorf("Expected session affinity on the managed frontend, got %+v", managed)
+	}
+	if existing := findFrontendEndpoint(fd, "existing.example.com"); existing.SessionAffinityEnabledState != "" {
+		t.Errorf("Expected the frontend the controller didn't create to be left alone, got %+v", existing)
+	}
+	// Frontdoor ignores the TTL so it's never compared
+	managed.SessionAffinityTTLSeconds = to.Int32Ptr(600)
+	if p.applySessionAffinity(&fd, managed.ID, true) {
+		t.Error("Expected no change when session affinity is already enabled")
+	}
+
+	ingress.Annotations[sessionAffinityAnnotation] = "disabled"
+	if _, err := p.frontendsForIngress(ctx, &fd, ingress); err != nil {
+		t.Fatal(err)
+	}
+	if managed := findFrontendEndpoint(fd, "new.example.com"); managed.SessionAffinityEnabledState != frontdoor.SessionAffinityEnabledStateDisabled {
+		t.Errorf("Expected session affinity to be disabled, got %+v", managed)
+	}
+
+	ingress.Annotations[sessionAffinityTTLAnnotation] = "1h"
+	if _, err := p.frontendsForIngress(ctx, &fd, ingress); err == nil {
+		t.Error("Expected an error for the unsupported session affinity TTL")
+	}
+	delete(ingress.Annotations, sessionAffinityTTLAnnotation)
+	p.customDomains = false
+	if _, err := p.frontendsForIngress(ctx, &fd, ingress); err == nil {
+		t.Error("Expected an error for session affinity without custom domains")
+	}
+}
@@ -0,0 +1,18 @@
+package sync
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+
+	"github.com/Azure/azure-sdk-for-go/services/preview/frontdoor/mgmt/2018-08-01-preview/frontdoor"
+)
+
+// hashRoutingRules returns a short, stable hash of the routing rules
+// which can be stored on an ingress to show what was last applied
+func hashRoutingRules(rules []frontdoor.RoutingRule) string {
+	// Errors are ignored as the SDK types always marshal
+	data, _ := json.Marshal(rules) //nolint: errcheck
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:16]
+}
@@ -0,0 +1,78 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+)
+
+const (
+	// imdsTimeout limits how long the Instance Metadata Service is waited for, off Azure it doesn't answer
+	imdsTimeout = 2 * time.Second
+	// imdsAPIVersion is the Instance Metadata Service API version queried
+	imdsAPIVersion = "2019-03-11"
+)
+
+// imdsEndpoint is the Azure Instance Metadata Service, only reachable from Azure VMs
+var imdsEndpoint = "http://169.254.169.254"
+
+// instanceMetadata holds the fields read from the compute metadata of the VM the controller runs on
+type instanceMetadata struct {
+	SubscriptionID    string `json:"subscriptionId"`
+	ResourceGroupName string `json:"resourceGroupName"`
+}
+
+// DefaultFromInstanceMetadata sets AZURE_SUBSCRIPTION_ID, and when IMDS_RESOURCE_GROUP is set
+// AZURE_RESOURCE_GROUP_NAME, from the Azure Instance Metadata Service if they aren't configured.
+// Off Azure the service can't be reached so the config is left for validation to report.
+func DefaultFromInstanceMetadata(ctx context.Context, config *utils.Config) {
+	needsResourceGroup := config.IMDSResourceGroup && config.ResourceGroupName == ""
+	if config.SubscriptionID != "" && !needsResourceGroup {
+		return
+	}
+	logger := utils.GetLogger(ctx)
+
+	metadata, err := getInstanceMetadata(ctx)
+	if err != nil {
+		logger.WithError(err).Debug("Instance Metadata Service unavailable, not running on Azure")
+		return
+	}
+	if config.SubscriptionID == "" && metadata.SubscriptionID != "" {
+		config.SubscriptionID = metadata.SubscriptionID
+		logger.WithField("subscriptionID", config.SubscriptionID).Info("Using subscription from the Instance Metadata Service")
+	}
+	if needsResourceGroup && metadata.ResourceGroupName != "" {
+		config.ResourceGroupName = metadata.ResourceGroupName
+		logger.WithField("resourceGroupName", config.ResourceGroupName).Info("Using resource group from the Instance Metadata Service")
+	}
+}
+
+// getInstanceMetadata reads the compute metadata of the VM from the Instance Metadata Service
+func getInstanceMetadata(ctx context.Context) (*instanceMetadata, error) {
+	// The service must be called directly, never through a proxy
+	client := &http.Client{Timeout: imdsTimeout, Transport: &http.Transport{Proxy: nil}}
+	req, err := http.NewRequest(http.MethodGet, imdsEndpoint+"/metadata/instance/compute?api-version="+imdsAPIVersion, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Metadata", "true")
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close() //nolint: errcheck
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Instance Metadata Service returned %s", resp.Status)
+	}
+
+	metadata := &instanceMetadata{}
+	err = json.NewDecoder(resp.Body).Decode(metadata)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode instance metadata: %v", err)
+	}
+	return metadata, nil
+}
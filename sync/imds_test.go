@@ -0,0 +1,54 @@
+package sync
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+func TestDefaultFromInstanceMetadata(t *testing.T) {
+	ctx := utils.WithLogger(context.Background(), log.WithField("test", t.Name()))
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("Metadata") != "true" || r.URL.Path != "/metadata/instance/compute" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`{"subscriptionId":"00000000-0000-0000-0000-000000000001","resourceGroupName":"MC_cluster1"}`)) //nolint: errcheck
+	}))
+	defer server.Close()
+	defer func(endpoint string) { imdsEndpoint = endpoint }(imdsEndpoint)
+	imdsEndpoint = server.URL
+
+	config := utils.Config{ResourceGroupName: "frontdoor-rg"}
+	DefaultFromInstanceMetadata(ctx, &config)
+	if config.SubscriptionID != "00000000-0000-0000-0000-000000000001" || config.ResourceGroupName != "frontdoor-rg" {
+		t.Errorf("Expected only the subscription to be defaulted, got %+v", config)
+	}
+
+	config = utils.Config{IMDSResourceGroup: true}
+	DefaultFromInstanceMetadata(ctx, &config)
+	if config.ResourceGroupName != "MC_cluster1" {
+		t.Errorf("Expected the resource group to be defaulted when enabled, got %q", config.ResourceGroupName)
+	}
+
+	requests = 0
+	config = utils.Config{SubscriptionID: "00000000-0000-0000-0000-000000000002", ResourceGroupName: "frontdoor-rg"}
+	DefaultFromInstanceMetadata(ctx, &config)
+	if requests != 0 || config.SubscriptionID != "00000000-0000-0000-0000-000000000002" {
+		t.Errorf("Expected configured settings to be kept without querying metadata, got %d requests", requests)
+	}
+
+	// Off Azure the config is left unset for validation to report
+	server.Close()
+	config = utils.Config{}
+	DefaultFromInstanceMetadata(ctx, &config)
+	if config.SubscriptionID != "" {
+		t.Errorf("Expected no subscription when metadata is unavailable, got %q", config.SubscriptionID)
+	}
+}
@@ -0,0 +1,140 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/Azure/azure-sdk-for-go/services/preview/frontdoor/mgmt/2018-08-01-preview/frontdoor"
+	"github.com/Azure/azure-storage-blob-go/2016-05-31/azblob"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+)
+
+// ingressPoolsStore persists the names of the backend pools and health probes created for single ingresses
+// so they're still removed once unused after the controller restarts
+type ingressPoolsStore interface {
+	load(ctx context.Context) (map[string]string, error)
+	save(ctx context.Context, pools map[string]string) error
+}
+
+// ingressPools maps the name of each backend pool and health probe the cluster created for a single
+// ingress, such as its canary pool, to the ingress. A pool and probe created for an ingress share a name.
+// Only these are removed once unused, so pools and probes added to the Frontdoor by its users, such as
+// the pools canary annotations name, are never removed even when they're named alike.
+type ingressPools struct {
+	// store is nil when no storage account is configured, the pools are then only kept in memory
+	store ingressPoolsStore
+	pools map[string]string
+	// changed is set while the pools differ from those last saved
+	changed bool
+}
+
+// newIngressPools loads the backend pools and health probes the cluster created for single ingresses from
+// the storage account, if it's used
+func newIngressPools(ctx context.Context, config utils.Config) (*ingressPools, error) {
+	if !config.NeedsStorageAccount() {
+		return &ingressPools{pools: map[string]string{}}, nil
+	}
+	container, err := ensureStorageContainer(ctx, config, lockContainerName)
+	if err != nil {
+		return nil, err
+	}
+	store := &blobIngressPools{blob: container.NewBlockBlobURL(fmt.Sprintf("pools-%s-%s.json", config.FrontDoorName, config.ClusterName))}
+	pools, err := store.load(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load backend pools and health probes created for ingresses: %v", err)
+	}
+	return &ingressPools{store: store, pools: pools}, nil
+}
+
+// recordIngressPool records the backend pool or health probe as created for the ingress
+func (p *Synchronizer) recordIngressPool(name string, ingress *v1beta1.Ingress) {
+	if p.ingressPools == nil {
+		return
+	}
+	key := ingress.Namespace + "/" + ingress.Name
+	if p.ingressPools.pools[name] != key {
+		p.ingressPools.pools[name] = key
+		p.ingressPools.changed = true
+	}
+}
+
+// isIngressPool returns true if the backend pool or health probe was created by the cluster for a single ingress
+func (p *Synchronizer) isIngressPool(name string) bool {
+	return p.ingressPools != nil && p.ingressPools.pools[name] != ""
+}
+
+// forgetRemovedIngressPools stops recording the backend pools and health probes which are no longer in the
+// Frontdoor, as an earlier update removed them
+func (p *Synchronizer) forgetRemovedIngressPools(fd frontdoor.FrontDoor) {
+	if p.ingressPools == nil || fd.Properties == nil {
+		return
+	}
+	exists := map[string]bool{}
+	if fd.BackendPools != nil {
+		for _, pool := range *fd.BackendPools {
+			exists[to.String(pool.Name)] = true
+		}
+	}
+	if fd.HealthProbeSettings != nil {
+		for _, probe := range *fd.HealthProbeSettings {
+			exists[to.String(probe.Name)] = true
+		}
+	}
+	for name := range p.ingressPools.pools {
+		if !exists[name] {
+			delete(p.ingressPools.pools, name)
+			p.ingressPools.changed = true
+		}
+	}
+}
+
+// commitIngressPools saves the backend pools and health probes created for ingresses once an update
+// succeeds, if they changed. Failing to save them doesn't fail the sync, they're saved again by the next sync.
+func (p *Synchronizer) commitIngressPools(ctx context.Context) {
+	if p.ingressPools == nil || p.ingressPools.store == nil || !p.ingressPools.changed {
+		return
+	}
+	if err := p.ingressPools.store.save(ctx, p.ingressPools.pools); err != nil {
+		utils.GetLogger(ctx).WithError(err).Warn("Failed to save backend pools and health probes created for ingresses")
+		return
+	}
+	p.ingressPools.changed = false
+}
+
+// blobIngressPools keeps the backend pools and health probes created for ingresses as JSON in a blob
+// alongside the lock
+type blobIngressPools struct {
+	blob azblob.BlockBlobURL
+}
+
+func (r *blobIngressPools) load(ctx context.Context) (map[string]string, error) {
+	pools := map[string]string{}
+	resp, err := r.blob.GetBlob(ctx, azblob.BlobRange{}, azblob.BlobAccessConditions{}, false)
+	if storageErr, ok := err.(azblob.StorageError); ok && storageErr.ServiceCode() == azblob.ServiceCodeBlobNotFound {
+		return pools, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	body := resp.Body()
+	defer body.Close() //nolint: errcheck
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	return pools, json.Unmarshal(data, &pools)
+}
+
+func (r *blobIngressPools) save(ctx context.Context, pools map[string]string) error {
+	data, err := json.Marshal(pools)
+	if err != nil {
+		return err
+	}
+	_, err = r.blob.PutBlob(ctx, bytes.NewReader(data), azblob.BlobHTTPHeaders{ContentType: "application/json"}, azblob.Metadata{}, azblob.BlobAccessConditions{})
+	return err
+}
@@ -0,0 +1,414 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	gosync "sync"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/preview/frontdoor/mgmt/2018-08-01-preview/frontdoor"
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+	azlock "github.com/lawrencegripper/goazurelocking"
+	log "github.com/sirupsen/logrus"
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+)
+
+// The tests in this file run the Synchronizer, through the Frontdoor SDK client, against an
+// in-memory Frontdoor API server and lock so they need no cloud resources.
+
+const testFrontDoorID = "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/frontDoors/frontdoor1"
+
+// fakeFrontDoorServer serves GET and PUT of a single Frontdoor from memory
+type fakeFrontDoorServer struct {
+	*httptest.Server
+	mu    gosync.Mutex
+	state []byte
+	// throttle is the number of requests still to be answered with 429 Too Many Requests
+	throttle  int
+	throttled int
+	puts      int
+	// onPut is called with each update, before it's applied
+	onPut func()
+	// onGet is called with each read, before it's answered
+	onGet func()
+}
+
+func newFakeFrontDoorServer(t *testing.T, fd frontdoor.FrontDoor) *fakeFrontDoorServer {
+	state, err := json.Marshal(fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeFrontDoorServer{state: state}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+func (s *fakeFrontDoorServer) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.throttle > 0 {
+		s.throttle--
+		s.throttled++
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(http.StatusTooManyRequests)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		if s.onGet != nil {
+			s.onGet()
+		}
+	case http.MethodPut:
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		fd := frontdoor.FrontDoor{}
+		if err := json.Unmarshal(body, &fd); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if s.onPut != nil {
+			s.onPut()
+		}
+		// Frontdoor rejects the whole update if two routing rules have the same name
+		if fd.Properties != nil && fd.RoutingRules != nil {
+			names := map[string]bool{}
+			for _, rule := range *fd.RoutingRules {
+				if names[to.String(rule.Name)] {
+					w.WriteHeader(http.StatusBadRequest)
+					return
+				}
+				names[to.String(rule.Name)] = true
+			}
+		}
+		// Azure sets the IDs of the resources and completes the update
+		fd.ID = to.StringPtr(testFrontDoorID)
+		if fd.Properties != nil {
+			fd.ProvisioningState = to.StringPtr("Succeeded")
+		}
+		s.state, _ = json.Marshal(fd) //nolint: errcheck
+		s.puts++
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(s.state) //nolint: errcheck
+}
+
+// routingRuleNames returns the names of the routing rules currently in the Frontdoor
+func (s *fakeFrontDoorServer) routingRuleNames(t *testing.T) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fd := frontdoor.FrontDoor{}
+	if err := json.Unmarshal(s.state, &fd); err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	if fd.Properties != nil && fd.RoutingRules != nil {
+		for _, rule := range *fd.RoutingRules {
+			names = append(names, to.String(rule.Name))
+		}
+	}
+	return names
+}
+
+// fakeLockService is shared by the synchronizers of every cluster in a test, standing in for blob leases
+type fakeLockService struct {
+	mu gosync.Mutex
+	// lost makes renewing the lock fail, as if the lease expired and was taken by another controller
+	lost bool
+}
+
+func (s *fakeLockService) getLock() (*azlock.Lock, error) {
+	s.mu.Lock()
+	released := false
+	return &azlock.Lock{
+		Renew: func() error {
+			if s.lost {
+				return errors.New("lease lost")
+			}
+			return nil
+		},
+		Unlock: func() error {
+			if released {
+				return errors.New("lock already released")
+			}
+			released = true
+			s.mu.Unlock()
+			return nil
+		},
+	}, nil
+}
+
+func testIntegrationFrontDoor(clusters ...string) frontdoor.FrontDoor {
+	pools := []frontdoor.BackendPool{}
+	for _, cluster := range clusters {
+		pool := testBackendPool(cluster, "10.0.0.1")
+		pool.ID = to.StringPtr(testFrontDoorID + "/backendPools/" + cluster)
+		pools = append(pools, pool)
+	}
+	return frontdoor.FrontDoor{
+		ID:       to.StringPtr(testFrontDoorID),
+		Name:     to.StringPtr("frontdoor1"),
+		Location: to.StringPtr("global"),
+		Properties: &frontdoor.Properties{
+			BackendPools: &pools,
+			FrontendEndpoints: &[]frontdoor.FrontendEndpoint{{
+				ID:                         to.StringPtr(testFrontDoorID + "/frontendEndpoints/default"),
+				Name:                       to.StringPtr("default"),
+				FrontendEndpointProperties: &frontdoor.FrontendEndpointProperties{HostName: to.StringPtr("fd1.azurefd.net")},
+			}},
+			RoutingRules: &[]frontdoor.RoutingRule{},
+		},
+	}
+}
+
+// newIntegrationSynchronizer creates a synchronizer for the cluster which calls the fake server
+func newIntegrationSynchronizer(ctx context.Context, t *testing.T, server *fakeFrontDoorServer, locks *fakeLockService, cluster string) *Synchronizer {
+	config := utils.Config{
+		SubscriptionID:    "sub",
+		ResourceGroupName: "rg",
+		FrontDoorName:     "frontdoor1",
+		FrontDoorHostname: "fd1.azurefd.net",
+		ClusterName:       cluster,
+		OwnershipMode:     utils.OwnershipModeStrict,
+	}
+	client := frontdoor.NewFrontDoorsClientWithBaseURI(server.URL, config.SubscriptionID)
+	client.Authorizer = autorest.NullAuthorizer{}
+	client.RetryDuration = time.Millisecond
+	client.PollingDelay = time.Millisecond
+
+	p := newSynchronizerForClient(ctx, config, client)
+	p.getLock = locks.getLock
+	fd, err := p.getCurrentState(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if err := p.loadRequiredResources(fd, config); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	return p
+}
+
+func integrationContext(t *testing.T) context.Context {
+	return utils.WithLogger(context.Background(), log.WithField("test", t.Name()))
+}
+
+func TestIntegrationConcurrentSyncersKeepEachOthersRules(t *testing.T) {
+	ctx := integrationContext(t)
+	server := newFakeFrontDoorServer(t, testIntegrationFrontDoor("cluster1", "cluster2"))
+	defer server.Close()
+	locks := &fakeLockService{}
+
+	syncers := map[string]*Synchronizer{
+		"cluster1": newIntegrationSynchronizer(ctx, t, server, locks, "cluster1"),
+		"cluster2": newIntegrationSynchronizer(ctx, t, server, locks, "cluster2"),
+	}
+	expected := []string{}
+	errs := make(chan error, 10*len(syncers))
+	wg := gosync.WaitGroup{}
+	for cluster, p := range syncers {
+		ingress := testIngress(cluster+"-app", "/"+cluster)
+		expected = append(expected, routingRuleName(ingress))
+		wg.Add(1)
+		go func(p *Synchronizer, ingress *v1beta1.Ingress) {
+			defer wg.Done()
+			for i := 0; i < 10; i++ {
+				if _, err := p.Sync(ctx, []*v1beta1.Ingress{ingress}, nil); err != nil {
+					errs <- err
+				}
+			}
+		}(p, ingress)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("unexpected error: %+v", err)
+	}
+
+	names := strings.Join(server.routingRuleNames(t), ",")
+	for _, name := range expected {
+		if !strings.Contains(names, name) {
+			t.Errorf("Expected %s to survive the other cluster's syncs, got %s", name, names)
+		}
+	}
+}
+
+func TestIntegrationLockLostBeforeUpdateLeavesFrontDoorUnchanged(t *testing.T) {
+	ctx := integrationContext(t)
+	server := newFakeFrontDoorServer(t, testIntegrationFrontDoor("cluster1"))
+	defer server.Close()
+	locks := &fakeLockService{lost: true}
+	p := newIntegrationSynchronizer(ctx, t, server, locks, "cluster1")
+
+	_, err := p.Sync(ctx, []*v1beta1.Ingress{testIngress("app", "/app")}, nil)
+	if err == nil || !strings.Contains(err.Error(), "lost the Frontdoor lock") {
+		t.Errorf("Expected the sync to fail as the lock was lost, got %v", err)
+	}
+	if server.puts != 0 {
+		t.Errorf("Expected Frontdoor not to be updated without the lock, got %d updates", server.puts)
+	}
+
+	// The lock is released so the next sync can go ahead once it's held again
+	locks.lost = false
+	if _, err := p.Sync(ctx, []*v1beta1.Ingress{testIngress("app", "/app")}, nil); err != nil {
+		t.Errorf("unexpected error: %+v", err)
+	}
+}
+
+func TestIntegrationLockLostDuringUpdateFailsSync(t *testing.T) {
+	ctx := integrationContext(t)
+	server := newFakeFrontDoorServer(t, testIntegrationFrontDoor("cluster1"))
+	defer server.Close()
+	locks := &fakeLockService{}
+	p := newIntegrationSynchronizer(ctx, t, server, locks, "cluster1")
+	server.onPut = func() { locks.lost = true }
+
+	_, err := p.Sync(ctx, []*v1beta1.Ingress{testIngress("app", "/app")}, nil)
+	if err == nil || !strings.Contains(err.Error(), "lost the Frontdoor lock while updating") {
+		t.Errorf("Expected the sync to fail as the lock was lost during the update, got %v", err)
+	}
+	if server.puts != 1 {
+		t.Errorf("Expected Frontdoor to be updated once, got %d updates", server.puts)
+	}
+}
+
+func TestIntegrationWithoutLockingConflictingChangeFailsSync(t *testing.T) {
+	ctx := integrationContext(t)
+	server := newFakeFrontDoorServer(t, testIntegrationFrontDoor("cluster1"))
+	defer server.Close()
+	p := newIntegrationSynchronizer(ctx, t, server, nil, "cluster1")
+	p.getLock = newLocalLock()
+	p.detectConflicts = true
+
+	if _, err := p.Sync(ctx, []*v1beta1.Ingress{testIngress("app", "/app")}, nil); err != nil {
+		t.Fatalf("Expected the sync to update the unchanged Frontdoor, got %+v", err)
+	}
+
+	// Another update lands between the sync reading the Frontdoor and checking it before updating
+	gets := 0
+	server.onGet = func() {
+		if gets++; gets == 2 {
+			fd := frontdoor.FrontDoor{}
+			json.Unmarshal(server.state, &fd) //nolint: errcheck
+			*fd.RoutingRules = append(*fd.RoutingRules, testRoutingRule("Manual", "", "/manual/*"))
+			server.state, _ = json.Marshal(fd) //nolint: errcheck
+		}
+	}
+	_, err := p.Sync(ctx, []*v1beta1.Ingress{testIngress("app", "/app"), testIngress("other", "/other")}, nil)
+	if err == nil || !strings.Contains(err.Error(), "Frontdoor changed while the sync was running") {
+		t.Errorf("Expected the sync to fail as the Frontdoor changed, got %v", err)
+	}
+	if server.puts != 1 {
+		t.Errorf("Expected the conflicting change not to be overwritten, got %d updates", server.puts)
+	}
+}
+
+func TestIntegrationWithoutLockingStatusChangesDontConflict(t *testing.T) {
+	ctx := integrationContext(t)
+	server := newFakeFrontDoorServer(t, testIntegrationFrontDoor("cluster1"))
+	defer server.Close()
+	p := newIntegrationSynchronizer(ctx, t, server, nil, "cluster1")
+	p.getLock = newLocalLock()
+	p.detectConflicts = true
+
+	// The previous update is still being applied when the sync checks the Frontdoor before updating
+	gets := 0
+	server.onGet = func() {
+		if gets++; gets == 2 {
+			fd := frontdoor.FrontDoor{}
+			json.Unmarshal(server.state, &fd) //nolint: errcheck
+			fd.ProvisioningState = to.StringPtr("Succeeded")
+			fd.ResourceState = frontdoor.ResourceStateEnabling
+			(*fd.BackendPools)[0].ResourceState = frontdoor.ResourceStateEnabling
+			(*fd.FrontendEndpoints)[0].CustomHTTPSProvisioningState = frontdoor.Enabling
+			(*fd.FrontendEndpoints)[0].CustomHTTPSProvisioningSubstate = frontdoor.IssuingCertificate
+			server.state, _ = json.Marshal(fd) //nolint: errcheck
+		}
+	}
+	if _, err := p.Sync(ctx, []*v1beta1.Ingress{testIngress("app", "/app")}, nil); err != nil {
+		t.Fatalf("Expected changes to the status fields not to conflict, got %+v", err)
+	}
+	if server.puts != 1 {
+		t.Errorf("Expected Frontdoor to be updated, got %d updates", server.puts)
+	}
+}
+
+func TestIntegrationThrottledRequestsAreRetried(t *testing.T) {
+	ctx := integrationContext(t)
+	server := newFakeFrontDoorServer(t, testIntegrationFrontDoor("cluster1"))
+	defer server.Close()
+	p := newIntegrationSynchronizer(ctx, t, server, &fakeLockService{}, "cluster1")
+
+	server.mu.Lock()
+	server.throttle = 3
+	server.mu.Unlock()
+
+	result, err := p.Sync(ctx, []*v1beta1.Ingress{testIngress("app", "/app")}, nil)
+	if err != nil {
+		t.Fatalf("Expected throttled requests to be retried, got: %+v", err)
+	}
+	if server.throttled != 3 || result.RulesCreated != 1 {
+		t.Errorf("Expected the rule to be created after 3 throttled requests, got %d throttled and %+v", server.throttled, result)
+	}
+}
+
+func TestIntegrationSyncOnlyRemovesItsLegacyRules(t *testing.T) {
+	ctx := integrationContext(t)
+	fd := testIntegrationFrontDoor("cluster1", "cluster2")
+	*fd.RoutingRules = []frontdoor.RoutingRule{
+		testRoutingRule("Manual", testFrontDoorID+"/backendPools/cluster1", "/manual"),
+		testRoutingRule("Ingress-app", testFrontDoorID+"/backendPools/cluster1", "/app"),
+		testRoutingRule("Ingress-other", testFrontDoorID+"/backendPools/cluster2", "/other"),
+	}
+	server := newFakeFrontDoorServer(t, fd)
+	defer server.Close()
+	p := newIntegrationSynchronizer(ctx, t, server, &fakeLockService{}, "cluster1")
+
+	app := testIngress("app", "/app")
+	for i := 0; i < 2; i++ {
+		if _, err := p.Sync(ctx, []*v1beta1.Ingress{app}, nil); err != nil {
+			t.Fatalf("unexpected error: %+v", err)
+		}
+	}
+
+	names := strings.Join(server.routingRuleNames(t), ",")
+	expected := strings.Join([]string{"Manual", routingRuleName(app), "Ingress-other"}, ",")
+	if names != expected {
+		t.Errorf("Expected only the legacy rule for the synced ingress to be replaced, want %s got %s", expected, names)
+	}
+}
+
+func TestIntegrationMultiHostIngressRulesHaveUniqueNames(t *testing.T) {
+	ctx := integrationContext(t)
+	server := newFakeFrontDoorServer(t, testIntegrationFrontDoor("cluster1"))
+	defer server.Close()
+	p := newIntegrationSynchronizer(ctx, t, server, &fakeLockService{}, "cluster1")
+
+	app := testIngress("app", "/app")
+	app.Spec.Rules = []v1beta1.IngressRule{
+		{Host: "shop.example.com", IngressRuleValue: app.Spec.Rules[0].IngressRuleValue},
+		{Host: "blog.example.com", IngressRuleValue: app.Spec.Rules[0].IngressRuleValue},
+	}
+	if _, err := p.Sync(ctx, []*v1beta1.Ingress{app}, nil); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	names := server.routingRuleNames(t)
+	if len(names) != 2 || names[0] == names[1] {
+		t.Errorf("Expected a uniquely named routing rule for each host, got %v", names)
+	}
+}
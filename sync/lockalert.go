@@ -0,0 +1,189 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+// LockAlert is posted to the lock alert webhook when the Frontdoor lock couldn't be acquired for longer
+// than LOCK_ALERT_AFTER, for example because another cluster is wedged holding it
+type LockAlert struct {
+	FrontDoor string    `json:"frontDoor"`
+	Cluster   string    `json:"cluster"`
+	Instance  string    `json:"instance"`
+	Time      time.Time `json:"time"`
+	// Since is when acquiring the lock started failing
+	Since time.Time `json:"since"`
+	Error string    `json:"error"`
+}
+
+// LockError is returned by syncs which couldn't acquire the Frontdoor lock, after its retries
+type LockError struct {
+	Err error
+}
+
+func (e *LockError) Error() string {
+	return fmt.Sprintf("failed to acquire the Frontdoor lock: %v", e.Err)
+}
+
+// IsLockError returns true if the error returned by a provider is from acquiring the Frontdoor lock, for
+// several providers only if each of them failed to acquire its lock
+func IsLockError(err error) bool {
+	switch err := err.(type) {
+	case *LockError, *LockUnavailableError:
+		return true
+	case *ProviderError:
+		return IsLockError(err.Err)
+	case utilerrors.Aggregate:
+		for _, err := range err.Errors() {
+			if !IsLockError(err) {
+				return false
+			}
+		}
+		return len(err.Errors()) > 0
+	}
+	return false
+}
+
+// LockUnavailableError is returned by syncs which couldn't acquire the Frontdoor lock once it has been
+// failing for longer than LOCK_ALERT_AFTER
+type LockUnavailableError struct {
+	FrontDoor string
+	// Since is when acquiring the lock started failing
+	Since time.Time
+	Err   error
+}
+
+func (e *LockUnavailableError) Error() string {
+	return fmt.Sprintf("unable to acquire the lock on Frontdoor %s since %s: %v", e.FrontDoor, e.Since.UTC().Format(time.RFC3339), e.Err)
+}
+
+// AsLockUnavailable returns the LockUnavailableError in the error returned by a provider, including
+// those from one of several providers
+func AsLockUnavailable(err error) (*LockUnavailableError, bool) {
+	switch err := err.(type) {
+	case *LockUnavailableError:
+		return err, true
+	case *ProviderError:
+		return AsLockUnavailable(err.Err)
+	case utilerrors.Aggregate:
+		for _, err := range err.Errors() {
+			if lockErr, ok := AsLockUnavailable(err); ok {
+				return lockErr, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// lockAlerter tracks how long acquiring the lock has been failing and alerts once it's been failing for
+// longer than the configured duration, rather than the sync silently retrying forever
+type lockAlerter struct {
+	after     time.Duration
+	frontDoor string
+	cluster   string
+	instance  string
+	// webhook is posted the alert, nil if no lock alert webhook is configured
+	webhook func(context.Context, LockAlert) error
+	now     func() time.Time
+	// failingSince is when acquiring the lock first failed, zero while it's acquired
+	failingSince time.Time
+	alerted      bool
+}
+
+// lockAlertingProvider alerts when the syncs of the provider have been failing to acquire the lock for too long
+type lockAlertingProvider struct {
+	provider Provider
+	alerter  *lockAlerter
+}
+
+// WithLockAlerts wraps the provider of the configured Frontdoor so once its syncs have been failing to acquire
+// the lock for longer than LOCK_ALERT_AFTER it's alerted on. The provider is returned as is if it isn't set.
+func WithLockAlerts(provider Provider, config utils.Config) Provider {
+	if config.LockAlertAfter <= 0 {
+		return provider
+	}
+	return &lockAlertingProvider{provider: provider, alerter: newLockAlerter(config)}
+}
+
+// Sync syncs the ingresses with the provider, recording whether it acquired the lock
+func (p *lockAlertingProvider) Sync(ctx context.Context, ingressToSync []*v1beta1.Ingress, backends []ClusterBackend) (*SyncResult, error) {
+	result, err := p.provider.Sync(ctx, ingressToSync, backends)
+	if lockErr, failed := err.(*LockError); failed {
+		return nil, p.alerter.failed(ctx, lockErr)
+	}
+	p.alerter.acquired(ctx)
+	return result, err
+}
+
+// newLockAlerter returns an alerter for the lock on the configured Frontdoor
+func newLockAlerter(config utils.Config) *lockAlerter {
+	alerter := &lockAlerter{
+		after:     config.LockAlertAfter,
+		frontDoor: config.FrontDoorName,
+		cluster:   config.ClusterName,
+		instance:  config.Identity(),
+		now:       time.Now,
+	}
+	if config.LockAlertWebhookURL != "" {
+		client := &http.Client{Timeout: webhookTimeout}
+		alerter.webhook = func(ctx context.Context, alert LockAlert) error {
+			return postJSON(ctx, client, config.LockAlertWebhookURL, alert)
+		}
+	}
+	lockUnavailable.Set(0, alerter.frontDoor)
+	return alerter
+}
+
+// acquired records the lock was acquired, ending any alert
+func (a *lockAlerter) acquired(ctx context.Context) {
+	if a.alerted {
+		utils.GetLogger(ctx).WithField("since", a.failingSince).Info("Acquired the Frontdoor lock again")
+		lockUnavailable.Set(0, a.frontDoor)
+	}
+	a.failingSince = time.Time{}
+	a.alerted = false
+}
+
+// failed records an attempt to acquire the lock failed, after its retries. Once it's been failing for longer
+// than the configured duration the error is returned as a LockUnavailableError, the first time the metric
+// is set, an error is logged and the webhook is posted the alert.
+func (a *lockAlerter) failed(ctx context.Context, failure *LockError) error {
+	if a.failingSince.IsZero() {
+		a.failingSince = a.now()
+	}
+	if a.now().Sub(a.failingSince) < a.after {
+		return failure
+	}
+	err := failure.Err
+	lockErr := &LockUnavailableError{FrontDoor: a.frontDoor, Since: a.failingSince, Err: err}
+	if a.alerted {
+		return lockErr
+	}
+	a.alerted = true
+
+	logger := utils.GetLogger(ctx)
+	lockUnavailable.Set(1, a.frontDoor)
+	logger.WithError(err).WithField(utils.EventField, "LockUnavailable").WithField("since", a.failingSince).
+		Error("Unable to acquire the Frontdoor lock for longer than LOCK_ALERT_AFTER, another controller may be stuck holding it")
+	if a.webhook != nil {
+		alert := LockAlert{
+			FrontDoor: a.frontDoor,
+			Cluster:   a.cluster,
+			Instance:  a.instance,
+			Time:      a.now(),
+			Since:     a.failingSince,
+			Error:     err.Error(),
+		}
+		if err := a.webhook(ctx, alert); err != nil {
+			logger.WithError(err).Warn("Failed to post lock alert to webhook")
+		}
+	}
+	return lockErr
+}
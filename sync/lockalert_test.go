@@ -0,0 +1,151 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+	azlock "github.com/lawrencegripper/goazurelocking"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+func TestSyncAlertsWhenLockUnavailableForTooLong(t *testing.T) {
+	ctx := integrationContext(t)
+	start := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := start
+
+	alerts := []LockAlert{}
+	lockErr := errors.New("lease already present")
+	synchronizer := &Synchronizer{getLock: func() (*azlock.Lock, error) { return nil, lockErr }}
+	p := WithLockAlerts(synchronizer, utils.Config{FrontDoorName: "frontdoor1", ClusterName: "cluster1", LockAlertAfter: 10 * time.Minute}).(*lockAlertingProvider)
+	p.alerter.now = func() time.Time { return now }
+	p.alerter.webhook = func(ctx context.Context, alert LockAlert) error {
+		alerts = append(alerts, alert)
+		return nil
+	}
+
+	if _, err := p.Sync(ctx, nil, nil); !isLockFailure(err, lockErr) {
+		t.Errorf("Expected the lock's error before LOCK_ALERT_AFTER, got %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		now = now.Add(10 * time.Minute)
+		_, err := p.Sync(ctx, nil, nil)
+		unavailable, ok := AsLockUnavailable(err)
+		if !ok || unavailable.Err != lockErr || unavailable.FrontDoor != "frontdoor1" {
+			t.Fatalf("Expected a LockUnavailableError after LOCK_ALERT_AFTER, got %v", err)
+		}
+	}
+	if len(alerts) != 1 || alerts[0].Cluster != "cluster1" || alerts[0].Error != lockErr.Error() {
+		t.Fatalf("Expected one alert for the outage, got %+v", alerts)
+	}
+
+	// Acquiring the lock ends the outage, so failing again starts timing a new one
+	p.alerter.acquired(ctx)
+	if !p.alerter.failingSince.IsZero() || p.alerter.alerted {
+		t.Errorf("Expected acquiring the lock to reset the alert, got %+v", p.alerter)
+	}
+	if _, err := p.Sync(ctx, nil, nil); !isLockFailure(err, lockErr) {
+		t.Errorf("Expected the lock's error at the start of a new outage, got %v", err)
+	}
+}
+
+// isLockFailure returns true if the sync failed to acquire the lock with the error, without alerting
+func isLockFailure(err error, lockErr error) bool {
+	failure, ok := err.(*LockError)
+	return ok && failure.Err == lockErr
+}
+
+func TestAsLockUnavailableFindsErrorFromProviders(t *testing.T) {
+	lockErr := &LockUnavailableError{FrontDoor: "frontdoor2", Err: errors.New("lease already present")}
+	err := utilerrors.NewAggregate([]error{
+		&ProviderError{Provider: "frontdoor1", Err: errors.New("unavailable")},
+		&ProviderError{Provider: "frontdoor2", Err: lockErr},
+	})
+	if found, ok := AsLockUnavailable(err); !ok || found != lockErr {
+		t.Errorf("Expected the provider's LockUnavailableError, got %v", found)
+	}
+	if _, ok := AsLockUnavailable(errors.New("unavailable")); ok {
+		t.Error("Expected no LockUnavailableError in other errors")
+	}
+}
+
+func TestIsLockErrorOnlyWhenEveryProviderFailedToLock(t *testing.T) {
+	lockErr := &ProviderError{Provider: "frontdoor1", Err: &LockError{Err: errors.New("lease already present")}}
+	unavailable := &ProviderError{Provider: "frontdoor2", Err: &LockUnavailableError{FrontDoor: "frontdoor2", Err: errors.New("lease already present")}}
+	if !IsLockError(utilerrors.NewAggregate([]error{lockErr, unavailable})) {
+		t.Error("Expected a lock error when every provider failed to acquire its lock")
+	}
+	other := &ProviderError{Provider: "frontdoor3", Err: errors.New("unavailable")}
+	if IsLockError(utilerrors.NewAggregate([]error{lockErr, other})) || IsLockError(errors.New("unavailable")) {
+		t.Error("Expected no lock error when a provider failed otherwise")
+	}
+}
+
+func TestLockFrontDoorStopsLockGoroutinesWhenLockFails(t *testing.T) {
+	ctx, cancel := context.WithCancel(integrationContext(t))
+	defer cancel()
+	defer func(original func(context.Context, string, string, string, time.Duration, ...azlock.BehaviorFunc) (*azlock.Lock, error)) {
+		newLockInstance = original
+	}(newLockInstance)
+	// Like the lock's behaviors, each instance runs a goroutine until its context is cancelled
+	newLockInstance = func(ctx context.Context, url, key, name string, ttl time.Duration, behavior ...azlock.BehaviorFunc) (*azlock.Lock, error) {
+		go func() { <-ctx.Done() }()
+		return &azlock.Lock{
+			Lock:   func() error { return errors.New("lease already present") },
+			Unlock: func() error { return nil },
+		}, nil
+	}
+
+	before := runtime.NumGoroutine()
+	for i := 0; i < 50; i++ {
+		if _, err := lockFrontDoor(ctx, utils.Config{FrontDoorName: "frontdoor1"}); err == nil {
+			t.Fatal("Expected the lock to fail")
+		}
+	}
+	if !goroutinesSettle(before) {
+		t.Errorf("Expected the goroutines of locks which failed to stop, went from %d to %d", before, runtime.NumGoroutine())
+	}
+}
+
+func TestLockFrontDoorStopsLockGoroutinesOnceUnlocked(t *testing.T) {
+	ctx, cancel := context.WithCancel(integrationContext(t))
+	defer cancel()
+	defer func(original func(context.Context, string, string, string, time.Duration, ...azlock.BehaviorFunc) (*azlock.Lock, error)) {
+		newLockInstance = original
+	}(newLockInstance)
+	newLockInstance = func(ctx context.Context, url, key, name string, ttl time.Duration, behavior ...azlock.BehaviorFunc) (*azlock.Lock, error) {
+		go func() { <-ctx.Done() }()
+		return &azlock.Lock{
+			Lock:   func() error { return nil },
+			Unlock: func() error { return nil },
+		}, nil
+	}
+
+	before := runtime.NumGoroutine()
+	for i := 0; i < 50; i++ {
+		lock, err := lockFrontDoor(ctx, utils.Config{FrontDoorName: "frontdoor1"})
+		if err != nil {
+			t.Fatalf("unexpected error: %+v", err)
+		}
+		if err := lock.Unlock(); err != nil {
+			t.Fatalf("unexpected error: %+v", err)
+		}
+	}
+	if !goroutinesSettle(before) {
+		t.Errorf("Expected the goroutines of released locks to stop, went from %d to %d", before, runtime.NumGoroutine())
+	}
+}
+
+// goroutinesSettle waits for the number of goroutines to drop back to the count given
+func goroutinesSettle(count int) bool {
+	for i := 0; i < 100; i++ {
+		if runtime.NumGoroutine() <= count {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
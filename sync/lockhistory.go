@@ -0,0 +1,137 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/Azure/azure-storage-blob-go/2016-05-31/azblob"
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+)
+
+const (
+	// lockContainerName is the container the locking library keeps its lock blobs in
+	lockContainerName = "azlockcontainer"
+	// lockHistoryDateFormat names the history blob for each day, keeping each well below an append blob's 50,000 block limit
+	lockHistoryDateFormat = "2006-01-02"
+)
+
+// Outcomes of a sync recorded in the lock history
+const (
+	lockOutcomeSynced     = "synced"
+	lockOutcomePartial    = "partial"
+	lockOutcomeRolledBack = "rolledBack"
+	lockOutcomeFailed     = "failed"
+)
+
+// lockRecord describes one hold of the Frontdoor lock, appended to the history as a line of JSON
+type lockRecord struct {
+	// Holder is the cluster which held the lock and Host the instance of the controller within it
+	Holder string `json:"holder"`
+	Host   string `json:"host"`
+	// Identity is the controller instance, '<cluster>/<pod>@<version>'
+	Identity string    `json:"identity,omitempty"`
+	SyncID   string    `json:"syncID,omitempty"`
+	Acquired time.Time `json:"acquired"`
+	Released time.Time `json:"released"`
+	Outcome  string    `json:"outcome"`
+	// RulesCreated and RulesUpdated count the routing rules changed while the lock was held
+	RulesCreated int `json:"rulesCreated"`
+	RulesUpdated int `json:"rulesUpdated"`
+	// FailedIngresses counts the ingresses which couldn't be synced
+	FailedIngresses int    `json:"failedIngresses"`
+	Error           string `json:"error,omitempty"`
+}
+
+// lockHistory keeps a record of each time the Frontdoor lock was held
+type lockHistory interface {
+	append(ctx context.Context, record lockRecord) error
+}
+
+// newLockRecord describes a sync made while holding the lock from its result or error
+func newLockRecord(ctx context.Context, holder, identity string, acquired, released time.Time, result *SyncResult, err error) lockRecord {
+	host, _ := os.Hostname() //nolint: errcheck
+	record := lockRecord{
+		Holder:   holder,
+		Host:     host,
+		Identity: identity,
+		SyncID:   utils.GetSyncID(ctx),
+		Acquired: acquired.UTC(),
+		Released: released.UTC(),
+		Outcome:  lockOutcomeSynced,
+	}
+	if err != nil {
+		record.Outcome = lockOutcomeFailed
+		record.Error = err.Error()
+		return record
+	}
+	record.RulesCreated = result.RulesCreated
+	record.RulesUpdated = result.RulesUpdated
+	record.FailedIngresses = len(result.Failed)
+	if result.RolledBack {
+		record.Outcome = lockOutcomeRolledBack
+	} else if len(result.Failed) > 0 {
+		record.Outcome = lockOutcomePartial
+	}
+	return record
+}
+
+// recordLockHistory appends the outcome of a sync to the lock history, if it's enabled. Failing to
+// record it doesn't fail the sync as Frontdoor has already been updated.
+func (p *Synchronizer) recordLockHistory(ctx context.Context, acquired time.Time, result *SyncResult, err error) {
+	if p.lockHistory == nil {
+		return
+	}
+	record := newLockRecord(ctx, p.clusterName, p.identity, acquired, time.Now(), result, err)
+	if appendErr := p.lockHistory.append(ctx, record); appendErr != nil {
+		utils.GetLogger(ctx).WithError(appendErr).Warn("Failed to append to lock history")
+	}
+}
+
+// blobLockHistory appends records to a blob for each day, alongside the lock in the locking container
+type blobLockHistory struct {
+	container azblob.ContainerURL
+	lockName  string
+}
+
+// newLockHistory returns the history of the Frontdoor's lock, nil if it's disabled
+func newLockHistory(ctx context.Context, config utils.Config) (lockHistory, error) {
+	if !config.LockHistory {
+		return nil, nil
+	}
+	container, err := ensureStorageContainer(ctx, config, lockContainerName)
+	if err != nil {
+		return nil, err
+	}
+	return &blobLockHistory{container: container, lockName: config.FrontDoorName}, nil
+}
+
+// blobName returns the name of the history blob for the day, it doesn't use the library's
+// 'azlk-' prefix so it can't be mistaken for a lock
+func (h *blobLockHistory) blobName(day time.Time) string {
+	return fmt.Sprintf("history-%s-%s.jsonl", h.lockName, day.UTC().Format(lockHistoryDateFormat))
+}
+
+func (h *blobLockHistory) append(ctx context.Context, record lockRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	blob := h.container.NewAppendBlobURL(h.blobName(record.Released))
+	_, err = blob.AppendBlock(ctx, bytes.NewReader(data), azblob.BlobAccessConditions{})
+	if storageErr, ok := err.(azblob.StorageError); ok && storageErr.ServiceCode() == azblob.ServiceCodeBlobNotFound {
+		// First record of the day, only create the blob if another cluster hasn't just done so
+		_, err = blob.Create(ctx, azblob.BlobHTTPHeaders{ContentType: "application/x-ndjson"}, azblob.Metadata{},
+			azblob.BlobAccessConditions{HTTPAccessConditions: azblob.HTTPAccessConditions{IfNoneMatch: azblob.ETagAny}})
+		if storageErr, ok := err.(azblob.StorageError); err != nil && (!ok || (storageErr.ServiceCode() != azblob.ServiceCodeBlobAlreadyExists && storageErr.ServiceCode() != azblob.ServiceCodeConditionNotMet)) {
+			return err
+		}
+		_, err = blob.AppendBlock(ctx, bytes.NewReader(data), azblob.BlobAccessConditions{})
+	}
+	return err
+}
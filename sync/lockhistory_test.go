@@ -0,0 +1,44 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+)
+
+func TestNewLockRecordOutcome(t *testing.T) {
+	ctx := utils.WithSyncID(context.Background(), "sync1")
+	acquired := time.Now()
+	released := acquired.Add(time.Second)
+
+	testCases := []struct {
+		name     string
+		result   *SyncResult
+		err      error
+		expected string
+	}{
+		{name: "synced", result: &SyncResult{RulesCreated: 1, Failed: map[string]error{}}, expected: lockOutcomeSynced},
+		{name: "partial", result: &SyncResult{Failed: map[string]error{"default/app": errors.New("bad path")}}, expected: lockOutcomePartial},
+		{name: "rolledBack", result: &SyncResult{RolledBack: true, Failed: map[string]error{"default/app": errors.New("unhealthy")}}, expected: lockOutcomeRolledBack},
+		{name: "failed", err: errors.New("update failed"), expected: lockOutcomeFailed},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			record := newLockRecord(ctx, "cluster1", "cluster1/pod1@dev", acquired, released, test.result, test.err)
+			if record.Outcome != test.expected {
+				t.Errorf("Expected outcome %s, got %s", test.expected, record.Outcome)
+			}
+			if record.Holder != "cluster1" || record.Identity != "cluster1/pod1@dev" || record.SyncID != "sync1" || !record.Released.Equal(released) {
+				t.Errorf("Expected the holder, sync and release time to be recorded, got %+v", record)
+			}
+			if (test.err != nil) != (record.Error != "") {
+				t.Errorf("Expected the error to be recorded only when the sync failed, got %q", record.Error)
+			}
+		})
+	}
+}
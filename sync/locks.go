@@ -0,0 +1,169 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-storage-blob-go/2016-05-31/azblob"
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+)
+
+// lockBlobPrefix is the start of the name of every lock blob created by the locking library
+const lockBlobPrefix = "azlk-"
+
+// LockInfo describes a lock in the container shared by every Frontdoor's locks
+type LockInfo struct {
+	Name string `json:"name"`
+	// LastUsed is when the lock blob was last written, which happens each time a lock is taken
+	LastUsed time.Time `json:"lastUsed"`
+	// Held is set while a controller holds the lock's lease
+	Held bool `json:"held"`
+	etag azblob.ETag
+}
+
+// lockStore lists, deletes and breaks the leases of the blobs used for locking
+type lockStore interface {
+	list(ctx context.Context) ([]LockInfo, error)
+	delete(ctx context.Context, lock LockInfo) error
+	breakLease(ctx context.Context, lock LockInfo) error
+}
+
+// staleLocks returns the locks which aren't held and haven't been used for the period
+func staleLocks(locks []LockInfo, now time.Time, unusedFor time.Duration) []LockInfo {
+	stale := []LockInfo{}
+	for _, lock := range locks {
+		if !lock.Held && now.Sub(lock.LastUsed) >= unusedFor {
+			stale = append(stale, lock)
+		}
+	}
+	return stale
+}
+
+// cleanLocks deletes the stale locks from the store, returning the names of those deleted
+func cleanLocks(ctx context.Context, store lockStore, now time.Time, unusedFor time.Duration) ([]string, error) {
+	locks, err := store.list(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list locks: %v", err)
+	}
+	deleted := []string{}
+	for _, lock := range staleLocks(locks, now, unusedFor) {
+		if err := store.delete(ctx, lock); err != nil {
+			// The lock may have been taken since it was listed
+			utils.GetLogger(ctx).WithError(err).WithField("lock", lock.Name).Warn("Failed to delete stale lock")
+			continue
+		}
+		deleted = append(deleted, lock.Name)
+	}
+	return deleted, nil
+}
+
+// breakLock breaks the lease on the named lock, failing if the lock doesn't exist or isn't held
+func breakLock(ctx context.Context, store lockStore, name string) error {
+	locks, err := store.list(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list locks: %v", err)
+	}
+	for _, lock := range locks {
+		if lock.Name != name {
+			continue
+		}
+		if !lock.Held {
+			return fmt.Errorf("the lock on Frontdoor %s isn't held", name)
+		}
+		if err := store.breakLease(ctx, lock); err != nil {
+			return fmt.Errorf("failed to break the lease on the lock on Frontdoor %s: %v", name, err)
+		}
+		utils.GetLogger(ctx).WithField(utils.EventField, "LockBroken").WithField("lock", name).
+			WithField("lastUsed", lock.LastUsed).Warn("Broke the lease on the Frontdoor lock")
+		return nil
+	}
+	return fmt.Errorf("no lock exists for Frontdoor %s", name)
+}
+
+// Locks returns the locks in the storage account used for locking, ordered by name
+func Locks(ctx context.Context, config utils.Config) ([]LockInfo, error) {
+	store, err := newBlobLockStore(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	return store.list(ctx)
+}
+
+// CleanLocks deletes the locks which aren't held and haven't been used for the period, returning their names.
+// Locks are created for each Frontdoor name and never deleted by the locking library, so they build up as
+// Frontdoors are renamed or removed.
+func CleanLocks(ctx context.Context, config utils.Config, unusedFor time.Duration) ([]string, error) {
+	if err := checkAuthoritative(config, "deleting stale locks"); err != nil {
+		return nil, err
+	}
+	store, err := newBlobLockStore(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	return cleanLocks(ctx, store, time.Now(), unusedFor)
+}
+
+// BreakLock immediately breaks the lease on the Frontdoor's lock, to recover when a controller which
+// crashed or is stuck left it held and other clusters are waiting on it. The controller which held it
+// finds out when it next renews the lock, failing the sync in progress.
+func BreakLock(ctx context.Context, config utils.Config, frontDoorName string) error {
+	store, err := newBlobLockStore(ctx, config)
+	if err != nil {
+		return err
+	}
+	return breakLock(ctx, store, frontDoorName)
+}
+
+// blobLockStore lists and deletes the lock blobs in the locking container
+type blobLockStore struct {
+	container azblob.ContainerURL
+}
+
+func newBlobLockStore(ctx context.Context, config utils.Config) (*blobLockStore, error) {
+	container, err := ensureStorageContainer(ctx, config, lockContainerName)
+	if err != nil {
+		return nil, err
+	}
+	return &blobLockStore{container: container}, nil
+}
+
+func (s *blobLockStore) list(ctx context.Context) ([]LockInfo, error) {
+	locks := []LockInfo{}
+	for marker := (azblob.Marker{}); marker.NotDone(); {
+		resp, err := s.container.ListBlobs(ctx, marker, azblob.ListBlobsOptions{Prefix: lockBlobPrefix})
+		if err != nil {
+			return nil, err
+		}
+		for _, blob := range resp.Blobs.Blob {
+			locks = append(locks, LockInfo{
+				Name:     strings.TrimPrefix(blob.Name, lockBlobPrefix),
+				LastUsed: blob.Properties.LastModified,
+				Held:     blob.Properties.LeaseState == azblob.LeaseStateLeased,
+				etag:     blob.Properties.Etag,
+			})
+		}
+		marker = resp.NextMarker
+	}
+	sort.Slice(locks, func(i, j int) bool { return locks[i].Name < locks[j].Name })
+	return locks, nil
+}
+
+// delete removes the lock blob, only if it hasn't been written since it was listed. Storage
+// rejects deleting a blob with an active lease so a lock taken since can't be removed.
+func (s *blobLockStore) delete(ctx context.Context, lock LockInfo) error {
+	blob := s.container.NewBlobURL(lockBlobPrefix + lock.Name)
+	_, err := blob.Delete(ctx, azblob.DeleteSnapshotsOptionNone,
+		azblob.BlobAccessConditions{HTTPAccessConditions: azblob.HTTPAccessConditions{IfMatch: lock.etag}})
+	return err
+}
+
+// breakLease breaks the lease on the lock blob at once, only if it hasn't been written since it was
+// listed so a lock taken again since isn't broken
+func (s *blobLockStore) breakLease(ctx context.Context, lock LockInfo) error {
+	blob := s.container.NewBlobURL(lockBlobPrefix + lock.Name)
+	_, err := blob.BreakLease(ctx, 0, azblob.HTTPAccessConditions{IfMatch: lock.etag})
+	return err
+}
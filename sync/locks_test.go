@@ -0,0 +1,81 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+type fakeLockStore struct {
+	locks     []LockInfo
+	deleted   []string
+	deleteErr map[string]error
+	broken    []string
+}
+
+func (s *fakeLockStore) list(ctx context.Context) ([]LockInfo, error) {
+	return s.locks, nil
+}
+
+func (s *fakeLockStore) delete(ctx context.Context, lock LockInfo) error {
+	if err := s.deleteErr[lock.Name]; err != nil {
+		return err
+	}
+	s.deleted = append(s.deleted, lock.Name)
+	return nil
+}
+
+func (s *fakeLockStore) breakLease(ctx context.Context, lock LockInfo) error {
+	s.broken = append(s.broken, lock.Name)
+	return nil
+}
+
+func TestCleanLocksDeletesOnlyStaleLocks(t *testing.T) {
+	ctx := utils.WithLogger(context.Background(), log.WithField("test", t.Name()))
+	now := time.Now()
+	store := &fakeLockStore{
+		locks: []LockInfo{
+			{Name: "recent", LastUsed: now.Add(-time.Minute)},
+			{Name: "held", LastUsed: now.Add(-48 * time.Hour), Held: true},
+			{Name: "stale", LastUsed: now.Add(-48 * time.Hour)},
+			{Name: "retaken", LastUsed: now.Add(-48 * time.Hour)},
+		},
+		deleteErr: map[string]error{"retaken": errors.New("condition not met")},
+	}
+
+	deleted, err := cleanLocks(ctx, store, now, 24*time.Hour)
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if !reflect.DeepEqual(deleted, []string{"stale"}) || !reflect.DeepEqual(store.deleted, []string{"stale"}) {
+		t.Errorf("Expected only the stale lock to be deleted, got %v", deleted)
+	}
+}
+
+func TestBreakLockOnlyBreaksHeldLock(t *testing.T) {
+	ctx := utils.WithLogger(context.Background(), log.WithField("test", t.Name()))
+	store := &fakeLockStore{
+		locks: []LockInfo{
+			{Name: "frontdoor1", Held: true},
+			{Name: "frontdoor2"},
+		},
+	}
+
+	if err := breakLock(ctx, store, "frontdoor1"); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if err := breakLock(ctx, store, "frontdoor2"); err == nil {
+		t.Error("Expected an error breaking a lock which isn't held")
+	}
+	if err := breakLock(ctx, store, "missing"); err == nil {
+		t.Error("Expected an error breaking a lock which doesn't exist")
+	}
+	if !reflect.DeepEqual(store.broken, []string{"frontdoor1"}) {
+		t.Errorf("Expected only the held lock to be broken, got %v", store.broken)
+	}
+}
@@ -0,0 +1,43 @@
+package sync
+
+import (
+	"github.com/lawrencegripper/azurefrontdooringress/metrics"
+)
+
+var (
+	verificationMismatches = metrics.NewCounter(
+		"frontdoor_sync_verification_mismatches_total",
+		"Routing rules which didn't match the desired state when read back after an update")
+	rollbacks = metrics.NewCounter(
+		"frontdoor_sync_rollbacks_total",
+		"Updates rolled back because the frontend was unhealthy afterwards")
+	lockLossesDuringUpdate = metrics.NewCounter(
+		"frontdoor_lock_lost_during_update_total",
+		"Updates during which the Frontdoor lock was lost, so another controller may have overwritten them")
+	updateConflicts = metrics.NewCounter(
+		"frontdoor_update_conflicts_total",
+		"Updates not made because the Frontdoor changed while the sync was running, when LOCKING_MODE is none")
+	lockUnavailable = metrics.NewGauge(
+		"frontdoor_lock_unavailable",
+		"1 if the Frontdoor lock couldn't be acquired for longer than LOCK_ALERT_AFTER, otherwise 0",
+		"frontdoor")
+	webhookFailures = metrics.NewCounter(
+		"frontdoor_webhook_failures_total",
+		"Notifications of Frontdoor updates which couldn't be posted to the webhook")
+	azureAuthFailures = metrics.NewCounter(
+		"frontdoor_azure_auth_failures_total",
+		"Azure AD tokens which couldn't be refreshed after retrying",
+		"resource")
+	providerHealthy = metrics.NewGauge(
+		"frontdoor_provider_healthy",
+		"1 if the last sync to the provider succeeded, 0 if it failed, when syncing to several providers",
+		"provider")
+	providerLastSuccessfulSync = metrics.NewGauge(
+		"frontdoor_provider_last_successful_sync_timestamp_seconds",
+		"Unix timestamp of the last successful sync to the provider, when syncing to several providers",
+		"provider")
+	providerSyncErrors = metrics.NewCounter(
+		"frontdoor_provider_sync_errors_total",
+		"Syncs to the provider which failed, when syncing to several providers",
+		"provider")
+)
@@ -0,0 +1,300 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/preview/frontdoor/mgmt/2018-08-01-preview/frontdoor"
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+)
+
+const (
+	// cdnAPIVersion is the version of the Microsoft.Cdn API used for Standard/Premium profiles
+	cdnAPIVersion = "2021-06-01"
+	// standardSku is the sku of the profile created by the migration template
+	standardSku = "Standard_AzureFrontDoor"
+	// defaultFrontendSuffix is the domain of the hostnames Frontdoor provides, other hostnames are custom domains
+	defaultFrontendSuffix = ".azurefd.net"
+)
+
+// compressedContentTypes are compressed by routes migrated with dynamic compression enabled,
+// classic Frontdoor uses a fixed list and Standard/Premium requires it to be set
+var compressedContentTypes = []string{
+	"application/javascript",
+	"application/json",
+	"application/xml",
+	"text/css",
+	"text/html",
+	"text/javascript",
+	"text/plain",
+	"text/xml",
+}
+
+// ARMTemplate is an Azure Resource Manager deployment template
+type ARMTemplate struct {
+	Schema         string        `json:"$schema"`
+	ContentVersion string        `json:"contentVersion"`
+	Resources      []ARMResource `json:"resources"`
+}
+
+// ARMResource is a resource in an ARM template
+type ARMResource struct {
+	Type       string                 `json:"type"`
+	APIVersion string                 `json:"apiVersion"`
+	Name       string                 `json:"name"`
+	Location   string                 `json:"location,omitempty"`
+	Sku        map[string]string      `json:"sku,omitempty"`
+	DependsOn  []string               `json:"dependsOn,omitempty"`
+	Properties map[string]interface{} `json:"properties,omitempty"`
+}
+
+// Migrate reads the Frontdoor and returns an ARM template for a Front Door Standard profile with the
+// equivalent of the routing rules created by the controller, along with warnings for anything which
+// can't be migrated or needs action after deployment. No changes are made.
+func Migrate(ctx context.Context, config utils.Config, profileName string) (ARMTemplate, []string, error) {
+	fd, err := Export(ctx, config)
+	if err != nil {
+		return ARMTemplate{}, nil, err
+	}
+	template, warnings := migrationTemplate(fd, profileName, config.MinimumTLSVersion)
+	return template, warnings, nil
+}
+
+// migrationTemplate converts the controller's routing rules, and the backend pools and frontend
+// endpoints they use, into origin groups, routes and custom domains in a Standard profile.
+// Custom domains require TLS minimumTLSVersion, for example '1.2'.
+func migrationTemplate(fd frontdoor.FrontDoor, profileName, minimumTLSVersion string) (ARMTemplate, []string) {
+	warnings := []string{}
+	endpointName := profileName
+	if fd.Name != nil {
+		endpointName = *fd.Name
+	}
+
+	profileID := fmt.Sprintf("[resourceId('Microsoft.Cdn/profiles', '%s')]", profileName)
+	endpointID := fmt.Sprintf("[resourceId('Microsoft.Cdn/profiles/afdEndpoints', '%s', '%s')]", profileName, endpointName)
+	resources := []ARMResource{
+		{
+			Type:       "Microsoft.Cdn/profiles",
+			APIVersion: cdnAPIVersion,
+			Name:       profileName,
+			Location:   "global",
+			Sku:        map[string]string{"name": standardSku},
+		},
+		{
+			Type:       "Microsoft.Cdn/profiles/afdEndpoints",
+			APIVersion: cdnAPIVersion,
+			Name:       profileName + "/" + endpointName,
+			Location:   "global",
+			DependsOn:  []string{profileID},
+			Properties: map[string]interface{}{"enabledState": "Enabled"},
+		},
+	}
+
+	originGroups := map[string]string{}
+	customDomains := map[string]string{}
+	routes := []ARMResource{}
+
+	rules := []frontdoor.RoutingRule{}
+	if fd.RoutingRules != nil {
+		rules = *fd.RoutingRules
+	}
+	for _, rule := range rules {
+		if rule.Name == nil || rule.RoutingRuleProperties == nil {
+			continue
+		}
+		if !strings.HasPrefix(*rule.Name, routingRulePrefix) {
+			warnings = append(warnings, fmt.Sprintf("routing rule %s isn't managed by the controller and isn't migrated", *rule.Name))
+			continue
+		}
+
+		pool := findBackendPoolByID(fd.BackendPools, subResourceID(rule.BackendPool))
+		if pool == nil {
+			warnings = append(warnings, fmt.Sprintf("routing rule %s uses a backend pool which doesn't exist, it isn't migrated", *rule.Name))
+			continue
+		}
+		poolName := *pool.Name
+		originGroupID, exists := originGroups[poolName]
+		if !exists {
+			var poolResources []ARMResource
+			originGroupID, poolResources = originGroupResources(fd, *pool, profileName, profileID)
+			originGroups[poolName] = originGroupID
+			resources = append(resources, poolResources...)
+		}
+
+		linkToDefaultDomain := "Disabled"
+		routeDomains := []map[string]string{}
+		routeDependsOn := []string{endpointID, originGroupID}
+		for _, id := range subResourceIDs(rule.FrontendEndpoints) {
+			frontend := findFrontendByID(fd.FrontendEndpoints, id)
+			if frontend == nil || frontend.HostName == nil {
+				warnings = append(warnings, fmt.Sprintf("routing rule %s uses a frontend endpoint which doesn't exist, it's left out of the route", *rule.Name))
+				continue
+			}
+			hostname := *frontend.HostName
+			if strings.HasSuffix(hostname, defaultFrontendSuffix) {
+				linkToDefaultDomain = "Enabled"
+				continue
+			}
+			domainID, exists := customDomains[hostname]
+			if !exists {
+				domainID = fmt.Sprintf("[resourceId('Microsoft.Cdn/profiles/customDomains', '%s', '%s')]", profileName, *frontend.Name)
+				customDomains[hostname] = domainID
+				resources = append(resources, ARMResource{
+					Type:       "Microsoft.Cdn/profiles/customDomains",
+					APIVersion: cdnAPIVersion,
+					Name:       profileName + "/" + *frontend.Name,
+					DependsOn:  []string{profileID},
+					Properties: map[string]interface{}{
+						"hostName": hostname,
+						"tlsSettings": map[string]string{
+							"certificateType":   "ManagedCertificate",
+							"minimumTlsVersion": "TLS" + strings.Replace(minimumTLSVersion, ".", "", 1),
+						},
+					},
+				})
+				warnings = append(warnings, fmt.Sprintf("custom domain %s must be validated with a DNS TXT record and have its CNAME moved to the new endpoint after deployment", hostname))
+			}
+			routeDomains = append(routeDomains, map[string]string{"id": domainID})
+			routeDependsOn = append(routeDependsOn, domainID)
+		}
+
+		routes = append(routes, ARMResource{
+			Type:       "Microsoft.Cdn/profiles/afdEndpoints/routes",
+			APIVersion: cdnAPIVersion,
+			Name:       profileName + "/" + endpointName + "/" + *rule.Name,
+			DependsOn:  routeDependsOn,
+			Properties: routeProperties(rule, originGroupID, routeDomains, linkToDefaultDomain),
+		})
+	}
+
+	// Routes are added last so they follow the resources they depend on
+	resources = append(resources, routes...)
+
+	return ARMTemplate{
+		Schema:         "https://schema.management.azure.com/schemas/2019-04-01/deploymentTemplate.json#",
+		ContentVersion: "1.0.0.0",
+		Resources:      resources,
+	}, warnings
+}
+
+// originGroupResources returns the ID of the origin group created for the backend pool, along with
+// the origin group and its origins
+func originGroupResources(fd frontdoor.FrontDoor, pool frontdoor.BackendPool, profileName, profileID string) (string, []ARMResource) {
+	poolName := *pool.Name
+	originGroupID := fmt.Sprintf("[resourceId('Microsoft.Cdn/profiles/originGroups', '%s', '%s')]", profileName, poolName)
+
+	properties := map[string]interface{}{}
+	if pool.BackendPoolProperties != nil {
+		if lb := findLoadBalancingSettings(fd.LoadBalancingSettings, subResourceID(pool.LoadBalancingSettings)); lb != nil {
+			properties["loadBalancingSettings"] = map[string]interface{}{
+				"sampleSize":                      lb.SampleSize,
+				"successfulSamplesRequired":       lb.SuccessfulSamplesRequired,
+				"additionalLatencyInMilliseconds": lb.AdditionalLatencyMilliseconds,
+			}
+		}
+		if probe := findHealthProbeSettings(fd.HealthProbeSettings, subResourceID(pool.HealthProbeSettings)); probe != nil {
+			properties["healthProbeSettings"] = map[string]interface{}{
+				"probePath":              probe.Path,
+				"probeProtocol":          string(probe.Protocol),
+				"probeIntervalInSeconds": probe.IntervalInSeconds,
+				"probeRequestType":       "HEAD",
+			}
+		}
+	}
+
+	resources := []ARMResource{
+		{
+			Type:       "Microsoft.Cdn/profiles/originGroups",
+			APIVersion: cdnAPIVersion,
+			Name:       profileName + "/" + poolName,
+			DependsOn:  []string{profileID},
+			Properties: properties,
+		},
+	}
+
+	if pool.BackendPoolProperties != nil && pool.Backends != nil {
+		for i, backend := range *pool.Backends {
+			origin := map[string]interface{}{
+				"hostName":     backend.Address,
+				"httpPort":     backend.HTTPPort,
+				"httpsPort":    backend.HTTPSPort,
+				"priority":     backend.Priority,
+				"weight":       backend.Weight,
+				"enabledState": string(backend.EnabledState),
+			}
+			if backend.BackendHostHeader != nil {
+				origin["originHostHeader"] = backend.BackendHostHeader
+			}
+			resources = append(resources, ARMResource{
+				Type:       "Microsoft.Cdn/profiles/originGroups/origins",
+				APIVersion: cdnAPIVersion,
+				Name:       fmt.Sprintf("%s/%s/origin-%d", profileName, poolName, i+1),
+				DependsOn:  []string{originGroupID},
+				Properties: origin,
+			})
+		}
+	}
+	return originGroupID, resources
+}
+
+// routeProperties converts the routing rule to the properties of a Standard profile route, carrying over
+// settings the controller doesn't manage but which may have been set outside it
+func routeProperties(rule frontdoor.RoutingRule, originGroupID string, customDomains []map[string]string, linkToDefaultDomain string) map[string]interface{} {
+	properties := standardRouteProperties(routeFromRoutingRule(rule), originGroupID, customDomains, linkToDefaultDomain)
+	if rule.ForwardingProtocol != "" {
+		properties["forwardingProtocol"] = string(rule.ForwardingProtocol)
+	}
+	if rule.CustomForwardingPath != nil {
+		properties["originPath"] = rule.CustomForwardingPath
+	}
+	return properties
+}
+
+func findBackendPoolByID(pools *[]frontdoor.BackendPool, id string) *frontdoor.BackendPool {
+	if pools == nil {
+		return nil
+	}
+	for i, pool := range *pools {
+		if pool.ID != nil && pool.Name != nil && strings.EqualFold(*pool.ID, id) {
+			return &(*pools)[i]
+		}
+	}
+	return nil
+}
+
+func findFrontendByID(frontends *[]frontdoor.FrontendEndpoint, id string) *frontdoor.FrontendEndpoint {
+	if frontends == nil {
+		return nil
+	}
+	for i, frontend := range *frontends {
+		if frontend.ID != nil && frontend.Name != nil && frontend.FrontendEndpointProperties != nil && strings.EqualFold(*frontend.ID, id) {
+			return &(*frontends)[i]
+		}
+	}
+	return nil
+}
+
+func findLoadBalancingSettings(settings *[]frontdoor.LoadBalancingSettingsModel, id string) *frontdoor.LoadBalancingSettingsProperties {
+	if settings == nil {
+		return nil
+	}
+	for _, s := range *settings {
+		if s.ID != nil && strings.EqualFold(*s.ID, id) {
+			return s.LoadBalancingSettingsProperties
+		}
+	}
+	return nil
+}
+
+func findHealthProbeSettings(settings *[]frontdoor.HealthProbeSettingsModel, id string) *frontdoor.HealthProbeSettingsProperties {
+	if settings == nil {
+		return nil
+	}
+	for _, s := range *settings {
+		if s.ID != nil && strings.EqualFold(*s.ID, id) {
+			return s.HealthProbeSettingsProperties
+		}
+	}
+	return nil
+}
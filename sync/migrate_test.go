@@ -0,0 +1,100 @@
+package sync
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/preview/frontdoor/mgmt/2018-08-01-preview/frontdoor"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+func TestMigrationTemplate(t *testing.T) {
+	cachedRule := testRoutingRule("Ingress-static", "/pools/Cluster1", "/static/*")
+	cachedRule.CacheConfiguration = &frontdoor.CacheConfiguration{
+		QueryParameterStripDirective: frontdoor.StripAll,
+		DynamicCompression:           frontdoor.DynamicCompressionEnabledEnabled,
+	}
+	rules := []frontdoor.RoutingRule{
+		testRoutingRule("Ingress-api", "/pools/cluster1", "/api"),
+		cachedRule,
+		testRoutingRule("Manual", "/pools/cluster1", "/manual"),
+		testRoutingRule("Ingress-missingpool", "/pools/missing", "/missing"),
+	}
+	for i := range rules {
+		rules[i].FrontendEndpoints = &[]frontdoor.SubResource{{ID: to.StringPtr("/frontends/default")}, {ID: to.StringPtr("/frontends/custom")}}
+	}
+
+	pool := testBackendPool("cluster1", "10.0.0.1")
+	pool.ID = to.StringPtr("/pools/cluster1")
+	fd := frontdoor.FrontDoor{
+		Name: to.StringPtr("fd"),
+		Properties: &frontdoor.Properties{
+			RoutingRules: &rules,
+			BackendPools: &[]frontdoor.BackendPool{pool},
+			FrontendEndpoints: &[]frontdoor.FrontendEndpoint{
+				{
+					ID:                         to.StringPtr("/frontends/default"),
+					Name:                       to.StringPtr("default"),
+					FrontendEndpointProperties: &frontdoor.FrontendEndpointProperties{HostName: to.StringPtr("fd.azurefd.net")},
+				},
+				{
+					ID:                         to.StringPtr("/frontends/custom"),
+					Name:                       to.StringPtr("custom"),
+					FrontendEndpointProperties: &frontdoor.FrontendEndpointProperties{HostName: to.StringPtr("www.example.com")},
+				},
+			},
+		},
+	}
+
+	template, warnings := migrationTemplate(fd, "profile", "1.2")
+
+	expected := map[string][]string{
+		"Microsoft.Cdn/profiles":                      {"profile"},
+		"Microsoft.Cdn/profiles/afdEndpoints":         {"profile/fd"},
+		"Microsoft.Cdn/profiles/originGroups":         {"profile/cluster1"},
+		"Microsoft.Cdn/profiles/originGroups/origins": {"profile/cluster1/origin-1"},
+		"Microsoft.Cdn/profiles/customDomains":        {"profile/custom"},
+		"Microsoft.Cdn/profiles/afdEndpoints/routes":  {"profile/fd/Ingress-api", "profile/fd/Ingress-static"},
+	}
+	actual := map[string][]string{}
+	routes := map[string]ARMResource{}
+	for _, r := range template.Resources {
+		actual[r.Type] = append(actual[r.Type], r.Name)
+		if r.Type == "Microsoft.Cdn/profiles/afdEndpoints/routes" {
+			routes[r.Name] = r
+		}
+	}
+	for resourceType := range actual {
+		sort.Strings(actual[resourceType])
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Errorf("Expected resources %v got %v", expected, actual)
+	}
+
+	// The unmanaged rule, missing pool and custom domain validation are warned about
+	if len(warnings) != 3 {
+		t.Errorf("Expected 3 warnings got %v", warnings)
+	}
+
+	for _, r := range template.Resources {
+		if r.Type == "Microsoft.Cdn/profiles/customDomains" {
+			tls := r.Properties["tlsSettings"].(map[string]string)
+			if tls["minimumTlsVersion"] != "TLS12" {
+				t.Errorf("Expected custom domain to require TLS12 got %s", tls["minimumTlsVersion"])
+			}
+		}
+	}
+
+	static := routes["profile/fd/Ingress-static"].Properties
+	if static["linkToDefaultDomain"] != "Enabled" {
+		t.Errorf("Expected route to be linked to the default domain got %v", static["linkToDefaultDomain"])
+	}
+	cache, ok := static["cacheConfiguration"].(map[string]interface{})
+	if !ok || cache["queryStringCachingBehavior"] != "IgnoreQueryString" {
+		t.Errorf("Expected route to ignore the query string when caching got %v", static["cacheConfiguration"])
+	}
+	if _, cached := routes["profile/fd/Ingress-api"].Properties["cacheConfiguration"]; cached {
+		t.Error("Expected route without cache configuration to not cache")
+	}
+}
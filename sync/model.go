@@ -0,0 +1,117 @@
+package sync
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+)
+
+// The desired state model describes the routing the controller wants, built from the ingresses without
+// the Azure SDK's types so it can be tested on its own. Translators turn it into the resources of a
+// particular API, those in classic.go for the Frontdoor API the controller updates and those in
+// standard.go for Front Door Standard/Premium, so moving to another API only needs a translator.
+// The cluster's backends are modelled by ClusterBackend.
+
+// Protocols a route accepts
+const (
+	ProtocolHTTP  = "Http"
+	ProtocolHTTPS = "Https"
+)
+
+// Route routes the paths of one of an ingress's rules to the cluster
+type Route struct {
+	Name string
+	// Host is the host of the ingress rule, empty for rules without one which use the default frontend
+	Host      string
+	Paths     []string
+	Protocols []string
+	Enabled   bool
+	// Cache is nil if the route's responses aren't cached
+	Cache *RouteCache
+}
+
+// RouteCache is how a route's responses are cached at the edge
+type RouteCache struct {
+	// DynamicCompression compresses cached responses
+	DynamicCompression bool
+	// IgnoreQueryString caches one response whatever the query string, otherwise each query string is cached separately
+	IgnoreQueryString bool
+}
+
+// Frontend is a hostname traffic is received for
+type Frontend struct {
+	Name     string
+	HostName string
+}
+
+// routesForIngress returns the routes for the paths of each of the ingress's rules, leaving out excluded
+// paths, enabled or disabled by its schedule at the time. Paths to unready services are left out too,
+// disabling the route if none are left.
+func routesForIngress(ingress *v1beta1.Ingress, now time.Time) ([]Route, error) {
+	routes := []Route{}
+	excluded := excludedPaths(ingress)
+	unready := unreadyServices(ingress)
+	cache, err := routeCacheForIngress(ingress)
+	if err != nil {
+		return nil, err
+	}
+	enabled, err := scheduledEnabled(ingress, now)
+	if err != nil {
+		return nil, err
+	}
+	// hostRules counts the ingress's rules for each host, each needs its own routing rule name
+	hostRules := map[string]int{}
+	for _, rule := range ingress.Spec.Rules {
+		if rule.HTTP == nil {
+			continue
+		}
+		paths := []string{}
+		unreadyPaths := []string{}
+		for _, path := range rule.HTTP.Paths {
+			if !strings.HasPrefix(path.Path, "/") {
+				return nil, fmt.Errorf("path %q must start with '/' to be routed by Frontdoor", path.Path)
+			}
+			if isExcludedPath(path.Path, excluded) {
+				continue
+			}
+			if unready[path.Backend.ServiceName] {
+				unreadyPaths = append(unreadyPaths, path.Path)
+				continue
+			}
+			paths = append(paths, path.Path)
+		}
+		routeEnabled := enabled
+		if len(paths) == 0 && len(unreadyPaths) > 0 {
+			// Kept disabled, rather than removed, so it's enabled again as it was when they recover
+			paths, routeEnabled = unreadyPaths, false
+		}
+		if len(paths) == 0 {
+			continue
+		}
+		name := hostRoutingRuleName(ingress, rule.Host)
+		if hostRules[rule.Host]++; hostRules[rule.Host] > 1 {
+			name = hostRoutingRuleName(ingress, fmt.Sprintf("%s#%d", rule.Host, hostRules[rule.Host]))
+		}
+		if err := utils.ValidateFrontDoorChildName(name); err != nil {
+			return nil, fmt.Errorf("generated routing rule name isn't valid in Frontdoor: %v", err)
+		}
+		routes = append(routes, Route{
+			Name:      name,
+			Host:      rule.Host,
+			Paths:     paths,
+			Protocols: []string{ProtocolHTTP, ProtocolHTTPS},
+			Enabled:   routeEnabled,
+			Cache:     cache,
+		})
+	}
+	if len(routes) == 0 {
+		if len(excluded) > 0 {
+			return nil, fmt.Errorf("ingress has no http paths left to route after excluding %v", excluded)
+		}
+		return nil, fmt.Errorf("ingress has no http rules to route")
+	}
+	return routes, nil
+}
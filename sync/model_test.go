@@ -0,0 +1,88 @@
+package sync
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest/to"
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+)
+
+func TestRoutesForIngress(t *testing.T) {
+	ingress := testIngress("app", "/api", "/internal", "/web")
+	ingress.Spec.Rules[0].Host = "app.contoso.com"
+	ingress.Annotations = map[string]string{
+		excludePathsAnnotation:       "/internal",
+		dynamicCompressionAnnotation: "Enabled",
+		disabledScheduleAnnotation:   "2019-06-07T11:00:00Z/2019-06-07T13:00:00Z",
+	}
+	inMaintenance, _ := time.Parse(time.RFC3339, "2019-06-07T12:00:00Z")
+
+	routes, err := routesForIngress(ingress, inMaintenance)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Route{{
+		Name:      hostRoutingRuleName(ingress, "app.contoso.com"),
+		Host:      "app.contoso.com",
+		Paths:     []string{"/api", "/web"},
+		Protocols: []string{ProtocolHTTP, ProtocolHTTPS},
+		Enabled:   false,
+		Cache:     &RouteCache{DynamicCompression: true},
+	}}
+	if !reflect.DeepEqual(routes, expected) {
+		t.Errorf("Expected routes %+v got %+v", expected, routes)
+	}
+}
+
+func TestRoutesForIngressNamesEachRuleUniquely(t *testing.T) {
+	ingress := testIngress("app", "/api")
+	http := ingress.Spec.Rules[0].IngressRuleValue
+	ingress.Spec.Rules = []v1beta1.IngressRule{
+		{IngressRuleValue: http},
+		{Host: "a.example.com", IngressRuleValue: http},
+		{Host: "b.example.com", IngressRuleValue: http},
+		{Host: "a.example.com", IngressRuleValue: http},
+		{IngressRuleValue: http},
+	}
+	routes, err := routesForIngress(ingress, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := map[string]bool{}
+	for _, route := range routes {
+		if names[route.Name] {
+			t.Errorf("Expected each rule of the ingress to have its own name, got %s twice", route.Name)
+		}
+		names[route.Name] = true
+	}
+	if routes[0].Name != routingRuleName(ingress) {
+		t.Error("Expected the rule without a host to keep the ingress's rule name")
+	}
+}
+
+func TestRoutesForIngressWithOnlyExcludedPaths(t *testing.T) {
+	ingress := testIngress("app", "/internal")
+	ingress.Annotations = map[string]string{excludePathsAnnotation: "/internal"}
+	if _, err := routesForIngress(ingress, time.Now()); err == nil {
+		t.Error("Expected an error for an ingress with no paths left to route")
+	}
+}
+
+func TestClassicRoutingRuleRoundTrips(t *testing.T) {
+	route := Route{
+		Name:      "Ingress-default-app",
+		Paths:     []string{"/api", "/web"},
+		Protocols: []string{ProtocolHTTP, ProtocolHTTPS},
+		Enabled:   true,
+		Cache:     &RouteCache{IgnoreQueryString: true},
+	}
+	rule := classicRoutingRule(route, to.StringPtr("pool"), to.StringPtr("frontend"))
+	if to.String((*rule.FrontendEndpoints)[0].ID) != "frontend" || to.String(rule.BackendPool.ID) != "pool" {
+		t.Errorf("Expected rule bound to the frontend and pool got %+v", rule.RoutingRuleProperties)
+	}
+	if got := routeFromRoutingRule(rule); !reflect.DeepEqual(got, route) {
+		t.Errorf("Expected route %+v got %+v", route, got)
+	}
+}
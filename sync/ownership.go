@@ -0,0 +1,228 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"reflect"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/preview/frontdoor/mgmt/2018-08-01-preview/frontdoor"
+	"github.com/Azure/azure-storage-blob-go/2016-05-31/azblob"
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+)
+
+// managedField is a field of a routing rule which is set by the controller
+type managedField struct {
+	name string
+	// get returns a normalized value which can be compared with reflect.DeepEqual
+	get func(*frontdoor.RoutingRuleProperties) interface{}
+	// set copies the field from src to dst
+	set func(dst, src *frontdoor.RoutingRuleProperties)
+}
+
+// managedRoutingRuleFields are the fields of a routing rule the controller sets from an ingress
+var managedRoutingRuleFields = []managedField{
+	{
+		name: "patternsToMatch",
+		get:  func(p *frontdoor.RoutingRuleProperties) interface{} { return sortedStrings(p.PatternsToMatch) },
+		set:  func(dst, src *frontdoor.RoutingRuleProperties) { dst.PatternsToMatch = src.PatternsToMatch },
+	},
+	{
+		name: "acceptedProtocols",
+		get:  func(p *frontdoor.RoutingRuleProperties) interface{} { return protocolStrings(p.AcceptedProtocols) },
+		set:  func(dst, src *frontdoor.RoutingRuleProperties) { dst.AcceptedProtocols = src.AcceptedProtocols },
+	},
+	{
+		name: "enabledState",
+		get:  func(p *frontdoor.RoutingRuleProperties) interface{} { return p.EnabledState },
+		set:  func(dst, src *frontdoor.RoutingRuleProperties) { dst.EnabledState = src.EnabledState },
+	},
+	{
+		// Azure may change the case of resource IDs
+		name: "backendPool",
+		get: func(p *frontdoor.RoutingRuleProperties) interface{} {
+			return strings.ToLower(subResourceID(p.BackendPool))
+		},
+		set: func(dst, src *frontdoor.RoutingRuleProperties) { dst.BackendPool = src.BackendPool },
+	},
+	{
+		name: "frontendEndpoints",
+		get: func(p *frontdoor.RoutingRuleProperties) interface{} {
+			return strings.ToLower(strings.Join(subResourceIDs(p.FrontendEndpoints), ","))
+		},
+		set: func(dst, src *frontdoor.RoutingRuleProperties) { dst.FrontendEndpoints = src.FrontendEndpoints },
+	},
+	{
+		name: "cacheConfiguration",
+		get: func(p *frontdoor.RoutingRuleProperties) interface{} {
+			if p.CacheConfiguration == nil {
+				return frontdoor.CacheConfiguration{}
+			}
+			return *p.CacheConfiguration
+		},
+		set: func(dst, src *frontdoor.RoutingRuleProperties) { dst.CacheConfiguration = src.CacheConfiguration },
+	},
+}
+
+// mergeRoutingRules applies the desired rules to the existing rules in Frontdoor, following the ownership mode,
+// rules which aren't desired are left unchanged
+//
+// Strict: desired rules replace any existing rule with the same name, reverting manual edits
+// Merge: managed fields which were changed outside the controller since it last applied them are left alone,
+// as are any fields the controller doesn't manage
+func (p *Synchronizer) mergeRoutingRules(ctx context.Context, existing, desired []frontdoor.RoutingRule) []frontdoor.RoutingRule {
+	logger := utils.GetLogger(ctx)
+
+	desiredByName := map[string]frontdoor.RoutingRule{}
+	for _, rule := range desired {
+		desiredByName[*rule.Name] = rule
+	}
+
+	merged := make([]frontdoor.RoutingRule, 0, len(existing)+len(desired))
+	for _, current := range existing {
+		if current.Name == nil {
+			merged = append(merged, current)
+			continue
+		}
+		want, isDesired := desiredByName[*current.Name]
+		if !isDesired {
+			merged = append(merged, current)
+			continue
+		}
+		delete(desiredByName, *current.Name)
+
+		ruleLogger := logger.WithField("ruleName", *current.Name)
+		if p.ownershipMode != utils.OwnershipModeMerge || current.RoutingRuleProperties == nil {
+			if current.RoutingRuleProperties != nil {
+				if diffs := diffRoutingRule(want, current); len(diffs) > 0 {
+					ruleLogger.WithField("differences", diffs).WithField(utils.EventField, "DriftReverted").Info("Reverting changes made outside the controller to routing rule")
+				}
+			}
+			merged = append(merged, want)
+			continue
+		}
+
+		lastApplied, known := p.lastApplied[*current.Name]
+		// Copy the properties so the existing state isn't modified
+		props := *current.RoutingRuleProperties
+		for _, field := range managedRoutingRuleFields {
+			externallyModified := known && !reflect.DeepEqual(field.get(&props), field.get(lastApplied.RoutingRuleProperties))
+			if externallyModified {
+				if !reflect.DeepEqual(field.get(&props), field.get(want.RoutingRuleProperties)) {
+					ruleLogger.
+						WithField("field", field.name).
+						WithField("current", field.get(&props)).
+						WithField("desired", field.get(want.RoutingRuleProperties)).
+						Info("Leaving field modified outside the controller unchanged")
+				}
+				continue
+			}
+			field.set(&props, want.RoutingRuleProperties)
+		}
+		current.RoutingRuleProperties = &props
+		merged = append(merged, current)
+	}
+
+	// Add new rules in the order they were desired
+	for _, rule := range desired {
+		if _, isNew := desiredByName[*rule.Name]; isNew {
+			merged = append(merged, rule)
+		}
+	}
+
+	return merged
+}
+
+// recordApplied stores the rules the controller applied so later external changes can be detected
+func (p *Synchronizer) recordApplied(desired []frontdoor.RoutingRule) {
+	if p.lastApplied == nil {
+		p.lastApplied = map[string]frontdoor.RoutingRule{}
+	}
+	for _, rule := range desired {
+		if previous, known := p.lastApplied[*rule.Name]; !known || len(diffRoutingRule(previous, rule)) > 0 {
+			p.appliedChanged = true
+		}
+		p.lastApplied[*rule.Name] = rule
+	}
+}
+
+// appliedRulesStore persists the rules last applied in merge mode, so changes made outside the controller
+// before it restarts are still told apart from its own and aren't reverted
+type appliedRulesStore interface {
+	load(ctx context.Context) (map[string]frontdoor.RoutingRule, error)
+	save(ctx context.Context, rules map[string]frontdoor.RoutingRule) error
+}
+
+// newAppliedRulesStore returns the store for the rules last applied, alongside the lock, nil outside merge
+// mode or without a storage account, when they're only kept in memory
+func newAppliedRulesStore(ctx context.Context, config utils.Config) (appliedRulesStore, error) {
+	if config.OwnershipMode != utils.OwnershipModeMerge || !config.NeedsStorageAccount() {
+		return nil, nil
+	}
+	container, err := ensureStorageContainer(ctx, config, lockContainerName)
+	if err != nil {
+		return nil, err
+	}
+	return &blobAppliedRules{blob: container.NewBlockBlobURL(fmt.Sprintf("applied-%s-%s.json", config.FrontDoorName, config.ClusterName))}, nil
+}
+
+// loadAppliedRules loads the rules last applied before the controller restarted, if they're persisted
+func (p *Synchronizer) loadAppliedRules(ctx context.Context) error {
+	if p.appliedRules == nil {
+		return nil
+	}
+	rules, err := p.appliedRules.load(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to load routing rules last applied: %v", err)
+	}
+	p.lastApplied = rules
+	return nil
+}
+
+// commitAppliedRules saves the rules last applied once an update succeeds, if they changed. Failing to
+// save them doesn't fail the sync, they're saved again by the next sync.
+func (p *Synchronizer) commitAppliedRules(ctx context.Context) {
+	if p.appliedRules == nil || !p.appliedChanged {
+		return
+	}
+	if err := p.appliedRules.save(ctx, p.lastApplied); err != nil {
+		utils.GetLogger(ctx).WithError(err).Warn("Failed to save routing rules last applied")
+		return
+	}
+	p.appliedChanged = false
+}
+
+// blobAppliedRules keeps the rules last applied as JSON in a blob alongside the lock
+type blobAppliedRules struct {
+	blob azblob.BlockBlobURL
+}
+
+func (r *blobAppliedRules) load(ctx context.Context) (map[string]frontdoor.RoutingRule, error) {
+	rules := map[string]frontdoor.RoutingRule{}
+	resp, err := r.blob.GetBlob(ctx, azblob.BlobRange{}, azblob.BlobAccessConditions{}, false)
+	if storageErr, ok := err.(azblob.StorageError); ok && storageErr.ServiceCode() == azblob.ServiceCodeBlobNotFound {
+		return rules, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	body := resp.Body()
+	defer body.Close() //nolint: errcheck
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	return rules, json.Unmarshal(data, &rules)
+}
+
+func (r *blobAppliedRules) save(ctx context.Context, rules map[string]frontdoor.RoutingRule) error {
+	data, err := json.Marshal(rules)
+	if err != nil {
+		return err
+	}
+	_, err = r.blob.PutBlob(ctx, bytes.NewReader(data), azblob.BlobHTTPHeaders{ContentType: "application/json"}, azblob.Metadata{}, azblob.BlobAccessConditions{})
+	return err
+}
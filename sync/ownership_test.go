@@ -0,0 +1,100 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/preview/frontdoor/mgmt/2018-08-01-preview/frontdoor"
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+)
+
+func TestMergeRoutingRules(t *testing.T) {
+	applied := testRoutingRule("Ingress-app", "/pools/cluster1", "/app")
+	// Someone has edited the patterns in the portal
+	edited := testRoutingRule("Ingress-app", "/pools/cluster1", "/app", "/manual")
+	unowned := testRoutingRule("manual-rule", "/pools/other", "/other")
+	// The ingress has since moved to a new pool
+	desired := testRoutingRule("Ingress-app", "/pools/cluster2", "/app")
+	added := testRoutingRule("Ingress-new", "/pools/cluster1", "/new")
+
+	testCases := []struct {
+		mode             string
+		expectedPatterns []string
+	}{
+		{mode: utils.OwnershipModeStrict, expectedPatterns: []string{"/app"}},
+		{mode: utils.OwnershipModeMerge, expectedPatterns: []string{"/app", "/manual"}},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.mode, func(t *testing.T) {
+			p := &Synchronizer{ownershipMode: test.mode}
+			p.recordApplied([]frontdoor.RoutingRule{applied})
+
+			merged := p.mergeRoutingRules(context.Background(),
+				[]frontdoor.RoutingRule{edited, unowned},
+				[]frontdoor.RoutingRule{desired, added})
+
+			if len(merged) != 3 {
+				t.Fatalf("Expected 3 rules, got %d", len(merged))
+			}
+			if *merged[1].Name != "manual-rule" || len(diffRoutingRule(unowned, merged[1])) > 0 {
+				t.Error("Expected rule not owned by the controller to be unchanged")
+			}
+			if *merged[2].Name != "Ingress-new" {
+				t.Error("Expected new rule to be added")
+			}
+
+			props := merged[0].RoutingRuleProperties
+			if *props.BackendPool.ID != "/pools/cluster2" {
+				t.Errorf("Expected unmodified field to be updated, got %s", *props.BackendPool.ID)
+			}
+			if patterns := sortedStrings(props.PatternsToMatch); len(patterns) != len(test.expectedPatterns) {
+				t.Errorf("Expected patterns %v, got %v", test.expectedPatterns, patterns)
+			}
+		})
+	}
+}
+
+type fakeAppliedRulesStore struct {
+	saved map[string]frontdoor.RoutingRule
+}
+
+func (s *fakeAppliedRulesStore) load(ctx context.Context) (map[string]frontdoor.RoutingRule, error) {
+	data, err := json.Marshal(s.saved)
+	if err != nil {
+		return nil, err
+	}
+	rules := map[string]frontdoor.RoutingRule{}
+	return rules, json.Unmarshal(data, &rules)
+}
+
+func (s *fakeAppliedRulesStore) save(ctx context.Context, rules map[string]frontdoor.RoutingRule) error {
+	s.saved = map[string]frontdoor.RoutingRule{}
+	for name, rule := range rules {
+		s.saved[name] = rule
+	}
+	return nil
+}
+
+func TestMergeKeepsExternalChangesAfterRestart(t *testing.T) {
+	ctx := context.Background()
+	applied := testRoutingRule("Ingress-app", "/pools/cluster1", "/app")
+	// Edited in the portal while the controller restarted
+	edited := testRoutingRule("Ingress-app", "/pools/cluster1", "/app", "/manual")
+
+	store := &fakeAppliedRulesStore{}
+	before := &Synchronizer{ownershipMode: utils.OwnershipModeMerge, appliedRules: store}
+	before.recordApplied([]frontdoor.RoutingRule{applied})
+	before.commitAppliedRules(ctx)
+
+	after := &Synchronizer{ownershipMode: utils.OwnershipModeMerge, appliedRules: store}
+	if err := after.loadAppliedRules(ctx); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	merged := after.mergeRoutingRules(ctx, []frontdoor.RoutingRule{edited}, []frontdoor.RoutingRule{applied})
+	if patterns := sortedStrings(merged[0].PatternsToMatch); len(patterns) != 2 {
+		t.Errorf("Expected the change made before the restart to be kept, got patterns %v", patterns)
+	}
+}
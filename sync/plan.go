@@ -0,0 +1,162 @@
+package sync
+
+import (
+	"context"
+	"reflect"
+	"sort"
+
+	"github.com/Azure/azure-sdk-for-go/services/preview/frontdoor/mgmt/2018-08-01-preview/frontdoor"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+)
+
+// SyncPlan describes the changes a sync of the ingresses would make to Frontdoor
+type SyncPlan struct {
+	// Changes is set when applying the plan would change Frontdoor
+	Changes       bool          `json:"changes"`
+	RulesToAdd    []PlannedRule `json:"rulesToAdd"`
+	RulesToUpdate []PlannedRule `json:"rulesToUpdate"`
+	RulesToDelete []string      `json:"rulesToDelete"`
+	BackendPools  []PlannedPool `json:"backendPools"`
+	// FrontendEndpointsToAdd are the hosts custom domain frontends would be added for
+	FrontendEndpointsToAdd []string `json:"frontendEndpointsToAdd"`
+	// Failed holds the error for each ingress which couldn't be planned keyed by 'namespace/name'
+	Failed map[string]string `json:"failed"`
+	// Diff is every field of the Frontdoor the sync would change
+	Diff Diff `json:"diff"`
+}
+
+// PlannedRule is a routing rule a sync would add or update
+type PlannedRule struct {
+	Name    string `json:"name"`
+	Ingress string `json:"ingress"`
+	// Differences from the rule currently in Frontdoor, set for updates
+	Differences []string              `json:"differences,omitempty"`
+	Rule        frontdoor.RoutingRule `json:"rule"`
+}
+
+// PlannedPool is a backend pool a sync would add or whose backends it would change
+type PlannedPool struct {
+	Name     string   `json:"name"`
+	Added    bool     `json:"added"`
+	Backends []string `json:"backends"`
+}
+
+// Plan reads the Frontdoor and returns the changes syncing the ingresses would make, nothing is changed
+func Plan(ctx context.Context, config utils.Config, ingresses []*v1beta1.Ingress) (*SyncPlan, error) {
+	p, err := newSynchronizer(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	fd, err := p.getCurrentState(ctx)
+	if err != nil {
+		return nil, err
+	}
+	err = p.loadRequiredResources(fd, config)
+	if err != nil {
+		return nil, err
+	}
+	return p.plan(ctx, fd, ingresses)
+}
+
+// plan works out the changes syncing the ingresses would make to the Frontdoor
+func (p *Synchronizer) plan(ctx context.Context, fdState frontdoor.FrontDoor, ingresses []*v1beta1.Ingress) (*SyncPlan, error) {
+	// Backend pools are modified in place so copy the state before adding the ingresses
+	current, err := copyFrontDoor(fdState)
+	if err != nil {
+		return nil, err
+	}
+
+	result, rulesToAdd, ruleOwners := p.addIngresses(ctx, &fdState, ingresses)
+	existingRules := []frontdoor.RoutingRule{}
+	if fdState.RoutingRules != nil {
+		existingRules = *fdState.RoutingRules
+	}
+	// Renamed legacy rules are planned as a delete of the old name and an add of the new
+	renamedRules := p.renameLegacyRoutingRules(ctx, fdState, existingRules, ingresses, result)
+	mergedRules := p.mergeRoutingRules(ctx, renamedRules, rulesToAdd)
+	mergedRules = p.keepSharedRoutingRules(ctx, fdState, existingRules, mergedRules, ingresses, result)
+	mergedRules = p.applyDefaultRoute(ctx, mergedRules)
+
+	plan := &SyncPlan{
+		RulesToAdd:             []PlannedRule{},
+		RulesToUpdate:          []PlannedRule{},
+		RulesToDelete:          []string{},
+		BackendPools:           []PlannedPool{},
+		FrontendEndpointsToAdd: []string{},
+		Failed:                 map[string]string{},
+	}
+	for key, err := range result.Failed {
+		plan.Failed[key] = err.Error()
+	}
+
+	existingByName := map[string]frontdoor.RoutingRule{}
+	for _, rule := range existingRules {
+		if rule.Name != nil {
+			existingByName[*rule.Name] = rule
+		}
+	}
+	mergedNames := map[string]bool{}
+	for _, rule := range mergedRules {
+		if rule.Name == nil {
+			continue
+		}
+		mergedNames[*rule.Name] = true
+		owner := ruleOwners[*rule.Name]
+		if owner == "" {
+			continue
+		}
+		existing, exists := existingByName[*rule.Name]
+		if !exists {
+			plan.RulesToAdd = append(plan.RulesToAdd, PlannedRule{Name: *rule.Name, Ingress: owner, Rule: rule})
+		} else if diffs := diffRoutingRule(rule, existing); len(diffs) > 0 {
+			plan.RulesToUpdate = append(plan.RulesToUpdate, PlannedRule{Name: *rule.Name, Ingress: owner, Differences: diffs, Rule: rule})
+		}
+	}
+	for name := range existingByName {
+		if !mergedNames[name] {
+			plan.RulesToDelete = append(plan.RulesToDelete, name)
+		}
+	}
+	sort.Strings(plan.RulesToDelete)
+
+	if fdState.BackendPools != nil {
+		for _, pool := range *fdState.BackendPools {
+			if pool.Name == nil || pool.BackendPoolProperties == nil {
+				continue
+			}
+			before := findBackendPool(current, *pool.Name)
+			if before != nil && before.BackendPoolProperties != nil && reflect.DeepEqual(before.Backends, pool.Backends) {
+				continue
+			}
+			planned := PlannedPool{Name: *pool.Name, Added: before == nil, Backends: []string{}}
+			if pool.Backends != nil {
+				for _, backend := range *pool.Backends {
+					planned.Backends = append(planned.Backends, to.String(backend.Address))
+				}
+			}
+			plan.BackendPools = append(plan.BackendPools, planned)
+		}
+	}
+
+	if fdState.FrontendEndpoints != nil {
+		for _, frontend := range *fdState.FrontendEndpoints {
+			if frontend.FrontendEndpointProperties != nil && frontend.HostName != nil && findFrontendEndpoint(current, *frontend.HostName) == nil {
+				plan.FrontendEndpointsToAdd = append(plan.FrontendEndpointsToAdd, *frontend.HostName)
+			}
+		}
+	}
+
+	// The rules are set on a copy of the properties as the caller's Frontdoor isn't changed
+	planned := fdState
+	if fdState.Properties != nil {
+		properties := *fdState.Properties
+		properties.RoutingRules = &mergedRules
+		planned.Properties = &properties
+	}
+	plan.Diff = DiffFrontDoor(current, planned)
+
+	plan.Changes = len(plan.RulesToAdd)+len(plan.RulesToUpdate)+len(plan.RulesToDelete)+len(plan.BackendPools)+len(plan.FrontendEndpointsToAdd) > 0
+	return plan, nil
+}
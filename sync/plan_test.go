@@ -0,0 +1,88 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/preview/frontdoor/mgmt/2018-08-01-preview/frontdoor"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+	log "github.com/sirupsen/logrus"
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func testIngress(name string, paths ...string) *v1beta1.Ingress {
+	httpPaths := []v1beta1.HTTPIngressPath{}
+	for _, path := range paths {
+		httpPaths = append(httpPaths, v1beta1.HTTPIngressPath{Path: path})
+	}
+	return &v1beta1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Spec: v1beta1.IngressSpec{
+			Rules: []v1beta1.IngressRule{{
+				IngressRuleValue: v1beta1.IngressRuleValue{HTTP: &v1beta1.HTTPIngressRuleValue{Paths: httpPaths}},
+			}},
+		},
+	}
+}
+
+func TestPlanListsRuleChanges(t *testing.T) {
+	ctx := utils.WithLogger(context.Background(), log.WithField("test", t.Name()))
+	pool := testBackendPool("cluster1", "10.0.0.1")
+	pool.ID = to.StringPtr("/frontDoors/fd1/backendPools/cluster1")
+	frontend := frontdoor.FrontendEndpoint{ID: to.StringPtr("/frontDoors/fd1/frontendEndpoints/default")}
+	p := &Synchronizer{clusterName: "cluster1", backendPool: pool, endPoint: frontend, ownershipMode: utils.OwnershipModeStrict}
+
+	unchanged, err := p.routingRulesForIngress(testIngress("same", "/same"), pool.ID, map[string]*string{"": frontend.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	changed, err := p.routingRulesForIngress(testIngress("changed", "/old"), pool.ID, map[string]*string{"": frontend.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	fd := frontdoor.FrontDoor{
+		ID: to.StringPtr("/frontDoors/fd1"),
+		Properties: &frontdoor.Properties{
+			BackendPools:      &[]frontdoor.BackendPool{pool},
+			FrontendEndpoints: &[]frontdoor.FrontendEndpoint{frontend},
+			RoutingRules:      &[]frontdoor.RoutingRule{unchanged[0], changed[0]},
+		},
+	}
+
+	plan, err := p.plan(ctx, fd, []*v1beta1.Ingress{
+		testIngress("same", "/same"),
+		testIngress("changed", "/new"),
+		testIngress("added", "/added"),
+		testIngress("broken", "no-slash"),
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	if !plan.Changes {
+		t.Error("Expected the plan to have changes")
+	}
+	if len(plan.RulesToAdd) != 1 || plan.RulesToAdd[0].Name != routingRuleName(testIngress("added")) || plan.RulesToAdd[0].Ingress != "default/added" {
+		t.Errorf("Expected the rule for default/added to be added, got %+v", plan.RulesToAdd)
+	}
+	if len(plan.RulesToUpdate) != 1 || plan.RulesToUpdate[0].Name != routingRuleName(testIngress("changed")) || len(plan.RulesToUpdate[0].Differences) == 0 {
+		t.Errorf("Expected the rule for default/changed to be updated with its differences, got %+v", plan.RulesToUpdate)
+	}
+	if len(plan.RulesToDelete) != 0 || len(plan.BackendPools) != 0 || len(plan.FrontendEndpointsToAdd) != 0 {
+		t.Errorf("Expected no other changes, got %+v", plan)
+	}
+	if _, failed := plan.Failed["default/broken"]; !failed || len(plan.Failed) != 1 {
+		t.Errorf("Expected only default/broken to fail, got %v", plan.Failed)
+	}
+	changedPath := fmt.Sprintf("routingRules[%s].patternsToMatch", routingRuleName(testIngress("changed")))
+	addedPath := fmt.Sprintf("routingRules[%s]", routingRuleName(testIngress("added")))
+	if len(plan.Diff) != 2 || plan.Diff[0].Path != addedPath || plan.Diff[1].Path != changedPath {
+		t.Errorf("Expected the diff to have the added and changed rules, got\n%s", plan.Diff)
+	}
+	if len(*fd.RoutingRules) != 2 {
+		t.Error("Expected the Frontdoor passed in to be unchanged")
+	}
+}
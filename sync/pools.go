@@ -0,0 +1,181 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/preview/frontdoor/mgmt/2018-08-01-preview/frontdoor"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+)
+
+// namespaceBackendPoolName returns the name of the backend pool used for a namespace
+// when each namespace has its own pool
+func namespaceBackendPoolName(clusterName, namespace string) string {
+	return fmt.Sprintf("%s-%s", clusterName, namespace)
+}
+
+const (
+	// DefaultBackendWeight is the weight of the cluster's backends unless their service sets one
+	DefaultBackendWeight = 50
+	// DefaultHTTPPort and DefaultHTTPSPort are used for backends which don't set their ports
+	DefaultHTTPPort  = 80
+	DefaultHTTPSPort = 443
+)
+
+// ClusterBackend is an address in the cluster Frontdoor sends traffic to, such as the load
+// balancer of one of the cluster's ingress controllers
+type ClusterBackend struct {
+	Address string `json:"address"`
+	// Weight is the share of the cluster's traffic sent to the backend relative to its other backends
+	Weight int32 `json:"weight"`
+	// HTTPPort and HTTPSPort are the load balancer's ports Frontdoor connects to, the defaults are used if zero
+	HTTPPort  int32 `json:"httpPort,omitempty"`
+	HTTPSPort int32 `json:"httpsPort,omitempty"`
+}
+
+// setClusterBackends replaces the backends of the cluster's pool, and its pools for the namespaces of the
+// ingresses synced, with the cluster's backends. Pools are matched by their exact name as another cluster's
+// name may start with this one's. Other settings of existing backends, such as their host header, are kept.
+// Nothing is changed if there are no backends so the cluster's traffic isn't dropped.
+func (p *Synchronizer) setClusterBackends(fd *frontdoor.FrontDoor, backends []ClusterBackend, ingresses []*v1beta1.Ingress) {
+	if len(backends) == 0 || fd.BackendPools == nil {
+		return
+	}
+	clusterPools := map[string]bool{p.clusterName: true}
+	if p.poolPerNamespace {
+		for _, ingress := range ingresses {
+			if ingress != nil {
+				clusterPools[namespaceBackendPoolName(p.clusterName, ingress.Namespace)] = true
+			}
+		}
+	}
+	for i, pool := range *fd.BackendPools {
+		if pool.Name == nil || !clusterPools[*pool.Name] {
+			continue
+		}
+		existing := map[string]frontdoor.Backend{}
+		if pool.BackendPoolProperties != nil && pool.Backends != nil {
+			for _, backend := range *pool.Backends {
+				if backend.Address != nil {
+					existing[*backend.Address] = backend
+				}
+			}
+		}
+
+		updated := []frontdoor.Backend{}
+		for _, clusterBackend := range backends {
+			var existingBackend *frontdoor.Backend
+			if backend, ok := existing[clusterBackend.Address]; ok {
+				existingBackend = &backend
+			}
+			updated = append(updated, classicBackend(existingBackend, clusterBackend, p.backendPriority))
+		}
+
+		if pool.BackendPoolProperties == nil {
+			(*fd.BackendPools)[i].BackendPoolProperties = &frontdoor.BackendPoolProperties{}
+		}
+		(*fd.BackendPools)[i].Backends = &updated
+	}
+}
+
+// setBackend adds the backend to the pool, replacing any backend with the same address so
+// a change to its settings, such as its priority, is applied when the controller restarts
+func setBackend(pool *frontdoor.BackendPool, backend frontdoor.Backend) {
+	backends := []frontdoor.Backend{}
+	if pool.BackendPoolProperties == nil {
+		pool.BackendPoolProperties = &frontdoor.BackendPoolProperties{}
+	}
+	if pool.Backends != nil {
+		backends = *pool.Backends
+	}
+	for i, existing := range backends {
+		if existing.Address != nil && backend.Address != nil && *existing.Address == *backend.Address {
+			backends[i] = backend
+			pool.Backends = &backends
+			return
+		}
+	}
+	backends = append(backends, backend)
+	pool.Backends = &backends
+}
+
+// removeUnusedIngressPools removes the backend pools the cluster created for a single ingress which no
+// routing rule is bound to, as the ingress was deleted or no longer needs its own pool. The rules of every
+// cluster sharing the Frontdoor are kept in it so a pool another cluster uses is never removed. Pools
+// the cluster didn't record creating are kept, whatever they're named.
+func (p *Synchronizer) removeUnusedIngressPools(ctx context.Context, fd *frontdoor.FrontDoor, rules []frontdoor.RoutingRule) {
+	if fd.Properties == nil || fd.BackendPools == nil {
+		return
+	}
+	used := map[string]bool{}
+	for _, rule := range rules {
+		if rule.RoutingRuleProperties == nil {
+			continue
+		}
+		// Pools added in this sync don't have an ID yet so they're matched by name
+		used[strings.ToLower(childResourceName(subResourceID(rule.BackendPool)))] = true
+	}
+
+	// Pools removed are only forgotten by the next sync, once they're gone, in case this update fails
+	p.forgetRemovedIngressPools(*fd)
+	kept := []frontdoor.BackendPool{}
+	for _, pool := range *fd.BackendPools {
+		if pool.Name == nil || used[strings.ToLower(*pool.Name)] || !p.isIngressPool(*pool.Name) {
+			kept = append(kept, pool)
+			continue
+		}
+		utils.GetLogger(ctx).WithField("backendPool", *pool.Name).Info("Removing backend pool created for an ingress as no routing rule uses it")
+	}
+	fd.BackendPools = &kept
+}
+
+// childResourceName returns the name of the Frontdoor child resource with the ID
+func childResourceName(id string) string {
+	return id[strings.LastIndex(id, "/")+1:]
+}
+
+// ensureNamespaceBackendPool returns the ID of the backend pool for the namespace, adding it to the
+// Frontdoor if it doesn't exist. New pools copy the backends and settings of the cluster's pool.
+func (p *Synchronizer) ensureNamespaceBackendPool(fd *frontdoor.FrontDoor, namespace string) (*string, error) {
+	name := namespaceBackendPoolName(p.clusterName, namespace)
+	if err := utils.ValidateFrontDoorChildName(name); err != nil {
+		return nil, fmt.Errorf("backend pool name for namespace isn't valid in Frontdoor: %v", err)
+	}
+
+	if fd.ID == nil {
+		return nil, fmt.Errorf("Frontdoor has no ID, unable to reference backend pool %s", name)
+	}
+	// Pools added in this sync don't have an ID yet so build it from the Frontdoor's
+	poolID := to.StringPtr(fmt.Sprintf("%s/backendPools/%s", *fd.ID, name))
+
+	if pool := findBackendPool(*fd, name); pool != nil {
+		if pool.ID != nil {
+			return pool.ID, nil
+		}
+		return poolID, nil
+	}
+
+	template := findBackendPool(*fd, p.clusterName)
+	if template == nil || template.BackendPoolProperties == nil {
+		return nil, fmt.Errorf("Frontdoor instance doesn't have a backendPool for cluster, require a configured pool named %s to exist", p.clusterName)
+	}
+
+	pools := []frontdoor.BackendPool{}
+	if fd.BackendPools != nil {
+		pools = *fd.BackendPools
+	}
+	pools = append(pools, frontdoor.BackendPool{
+		Name: to.StringPtr(name),
+		BackendPoolProperties: &frontdoor.BackendPoolProperties{
+			Backends:              template.Backends,
+			LoadBalancingSettings: template.LoadBalancingSettings,
+			HealthProbeSettings:   template.HealthProbeSettings,
+		},
+	})
+	fd.BackendPools = &pools
+
+	return poolID, nil
+}
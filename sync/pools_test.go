@@ -0,0 +1,78 @@
+package sync
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/preview/frontdoor/mgmt/2018-08-01-preview/frontdoor"
+	"github.com/Azure/go-autorest/autorest/to"
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+)
+
+func TestSetBackendReplacesBackendWithSameAddress(t *testing.T) {
+	pool := testBackendPool("cluster1", "10.0.0.1", "10.0.0.2")
+
+	setBackend(&pool, frontdoor.Backend{Address: to.StringPtr("10.0.0.2"), Priority: to.Int32Ptr(2)})
+	if len(*pool.Backends) != 2 || to.Int32((*pool.Backends)[1].Priority) != 2 {
+		t.Errorf("Expected the existing backend to be updated with its new priority, got %+v", *pool.Backends)
+	}
+
+	setBackend(&pool, frontdoor.Backend{Address: to.StringPtr("10.0.0.3"), Priority: to.Int32Ptr(1)})
+	if len(*pool.Backends) != 3 || to.String((*pool.Backends)[2].Address) != "10.0.0.3" {
+		t.Errorf("Expected a backend with a new address to be added, got %+v", *pool.Backends)
+	}
+}
+
+func TestSetClusterBackends(t *testing.T) {
+	p := &Synchronizer{clusterName: "cluster1", backendPriority: 2, poolPerNamespace: true}
+	ingress := testIngress("app", "/")
+	ingress.Namespace = "team-a"
+	fd := frontdoor.FrontDoor{Properties: &frontdoor.Properties{BackendPools: &[]frontdoor.BackendPool{
+		{Name: to.StringPtr("cluster1"), BackendPoolProperties: &frontdoor.BackendPoolProperties{Backends: &[]frontdoor.Backend{
+			{Address: to.StringPtr("10.0.0.1"), BackendHostHeader: to.StringPtr("app.internal"), Weight: to.Int32Ptr(50)},
+			{Address: to.StringPtr("10.0.0.9"), Weight: to.Int32Ptr(50)},
+		}}},
+		{Name: to.StringPtr("cluster1-team-a"), BackendPoolProperties: &frontdoor.BackendPoolProperties{}},
+		{Name: to.StringPtr("cluster2"), BackendPoolProperties: &frontdoor.BackendPoolProperties{Backends: &[]frontdoor.Backend{
+			{Address: to.StringPtr("10.1.0.1")},
+		}}},
+	}}}
+
+	p.setClusterBackends(&fd, []ClusterBackend{{Address: "10.0.0.1", Weight: 50, HTTPPort: 8080}, {Address: "10.0.0.2", Weight: 25}}, []*v1beta1.Ingress{ingress})
+
+	for _, name := range []string{"cluster1", "cluster1-team-a"} {
+		backends := *findBackendPool(fd, name).Backends
+		if len(backends) != 2 || *backends[0].Address != "10.0.0.1" || *backends[1].Address != "10.0.0.2" ||
+			*backends[1].Weight != 25 || *backends[1].Priority != 2 || *backends[1].HTTPSPort != 443 {
+			t.Errorf("Expected pool %s to have the cluster's backends, got %+v", name, backends)
+		}
+	}
+	if backend := (*findBackendPool(fd, "cluster1").Backends)[0]; *backend.HTTPPort != 8080 || *backend.BackendHostHeader != "app.internal" {
+		t.Errorf("Expected the backend's port to be set and its other settings kept, got %+v", backend)
+	}
+	if backends := *findBackendPool(fd, "cluster2").Backends; len(backends) != 1 || *backends[0].Address != "10.1.0.1" {
+		t.Errorf("Expected another cluster's pool to be unchanged, got %+v", backends)
+	}
+
+	p.setClusterBackends(&fd, nil, []*v1beta1.Ingress{ingress})
+	if backends := *findBackendPool(fd, "cluster1").Backends; len(backends) != 2 {
+		t.Errorf("Expected the backends to be kept when there are none, got %+v", backends)
+	}
+}
+
+func TestSetClusterBackendsLeavesClustersWithSharedPrefixAlone(t *testing.T) {
+	p := &Synchronizer{clusterName: "prod", poolPerNamespace: true}
+	fd := frontdoor.FrontDoor{Properties: &frontdoor.Properties{BackendPools: &[]frontdoor.BackendPool{
+		testBackendPool("prod", "10.0.0.1"),
+		testBackendPool("prod-default", "10.0.0.1"),
+		testBackendPool("prod-eu", "10.1.0.1"),
+		testBackendPool("prod-eu-default", "10.1.0.1"),
+	}}}
+
+	p.setClusterBackends(&fd, []ClusterBackend{{Address: "10.0.0.2", Weight: 50}}, []*v1beta1.Ingress{testIngress("app", "/")})
+
+	for name, address := range map[string]string{"prod": "10.0.0.2", "prod-default": "10.0.0.2", "prod-eu": "10.1.0.1", "prod-eu-default": "10.1.0.1"} {
+		if backends := *findBackendPool(fd, name).Backends; len(backends) != 1 || *backends[0].Address != address {
+			t.Errorf("Expected pool %s to have backend %s, got %+v", name, address, backends)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package sync
+
+import (
+	"context"
+
+	"github.com/Azure/azure-sdk-for-go/services/preview/frontdoor/mgmt/2018-08-01-preview/frontdoor"
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+)
+
+// Validate checks the Frontdoor can be read with the configured credentials and
+// has the backend pool and frontend endpoint required by the controller. No changes are made.
+func Validate(ctx context.Context, config utils.Config) error {
+	fd, err := Export(ctx, config)
+	if err != nil {
+		return err
+	}
+	return checkRequiredResources(fd, config)
+}
+
+// Export returns the current configuration of the Frontdoor
+func Export(ctx context.Context, config utils.Config) (frontdoor.FrontDoor, error) {
+	fdClient, err := newFrontDoorsClient(ctx, config)
+	if err != nil {
+		return frontdoor.FrontDoor{}, err
+	}
+	return fdClient.Get(ctx, config.ResourceGroupName, config.FrontDoorName)
+}
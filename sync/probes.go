@@ -0,0 +1,177 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/preview/frontdoor/mgmt/2018-08-01-preview/frontdoor"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+)
+
+const (
+	// probePathAnnotation is the path Frontdoor requests to check the health of the ingress's backends
+	probePathAnnotation = "azure/frontdoor-probe-path"
+	// probeProtocolAnnotation is the protocol, 'Http' or 'Https', of the ingress's health probe
+	probeProtocolAnnotation = "azure/frontdoor-probe-protocol"
+	// probePrefix is the start of the name of the health probe, and backend pool, created for an ingress
+	probePrefix = "Probe-"
+)
+
+// healthProbe holds the probe settings from an ingress's annotations, empty fields keep the pool's setting
+type healthProbe struct {
+	path     string
+	protocol frontdoor.Protocol
+}
+
+// probeName returns the name of the health probe settings and backend pool created for the ingress
+func probeName(ingress *v1beta1.Ingress) string {
+	return ingressResourceName(probePrefix, ingress)
+}
+
+// probeSettings returns the health probe from the ingress annotations, nil if neither annotation is set
+func probeSettings(ingress *v1beta1.Ingress) (*healthProbe, error) {
+	path, hasPath := ingress.Annotations[probePathAnnotation]
+	protocol, hasProtocol := ingress.Annotations[probeProtocolAnnotation]
+	if !hasPath && !hasProtocol {
+		return nil, nil
+	}
+
+	probe := &healthProbe{path: path}
+	if hasPath && !strings.HasPrefix(path, "/") {
+		return nil, fmt.Errorf("%s: %q must start with '/'", probePathAnnotation, path)
+	}
+	switch strings.ToLower(protocol) {
+	case "":
+	case strings.ToLower(string(frontdoor.HTTP)):
+		probe.protocol = frontdoor.HTTP
+	case strings.ToLower(string(frontdoor.HTTPS)):
+		probe.protocol = frontdoor.HTTPS
+	default:
+		return nil, fmt.Errorf("%s: %q must be 'Http' or 'Https'", probeProtocolAnnotation, protocol)
+	}
+	return probe, nil
+}
+
+// ensureProbeBackendPool adds or replaces a pool for the ingress with the backends and settings
+// of the pool named poolName, bound to a health probe created from the ingress's settings
+func (p *Synchronizer) ensureProbeBackendPool(fd *frontdoor.FrontDoor, ingress *v1beta1.Ingress, poolName string, probe *healthProbe) (*string, error) {
+	name := probeName(ingress)
+	if err := utils.ValidateFrontDoorChildName(name); err != nil {
+		return nil, fmt.Errorf("health probe backend pool name isn't valid in Frontdoor: %v", err)
+	}
+	if fd.ID == nil {
+		return nil, fmt.Errorf("Frontdoor has no ID, unable to reference backend pool %s", name)
+	}
+	template := findBackendPool(*fd, poolName)
+	if template == nil || template.BackendPoolProperties == nil {
+		return nil, fmt.Errorf("backend pool %s doesn't exist to create the health probe's pool from", poolName)
+	}
+
+	pool := frontdoor.BackendPool{
+		Name: to.StringPtr(name),
+		BackendPoolProperties: &frontdoor.BackendPoolProperties{
+			Backends:              template.Backends,
+			LoadBalancingSettings: template.LoadBalancingSettings,
+			HealthProbeSettings:   template.HealthProbeSettings,
+		},
+	}
+	err := p.setIngressProbe(fd, ingress, &pool, probe)
+	if err != nil {
+		return nil, err
+	}
+
+	// The pool is owned by the controller so is replaced on every sync
+	pools := []frontdoor.BackendPool{}
+	for _, existing := range *fd.BackendPools {
+		if existing.Name != nil && *existing.Name == name {
+			continue
+		}
+		pools = append(pools, existing)
+	}
+	pools = append(pools, pool)
+	fd.BackendPools = &pools
+	p.recordIngressPool(name, ingress)
+
+	return to.StringPtr(fmt.Sprintf("%s/backendPools/%s", *fd.ID, name)), nil
+}
+
+// removeUnusedIngressProbes removes the health probes the cluster created for a single ingress which no
+// backend pool is bound to, as their pool was removed or the ingress no longer sets a probe. Probes the
+// cluster didn't record creating are kept, whatever they're named. It's called once unused pools are removed.
+func (p *Synchronizer) removeUnusedIngressProbes(ctx context.Context, fd *frontdoor.FrontDoor) {
+	if fd.Properties == nil || fd.HealthProbeSettings == nil {
+		return
+	}
+	used := map[string]bool{}
+	if fd.BackendPools != nil {
+		for _, pool := range *fd.BackendPools {
+			if pool.BackendPoolProperties != nil {
+				used[strings.ToLower(childResourceName(subResourceID(pool.HealthProbeSettings)))] = true
+			}
+		}
+	}
+
+	kept := []frontdoor.HealthProbeSettingsModel{}
+	for _, probe := range *fd.HealthProbeSettings {
+		if probe.Name == nil || used[strings.ToLower(*probe.Name)] || !p.isIngressPool(*probe.Name) {
+			kept = append(kept, probe)
+			continue
+		}
+		utils.GetLogger(ctx).WithField("healthProbe", *probe.Name).Info("Removing health probe created for an ingress as no backend pool uses it")
+	}
+	fd.HealthProbeSettings = &kept
+}
+
+// setIngressProbe adds or replaces the health probe settings for the ingress, starting from the
+// settings of the probe currently bound to the pool, and binds the pool to them
+func (p *Synchronizer) setIngressProbe(fd *frontdoor.FrontDoor, ingress *v1beta1.Ingress, pool *frontdoor.BackendPool, probe *healthProbe) error {
+	name := probeName(ingress)
+	if err := utils.ValidateFrontDoorChildName(name); err != nil {
+		return fmt.Errorf("health probe name isn't valid in Frontdoor: %v", err)
+	}
+	if fd.ID == nil {
+		return fmt.Errorf("Frontdoor has no ID, unable to reference health probe %s", name)
+	}
+
+	properties := &frontdoor.HealthProbeSettingsProperties{Path: to.StringPtr("/"), Protocol: frontdoor.HTTP}
+	if pool.HealthProbeSettings != nil {
+		if current := findHealthProbeSettings(fd.HealthProbeSettings, subResourceID(pool.HealthProbeSettings)); current != nil {
+			properties.IntervalInSeconds = current.IntervalInSeconds
+			if current.Path != nil {
+				properties.Path = current.Path
+			}
+			if current.Protocol != "" {
+				properties.Protocol = current.Protocol
+			}
+		}
+	}
+	if probe.path != "" {
+		properties.Path = to.StringPtr(probe.path)
+	}
+	if probe.protocol != "" {
+		properties.Protocol = probe.protocol
+	}
+
+	// The probe is owned by the controller so is replaced on every sync
+	probes := []frontdoor.HealthProbeSettingsModel{}
+	if fd.HealthProbeSettings != nil {
+		for _, existing := range *fd.HealthProbeSettings {
+			if existing.Name != nil && *existing.Name == name {
+				continue
+			}
+			probes = append(probes, existing)
+		}
+	}
+	probes = append(probes, frontdoor.HealthProbeSettingsModel{
+		Name:                          to.StringPtr(name),
+		HealthProbeSettingsProperties: properties,
+	})
+	fd.HealthProbeSettings = &probes
+	p.recordIngressPool(name, ingress)
+
+	pool.HealthProbeSettings = &frontdoor.SubResource{ID: to.StringPtr(fmt.Sprintf("%s/healthProbeSettings/%s", *fd.ID, name))}
+	return nil
+}
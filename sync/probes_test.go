@@ -0,0 +1,173 @@
+package sync
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/preview/frontdoor/mgmt/2018-08-01-preview/frontdoor"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+func testProbeFrontDoor() frontdoor.FrontDoor {
+	cluster := testBackendPool("cluster1", "10.0.0.1")
+	cluster.HealthProbeSettings = &frontdoor.SubResource{ID: to.StringPtr("/frontDoors/fd1/healthProbeSettings/default")}
+	return frontdoor.FrontDoor{
+		ID: to.StringPtr("/frontDoors/fd1"),
+		Properties: &frontdoor.Properties{
+			BackendPools: &[]frontdoor.BackendPool{cluster, testBackendPool("canary", "10.1.0.1")},
+			HealthProbeSettings: &[]frontdoor.HealthProbeSettingsModel{{
+				ID:   to.StringPtr("/frontDoors/fd1/healthProbeSettings/default"),
+				Name: to.StringPtr("default"),
+				HealthProbeSettingsProperties: &frontdoor.HealthProbeSettingsProperties{
+					Path:              to.StringPtr("/"),
+					Protocol:          frontdoor.HTTPS,
+					IntervalInSeconds: to.Int32Ptr(30),
+				},
+			}},
+		},
+	}
+}
+
+func TestProbeSettingsValidatesAnnotations(t *testing.T) {
+	testCases := []struct {
+		name        string
+		annotations map[string]string
+		expected    *healthProbe
+		expectError bool
+	}{
+		{name: "none", annotations: map[string]string{}},
+		{name: "path", annotations: map[string]string{probePathAnnotation: "/healthz"}, expected: &healthProbe{path: "/healthz"}},
+		{name: "protocol", annotations: map[string]string{probeProtocolAnnotation: "http"}, expected: &healthProbe{protocol: frontdoor.HTTP}},
+		{name: "relative path", annotations: map[string]string{probePathAnnotation: "healthz"}, expectError: true},
+		{name: "unknown protocol", annotations: map[string]string{probeProtocolAnnotation: "tcp"}, expectError: true},
+	}
+	for _, test := range testCases {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			ingress := testIngress("app", "/")
+			ingress.Annotations = test.annotations
+			probe, err := probeSettings(ingress)
+			if test.expectError != (err != nil) {
+				t.Fatalf("Expected error %v, got %v", test.expectError, err)
+			}
+			if (probe == nil) != (test.expected == nil) || (probe != nil && *probe != *test.expected) {
+				t.Errorf("Expected %+v, got %+v", test.expected, probe)
+			}
+		})
+	}
+}
+
+func TestBackendPoolForIngressBindsDedicatedProbe(t *testing.T) {
+	fd := testProbeFrontDoor()
+	p := &Synchronizer{clusterName: "cluster1", backendPool: *findBackendPool(fd, "cluster1")}
+	ingress := testIngress("app", "/")
+	ingress.Annotations = map[string]string{probePathAnnotation: "/healthz"}
+
+	id, err := p.backendPoolForIngress(&fd, ingress)
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	name := probeName(ingress)
+	if *id != "/frontDoors/fd1/backendPools/"+name {
+		t.Errorf("Expected the ingress to use its own pool, got %s", *id)
+	}
+	pool := findBackendPool(fd, name)
+	if pool == nil || len(*pool.Backends) != 1 || *pool.HealthProbeSettings.ID != "/frontDoors/fd1/healthProbeSettings/"+name {
+		t.Fatalf("Expected a pool with the cluster's backends bound to the ingress's probe, got %+v", pool)
+	}
+	probes := *fd.HealthProbeSettings
+	probe := probes[len(probes)-1]
+	if *probe.Name != name || *probe.Path != "/healthz" || probe.Protocol != frontdoor.HTTPS || *probe.IntervalInSeconds != 30 {
+		t.Errorf("Expected the probe to override the path of the cluster's probe, got %+v", probe.HealthProbeSettingsProperties)
+	}
+	if *findBackendPool(fd, "cluster1").HealthProbeSettings.ID != "/frontDoors/fd1/healthProbeSettings/default" {
+		t.Error("Expected the cluster's pool to be unchanged")
+	}
+
+	// Syncing again replaces the probe and pool rather than adding duplicates
+	_, err = p.backendPoolForIngress(&fd, ingress)
+	if err != nil || len(*fd.HealthProbeSettings) != 2 || len(*fd.BackendPools) != 3 {
+		t.Errorf("Expected the probe and pool to be replaced, got %d probes and %d pools, error %v", len(*fd.HealthProbeSettings), len(*fd.BackendPools), err)
+	}
+}
+
+func TestBackendPoolForIngressBindsProbeToCanaryPool(t *testing.T) {
+	fd := testProbeFrontDoor()
+	p := &Synchronizer{clusterName: "cluster1", backendPool: *findBackendPool(fd, "cluster1")}
+	ingress := testIngress("app", "/")
+	ingress.Annotations = map[string]string{
+		canaryPoolAnnotation:    "canary",
+		canaryWeightAnnotation:  "10",
+		probeProtocolAnnotation: "Http",
+	}
+
+	id, err := p.backendPoolForIngress(&fd, ingress)
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	if *id != "/frontDoors/fd1/backendPools/"+canaryBackendPoolName(ingress) || findBackendPool(fd, probeName(ingress)) != nil {
+		t.Errorf("Expected the canary pool to be used without another pool, got %s", *id)
+	}
+	canaryPool := findBackendPool(fd, canaryBackendPoolName(ingress))
+	if *canaryPool.HealthProbeSettings.ID != "/frontDoors/fd1/healthProbeSettings/"+probeName(ingress) {
+		t.Errorf("Expected the canary pool to be bound to the ingress's probe, got %s", *canaryPool.HealthProbeSettings.ID)
+	}
+}
+
+func TestUnusedProbesAndTheirPoolsAreRemoved(t *testing.T) {
+	ctx := utils.WithLogger(context.Background(), log.WithField("test", t.Name()))
+	fd := testProbeFrontDoor()
+	p := &Synchronizer{clusterName: "cluster1", backendPool: *findBackendPool(fd, "cluster1"), ingressPools: &ingressPools{pools: map[string]string{}}}
+	app := testIngress("app", "/app")
+	app.Annotations = map[string]string{probePathAnnotation: "/healthz"}
+	deleted := testIngress("deleted", "/deleted")
+	deleted.Annotations = map[string]string{probePathAnnotation: "/healthz"}
+	appPoolID, err := p.backendPoolForIngress(&fd, app)
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if _, err := p.backendPoolForIngress(&fd, deleted); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	// Only the app ingress is still routed once the other is deleted
+	rules := []frontdoor.RoutingRule{testRoutingRule(routingRuleName(app), *appPoolID, "/app")}
+	p.removeUnusedIngressPools(ctx, &fd, rules)
+	p.removeUnusedIngressProbes(ctx, &fd)
+	if findBackendPool(fd, probeName(deleted)) != nil || len(*fd.HealthProbeSettings) != 2 || (*fd.HealthProbeSettings)[1].Name == nil || *(*fd.HealthProbeSettings)[1].Name != probeName(app) {
+		t.Errorf("Expected the deleted ingress's probe and pool to be removed, got %d probes", len(*fd.HealthProbeSettings))
+	}
+	if findBackendPool(fd, probeName(app)) == nil || findBackendPool(fd, "canary") == nil {
+		t.Error("Expected the pools in use and those not created for an ingress to be kept")
+	}
+
+	// Removing the annotation routes the ingress to the cluster's pool, leaving only the default probe
+	rules = []frontdoor.RoutingRule{testRoutingRule(routingRuleName(app), "/frontDoors/fd1/backendPools/cluster1", "/app")}
+	p.removeUnusedIngressPools(ctx, &fd, rules)
+	p.removeUnusedIngressProbes(ctx, &fd)
+	if findBackendPool(fd, probeName(app)) != nil || len(*fd.HealthProbeSettings) != 1 || *(*fd.HealthProbeSettings)[0].Name != "default" {
+		t.Errorf("Expected the probe and pool of the ingress without the annotation to be removed, got %d probes", len(*fd.HealthProbeSettings))
+	}
+}
+
+func TestProbesAndPoolsAddedByUsersAreKept(t *testing.T) {
+	ctx := utils.WithLogger(context.Background(), log.WithField("test", t.Name()))
+	fd := testProbeFrontDoor()
+	*fd.BackendPools = append(*fd.BackendPools, testBackendPool("Probe-staging", "10.2.0.1"))
+	*fd.HealthProbeSettings = append(*fd.HealthProbeSettings, frontdoor.HealthProbeSettingsModel{
+		Name:                          to.StringPtr("Probe-staging"),
+		HealthProbeSettingsProperties: &frontdoor.HealthProbeSettingsProperties{Path: to.StringPtr("/healthz")},
+	})
+	p := &Synchronizer{clusterName: "cluster1", backendPool: *findBackendPool(fd, "cluster1"), ingressPools: &ingressPools{pools: map[string]string{}}}
+
+	rules := []frontdoor.RoutingRule{testRoutingRule("Manual", "/frontDoors/fd1/backendPools/cluster1", "/")}
+	p.removeUnusedIngressPools(ctx, &fd, rules)
+	p.removeUnusedIngressProbes(ctx, &fd)
+	if findBackendPool(fd, "Probe-staging") == nil || len(*fd.HealthProbeSettings) != 2 {
+		t.Errorf("Expected the pool and probe the controller didn't create to be kept, got %d probes", len(*fd.HealthProbeSettings))
+	}
+}
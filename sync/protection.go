@@ -0,0 +1,159 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/preview/frontdoor/mgmt/2018-08-01-preview/frontdoor"
+	"github.com/Azure/azure-storage-blob-go/2016-05-31/azblob"
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+)
+
+// pruneAnnotation set to 'false' protects the ingress's routing rules from being deleted, even once the
+// ingress is deleted, for example while an app migrates and its route must stay for a while
+const pruneAnnotation = "azure/frontdoor-prune"
+
+// protectedRulesStore persists the protected routing rules so the protection outlives the ingress and
+// controller restarts
+type protectedRulesStore interface {
+	load(ctx context.Context) (map[string]string, error)
+	save(ctx context.Context, rules map[string]string) error
+}
+
+// protectedRules maps the name of each routing rule protected from being deleted to the ingress which
+// protected it. Routing rules can't be tagged in the Frontdoor API version used, and the Frontdoor's own
+// tags are limited in number and shared with its users, so they're kept alongside the lock.
+type protectedRules struct {
+	// store is nil when no storage account is configured, the protection is then only kept in memory
+	store protectedRulesStore
+	rules map[string]string
+	// changed is set while the rules differ from those last saved
+	changed bool
+}
+
+// newProtectedRules loads the cluster's protected routing rules from the storage account, if it's used
+func newProtectedRules(ctx context.Context, config utils.Config) (*protectedRules, error) {
+	if !config.NeedsStorageAccount() {
+		return &protectedRules{rules: map[string]string{}}, nil
+	}
+	container, err := ensureStorageContainer(ctx, config, lockContainerName)
+	if err != nil {
+		return nil, err
+	}
+	store := &blobProtectedRules{blob: container.NewBlockBlobURL(fmt.Sprintf("protected-%s-%s.json", config.FrontDoorName, config.ClusterName))}
+	rules, err := store.load(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load protected routing rules: %v", err)
+	}
+	return &protectedRules{store: store, rules: rules}, nil
+}
+
+// pruneProtected returns true if the ingress protects its routing rules from being deleted
+func pruneProtected(ingress *v1beta1.Ingress) bool {
+	return strings.EqualFold(ingress.Annotations[pruneAnnotation], "false")
+}
+
+// isProtectedRule returns true if the routing rule is protected from being deleted
+func (p *Synchronizer) isProtectedRule(name string) bool {
+	return p.protection != nil && p.protection.rules[name] != ""
+}
+
+// updateProtectedRules protects the routing rules of each ingress synced which has pruning disabled, and
+// ends the protection of those of ingresses synced without it. Protected rules which no longer exist are
+// forgotten. The changes are saved by commitProtectedRules once the update succeeds.
+func (p *Synchronizer) updateProtectedRules(ctx context.Context, existing []frontdoor.RoutingRule, ingresses []*v1beta1.Ingress, result *SyncResult, ruleOwners map[string]string) {
+	if p.protection == nil {
+		return
+	}
+	logger := utils.GetLogger(ctx)
+	protect := map[string]bool{}
+	for _, ingress := range ingresses {
+		if ingress == nil {
+			continue
+		}
+		key := ingress.Namespace + "/" + ingress.Name
+		if _, synced := result.RulesHash[key]; synced {
+			protect[key] = pruneProtected(ingress)
+		}
+	}
+
+	rules := p.protection.rules
+	for name, owner := range ruleOwners {
+		protected, synced := protect[owner]
+		switch {
+		case !synced:
+		case protected && rules[name] == "":
+			logger.WithField("ruleName", name).WithField("ingress", owner).
+				Info("Protecting routing rule from being deleted, even once its ingress is deleted")
+			rules[name] = owner
+			p.protection.changed = true
+		case !protected && rules[name] != "":
+			logger.WithField("ruleName", name).WithField("ingress", owner).Info("Routing rule is no longer protected from being deleted")
+			delete(rules, name)
+			p.protection.changed = true
+		}
+	}
+
+	exists := map[string]bool{}
+	for _, rule := range existing {
+		if rule.Name != nil {
+			exists[*rule.Name] = true
+		}
+	}
+	for name := range rules {
+		if !exists[name] && ruleOwners[name] == "" {
+			delete(rules, name)
+			p.protection.changed = true
+		}
+	}
+}
+
+// commitProtectedRules saves the protected routing rules once an update succeeds, if they changed. Failing
+// to save them doesn't fail the sync, they're saved again by the next sync.
+func (p *Synchronizer) commitProtectedRules(ctx context.Context) {
+	if p.protection == nil || p.protection.store == nil || !p.protection.changed {
+		return
+	}
+	if err := p.protection.store.save(ctx, p.protection.rules); err != nil {
+		utils.GetLogger(ctx).WithError(err).Warn("Failed to save protected routing rules")
+		return
+	}
+	p.protection.changed = false
+}
+
+// blobProtectedRules keeps the protected routing rules as JSON in a blob alongside the lock
+type blobProtectedRules struct {
+	blob azblob.BlockBlobURL
+}
+
+func (r *blobProtectedRules) load(ctx context.Context) (map[string]string, error) {
+	rules := map[string]string{}
+	resp, err := r.blob.GetBlob(ctx, azblob.BlobRange{}, azblob.BlobAccessConditions{}, false)
+	if storageErr, ok := err.(azblob.StorageError); ok && storageErr.ServiceCode() == azblob.ServiceCodeBlobNotFound {
+		return rules, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	body := resp.Body()
+	defer body.Close() //nolint: errcheck
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	return rules, json.Unmarshal(data, &rules)
+}
+
+func (r *blobProtectedRules) save(ctx context.Context, rules map[string]string) error {
+	data, err := json.Marshal(rules)
+	if err != nil {
+		return err
+	}
+	_, err = r.blob.PutBlob(ctx, bytes.NewReader(data), azblob.BlobHTTPHeaders{ContentType: "application/json"}, azblob.Metadata{}, azblob.BlobAccessConditions{})
+	return err
+}
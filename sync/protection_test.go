@@ -0,0 +1,92 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/preview/frontdoor/mgmt/2018-08-01-preview/frontdoor"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+	log "github.com/sirupsen/logrus"
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+type fakeProtectedRulesStore struct {
+	saved   map[string]string
+	saveErr error
+}
+
+func (s *fakeProtectedRulesStore) load(ctx context.Context) (map[string]string, error) {
+	return map[string]string{}, nil
+}
+
+func (s *fakeProtectedRulesStore) save(ctx context.Context, rules map[string]string) error {
+	if s.saveErr != nil {
+		return s.saveErr
+	}
+	s.saved = map[string]string{}
+	for name, owner := range rules {
+		s.saved[name] = owner
+	}
+	return nil
+}
+
+func TestProtectedRulesAreNotPruned(t *testing.T) {
+	ctx := utils.WithLogger(context.Background(), log.WithField("test", t.Name()))
+	pool := testBackendPool("cluster1", "10.0.0.1")
+	pool.ID = to.StringPtr("/frontDoors/fd1/backendPools/cluster1")
+	fd := frontdoor.FrontDoor{
+		Properties: &frontdoor.Properties{BackendPools: &[]frontdoor.BackendPool{pool}},
+		Tags:       map[string]*string{"team": to.StringPtr("web")},
+	}
+
+	migrating := testIngress("migrating", "/old")
+	migrating.Annotations = map[string]string{pruneAnnotation: "false"}
+	unprotected := testIngress("unprotected", "/unprotected")
+	existing := []frontdoor.RoutingRule{
+		testRoutingRule(routingRuleName(migrating), *pool.ID, "/old"),
+		testRoutingRule(routingRuleName(unprotected), *pool.ID, "/unprotected"),
+	}
+	ruleOwners := map[string]string{
+		routingRuleName(migrating):   "default/migrating",
+		routingRuleName(unprotected): "default/unprotected",
+	}
+	result := &SyncResult{RulesHash: map[string]string{"default/migrating": "hash", "default/unprotected": "hash"}}
+
+	store := &fakeProtectedRulesStore{}
+	p := &Synchronizer{clusterName: "cluster1", syncStrategy: utils.SyncStrategyReplace}
+	p.protection = &protectedRules{store: store, rules: map[string]string{
+		routingRuleName(unprotected):       "default/unprotected",
+		"Ingress-default-removed-1a2b3c4d": "default/removed",
+	}}
+	p.updateProtectedRules(ctx, existing, []*v1beta1.Ingress{migrating, unprotected}, result, ruleOwners)
+	expected := map[string]string{routingRuleName(migrating): "default/migrating"}
+	if !reflect.DeepEqual(p.protection.rules, expected) {
+		t.Errorf("Expected only the rule of the ingress with pruning disabled to be protected, got %v", p.protection.rules)
+	}
+	if len(fd.Tags) != 1 {
+		t.Errorf("Expected the Frontdoor's tags to be left alone, got %v", fd.Tags)
+	}
+
+	// The protection is only saved once the update succeeds, and saved again if that fails
+	if store.saved != nil {
+		t.Error("Expected the protected rules not to be saved before the update")
+	}
+	store.saveErr = errors.New("unavailable")
+	p.commitProtectedRules(ctx)
+	store.saveErr = nil
+	p.commitProtectedRules(ctx)
+	if !reflect.DeepEqual(store.saved, expected) || p.protection.changed {
+		t.Errorf("Expected the protected rules to be saved, got %v", store.saved)
+	}
+
+	// Once both ingresses are deleted only the protected rule is kept
+	live := WithLiveIngresses(ctx, map[types.UID]string{})
+	kept := p.pruneRoutingRules(live, fd, existing, map[string]string{})
+	if len(kept) != 1 || *kept[0].Name != routingRuleName(migrating) {
+		t.Errorf("Expected only the protected rule to be kept, got %d rules", len(kept))
+	}
+}
@@ -0,0 +1,201 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+// ProviderError is the error from one of several providers the ingresses are synced to
+type ProviderError struct {
+	Provider string
+	Err      error
+}
+
+func (e *ProviderError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Provider, e.Err)
+}
+
+// ProviderReport describes the outcome of a sync for one of several providers
+type ProviderReport struct {
+	Provider string `json:"provider"`
+	// Healthy is false when the provider couldn't be synced at all
+	Healthy      bool `json:"healthy"`
+	RulesCreated int  `json:"rulesCreated"`
+	RulesUpdated int  `json:"rulesUpdated"`
+	RolledBack   bool `json:"rolledBack,omitempty"`
+	// Failed are the 'namespace/name' of the ingresses which weren't synced to the provider
+	Failed []string `json:"failed,omitempty"`
+	Error  string   `json:"error,omitempty"`
+}
+
+// namedProvider is a provider and the name it's reported under
+type namedProvider struct {
+	name     string
+	provider Provider
+}
+
+// MultiProvider syncs the ingresses to each of several providers in turn. A provider
+// failing doesn't stop the others being synced, its error is reported for every ingress.
+type MultiProvider struct {
+	providers []namedProvider
+}
+
+// newFrontDoorProvider creates the provider for a single Front Door
+var newFrontDoorProvider = func(ctx context.Context, config utils.Config) (Provider, error) {
+	fdSyncer, err := NewFontDoorSyncer(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	return WithLockAlerts(fdSyncer, config), nil
+}
+
+// NewProvider creates a provider for each Front Door in the config, when there
+// is more than one they're combined in a MultiProvider. A Front Door whose provider
+// can't be created, for example as it's unreachable, is reported unhealthy and created
+// again by each sync, so the others are still synced. An error is only returned if
+// no provider could be created.
+func NewProvider(ctx context.Context, config utils.Config) (Provider, error) {
+	frontDoors := config.FrontDoors()
+	if len(frontDoors) == 1 {
+		return newFrontDoorProvider(ctx, config)
+	}
+
+	multi := &MultiProvider{}
+	failedProviders := []error{}
+	for _, fdConfig := range frontDoors {
+		fdConfig := fdConfig
+		fdCtx := utils.WithLogger(ctx, utils.GetLogger(ctx).WithField("provider", fdConfig.FrontDoorName))
+		provider, err := newFrontDoorProvider(fdCtx, fdConfig)
+		if err != nil {
+			utils.GetLogger(fdCtx).WithError(err).Error("Failed to create provider, it's created again by each sync")
+			providerHealthy.Set(0, fdConfig.FrontDoorName)
+			failedProviders = append(failedProviders, &ProviderError{Provider: fdConfig.FrontDoorName, Err: err})
+			provider = &retryingProvider{create: func() (Provider, error) { return newFrontDoorProvider(fdCtx, fdConfig) }}
+		}
+		multi.add(fdConfig.FrontDoorName, provider)
+	}
+	if len(failedProviders) == len(frontDoors) {
+		return nil, utilerrors.NewAggregate(failedProviders)
+	}
+	return multi, nil
+}
+
+// retryingProvider stands in for a provider which couldn't be created when the controller started, each
+// sync creates it again until it can be, then syncs it
+type retryingProvider struct {
+	// create is called with the context the controller started with, as the provider outlives the sync
+	create   func() (Provider, error)
+	provider Provider
+}
+
+func (p *retryingProvider) Sync(ctx context.Context, ingressToSync []*v1beta1.Ingress, backends []ClusterBackend) (*SyncResult, error) {
+	if p.provider == nil {
+		provider, err := p.create()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create provider: %v", err)
+		}
+		utils.GetLogger(ctx).Info("Created provider which failed when the controller started")
+		p.provider = provider
+	}
+	return p.provider.Sync(ctx, ingressToSync, backends)
+}
+
+func (m *MultiProvider) add(name string, provider Provider) {
+	m.providers = append(m.providers, namedProvider{name: name, provider: provider})
+}
+
+// Sync syncs the ingresses to every provider and combines the results. An ingress is only
+// reported as synced if it was synced to every provider. An error is only returned if no provider could be synced.
+func (m *MultiProvider) Sync(ctx context.Context, ingressToSync []*v1beta1.Ingress, backends []ClusterBackend) (*SyncResult, error) {
+	logger := utils.GetLogger(ctx)
+
+	results := make([]*SyncResult, len(m.providers))
+	errs := make([]error, len(m.providers))
+	for i, p := range m.providers {
+		providerCtx := utils.WithLogger(ctx, logger.WithField("provider", p.name))
+		results[i], errs[i] = p.provider.Sync(providerCtx, ingressToSync, backends)
+	}
+
+	result := m.combineResults(ingressToSync, results, errs)
+
+	failedProviders := []error{}
+	for i, p := range m.providers {
+		if errs[i] == nil {
+			providerHealthy.Set(1, p.name)
+			providerLastSuccessfulSync.Set(float64(results[i].Time.Unix()), p.name)
+			continue
+		}
+		providerHealthy.Set(0, p.name)
+		providerSyncErrors.Inc(p.name)
+		failedProviders = append(failedProviders, &ProviderError{Provider: p.name, Err: errs[i]})
+	}
+	if len(failedProviders) == len(m.providers) {
+		return nil, utilerrors.NewAggregate(failedProviders)
+	}
+	return result, nil
+}
+
+// combineResults merges the result from each provider, errs holds the error returned by each provider
+func (m *MultiProvider) combineResults(ingressToSync []*v1beta1.Ingress, results []*SyncResult, errs []error) *SyncResult {
+	combined := &SyncResult{
+		RulesHash: map[string]string{},
+		Failed:    map[string]error{},
+		Diverged:  map[string][]string{},
+	}
+	failures := map[string][]error{}
+
+	for i, p := range m.providers {
+		report := ProviderReport{Provider: p.name, Healthy: errs[i] == nil}
+
+		if errs[i] != nil {
+			report.Error = errs[i].Error()
+			for _, ingress := range ingressToSync {
+				key := ingress.Namespace + "/" + ingress.Name
+				failures[key] = append(failures[key], &ProviderError{Provider: p.name, Err: errs[i]})
+				report.Failed = append(report.Failed, key)
+			}
+			combined.Providers = append(combined.Providers, report)
+			continue
+		}
+
+		result := results[i]
+		report.RulesCreated = result.RulesCreated
+		report.RulesUpdated = result.RulesUpdated
+		report.RolledBack = result.RolledBack
+		combined.RulesCreated += result.RulesCreated
+		combined.RulesUpdated += result.RulesUpdated
+		combined.RolledBack = combined.RolledBack || result.RolledBack
+		if result.Time.After(combined.Time) {
+			combined.Time = result.Time
+		}
+		for key, hash := range result.RulesHash {
+			combined.RulesHash[key] = hash
+		}
+		for key, err := range result.Failed {
+			failures[key] = append(failures[key], &ProviderError{Provider: p.name, Err: err})
+			report.Failed = append(report.Failed, key)
+		}
+		for key, diffs := range result.Diverged {
+			for _, diff := range diffs {
+				combined.Diverged[key] = append(combined.Diverged[key], fmt.Sprintf("%s: %s", p.name, diff))
+			}
+		}
+		sort.Strings(report.Failed)
+		combined.Providers = append(combined.Providers, report)
+	}
+
+	for key, keyErrs := range failures {
+		delete(combined.RulesHash, key)
+		if len(keyErrs) == 1 {
+			combined.Failed[key] = keyErrs[0]
+			continue
+		}
+		combined.Failed[key] = utilerrors.NewAggregate(keyErrs)
+	}
+	return combined
+}
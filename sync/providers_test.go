@@ -0,0 +1,133 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+	log "github.com/sirupsen/logrus"
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+)
+
+// fakeProvider returns the same result or error from every sync
+type fakeProvider struct {
+	result *SyncResult
+	err    error
+	syncs  int
+}
+
+func (p *fakeProvider) Sync(ctx context.Context, ingressToSync []*v1beta1.Ingress, backends []ClusterBackend) (*SyncResult, error) {
+	p.syncs++
+	return p.result, p.err
+}
+
+func TestMultiProviderSyncsHealthyProvidersWhenOneFails(t *testing.T) {
+	ctx := utils.WithLogger(context.Background(), log.WithField("test", t.Name()))
+	synced := time.Now()
+	healthy := &fakeProvider{result: &SyncResult{
+		Time:         synced,
+		RulesHash:    map[string]string{"default/app": "hash"},
+		Failed:       map[string]error{"default/other": errors.New("invalid path")},
+		Diverged:     map[string][]string{"default/app": {"rule changed"}},
+		RulesCreated: 2,
+	}}
+	failing := &fakeProvider{err: errors.New("throttled")}
+	multi := &MultiProvider{}
+	multi.add("frontdoor1", healthy)
+	multi.add("frontdoor2", failing)
+	ingresses := []*v1beta1.Ingress{testIngress("app", "/app"), testIngress("other", "/other")}
+
+	result, err := multi.Sync(ctx, ingresses, nil)
+
+	if err != nil {
+		t.Fatalf("Expected the healthy provider's result, got error: %+v", err)
+	}
+	if healthy.syncs != 1 || failing.syncs != 1 {
+		t.Errorf("Expected each provider to be synced once, got %d and %d", healthy.syncs, failing.syncs)
+	}
+	if len(result.RulesHash) != 0 {
+		t.Errorf("Expected ingresses not synced to every provider to be failed, got %v", result.RulesHash)
+	}
+	if err, ok := result.Failed["default/app"].(*ProviderError); !ok || err.Provider != "frontdoor2" {
+		t.Errorf("Expected app to fail with the failing provider's error, got %v", result.Failed["default/app"])
+	}
+	if err := result.Failed["default/other"]; err == nil || err.Error() != "[frontdoor1: invalid path, frontdoor2: throttled]" {
+		t.Errorf("Expected other to fail with both providers' errors, got %v", err)
+	}
+	if diffs := result.Diverged["default/app"]; len(diffs) != 1 || diffs[0] != "frontdoor1: rule changed" {
+		t.Errorf("Expected the differences to name the provider, got %v", diffs)
+	}
+	if result.RulesCreated != 2 || !result.Time.Equal(synced) {
+		t.Errorf("Unexpected result: %+v", result)
+	}
+
+	if len(result.Providers) != 2 {
+		t.Fatalf("Expected a report for each provider, got %+v", result.Providers)
+	}
+	if report := result.Providers[0]; !report.Healthy || report.RulesCreated != 2 || len(report.Failed) != 1 {
+		t.Errorf("Unexpected report for the healthy provider: %+v", report)
+	}
+	if report := result.Providers[1]; report.Healthy || report.Error != "throttled" || len(report.Failed) != 2 {
+		t.Errorf("Unexpected report for the failing provider: %+v", report)
+	}
+}
+
+func TestMultiProviderErrorsWhenEveryProviderFails(t *testing.T) {
+	ctx := utils.WithLogger(context.Background(), log.WithField("test", t.Name()))
+	multi := &MultiProvider{}
+	multi.add("frontdoor1", &fakeProvider{err: errors.New("lock unavailable")})
+	multi.add("frontdoor2", &fakeProvider{err: errors.New("throttled")})
+
+	_, err := multi.Sync(ctx, []*v1beta1.Ingress{testIngress("app", "/app")}, nil)
+
+	if err == nil || err.Error() != "[frontdoor1: lock unavailable, frontdoor2: throttled]" {
+		t.Errorf("Expected an error naming each provider, got %v", err)
+	}
+}
+
+func TestNewProviderRetriesFrontDoorsWhichFailToStart(t *testing.T) {
+	ctx := utils.WithLogger(context.Background(), log.WithField("test", t.Name()))
+	defer func(original func(context.Context, utils.Config) (Provider, error)) {
+		newFrontDoorProvider = original
+	}(newFrontDoorProvider)
+	unavailable := map[string]bool{"frontdoor2": true}
+	providers := map[string]*fakeProvider{}
+	newFrontDoorProvider = func(ctx context.Context, config utils.Config) (Provider, error) {
+		if unavailable[config.FrontDoorName] {
+			return nil, errors.New("unreachable")
+		}
+		providers[config.FrontDoorName] = &fakeProvider{result: &SyncResult{Time: time.Now(), RulesHash: map[string]string{"default/app": "hash"}}}
+		return providers[config.FrontDoorName], nil
+	}
+	config := utils.Config{FrontDoorName: "frontdoor1", AdditionalFrontDoors: []string{"frontdoor2=fd2.azurefd.net"}}
+	ingresses := []*v1beta1.Ingress{testIngress("app", "/app")}
+
+	provider, err := NewProvider(ctx, config)
+	if err != nil {
+		t.Fatalf("Expected the controller to start with one Front Door available, got error: %+v", err)
+	}
+	result, err := provider.Sync(ctx, ingresses, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if report := result.Providers[1]; report.Healthy || report.Error == "" || result.Failed["default/app"] == nil {
+		t.Errorf("Expected the Front Door which failed to start to be reported unhealthy, got %+v", report)
+	}
+
+	// Once the Front Door is available the next sync creates and syncs it
+	unavailable["frontdoor2"] = false
+	result, err = provider.Sync(ctx, ingresses, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	if !result.Providers[1].Healthy || providers["frontdoor2"].syncs != 1 || result.RulesHash["default/app"] == "" {
+		t.Errorf("Expected the Front Door to be synced once it could be created, got %+v", result.Providers[1])
+	}
+
+	unavailable["frontdoor1"], unavailable["frontdoor2"] = true, true
+	if _, err := NewProvider(ctx, config); err == nil || err.Error() != "[frontdoor1: unreachable, frontdoor2: unreachable]" {
+		t.Errorf("Expected an error naming each Front Door when none can be created, got %v", err)
+	}
+}
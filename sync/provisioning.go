@@ -0,0 +1,68 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/preview/frontdoor/mgmt/2018-08-01-preview/frontdoor"
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+)
+
+const (
+	// provisioningPollInterval is how often the Frontdoor is read while an update is in progress
+	provisioningPollInterval = 15 * time.Second
+	// provisioningTimeout limits how long the controller waits for an update it didn't start,
+	// Frontdoor updates usually take a few minutes
+	provisioningTimeout = 15 * time.Minute
+)
+
+// provisioningComplete returns whether the Frontdoor's last update has finished, successfully or not
+func provisioningComplete(fd frontdoor.FrontDoor) bool {
+	if fd.Properties == nil || fd.ProvisioningState == nil {
+		return true
+	}
+	switch strings.ToLower(*fd.ProvisioningState) {
+	case "succeeded", "failed", "canceled":
+		return true
+	}
+	return false
+}
+
+// waitForProvisioning reads the Frontdoor, waiting for any update in progress to finish first. An update
+// can still be running in Azure when the controller which started it was stopped, for example by a pod
+// eviction, so the state it leaves behind is read rather than assuming the update was applied.
+func waitForProvisioning(ctx context.Context, get func(context.Context) (frontdoor.FrontDoor, error), interval, timeout time.Duration) (frontdoor.FrontDoor, error) {
+	logger := utils.GetLogger(ctx)
+	deadline := time.Now().Add(timeout)
+	waited := false
+	for {
+		fd, err := get(ctx)
+		if err != nil {
+			return fd, err
+		}
+		if provisioningComplete(fd) {
+			if fd.ProvisioningState != nil && strings.EqualFold(*fd.ProvisioningState, "failed") {
+				logger.WithField(utils.EventField, "PreviousUpdateFailed").
+					Warn("Frontdoor's last update failed, reconciling from its current state")
+			} else if waited {
+				logger.Info("Frontdoor update in progress has finished, reconciling from its current state")
+			}
+			return fd, nil
+		}
+		if time.Now().After(deadline) {
+			return fd, fmt.Errorf("Frontdoor is still %s after waiting %v for an update in progress to finish", *fd.ProvisioningState, timeout)
+		}
+		if !waited {
+			logger.WithField("provisioningState", *fd.ProvisioningState).
+				Info("Frontdoor has an update in progress, possibly from a controller which was stopped mid-update, waiting for it to finish")
+			waited = true
+		}
+		select {
+		case <-ctx.Done():
+			return fd, ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package sync
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/preview/frontdoor/mgmt/2018-08-01-preview/frontdoor"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+func TestWaitForProvisioning(t *testing.T) {
+	testCases := []struct {
+		name        string
+		states      []string
+		timeout     time.Duration
+		expectReads int
+		expectErr   bool
+	}{
+		{name: "complete", states: []string{"Succeeded"}, timeout: time.Second, expectReads: 1},
+		{name: "previousUpdateFailed", states: []string{"Failed"}, timeout: time.Second, expectReads: 1},
+		{name: "inProgress", states: []string{"Updating", "Updating", "Succeeded"}, timeout: time.Second, expectReads: 3},
+		{name: "stuck", states: []string{"Updating", "Updating", "Updating"}, timeout: 0, expectReads: 1, expectErr: true},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			reads := 0
+			get := func(context.Context) (frontdoor.FrontDoor, error) {
+				state := test.states[reads]
+				reads++
+				return frontdoor.FrontDoor{Properties: &frontdoor.Properties{ProvisioningState: to.StringPtr(state)}}, nil
+			}
+			fd, err := waitForProvisioning(context.Background(), get, time.Millisecond, test.timeout)
+			if reads != test.expectReads {
+				t.Errorf("Expected %d reads got %d", test.expectReads, reads)
+			}
+			if test.expectErr && err == nil {
+				t.Error("Expected an error waiting for the update to finish")
+			}
+			if !test.expectErr && (err != nil || !provisioningComplete(fd)) {
+				t.Errorf("Expected the Frontdoor once its update finished, got %v, err %v", *fd.ProvisioningState, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package sync
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	gosync "sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest"
+	log "github.com/sirupsen/logrus"
+)
+
+// recordedExchange is a response from the Frontdoor API saved to disk with the request it answered
+type recordedExchange struct {
+	Method     string      `json:"method"`
+	URL        string      `json:"url"`
+	StatusCode int         `json:"statusCode"`
+	Header     http.Header `json:"header"`
+	Body       string      `json:"body"`
+}
+
+// recordedCount numbers the recorded responses so those received at the same time keep their order
+var recordedCount uint64
+
+// recordResponse saves every response, redacted, to a file in dir named so the files sort in the
+// order the responses were received
+func recordResponse(dir string) autorest.RespondDecorator {
+	return func(p autorest.Responder) autorest.Responder {
+		return autorest.ResponderFunc(func(r *http.Response) error {
+			err := p.Respond(r)
+			if r == nil || r.Request == nil {
+				return err
+			}
+			body := []byte{}
+			if r.Body != nil {
+				body, _ = ioutil.ReadAll(r.Body) //nolint: errcheck
+				r.Body = ioutil.NopCloser(bytes.NewReader(body))
+			}
+			exchange := recordedExchange{
+				Method:     r.Request.Method,
+				URL:        r.Request.URL.String(),
+				StatusCode: r.StatusCode,
+				Header:     r.Header,
+				Body:       redactDump(body),
+			}
+			data, _ := json.MarshalIndent(exchange, "", "  ") //nolint: errcheck
+			name := fmt.Sprintf("%s-%06d.json", time.Now().UTC().Format(snapshotIDFormat), atomic.AddUint64(&recordedCount, 1))
+			if writeErr := ioutil.WriteFile(filepath.Join(dir, name), data, 0600); writeErr != nil {
+				log.WithError(writeErr).Warn("Failed to record response from AzureFD API")
+			}
+			return err
+		})
+	}
+}
+
+// replaySender answers requests with the responses recorded in a directory instead of calling Azure.
+// Each recorded response is used once, in order, after which the last one for the request is repeated.
+type replaySender struct {
+	mu        gosync.Mutex
+	exchanges []recordedExchange
+	used      []bool
+}
+
+// newReplaySender loads the responses recorded in dir
+func newReplaySender(dir string) (*replaySender, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read recorded responses: %v", err)
+	}
+	names := []string{}
+	for _, file := range files {
+		if !file.IsDir() && strings.HasSuffix(file.Name(), ".json") {
+			names = append(names, file.Name())
+		}
+	}
+	sort.Strings(names)
+
+	s := &replaySender{}
+	for _, name := range names {
+		data, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read recorded response %s: %v", name, err)
+		}
+		exchange := recordedExchange{}
+		if err := json.Unmarshal(data, &exchange); err != nil {
+			return nil, fmt.Errorf("failed to parse recorded response %s: %v", name, err)
+		}
+		s.exchanges = append(s.exchanges, exchange)
+	}
+	s.used = make([]bool, len(s.exchanges))
+	return s, nil
+}
+
+// Do implements autorest.Sender
+func (s *replaySender) Do(r *http.Request) (*http.Response, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	url := r.URL.String()
+	last := -1
+	for i, exchange := range s.exchanges {
+		if exchange.Method != r.Method || exchange.URL != url {
+			continue
+		}
+		if !s.used[i] {
+			s.used[i] = true
+			return exchange.response(r), nil
+		}
+		last = i
+	}
+	if last >= 0 {
+		return s.exchanges[last].response(r), nil
+	}
+	return nil, fmt.Errorf("no recorded response for %s %s", r.Method, url)
+}
+
+// response builds the recorded response to the request
+func (e recordedExchange) response(r *http.Request) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", e.StatusCode, http.StatusText(e.StatusCode)),
+		StatusCode:    e.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        e.Header,
+		Body:          ioutil.NopCloser(strings.NewReader(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       r,
+	}
+}
+
+// ensureRecordingDir creates the directory responses are recorded to
+func ensureRecordingDir(dir string) error {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return fmt.Errorf("failed to create recording directory: %v", err)
+	}
+	return nil
+}
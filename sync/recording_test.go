@@ -0,0 +1,55 @@
+package sync
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/Azure/go-autorest/autorest"
+)
+
+func TestReplaySenderReturnsRecordedResponsesInOrder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "recording")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir) //nolint: errcheck
+
+	target, _ := url.Parse("https://management.azure.com/frontDoors/fd1?api-version=2018-08-01-preview")
+	record := recordResponse(dir)(autorest.ResponderFunc(func(*http.Response) error { return nil }))
+	for _, body := range []string{`{"name":"first"}`, `{"name":"second"}`} {
+		resp := &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"application/json"}},
+			Body:       ioutil.NopCloser(strings.NewReader(body)),
+			Request:    &http.Request{Method: http.MethodGet, URL: target},
+		}
+		if err := record.Respond(resp); err != nil {
+			t.Fatalf("unexpected error: %+v", err)
+		}
+		if kept, _ := ioutil.ReadAll(resp.Body); string(kept) != body {
+			t.Errorf("Expected the response body to still be readable, got %q", kept)
+		}
+	}
+
+	sender, err := newReplaySender(dir)
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+	for _, want := range []string{`{"name":"first"}`, `{"name":"second"}`, `{"name":"second"}`} {
+		resp, err := sender.Do(&http.Request{Method: http.MethodGet, URL: target})
+		if err != nil {
+			t.Fatalf("unexpected error: %+v", err)
+		}
+		if got, _ := ioutil.ReadAll(resp.Body); string(got) != want || resp.StatusCode != http.StatusOK {
+			t.Errorf("Expected %d %s, got %d %s", http.StatusOK, want, resp.StatusCode, got)
+		}
+	}
+
+	if _, err := sender.Do(&http.Request{Method: http.MethodPut, URL: target}); err == nil {
+		t.Error("Expected an error for a request which wasn't recorded")
+	}
+}
@@ -0,0 +1,264 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/preview/frontdoor/mgmt/2018-08-01-preview/frontdoor"
+	"github.com/Azure/azure-storage-blob-go/2016-05-31/azblob"
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// registeredIngress is the routing rules last generated for an ingress, recorded in the rule registry
+type registeredIngress struct {
+	// Ingress is the ingress's 'namespace/name'
+	Ingress string   `json:"ingress"`
+	Rules   []string `json:"rules"`
+}
+
+// ruleRegistryStore persists the rule registry so it survives the controller restarting
+type ruleRegistryStore interface {
+	load(ctx context.Context) (map[string]registeredIngress, error)
+	save(ctx context.Context, entries map[string]registeredIngress) error
+}
+
+// ruleRegistry maps the UID of each ingress synced to the names of the routing rules generated for it,
+// so the rules of an ingress which is deleted, or renamed by being recreated, are removed rather than
+// left routing traffic under the old name
+type ruleRegistry struct {
+	// store is nil when the registry is only kept in memory
+	store   ruleRegistryStore
+	entries map[string]registeredIngress
+}
+
+// newRuleRegistry loads the cluster's rule registry from the storage account, nil if it's disabled
+func newRuleRegistry(ctx context.Context, config utils.Config) (*ruleRegistry, error) {
+	if !config.RuleRegistry {
+		return nil, nil
+	}
+	container, err := ensureStorageContainer(ctx, config, lockContainerName)
+	if err != nil {
+		return nil, err
+	}
+	store := &blobRuleRegistry{blob: container.NewBlockBlobURL(fmt.Sprintf("registry-%s-%s.json", config.FrontDoorName, config.ClusterName))}
+	entries, err := store.load(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load routing rule registry: %v", err)
+	}
+	return &ruleRegistry{store: store, entries: entries}, nil
+}
+
+type liveIngressesKey struct{}
+
+// WithLiveIngresses returns a context telling the sync the UIDs, with the 'namespace/name', of every
+// ingress which exists and is annotated to be routed, including those which aren't being synced. Without
+// it the rule registry can't tell an ingress which has been deleted from one which wasn't synced, so only
+// removes rules an ingress which is synced no longer generates, and the replace strategy doesn't prune.
+func WithLiveIngresses(ctx context.Context, uids map[types.UID]string) context.Context {
+	return context.WithValue(ctx, liveIngressesKey{}, uids)
+}
+
+// releaseRules removes the routing rules of the cluster's pools which were generated for an ingress in
+// the registry but no longer are, as the ingress was deleted or its rules renamed. When an ingress synced
+// for the first time has a rule matching the same traffic as one removed, the ingress was recreated under
+// a new name or namespace so its rule takes the removed rule's place. Otherwise protected rules are kept.
+// It returns the rules left, the registry to commit once the update succeeds and how many rules were
+// migrated.
+func (p *Synchronizer) releaseRules(ctx context.Context, fd frontdoor.FrontDoor, rules []frontdoor.RoutingRule, ingresses []*v1beta1.Ingress, result *SyncResult, ruleOwners map[string]string) ([]frontdoor.RoutingRule, map[string]registeredIngress, int) {
+	if p.ruleRegistry == nil {
+		return rules, nil, 0
+	}
+	logger := utils.GetLogger(ctx)
+
+	next := make(map[string]registeredIngress, len(p.ruleRegistry.entries))
+	for uid, entry := range p.ruleRegistry.entries {
+		next[uid] = entry
+	}
+	// released holds the name of each rule no longer generated with the ingress it was generated for
+	released := map[string]string{}
+	if live, known := ctx.Value(liveIngressesKey{}).(map[types.UID]string); known {
+		for uid, entry := range p.ruleRegistry.entries {
+			if _, exists := live[types.UID(uid)]; exists {
+				continue
+			}
+			for _, name := range entry.Rules {
+				released[name] = entry.Ingress
+			}
+			delete(next, uid)
+		}
+	}
+
+	generated := map[string][]string{}
+	firstSynced := map[string]bool{}
+	for name, owner := range ruleOwners {
+		generated[owner] = append(generated[owner], name)
+	}
+	for _, ingress := range ingresses {
+		if ingress == nil || ingress.UID == "" {
+			continue
+		}
+		key := ingress.Namespace + "/" + ingress.Name
+		if _, synced := result.RulesHash[key]; !synced {
+			continue
+		}
+		names := generated[key]
+		sort.Strings(names)
+		current := map[string]bool{}
+		for _, name := range names {
+			current[name] = true
+		}
+		entry, registered := p.ruleRegistry.entries[string(ingress.UID)]
+		firstSynced[key] = !registered
+		for _, name := range entry.Rules {
+			if !current[name] {
+				released[name] = key
+			}
+		}
+		next[string(ingress.UID)] = registeredIngress{Ingress: key, Rules: names}
+	}
+
+	removed := func(rule frontdoor.RoutingRule) (string, bool) {
+		if rule.Name == nil {
+			return "", false
+		}
+		owner, isReleased := released[*rule.Name]
+		// A rule another ingress now generates, or routing to another cluster's pool, is kept
+		return owner, isReleased && ruleOwners[*rule.Name] == "" && p.routesToOwnPool(fd, rule, owner)
+	}
+
+	newRules := map[string]frontdoor.RoutingRule{}
+	for _, rule := range rules {
+		if rule.Name != nil && firstSynced[ruleOwners[*rule.Name]] && routeMatch(rule) != "" {
+			newRules[routeMatch(rule)] = rule
+		}
+	}
+	// migrations maps the name of each removed rule to the new rule replacing it, moved holds the new rules' names
+	migrations := map[string]frontdoor.RoutingRule{}
+	moved := map[string]bool{}
+	for _, rule := range rules {
+		if _, isRemoved := removed(rule); !isRemoved {
+			continue
+		}
+		if replacement, exists := newRules[routeMatch(rule)]; exists && !moved[*replacement.Name] {
+			migrations[*rule.Name] = replacement
+			moved[*replacement.Name] = true
+		}
+	}
+
+	kept := make([]frontdoor.RoutingRule, 0, len(rules))
+	for _, rule := range rules {
+		if rule.Name != nil && moved[*rule.Name] {
+			continue
+		}
+		owner, isRemoved := removed(rule)
+		if !isRemoved {
+			kept = append(kept, rule)
+			continue
+		}
+		ruleLogger := logger.WithField("ruleName", *rule.Name).WithField("ingress", owner)
+		if replacement, migrated := migrations[*rule.Name]; migrated {
+			ruleLogger.WithField("newRuleName", *replacement.Name).WithField("newIngress", ruleOwners[*replacement.Name]).
+				WithField(utils.EventField, "RoutingRuleMigrated").Info("Migrating routing rule of ingress recreated under a new name")
+			kept = append(kept, replacement)
+			continue
+		}
+		if p.isProtectedRule(*rule.Name) {
+			ruleLogger.Info("Keeping routing rule no longer generated for its ingress as it's protected by " + pruneAnnotation)
+			kept = append(kept, rule)
+			continue
+		}
+		ruleLogger.Info("Removing routing rule no longer generated for its ingress")
+	}
+	return kept, next, len(migrations)
+}
+
+// routeMatch returns the frontends and patterns the rule matches, which are the same for the rules of an
+// ingress recreated under a new name, or an empty string if the rule has no properties
+func routeMatch(rule frontdoor.RoutingRule) string {
+	if rule.RoutingRuleProperties == nil {
+		return ""
+	}
+	patterns := []string{}
+	if rule.PatternsToMatch != nil {
+		patterns = append(patterns, *rule.PatternsToMatch...)
+	}
+	sort.Strings(patterns)
+	return strings.Join(subResourceIDs(rule.FrontendEndpoints), ",") + "|" + strings.Join(patterns, ",")
+}
+
+// routesToOwnPool returns true if the rule routes to one of the pools the cluster creates for the
+// ingress, given as 'namespace/name'
+func (p *Synchronizer) routesToOwnPool(fd frontdoor.FrontDoor, rule frontdoor.RoutingRule, ingress string) bool {
+	if rule.RoutingRuleProperties == nil {
+		return false
+	}
+	pool := findBackendPoolByID(fd.BackendPools, subResourceID(rule.BackendPool))
+	if pool == nil || pool.Name == nil {
+		return false
+	}
+	parts := strings.SplitN(ingress, "/", 2)
+	if len(parts) != 2 {
+		return false
+	}
+	owner := &v1beta1.Ingress{}
+	owner.Namespace, owner.Name = parts[0], parts[1]
+	switch *pool.Name {
+	case p.clusterName, namespaceBackendPoolName(p.clusterName, owner.Namespace), canaryBackendPoolName(owner), legacyCanaryBackendPoolName(owner):
+		return true
+	}
+	return false
+}
+
+// commitRuleRegistry records the rules generated by an update which succeeded. Failing to save it
+// doesn't fail the sync, the registry is saved again by the next sync.
+func (p *Synchronizer) commitRuleRegistry(ctx context.Context, entries map[string]registeredIngress) {
+	if p.ruleRegistry == nil || entries == nil {
+		return
+	}
+	p.ruleRegistry.entries = entries
+	if p.ruleRegistry.store == nil {
+		return
+	}
+	if err := p.ruleRegistry.store.save(ctx, entries); err != nil {
+		utils.GetLogger(ctx).WithError(err).Warn("Failed to save routing rule registry")
+	}
+}
+
+// blobRuleRegistry keeps the registry as JSON in a blob alongside the lock
+type blobRuleRegistry struct {
+	blob azblob.BlockBlobURL
+}
+
+func (r *blobRuleRegistry) load(ctx context.Context) (map[string]registeredIngress, error) {
+	entries := map[string]registeredIngress{}
+	resp, err := r.blob.GetBlob(ctx, azblob.BlobRange{}, azblob.BlobAccessConditions{}, false)
+	if storageErr, ok := err.(azblob.StorageError); ok && storageErr.ServiceCode() == azblob.ServiceCodeBlobNotFound {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	body := resp.Body()
+	defer body.Close() //nolint: errcheck
+	data, err := ioutil.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+	return entries, json.Unmarshal(data, &entries)
+}
+
+func (r *blobRuleRegistry) save(ctx context.Context, entries map[string]registeredIngress) error {
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	_, err = r.blob.PutBlob(ctx, bytes.NewReader(data), azblob.BlobHTTPHeaders{ContentType: "application/json"}, azblob.Metadata{}, azblob.BlobAccessConditions{})
+	return err
+}
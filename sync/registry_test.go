@@ -0,0 +1,134 @@
+package sync
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/preview/frontdoor/mgmt/2018-08-01-preview/frontdoor"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+	log "github.com/sirupsen/logrus"
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestReleaseRules(t *testing.T) {
+	ctx := utils.WithLogger(context.Background(), log.WithField("test", t.Name()))
+	ownPool := testBackendPool("cluster1", "10.0.0.1")
+	ownPool.ID = to.StringPtr("/frontdoors/fd/backendPools/cluster1")
+	otherPool := testBackendPool("cluster2", "10.0.0.2")
+	otherPool.ID = to.StringPtr("/frontdoors/fd/backendPools/cluster2")
+	fd := frontdoor.FrontDoor{Properties: &frontdoor.Properties{BackendPools: &[]frontdoor.BackendPool{ownPool, otherPool}}}
+	rule := func(name string, pool frontdoor.BackendPool) frontdoor.RoutingRule {
+		return frontdoor.RoutingRule{Name: to.StringPtr(name), RoutingRuleProperties: &frontdoor.RoutingRuleProperties{
+			BackendPool: &frontdoor.SubResource{ID: pool.ID},
+		}}
+	}
+
+	app := testIngress("app", "/")
+	app.UID = "uid-app"
+	p := &Synchronizer{clusterName: "cluster1", ruleRegistry: &ruleRegistry{entries: map[string]registeredIngress{
+		"uid-app":     {Ingress: "default/app", Rules: []string{"Ingress-default-app-old"}},
+		"uid-deleted": {Ingress: "default/deleted", Rules: []string{"Ingress-default-deleted-1"}},
+		"uid-shared":  {Ingress: "default/shared", Rules: []string{"Ingress-default-shared-1"}},
+	}}}
+	rules := []frontdoor.RoutingRule{
+		rule("Ingress-default-app-new", ownPool),
+		rule("Ingress-default-app-old", ownPool),
+		rule("Ingress-default-deleted-1", ownPool),
+		rule("Ingress-default-shared-1", otherPool),
+	}
+	result := &SyncResult{RulesHash: map[string]string{"default/app": "hash"}}
+	ruleOwners := map[string]string{"Ingress-default-app-new": "default/app"}
+
+	names := func(rules []frontdoor.RoutingRule) string {
+		names := []string{}
+		for _, rule := range rules {
+			names = append(names, *rule.Name)
+		}
+		return strings.Join(names, ",")
+	}
+
+	kept, registry, _ := p.releaseRules(ctx, fd, rules, []*v1beta1.Ingress{app}, result, ruleOwners)
+	if got := names(kept); got != "Ingress-default-app-new,Ingress-default-deleted-1,Ingress-default-shared-1" {
+		t.Errorf("Expected only the renamed rule to be removed without the live ingresses got %s", got)
+	}
+	if !reflect.DeepEqual(registry["uid-app"].Rules, []string{"Ingress-default-app-new"}) || len(registry) != 3 {
+		t.Errorf("Expected the ingress's new rules to be registered got %v", registry)
+	}
+
+	live := WithLiveIngresses(ctx, map[types.UID]string{"uid-app": "default/app"})
+	kept, registry, _ = p.releaseRules(live, fd, rules, []*v1beta1.Ingress{app}, result, ruleOwners)
+	if got := names(kept); got != "Ingress-default-app-new,Ingress-default-shared-1" {
+		t.Errorf("Expected the deleted ingress's rule to be removed, but not another cluster's, got %s", got)
+	}
+	if _, registered := registry["uid-deleted"]; registered || len(registry) != 1 {
+		t.Errorf("Expected the deleted ingresses to be forgotten got %v", registry)
+	}
+
+	p.commitRuleRegistry(ctx, registry)
+	if !reflect.DeepEqual(p.ruleRegistry.entries, registry) {
+		t.Error("Expected the registry to be committed")
+	}
+}
+
+func TestReleaseRulesWithoutRegistry(t *testing.T) {
+	ctx := utils.WithLogger(context.Background(), log.WithField("test", t.Name()))
+	p := &Synchronizer{clusterName: "cluster1"}
+	rules := []frontdoor.RoutingRule{{Name: to.StringPtr("Ingress-default-app-1")}}
+	kept, registry, _ := p.releaseRules(ctx, frontdoor.FrontDoor{}, rules, nil, &SyncResult{}, nil)
+	if len(kept) != 1 || registry != nil {
+		t.Errorf("Expected the rules to be unchanged got %v", kept)
+	}
+}
+
+func TestReleaseRulesMigratesRecreatedIngress(t *testing.T) {
+	ctx := utils.WithLogger(context.Background(), log.WithField("test", t.Name()))
+	pool := testBackendPool("cluster1", "10.0.0.1")
+	pool.ID = to.StringPtr("/frontdoors/fd/backendPools/cluster1")
+	fd := frontdoor.FrontDoor{Properties: &frontdoor.Properties{BackendPools: &[]frontdoor.BackendPool{pool}}}
+	rule := func(name string, patterns ...string) frontdoor.RoutingRule {
+		return frontdoor.RoutingRule{Name: to.StringPtr(name), RoutingRuleProperties: &frontdoor.RoutingRuleProperties{
+			BackendPool:       &frontdoor.SubResource{ID: pool.ID},
+			FrontendEndpoints: &[]frontdoor.SubResource{{ID: to.StringPtr("/frontdoors/fd/frontendEndpoints/default")}},
+			PatternsToMatch:   &patterns,
+		}}
+	}
+
+	moved := testIngress("app", "/")
+	moved.Namespace = "web"
+	moved.UID = "uid-moved"
+	p := &Synchronizer{clusterName: "cluster1", ruleRegistry: &ruleRegistry{entries: map[string]registeredIngress{
+		"uid-app":   {Ingress: "default/app", Rules: []string{"Ingress-default-app-1", "Ingress-default-app-2"}},
+		"uid-other": {Ingress: "default/other", Rules: []string{"Ingress-default-other-1"}},
+	}}}
+	rules := []frontdoor.RoutingRule{
+		rule("Ingress-default-app-1", "/"),
+		rule("Ingress-default-other-1", "/other"),
+		rule("Ingress-default-app-2", "/api", "/api/*"),
+		rule("Ingress-web-app-1", "/api/*", "/api"),
+	}
+	result := &SyncResult{RulesHash: map[string]string{"web/app": "hash"}}
+	ruleOwners := map[string]string{"Ingress-web-app-1": "web/app"}
+	live := WithLiveIngresses(ctx, map[types.UID]string{"uid-moved": "web/app", "uid-other": "default/other"})
+
+	kept, registry, migrated := p.releaseRules(live, fd, rules, []*v1beta1.Ingress{moved}, result, ruleOwners)
+	names := []string{}
+	for _, rule := range kept {
+		names = append(names, *rule.Name)
+	}
+	if got := strings.Join(names, ","); got != "Ingress-default-other-1,Ingress-web-app-1" || migrated != 1 {
+		t.Errorf("Expected the matching rule to be migrated in its place got %s, %d migrated", got, migrated)
+	}
+	if !reflect.DeepEqual(registry["uid-moved"].Rules, []string{"Ingress-web-app-1"}) {
+		t.Errorf("Expected the recreated ingress to be registered got %v", registry)
+	}
+
+	// Once registered the ingress's rules are no longer migrated
+	p.commitRuleRegistry(ctx, registry)
+	if _, _, migrated = p.releaseRules(live, fd, rules, []*v1beta1.Ingress{moved}, result, ruleOwners); migrated != 0 {
+		t.Errorf("Expected nothing to be migrated got %d", migrated)
+	}
+}
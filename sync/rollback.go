@@ -0,0 +1,102 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/preview/frontdoor/mgmt/2018-08-01-preview/frontdoor"
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+)
+
+const (
+	// rollbackProbeInterval is how often the frontend is probed after an update
+	rollbackProbeInterval = 5 * time.Second
+	// rollbackFailureRatio is the fraction of failed probes above which an update is rolled back
+	rollbackFailureRatio = 0.5
+	// rollbackProbeTimeout limits how long a single probe can take
+	rollbackProbeTimeout = 10 * time.Second
+)
+
+// newFrontendProbe returns a probe which requests the path from the frontend hostname,
+// failing on errors and 5xx responses
+func newFrontendProbe(config utils.Config) func(context.Context) error {
+	client := &http.Client{Timeout: rollbackProbeTimeout}
+	url := fmt.Sprintf("https://%s%s", config.FrontDoorHostname, config.RollbackProbePath)
+	return func(ctx context.Context) error {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			return err
+		}
+		resp, err := client.Do(req.WithContext(ctx))
+		if err != nil {
+			return err
+		}
+		resp.Body.Close() //nolint: errcheck
+		if resp.StatusCode >= 500 {
+			return fmt.Errorf("%s returned %s", url, resp.Status)
+		}
+		return nil
+	}
+}
+
+// probeHealth runs the probe every interval for the window and returns an error
+// describing the failures if more than rollbackFailureRatio of the probes fail
+func probeHealth(ctx context.Context, probe func(context.Context) error, window, interval time.Duration) error {
+	probes := int(window / interval)
+	if probes < 1 {
+		probes = 1
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	total, failed := 0, 0
+	var lastErr error
+	for {
+		total++
+		if err := probe(ctx); err != nil {
+			failed++
+			lastErr = err
+		}
+		if total >= probes {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+
+	if float64(failed)/float64(total) > rollbackFailureRatio {
+		return fmt.Errorf("%d of %d probes of the frontend failed after the update, last error: %v", failed, total, lastErr)
+	}
+	return nil
+}
+
+// rollbackIfUnhealthy probes the frontend after an update, if enabled, and re-applies the
+// configuration from before the update when it's unhealthy. It returns why the update was
+// rolled back, empty if it wasn't, or an error if the rollback failed.
+func (p *Synchronizer) rollbackIfUnhealthy(ctx context.Context, previous frontdoor.FrontDoor) (string, error) {
+	if p.rollbackWindow <= 0 {
+		return "", nil
+	}
+	logger := utils.GetLogger(ctx)
+	logger.WithField("window", p.rollbackWindow).Info("Probing frontend after update")
+
+	unhealthy := probeHealth(ctx, p.probe, p.rollbackWindow, rollbackProbeInterval)
+	if unhealthy == nil {
+		return "", nil
+	}
+	if ctx.Err() != nil {
+		return "", ctx.Err()
+	}
+
+	logger.WithError(unhealthy).Error("Frontend unhealthy after update, rolling back to previous Frontdoor configuration")
+	rollbacks.Inc()
+	if _, err := p.updateState(ctx, previous); err != nil {
+		return "", fmt.Errorf("failed to roll back unhealthy update (%v): %v", unhealthy, err)
+	}
+	return fmt.Sprintf("rolled back as the frontend was unhealthy: %v", unhealthy), nil
+}
@@ -0,0 +1,66 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+)
+
+func TestProbeHealth(t *testing.T) {
+	testCases := []struct {
+		name          string
+		results       []error
+		expectHealthy bool
+	}{
+		{name: "allPass", results: []error{nil, nil, nil, nil}, expectHealthy: true},
+		{name: "halfFail", results: []error{errors.New("502"), nil, errors.New("502"), nil}, expectHealthy: true},
+		{name: "mostFail", results: []error{errors.New("502"), errors.New("502"), nil, errors.New("timeout")}, expectHealthy: false},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			calls := 0
+			probe := func(context.Context) error {
+				err := test.results[calls%len(test.results)]
+				calls++
+				return err
+			}
+			// The window allows for four probes
+			err := probeHealth(context.Background(), probe, 4*time.Millisecond, time.Millisecond)
+			if calls != len(test.results) {
+				t.Errorf("Expected %d probes got %d", len(test.results), calls)
+			}
+			if test.expectHealthy && err != nil {
+				t.Errorf("Expected healthy got %v", err)
+			}
+			if !test.expectHealthy && err == nil {
+				t.Error("Expected unhealthy")
+			}
+		})
+	}
+}
+
+func TestSyncOnlyProbesFrontendWhenUpdateChangedFrontDoor(t *testing.T) {
+	ctx := integrationContext(t)
+	server := newFakeFrontDoorServer(t, testIntegrationFrontDoor("cluster1"))
+	defer server.Close()
+	p := newIntegrationSynchronizer(ctx, t, server, &fakeLockService{}, "cluster1")
+	probes := 0
+	p.rollbackWindow = time.Millisecond
+	p.probe = func(context.Context) error {
+		probes++
+		return nil
+	}
+
+	app := testIngress("app", "/app")
+	for i := 0; i < 2; i++ {
+		if _, err := p.Sync(ctx, []*v1beta1.Ingress{app}, nil); err != nil {
+			t.Fatalf("unexpected error: %+v", err)
+		}
+	}
+	if probes != 1 || server.puts != 1 {
+		t.Errorf("Expected only the sync which changed Frontdoor to update and probe it, got %d updates and %d probes", server.puts, probes)
+	}
+}
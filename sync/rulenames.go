@@ -0,0 +1,159 @@
+package sync
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"regexp"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/preview/frontdoor/mgmt/2018-08-01-preview/frontdoor"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+)
+
+// ruleNameHashLength is the number of hex characters of the ingress's hash added to its rule name
+const ruleNameHashLength = 8
+
+// invalidRuleNameChars matches the characters of an ingress's name Frontdoor doesn't allow in a rule name
+var invalidRuleNameChars = regexp.MustCompile(`[^a-zA-Z0-9-]`)
+
+// routingRuleName returns the name of the routing rule for the ingress's rule without a host,
+// 'Ingress-<namespace>-<name>-<hash>'. The namespace stops identically named ingresses in different
+// namespaces colliding and the hash of 'namespace/name' keeps names unique once dots are replaced and
+// long names are truncated.
+func routingRuleName(ingress *v1beta1.Ingress) string {
+	return ingressResourceName(routingRulePrefix, ingress)
+}
+
+// hostRoutingRuleName returns the name of the routing rule for the ingress's rule for the host,
+// 'Ingress-<namespace>-<name>-<hash>-<host hash>', as each host is routed by its own rule bound to the
+// host's frontend. The rule without a host keeps the name from routingRuleName.
+func hostRoutingRuleName(ingress *v1beta1.Ingress, host string) string {
+	if host == "" {
+		return routingRuleName(ingress)
+	}
+	return ingressResourceName(routingRulePrefix, ingress, host)
+}
+
+// hostRoutingRulePrefix returns the start of the names of the ingress's rules for a host, which only
+// differ in the host's hash at their end
+func hostRoutingRulePrefix(ingress *v1beta1.Ingress) string {
+	name := ingressResourceName(routingRulePrefix, ingress, "")
+	return name[:len(name)-ruleNameHashLength]
+}
+
+// hostRoutingRuleKey returns the start of the rule's name which hostRoutingRulePrefix returns for the
+// ingress the rule is for, if it's the rule for a host
+func hostRoutingRuleKey(name string) string {
+	if len(name) <= ruleNameHashLength {
+		return ""
+	}
+	return name[:len(name)-ruleNameHashLength]
+}
+
+// firstRoutingRuleName returns the name of the routing rule for the first of the ingress's rules
+func firstRoutingRuleName(ingress *v1beta1.Ingress) string {
+	for _, rule := range ingress.Spec.Rules {
+		if rule.HTTP != nil {
+			return hostRoutingRuleName(ingress, rule.Host)
+		}
+	}
+	return routingRuleName(ingress)
+}
+
+// ingressResourceName returns a name unique to the ingress, and to each of the parts given,
+// '<prefix><namespace>-<name>-<hash>' followed by '-<part hash>' for each part, which is valid for a
+// Frontdoor child resource
+func ingressResourceName(prefix string, ingress *v1beta1.Ingress, parts ...string) string {
+	suffix := "-" + shortHash(ingress.Namespace+"/"+ingress.Name)
+	for _, part := range parts {
+		suffix += "-" + shortHash(part)
+	}
+
+	name := invalidRuleNameChars.ReplaceAllString(ingress.Namespace+"-"+ingress.Name, "-")
+	maxLength := utils.MaxFrontDoorChildNameLength - len(prefix) - len(suffix)
+	if len(name) > maxLength {
+		name = name[:maxLength]
+	}
+	return prefix + strings.TrimRight(name, "-") + suffix
+}
+
+// shortHash returns the start of the hex SHA-256 of the value, which is ruleNameHashLength characters long
+func shortHash(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:])[:ruleNameHashLength]
+}
+
+// legacyRoutingRuleName returns the name earlier versions of the controller gave the ingress's rule
+func legacyRoutingRuleName(ingress *v1beta1.Ingress) string {
+	return routingRulePrefix + ingress.Name
+}
+
+// renameLegacyRoutingRules renames rules named 'Ingress-<name>' by earlier versions of the controller to the
+// name now used for their ingress, so the update replaces them rather than leaving a duplicate route and, in
+// merge mode, changes made outside the controller are kept.
+//
+// A legacy rule is only changed when an ingress in the sync has its name and the rule routes to that ingress's
+// cluster, namespace or canary pool, rules created by controllers in other clusters are left alone. When
+// ingresses in more than one namespace match, or a rule with the new name already exists, the legacy rule
+// is removed and the new rules replace it.
+func (p *Synchronizer) renameLegacyRoutingRules(ctx context.Context, fd frontdoor.FrontDoor, existing []frontdoor.RoutingRule, ingresses []*v1beta1.Ingress, result *SyncResult) []frontdoor.RoutingRule {
+	logger := utils.GetLogger(ctx)
+
+	existingNames := map[string]bool{}
+	for _, rule := range existing {
+		if rule.Name != nil {
+			existingNames[*rule.Name] = true
+		}
+	}
+
+	renamed := make([]frontdoor.RoutingRule, 0, len(existing))
+	for _, rule := range existing {
+		if rule.Name == nil || rule.RoutingRuleProperties == nil {
+			renamed = append(renamed, rule)
+			continue
+		}
+		owners := p.legacyRuleOwners(fd, rule, ingresses, result)
+		if len(owners) == 0 {
+			renamed = append(renamed, rule)
+			continue
+		}
+
+		ruleLogger := logger.WithField("ruleName", *rule.Name)
+		newName := firstRoutingRuleName(owners[0])
+		if len(owners) > 1 || existingNames[newName] {
+			ruleLogger.Info("Removing routing rule named by an earlier version of the controller, it's replaced by the ingress's new rules")
+			continue
+		}
+		ruleLogger.WithField("newName", newName).Info("Renaming routing rule named by an earlier version of the controller")
+		// The ID refers to the old name so is dropped, Azure sets it from the new name
+		rule.Name = to.StringPtr(newName)
+		rule.ID = nil
+		renamed = append(renamed, rule)
+	}
+	return renamed
+}
+
+// legacyRuleOwners returns the synced ingresses the rule could have been created for under the legacy naming scheme
+func (p *Synchronizer) legacyRuleOwners(fd frontdoor.FrontDoor, rule frontdoor.RoutingRule, ingresses []*v1beta1.Ingress, result *SyncResult) []*v1beta1.Ingress {
+	pool := findBackendPoolByID(fd.BackendPools, subResourceID(rule.BackendPool))
+	if pool == nil {
+		return nil
+	}
+	owners := []*v1beta1.Ingress{}
+	for _, ingress := range ingresses {
+		if ingress == nil || *rule.Name != legacyRoutingRuleName(ingress) {
+			continue
+		}
+		if _, synced := result.RulesHash[ingress.Namespace+"/"+ingress.Name]; !synced {
+			continue
+		}
+		switch *pool.Name {
+		case p.clusterName, namespaceBackendPoolName(p.clusterName, ingress.Namespace), legacyCanaryBackendPoolName(ingress):
+			owners = append(owners, ingress)
+		}
+	}
+	return owners
+}
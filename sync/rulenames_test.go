@@ -0,0 +1,115 @@
+package sync
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/preview/frontdoor/mgmt/2018-08-01-preview/frontdoor"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+	log "github.com/sirupsen/logrus"
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestRoutingRuleNameIncludesNamespace(t *testing.T) {
+	ingress := func(namespace, name string) *v1beta1.Ingress {
+		return &v1beta1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace}}
+	}
+
+	a := routingRuleName(ingress("team-a", "app"))
+	b := routingRuleName(ingress("team-b", "app"))
+	if a == b {
+		t.Errorf("Expected ingresses with the same name in different namespaces to have different rule names, both got %s", a)
+	}
+	if !strings.HasPrefix(a, "Ingress-team-a-app-") {
+		t.Errorf("Expected the rule name to include the namespace and name, got %s", a)
+	}
+
+	dotted := routingRuleName(ingress("default", "my.app"))
+	hyphenated := routingRuleName(ingress("default", "my-app"))
+	if dotted == hyphenated {
+		t.Errorf("Expected the hash to keep names unique once dots are replaced, both got %s", dotted)
+	}
+
+	long := routingRuleName(ingress(strings.Repeat("n", 63), strings.Repeat("a", 253)))
+	for _, name := range []string{a, dotted, long} {
+		if err := utils.ValidateFrontDoorChildName(name); err != nil {
+			t.Errorf("Expected a valid Frontdoor name: %v", err)
+		}
+	}
+}
+
+func TestHostRoutingRuleNameIsUniqueToHost(t *testing.T) {
+	app := testIngress("app", "/")
+	long := &v1beta1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: strings.Repeat("a", 253), Namespace: strings.Repeat("n", 63)}}
+	for _, ingress := range []*v1beta1.Ingress{app, long} {
+		names := map[string]bool{}
+		for _, host := range []string{"", "a.example.com", "b.example.com"} {
+			name := hostRoutingRuleName(ingress, host)
+			if err := utils.ValidateFrontDoorChildName(name); err != nil {
+				t.Errorf("Expected a valid Frontdoor name: %v", err)
+			}
+			if names[name] {
+				t.Errorf("Expected each host to have its own rule name, got %s twice", name)
+			}
+			names[name] = true
+			if host != "" && hostRoutingRuleKey(name) != hostRoutingRulePrefix(ingress) {
+				t.Errorf("Expected %s to be recognised as the ingress's rule for a host", name)
+			}
+		}
+	}
+	if hostRoutingRuleName(app, "") != routingRuleName(app) {
+		t.Error("Expected the rule without a host to keep the ingress's rule name")
+	}
+	if hostRoutingRuleKey(routingRuleName(app)) == hostRoutingRulePrefix(app) {
+		t.Error("Expected the rule without a host not to be taken for a rule for a host")
+	}
+}
+
+func TestRenameLegacyRoutingRules(t *testing.T) {
+	ctx := utils.WithLogger(context.Background(), log.WithField("test", t.Name()))
+	pool := testBackendPool("cluster1", "10.0.0.1")
+	pool.ID = to.StringPtr("/frontDoors/fd1/backendPools/cluster1")
+	otherPool := testBackendPool("cluster2", "10.1.0.1")
+	otherPool.ID = to.StringPtr("/frontDoors/fd1/backendPools/cluster2")
+	fd := frontdoor.FrontDoor{
+		Properties: &frontdoor.Properties{BackendPools: &[]frontdoor.BackendPool{pool, otherPool}},
+	}
+	p := &Synchronizer{clusterName: "cluster1"}
+
+	app := testIngress("app", "/app")
+	shared := testIngress("shared", "/shared")
+	sharedElsewhere := testIngress("shared", "/shared")
+	sharedElsewhere.Namespace = "other"
+	remote := testIngress("remote", "/remote")
+	ingresses := []*v1beta1.Ingress{app, shared, sharedElsewhere, remote}
+	result := &SyncResult{RulesHash: map[string]string{}}
+	for _, ingress := range ingresses {
+		result.RulesHash[ingress.Namespace+"/"+ingress.Name] = "hash"
+	}
+
+	existing := []frontdoor.RoutingRule{
+		testRoutingRule("Ingress-app", *pool.ID, "/app", "/manual"),
+		testRoutingRule("Ingress-shared", *pool.ID, "/shared"),
+		testRoutingRule("Ingress-remote", *otherPool.ID, "/remote"),
+		testRoutingRule("Manual", *pool.ID, "/manual"),
+	}
+	renamed := p.renameLegacyRoutingRules(ctx, fd, existing, ingresses, result)
+
+	names := []string{}
+	for _, rule := range renamed {
+		names = append(names, *rule.Name)
+	}
+	expected := []string{routingRuleName(app), "Ingress-remote", "Manual"}
+	if strings.Join(names, ",") != strings.Join(expected, ",") {
+		t.Fatalf("Expected rules %v, got %v", expected, names)
+	}
+	if len(*renamed[0].PatternsToMatch) != 2 {
+		t.Error("Expected the renamed rule to keep its existing properties")
+	}
+	if *existing[0].Name != "Ingress-app" {
+		t.Error("Expected the existing rules to be unchanged")
+	}
+}
@@ -0,0 +1,25 @@
+package sync
+
+import (
+	"fmt"
+
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+)
+
+// rulesEngineAnnotation names a Frontdoor rules engine configuration to bind to the ingress's routes,
+// which the Frontdoor API version used doesn't support
+const rulesEngineAnnotation = "azure/frontdoor-rules-engine"
+
+// rulesEngineUnsupported explains why the rules engine annotation can't be used
+var rulesEngineUnsupported = fmt.Sprintf("rules engines aren't supported by Frontdoor API version %s", frontdoorAPIVersion)
+
+// checkRulesEngineForIngress fails an ingress which references a rules engine configuration rather than
+// silently ignoring it. The controller removes the annotation as invalid before the sync, so this catches
+// ingresses synced without that check, such as by the plan command.
+func checkRulesEngineForIngress(ingress *v1beta1.Ingress) error {
+	name, exists := ingress.Annotations[rulesEngineAnnotation]
+	if !exists {
+		return nil
+	}
+	return fmt.Errorf("%s: %q can't be bound to the ingress's routes as %s", rulesEngineAnnotation, name, rulesEngineUnsupported)
+}
@@ -0,0 +1,21 @@
+package sync
+
+import (
+	"testing"
+
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestCheckRulesEngineForIngress(t *testing.T) {
+	ingress := func(annotations map[string]string) *v1beta1.Ingress {
+		return &v1beta1.Ingress{ObjectMeta: metav1.ObjectMeta{Name: "app", Annotations: annotations}}
+	}
+
+	if err := checkRulesEngineForIngress(ingress(map[string]string{})); err != nil {
+		t.Errorf("Expected no error without the annotation, got %v", err)
+	}
+	if err := checkRulesEngineForIngress(ingress(map[string]string{rulesEngineAnnotation: "headers"})); err == nil {
+		t.Error("Expected the annotation to be rejected as unsupported")
+	}
+}
@@ -0,0 +1,182 @@
+package sync
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+)
+
+const (
+	// enabledScheduleAnnotation lists the windows the ingress's routes are enabled in, they're disabled
+	// outside them, for example 'Mon-Fri 08:00-18:00'
+	enabledScheduleAnnotation = "azure/frontdoor-enabled-schedule"
+	// disabledScheduleAnnotation lists the windows the ingress's routes are disabled in, for example a
+	// maintenance window, it takes precedence over the enabled schedule
+	disabledScheduleAnnotation = "azure/frontdoor-disabled-schedule"
+)
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// scheduleWindow is a period of time in a schedule annotation
+type scheduleWindow interface {
+	contains(t time.Time) bool
+}
+
+// weeklyWindow repeats on the days set, from start to end as offsets from midnight UTC. A window
+// which ends before it starts runs overnight into the following day.
+type weeklyWindow struct {
+	days       [7]bool
+	start, end time.Duration
+}
+
+func (w weeklyWindow) contains(t time.Time) bool {
+	t = t.UTC()
+	offset := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+	if w.start < w.end {
+		return w.days[t.Weekday()] && offset >= w.start && offset < w.end
+	}
+	yesterday := (t.Weekday() + 6) % 7
+	return w.days[t.Weekday()] && offset >= w.start || w.days[yesterday] && offset < w.end
+}
+
+// absoluteWindow is a single period, such as a planned maintenance
+type absoluteWindow struct {
+	start, end time.Time
+}
+
+func (w absoluteWindow) contains(t time.Time) bool {
+	return !t.Before(w.start) && t.Before(w.end)
+}
+
+// parseSchedule parses the ';' separated windows of a schedule annotation. Each is either weekly,
+// days and a UTC time range such as 'Mon-Fri 08:00-18:00' or 'Sat,Sun 22:00-02:00', or an RFC 3339
+// interval such as '2019-12-24T00:00:00Z/2019-12-27T00:00:00Z'.
+func parseSchedule(value string) ([]scheduleWindow, error) {
+	windows := []scheduleWindow{}
+	for _, part := range strings.Split(value, ";") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		if bounds := strings.Split(part, "/"); len(bounds) == 2 {
+			start, err := time.Parse(time.RFC3339, strings.TrimSpace(bounds[0]))
+			if err != nil {
+				return nil, fmt.Errorf("window %q has an invalid start: %v", part, err)
+			}
+			end, err := time.Parse(time.RFC3339, strings.TrimSpace(bounds[1]))
+			if err != nil {
+				return nil, fmt.Errorf("window %q has an invalid end: %v", part, err)
+			}
+			if !end.After(start) {
+				return nil, fmt.Errorf("window %q must end after it starts", part)
+			}
+			windows = append(windows, absoluteWindow{start: start, end: end})
+			continue
+		}
+		window, err := parseWeeklyWindow(part)
+		if err != nil {
+			return nil, err
+		}
+		windows = append(windows, window)
+	}
+	if len(windows) == 0 {
+		return nil, fmt.Errorf("schedule %q has no windows", value)
+	}
+	return windows, nil
+}
+
+func parseWeeklyWindow(value string) (weeklyWindow, error) {
+	window := weeklyWindow{}
+	fields := strings.Fields(value)
+	if len(fields) != 2 {
+		return window, fmt.Errorf("window %q must be days and a time range, for example 'Mon-Fri 08:00-18:00'", value)
+	}
+	for _, days := range strings.Split(fields[0], ",") {
+		bounds := strings.Split(strings.ToLower(days), "-")
+		first, ok := weekdays[bounds[0]]
+		last := first
+		if ok && len(bounds) == 2 {
+			last, ok = weekdays[bounds[1]]
+		}
+		if !ok || len(bounds) > 2 {
+			return window, fmt.Errorf("window %q has invalid days %q, use names such as 'Mon', ranges such as 'Mon-Fri' or lists such as 'Sat,Sun'", value, days)
+		}
+		// Ranges can wrap around the end of the week, such as 'Fri-Mon'
+		for day := first; ; day = (day + 1) % 7 {
+			window.days[day] = true
+			if day == last {
+				break
+			}
+		}
+	}
+
+	times := strings.Split(fields[1], "-")
+	if len(times) != 2 {
+		return window, fmt.Errorf("window %q must have a time range such as '08:00-18:00'", value)
+	}
+	var err error
+	if window.start, err = parseTimeOfDay(times[0]); err != nil {
+		return window, fmt.Errorf("window %q has an invalid start: %v", value, err)
+	}
+	if window.end, err = parseTimeOfDay(times[1]); err != nil {
+		return window, fmt.Errorf("window %q has an invalid end: %v", value, err)
+	}
+	if window.start == window.end || window.start == 24*time.Hour {
+		return window, fmt.Errorf("window %q must have a different start and end", value)
+	}
+	return window, nil
+}
+
+// parseTimeOfDay parses 'HH:MM' as an offset from midnight, '24:00' is allowed as the end of the day
+func parseTimeOfDay(value string) (time.Duration, error) {
+	parts := strings.Split(value, ":")
+	if len(parts) != 2 || len(parts[0]) != 2 || len(parts[1]) != 2 {
+		return 0, fmt.Errorf("%q must be 'HH:MM'", value)
+	}
+	hours, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, fmt.Errorf("%q must be 'HH:MM'", value)
+	}
+	minutes, err := strconv.Atoi(parts[1])
+	if err != nil || hours < 0 || minutes < 0 || minutes > 59 || hours > 24 || hours == 24 && minutes != 0 {
+		return 0, fmt.Errorf("%q must be 'HH:MM' between 00:00 and 24:00", value)
+	}
+	return time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute, nil
+}
+
+// scheduledEnabled returns whether the ingress's routes are enabled at the time from its
+// schedule annotations, they're enabled when neither is set
+func scheduledEnabled(ingress *v1beta1.Ingress, now time.Time) (bool, error) {
+	inSchedule := func(annotation string) (bool, bool, error) {
+		value, exists := ingress.Annotations[annotation]
+		if !exists {
+			return false, false, nil
+		}
+		windows, err := parseSchedule(value)
+		if err != nil {
+			return false, true, fmt.Errorf("annotation %s: %v", annotation, err)
+		}
+		for _, window := range windows {
+			if window.contains(now) {
+				return true, true, nil
+			}
+		}
+		return false, true, nil
+	}
+
+	disabled, _, err := inSchedule(disabledScheduleAnnotation)
+	if err != nil {
+		return false, err
+	}
+	enabled, hasEnabledSchedule, err := inSchedule(enabledScheduleAnnotation)
+	if err != nil {
+		return false, err
+	}
+	return !disabled && (enabled || !hasEnabledSchedule), nil
+}
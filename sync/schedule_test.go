@@ -0,0 +1,68 @@
+package sync
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduledEnabled(t *testing.T) {
+	// 2019-06-07 is a Friday
+	friday := func(clock string) time.Time {
+		at, _ := time.Parse(time.RFC3339, "2019-06-07T"+clock+":00Z")
+		return at
+	}
+	testCases := []struct {
+		name     string
+		enabled  string
+		disabled string
+		now      time.Time
+		expected bool
+	}{
+		{name: "noSchedule", now: friday("12:00"), expected: true},
+		{name: "inWeeklyWindow", enabled: "Mon-Fri 08:00-18:00", now: friday("12:00"), expected: true},
+		{name: "afterWeeklyWindow", enabled: "Mon-Fri 08:00-18:00", now: friday("18:00"), expected: false},
+		{name: "notOnDay", enabled: "Sat,Sun 00:00-24:00", now: friday("12:00"), expected: false},
+		{name: "overnightFromPreviousDay", enabled: "Thu 22:00-02:00", now: friday("01:30"), expected: true},
+		{name: "rangeWrappingWeek", enabled: "Fri-Mon 00:00-24:00", now: friday("12:00"), expected: true},
+		{name: "inMaintenance", disabled: "2019-06-07T11:00:00Z/2019-06-07T13:00:00Z", now: friday("12:00"), expected: false},
+		{name: "maintenanceOverridesEnabled", enabled: "Mon-Fri 08:00-18:00", disabled: "Fri 11:00-13:00", now: friday("12:00"), expected: false},
+		{name: "afterMaintenance", disabled: "2019-06-07T11:00:00Z/2019-06-07T12:00:00Z", now: friday("12:00"), expected: true},
+	}
+	for _, test := range testCases {
+		t.Run(test.name, func(t *testing.T) {
+			ingress := testIngress("app", "/")
+			ingress.Annotations = map[string]string{}
+			if test.enabled != "" {
+				ingress.Annotations[enabledScheduleAnnotation] = test.enabled
+			}
+			if test.disabled != "" {
+				ingress.Annotations[disabledScheduleAnnotation] = test.disabled
+			}
+			enabled, err := scheduledEnabled(ingress, test.now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if enabled != test.expected {
+				t.Errorf("Expected enabled %t got %t", test.expected, enabled)
+			}
+		})
+	}
+}
+
+func TestParseScheduleRejectsInvalidWindows(t *testing.T) {
+	for _, schedule := range []string{
+		"",
+		"weekdays 08:00-18:00",
+		"Mon-Fri",
+		"Mon-Fri 8:00-18:00",
+		"Mon 08:00-08:00",
+		"Mon 08:00-25:00",
+		"Mon-Tue-Wed 08:00-18:00",
+		"2019-06-07T13:00:00Z/2019-06-07T11:00:00Z",
+		"2019-06-07/2019-06-08",
+	} {
+		if _, err := parseSchedule(schedule); err == nil {
+			t.Errorf("Expected schedule %q to be invalid", schedule)
+		}
+	}
+}
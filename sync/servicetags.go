@@ -0,0 +1,78 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/azure"
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+)
+
+const (
+	// frontDoorBackendServiceTag lists the addresses Frontdoor sends traffic to backends from
+	frontDoorBackendServiceTag = "AzureFrontDoor.Backend"
+	// serviceTagsLocation is the region queried for service tags, every region returns the
+	// same public cloud tags
+	serviceTagsLocation   = "westeurope"
+	serviceTagsAPIVersion = "2019-04-01"
+)
+
+// serviceTagsResponse is the part of the service tags list used by the controller
+type serviceTagsResponse struct {
+	Values []struct {
+		Name       string `json:"name"`
+		Properties struct {
+			ChangeNumber    string   `json:"changeNumber"`
+			AddressPrefixes []string `json:"addressPrefixes"`
+		} `json:"properties"`
+	} `json:"values"`
+}
+
+// FrontDoorBackendRanges returns the address prefixes, sorted, that Frontdoor sends traffic to backends
+// from using the Azure service tags API, along with the change number which increases when they change
+func FrontDoorBackendRanges(ctx context.Context, config utils.Config) ([]string, string, error) {
+	fdClient, err := newFrontDoorsClient(ctx, config)
+	if err != nil {
+		return nil, "", err
+	}
+
+	pathParameters := map[string]interface{}{
+		"location":       autorest.Encode("path", serviceTagsLocation),
+		"subscriptionId": autorest.Encode("path", fdClient.SubscriptionID),
+	}
+	preparer := autorest.CreatePreparer(
+		autorest.AsGet(),
+		autorest.WithBaseURL(fdClient.BaseURI),
+		autorest.WithPathParameters("/subscriptions/{subscriptionId}/providers/Microsoft.Network/locations/{location}/serviceTags", pathParameters),
+		autorest.WithQueryParameters(map[string]interface{}{"api-version": serviceTagsAPIVersion}))
+	req, err := preparer.Prepare((&http.Request{}).WithContext(ctx))
+	if err != nil {
+		return nil, "", err
+	}
+
+	resp, err := autorest.SendWithSender(fdClient, req, azure.DoRetryWithRegistration(fdClient.Client))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to list service tags: %v", err)
+	}
+	tags := serviceTagsResponse{}
+	err = autorest.Respond(resp,
+		fdClient.ByInspecting(),
+		azure.WithErrorUnlessStatusCode(http.StatusOK),
+		autorest.ByUnmarshallingJSON(&tags),
+		autorest.ByClosing())
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to list service tags: %v", err)
+	}
+
+	for _, tag := range tags.Values {
+		if tag.Name == frontDoorBackendServiceTag {
+			prefixes := append([]string{}, tag.Properties.AddressPrefixes...)
+			sort.Strings(prefixes)
+			return prefixes, tag.Properties.ChangeNumber, nil
+		}
+	}
+	return nil, "", fmt.Errorf("service tag %s not found", frontDoorBackendServiceTag)
+}
@@ -0,0 +1,277 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/preview/frontdoor/mgmt/2018-08-01-preview/frontdoor"
+	"github.com/Azure/azure-storage-blob-go/2016-05-31/azblob"
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+)
+
+const (
+	// snapshotContainerName is the container snapshots are stored in when using blob storage
+	snapshotContainerName = "frontdoor-snapshots"
+	// snapshotIDFormat is the UTC timestamp used as the ID of a snapshot, it sorts by time
+	snapshotIDFormat = "20060102T150405.000000000Z"
+)
+
+// snapshotStore saves copies of the Frontdoor configuration, taken before each update,
+// so a previous configuration can be restored
+type snapshotStore interface {
+	save(ctx context.Context, id string, data []byte) error
+	load(ctx context.Context, id string) ([]byte, error)
+	list(ctx context.Context) ([]string, error)
+	delete(ctx context.Context, id string) error
+}
+
+// newSnapshotStore returns the store for the configured snapshot location, nil if snapshots are disabled
+func newSnapshotStore(ctx context.Context, config utils.Config) (snapshotStore, error) {
+	switch config.SnapshotLocation {
+	case "":
+		return nil, nil
+	case utils.SnapshotLocationBlob:
+		return newBlobSnapshotStore(ctx, config)
+	default:
+		return &fileSnapshotStore{dir: filepath.Join(config.SnapshotLocation, config.FrontDoorName)}, nil
+	}
+}
+
+// saveSnapshot saves the Frontdoor configuration to the store, returning the ID of the snapshot
+func saveSnapshot(ctx context.Context, store snapshotStore, fd frontdoor.FrontDoor) (string, error) {
+	data, err := json.Marshal(fd)
+	if err != nil {
+		return "", err
+	}
+	id := time.Now().UTC().Format(snapshotIDFormat)
+	if err := store.save(ctx, id, data); err != nil {
+		return "", fmt.Errorf("failed to save snapshot of Frontdoor before updating it: %v", err)
+	}
+	utils.GetLogger(ctx).WithField("snapshot", id).Info("Saved snapshot of Frontdoor before update")
+	return id, nil
+}
+
+// pruneSnapshots deletes the oldest snapshots so only the number to retain are kept, all are kept if it's
+// zero. Failing to delete them doesn't fail the update, they're pruned again after the next snapshot.
+func pruneSnapshots(ctx context.Context, store snapshotStore, retain int) {
+	if retain <= 0 {
+		return
+	}
+	logger := utils.GetLogger(ctx)
+	ids, err := store.list(ctx)
+	if err != nil {
+		logger.WithError(err).Warn("Failed to list snapshots to prune")
+		return
+	}
+	for len(ids) > retain {
+		if err := store.delete(ctx, ids[0]); err != nil {
+			logger.WithError(err).WithField("snapshot", ids[0]).Warn("Failed to delete old snapshot")
+			return
+		}
+		logger.WithField("snapshot", ids[0]).Debug("Deleted old snapshot")
+		ids = ids[1:]
+	}
+}
+
+// copyFrontDoor returns a deep copy of the Frontdoor configuration
+func copyFrontDoor(fd frontdoor.FrontDoor) (frontdoor.FrontDoor, error) {
+	data, err := json.Marshal(fd)
+	if err != nil {
+		return frontdoor.FrontDoor{}, err
+	}
+	fdCopy := frontdoor.FrontDoor{}
+	err = json.Unmarshal(data, &fdCopy)
+	return fdCopy, err
+}
+
+// saveSnapshot saves the Frontdoor configuration before it's updated, if snapshots are enabled, and prunes
+// the oldest snapshots
+func (p *Synchronizer) saveSnapshot(ctx context.Context, fd frontdoor.FrontDoor) error {
+	if p.snapshots == nil {
+		return nil
+	}
+	if _, err := saveSnapshot(ctx, p.snapshots, fd); err != nil {
+		return err
+	}
+	pruneSnapshots(ctx, p.snapshots, p.snapshotRetention)
+	return nil
+}
+
+// Snapshots returns the IDs of the saved snapshots of the Frontdoor, oldest first
+func Snapshots(ctx context.Context, config utils.Config) ([]string, error) {
+	store, err := newSnapshotStore(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	if store == nil {
+		return nil, fmt.Errorf("snapshots aren't enabled, set SNAPSHOT_LOCATION")
+	}
+	return store.list(ctx)
+}
+
+// Restore replaces the configuration of the Frontdoor with a previously saved snapshot.
+// The current configuration is snapshotted first so the restore can itself be undone.
+func Restore(ctx context.Context, config utils.Config, id string) error {
+	logger := utils.GetLogger(ctx)
+
+	// Restoring replaces every cluster's rules and backends
+	if err := checkAuthoritative(config, "restoring a snapshot"); err != nil {
+		return err
+	}
+
+	store, err := newSnapshotStore(ctx, config)
+	if err != nil {
+		return err
+	}
+	if store == nil {
+		return fmt.Errorf("snapshots aren't enabled, set SNAPSHOT_LOCATION")
+	}
+
+	data, err := store.load(ctx, id)
+	if err != nil {
+		return fmt.Errorf("failed to load snapshot %s: %v", id, err)
+	}
+	snapshot := frontdoor.FrontDoor{}
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return fmt.Errorf("snapshot %s isn't a valid Frontdoor configuration: %v", id, err)
+	}
+
+	lock, err := lockFrontDoor(ctx, config)
+	if err != nil {
+		return err
+	}
+	defer lock.Unlock() //nolint: errcheck
+
+	fdClient, err := newFrontDoorsClient(ctx, config)
+	if err != nil {
+		return err
+	}
+	current, err := fdClient.Get(ctx, config.ResourceGroupName, config.FrontDoorName)
+	if err != nil {
+		return err
+	}
+	if _, err := saveSnapshot(ctx, store, current); err != nil {
+		return err
+	}
+	pruneSnapshots(ctx, store, config.SnapshotRetention)
+
+	logger.WithField("snapshot", id).Info("Restoring Frontdoor from snapshot")
+	_, err = updateFrontDoor(ctx, fdClient, config, snapshot)
+	return err
+}
+
+// fileSnapshotStore saves snapshots as files in a local directory
+type fileSnapshotStore struct {
+	dir string
+}
+
+func (s *fileSnapshotStore) save(ctx context.Context, id string, data []byte) error {
+	if err := os.MkdirAll(s.dir, 0700); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(s.dir, id+".json"), data, 0600)
+}
+
+func (s *fileSnapshotStore) load(ctx context.Context, id string) ([]byte, error) {
+	return ioutil.ReadFile(filepath.Join(s.dir, filepath.Base(id)+".json"))
+}
+
+func (s *fileSnapshotStore) delete(ctx context.Context, id string) error {
+	return os.Remove(filepath.Join(s.dir, filepath.Base(id)+".json"))
+}
+
+func (s *fileSnapshotStore) list(ctx context.Context) ([]string, error) {
+	files, err := ioutil.ReadDir(s.dir)
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	ids := []string{}
+	for _, f := range files {
+		if !f.IsDir() && strings.HasSuffix(f.Name(), ".json") {
+			ids = append(ids, strings.TrimSuffix(f.Name(), ".json"))
+		}
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// blobSnapshotStore saves snapshots as blobs in the storage account used for locking
+type blobSnapshotStore struct {
+	container azblob.ContainerURL
+	prefix    string
+}
+
+func newBlobSnapshotStore(ctx context.Context, config utils.Config) (*blobSnapshotStore, error) {
+	container, err := ensureStorageContainer(ctx, config, snapshotContainerName)
+	if err != nil {
+		return nil, err
+	}
+	return &blobSnapshotStore{container: container, prefix: config.FrontDoorName + "/"}, nil
+}
+
+// ensureStorageContainer returns the named container in the storage account used for locking, creating it if it doesn't exist
+func ensureStorageContainer(ctx context.Context, config utils.Config, name string) (azblob.ContainerURL, error) {
+	u, err := url.Parse(fmt.Sprintf("%s/%s", strings.TrimSuffix(config.StorageAccountURL, "/"), name))
+	if err != nil {
+		return azblob.ContainerURL{}, err
+	}
+	creds := azblob.NewSharedKeyCredential(storageAccountName(u), config.StorageAccountKey)
+	container := azblob.NewContainerURL(*u, azblob.NewPipeline(creds, azblob.PipelineOptions{}))
+
+	_, err = container.Create(ctx, nil, azblob.PublicAccessNone)
+	if storageErr, ok := err.(azblob.StorageError); err != nil && (!ok || storageErr.ServiceCode() != azblob.ServiceCodeContainerAlreadyExists) {
+		return azblob.ContainerURL{}, fmt.Errorf("failed to create container %s: %v", name, err)
+	}
+	return container, nil
+}
+
+func (s *blobSnapshotStore) save(ctx context.Context, id string, data []byte) error {
+	blob := s.container.NewBlockBlobURL(s.prefix + id + ".json")
+	_, err := blob.PutBlob(ctx, bytes.NewReader(data), azblob.BlobHTTPHeaders{ContentType: "application/json"}, azblob.Metadata{}, azblob.BlobAccessConditions{})
+	return err
+}
+
+func (s *blobSnapshotStore) load(ctx context.Context, id string) ([]byte, error) {
+	blob := s.container.NewBlockBlobURL(s.prefix + id + ".json")
+	resp, err := blob.GetBlob(ctx, azblob.BlobRange{}, azblob.BlobAccessConditions{}, false)
+	if err != nil {
+		return nil, err
+	}
+	body := resp.Body()
+	defer body.Close() //nolint: errcheck
+	return ioutil.ReadAll(body)
+}
+
+func (s *blobSnapshotStore) delete(ctx context.Context, id string) error {
+	blob := s.container.NewBlockBlobURL(s.prefix + id + ".json")
+	_, err := blob.Delete(ctx, azblob.DeleteSnapshotsOptionNone, azblob.BlobAccessConditions{})
+	return err
+}
+
+func (s *blobSnapshotStore) list(ctx context.Context) ([]string, error) {
+	ids := []string{}
+	for marker := (azblob.Marker{}); marker.NotDone(); {
+		resp, err := s.container.ListBlobs(ctx, marker, azblob.ListBlobsOptions{Prefix: s.prefix})
+		if err != nil {
+			return nil, err
+		}
+		for _, blob := range resp.Blobs.Blob {
+			ids = append(ids, strings.TrimSuffix(strings.TrimPrefix(blob.Name, s.prefix), ".json"))
+		}
+		marker = resp.NextMarker
+	}
+	sort.Strings(ids)
+	return ids, nil
+}
@@ -0,0 +1,111 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/preview/frontdoor/mgmt/2018-08-01-preview/frontdoor"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+func TestFileSnapshotStoreRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "snapshots")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir) //nolint: errcheck
+
+	ctx := utils.WithLogger(context.Background(), log.WithField("test", t.Name()))
+	store, err := newSnapshotStore(ctx, utils.Config{SnapshotLocation: dir, FrontDoorName: "fd1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fd := frontdoor.FrontDoor{
+		Name: to.StringPtr("fd1"),
+		Properties: &frontdoor.Properties{
+			RoutingRules: &[]frontdoor.RoutingRule{testRoutingRule("Ingress-a", "/pools/cluster1", "/a")},
+		},
+	}
+	first, err := saveSnapshot(ctx, store, fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := saveSnapshot(ctx, store, frontdoor.FrontDoor{Name: to.StringPtr("fd1")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids, err := store.list(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ids, []string{first, second}) {
+		t.Errorf("Expected snapshots %v oldest first got %v", []string{first, second}, ids)
+	}
+
+	data, err := store.load(ctx, first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	restored := frontdoor.FrontDoor{}
+	if err := json.Unmarshal(data, &restored); err != nil {
+		t.Fatal(err)
+	}
+	expected, err := copyFrontDoor(fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(restored, expected) {
+		t.Errorf("Expected snapshot to round trip the Frontdoor got %s", data)
+	}
+}
+
+func TestSnapshotsAreOnlySavedForChangesAndPruned(t *testing.T) {
+	dir, err := ioutil.TempDir("", "snapshots")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir) //nolint: errcheck
+
+	ctx := utils.WithLogger(context.Background(), log.WithField("test", t.Name()))
+	previous := testDifferentialFrontDoor()
+	desired, _ := copyFrontDoor(previous)
+	(*desired.RoutingRules)[0].PatternsToMatch = &[]string{"/a/v2/*"}
+	p := &Synchronizer{
+		clusterName:       "cluster1",
+		snapshots:         &fileSnapshotStore{dir: dir},
+		snapshotRetention: 2,
+		updateState: func(_ context.Context, fd frontdoor.FrontDoor) (frontdoor.FrontDoor, error) {
+			return fd, nil
+		},
+	}
+
+	if _, err := p.applyUpdate(ctx, previous, previous); err != nil {
+		t.Fatal(err)
+	}
+	if ids, _ := p.snapshots.list(ctx); len(ids) != 0 {
+		t.Errorf("Expected no snapshot when nothing changed, got %v", ids)
+	}
+
+	saved := []string{}
+	for i := 0; i < 3; i++ {
+		if _, err := p.applyUpdate(ctx, previous, desired); err != nil {
+			t.Fatal(err)
+		}
+		ids, err := p.snapshots.list(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		saved = append(saved, ids[len(ids)-1])
+	}
+	if ids, _ := p.snapshots.list(ctx); !reflect.DeepEqual(ids, saved[1:]) {
+		t.Errorf("Expected only the newest snapshots %v to be kept, got %v", saved[1:], ids)
+	}
+}
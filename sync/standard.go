@@ -0,0 +1,39 @@
+package sync
+
+// standardRouteProperties translates the route to the properties of a Front Door Standard/Premium route
+// sending its traffic to the origin group from the custom domains, and the endpoint's own domain if
+// linkToDefaultDomain is 'Enabled'
+func standardRouteProperties(route Route, originGroupID string, customDomains []map[string]string, linkToDefaultDomain string) map[string]interface{} {
+	enabledState := "Enabled"
+	if !route.Enabled {
+		enabledState = "Disabled"
+	}
+	properties := map[string]interface{}{
+		"originGroup":         map[string]string{"id": originGroupID},
+		"customDomains":       customDomains,
+		"supportedProtocols":  route.Protocols,
+		"patternsToMatch":     route.Paths,
+		"forwardingProtocol":  "MatchRequest",
+		"linkToDefaultDomain": linkToDefaultDomain,
+		"httpsRedirect":       "Disabled",
+		"enabledState":        enabledState,
+	}
+	if cache := route.Cache; cache != nil {
+		queryStringCaching := "UseQueryString"
+		if cache.IgnoreQueryString {
+			queryStringCaching = "IgnoreQueryString"
+		}
+		compression := map[string]interface{}{"isCompressionEnabled": false}
+		if cache.DynamicCompression {
+			compression = map[string]interface{}{
+				"isCompressionEnabled":   true,
+				"contentTypesToCompress": compressedContentTypes,
+			}
+		}
+		properties["cacheConfiguration"] = map[string]interface{}{
+			"queryStringCachingBehavior": queryStringCaching,
+			"compressionSettings":        compression,
+		}
+	}
+	return properties
+}
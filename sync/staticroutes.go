@@ -0,0 +1,81 @@
+package sync
+
+import (
+	"context"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/preview/frontdoor/mgmt/2018-08-01-preview/frontdoor"
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+)
+
+// staticRoutePrefix starts the name of the routing rules created for the static routes in the config
+const staticRoutePrefix = "Static-"
+
+// staticRouteName returns the name of the cluster's routing rule for the static route, the cluster is
+// part of the name so clusters sharing a Frontdoor only manage their own
+func staticRouteName(clusterName, route string) string {
+	return staticRoutePrefix + clusterName + "-" + route
+}
+
+// applyStaticRoutes adds or updates a routing rule for each static route, from the cluster's frontend
+// to the backend pool it names, and removes the cluster's static rules which are no longer configured,
+// unless another cluster is authoritative. A route whose backend pool doesn't exist is logged and any
+// rule it already has is left alone.
+func (p *Synchronizer) applyStaticRoutes(ctx context.Context, fd frontdoor.FrontDoor, rules []frontdoor.RoutingRule) []frontdoor.RoutingRule {
+	logger := utils.GetLogger(ctx)
+	prefix := staticRouteName(p.clusterName, "")
+
+	desired := map[string]*frontdoor.RoutingRule{}
+	for _, static := range p.staticRoutes {
+		name := staticRouteName(p.clusterName, static.Name)
+		routeLogger := logger.WithField("ruleName", name).WithField("backendPool", static.BackendPool)
+		if err := utils.ValidateFrontDoorChildName(name); err != nil {
+			routeLogger.WithError(err).Warn("Static route's routing rule name isn't valid in Frontdoor, not updating it")
+			desired[name] = nil
+			continue
+		}
+		pool := findBackendPool(fd, static.BackendPool)
+		if pool == nil || pool.ID == nil {
+			routeLogger.WithField(utils.EventField, "StaticRoutePoolNotFound").Warn("Backend pool of static route doesn't exist, not updating it")
+			desired[name] = nil
+			continue
+		}
+		rule := classicRoutingRule(Route{
+			Name:      name,
+			Paths:     static.Paths,
+			Protocols: p.acceptedProtocols(),
+			Enabled:   true,
+		}, pool.ID, p.endPoint.ID)
+		desired[name] = &rule
+	}
+
+	applied := make([]frontdoor.RoutingRule, 0, len(rules)+len(desired))
+	for _, rule := range rules {
+		if rule.Name == nil || !strings.HasPrefix(*rule.Name, prefix) {
+			applied = append(applied, rule)
+			continue
+		}
+		want, configured := desired[*rule.Name]
+		switch {
+		case !configured && p.keepsRoutingRules():
+			logger.WithField("ruleName", *rule.Name).Warn(p.keptRuleMessage())
+			applied = append(applied, rule)
+		case !configured:
+			logger.WithField("ruleName", *rule.Name).Info("Removing routing rule of static route which is no longer configured")
+		case want == nil:
+			applied = append(applied, rule)
+		default:
+			applied = append(applied, *want)
+		}
+		delete(desired, *rule.Name)
+	}
+	// Added in the order they're configured
+	for _, static := range p.staticRoutes {
+		name := staticRouteName(p.clusterName, static.Name)
+		if want := desired[name]; want != nil {
+			logger.WithField("ruleName", name).Info("Adding routing rule for static route")
+			applied = append(applied, *want)
+		}
+	}
+	return applied
+}
@@ -0,0 +1,51 @@
+package sync
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/preview/frontdoor/mgmt/2018-08-01-preview/frontdoor"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+func TestApplyStaticRoutes(t *testing.T) {
+	ctx := utils.WithLogger(context.Background(), log.WithField("test", t.Name()))
+	maintenance := testBackendPool("maintenance", "10.1.0.1")
+	maintenance.ID = to.StringPtr("/frontdoors/fd/backendPools/maintenance")
+	fd := frontdoor.FrontDoor{Properties: &frontdoor.Properties{BackendPools: &[]frontdoor.BackendPool{maintenance}}}
+	p := &Synchronizer{
+		clusterName: "cluster1",
+		endPoint:    frontdoor.FrontendEndpoint{ID: to.StringPtr("/frontdoors/fd/frontendEndpoints/fd")},
+		staticRoutes: []utils.StaticRoute{
+			{Name: "maintenance", BackendPool: "maintenance", Paths: []string{"/maintenance/*"}},
+			{Name: "missing", BackendPool: "missing", Paths: []string{"/missing"}},
+		},
+	}
+	ingressRule := frontdoor.RoutingRule{Name: to.StringPtr("Ingress-default-app-1a2b3c4d")}
+	otherCluster := frontdoor.RoutingRule{Name: to.StringPtr("Static-cluster2-maintenance")}
+	removed := frontdoor.RoutingRule{Name: to.StringPtr("Static-cluster1-old")}
+	missing := frontdoor.RoutingRule{Name: to.StringPtr("Static-cluster1-missing")}
+
+	rules := p.applyStaticRoutes(ctx, fd, []frontdoor.RoutingRule{ingressRule, otherCluster, removed, missing})
+	names := []string{}
+	for _, rule := range rules {
+		names = append(names, *rule.Name)
+	}
+	expected := "Ingress-default-app-1a2b3c4d,Static-cluster2-maintenance,Static-cluster1-missing,Static-cluster1-maintenance"
+	if got := strings.Join(names, ","); got != expected {
+		t.Fatalf("Expected rules %s got %s", expected, got)
+	}
+	added := rules[3]
+	if *added.BackendPool.ID != *maintenance.ID || *(*added.FrontendEndpoints)[0].ID != *p.endPoint.ID ||
+		(*added.PatternsToMatch)[0] != "/maintenance/*" || added.EnabledState != frontdoor.EnabledStateEnumEnabled {
+		t.Errorf("Expected a rule from the cluster's frontend to the maintenance pool got %+v", added.RoutingRuleProperties)
+	}
+
+	p.follower = true
+	if rules := p.applyStaticRoutes(ctx, fd, []frontdoor.RoutingRule{removed}); len(rules) != 2 {
+		t.Errorf("Expected a follower to leave static rules no longer configured got %+v", rules)
+	}
+}
@@ -0,0 +1,98 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/azure"
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+)
+
+// storageAPIVersion is the Microsoft.Storage API version used to list the storage account's keys
+const storageAPIVersion = "2019-04-01"
+
+// storageAccountKeys is the response from listing a storage account's keys
+type storageAccountKeys struct {
+	Keys []struct {
+		KeyName     string `json:"keyName"`
+		Value       string `json:"value"`
+		Permissions string `json:"permissions"`
+	} `json:"keys"`
+}
+
+// storageAccountName returns the name of the storage account from its URL,
+// for example 'https://mystorageaccount.blob.core.windows.net' -> 'mystorageaccount'
+func storageAccountName(storageAccountURL *url.URL) string {
+	return strings.Split(storageAccountURL.Hostname(), ".")[0]
+}
+
+// ResolveStorageAccountKey sets STORAGE_ACCOUNT_KEY, when it isn't configured, by listing the keys of the storage
+// account in STORAGE_AZURE_RESOURCE_GROUP_NAME. The subscription and credentials used can differ from the
+// Frontdoor's so lock storage can be shared by Frontdoors in several subscriptions.
+func ResolveStorageAccountKey(ctx context.Context, config *utils.Config) error {
+	if config.StorageAccountKey != "" || config.StorageResourceGroupName == "" {
+		return nil
+	}
+	u, err := url.Parse(config.StorageAccountURL)
+	if err != nil {
+		return err
+	}
+
+	client := autorest.NewClientWithUserAgent(utils.UserAgent())
+	client.Authorizer, err = newServicePrincipalAuthorizer(ctx, *config, "storage account", config.StorageClientID, config.StorageClientSecret, config.StorageTenantID)
+	if err != nil {
+		return authError{fmt.Errorf("failed to create Azure authorizer for the storage account: %v", err)}
+	}
+	key, err := listStorageAccountKey(ctx, client, azure.PublicCloud.ResourceManagerEndpoint, config.StorageSubscription(), config.StorageResourceGroupName, storageAccountName(u))
+	if err != nil {
+		return err
+	}
+	config.StorageAccountKey = key
+	return nil
+}
+
+// listStorageAccountKey returns a key with full permissions for the storage account from Azure Resource Manager
+func listStorageAccountKey(ctx context.Context, client autorest.Client, baseURI, subscriptionID, resourceGroupName, accountName string) (string, error) {
+	req, err := autorest.Prepare((&http.Request{}).WithContext(ctx),
+		autorest.AsPost(),
+		autorest.WithBaseURL(baseURI),
+		autorest.WithPathParameters("/subscriptions/{subscriptionId}/resourceGroups/{resourceGroupName}/providers/Microsoft.Storage/storageAccounts/{accountName}/listKeys",
+			map[string]interface{}{
+				"subscriptionId":    autorest.Encode("path", subscriptionID),
+				"resourceGroupName": autorest.Encode("path", resourceGroupName),
+				"accountName":       autorest.Encode("path", accountName),
+			}),
+		autorest.WithQueryParameters(map[string]interface{}{"api-version": storageAPIVersion}),
+		client.WithAuthorization())
+	if err != nil {
+		return "", err
+	}
+	resp, err := autorest.SendWithSender(client, req, autorest.DoRetryForStatusCodes(client.RetryAttempts, client.RetryDuration, autorest.StatusCodesForRetry...))
+	if err != nil {
+		return "", fmt.Errorf("failed to list keys of storage account %s: %v", accountName, err)
+	}
+
+	keys := storageAccountKeys{}
+	err = autorest.Respond(resp,
+		azure.WithErrorUnlessStatusCode(http.StatusOK),
+		autorest.ByUnmarshallingJSON(&keys),
+		autorest.ByClosing())
+	if err != nil {
+		wrapped := fmt.Errorf("failed to list keys of storage account %s in resource group %s: %v", accountName, resourceGroupName, err)
+		if IsAuthError(err) {
+			// Kept recognisable so the commands can exit with the auth error code
+			return "", authError{wrapped}
+		}
+		return "", wrapped
+	}
+	for _, key := range keys.Keys {
+		if strings.EqualFold(key.Permissions, "full") && key.Value != "" {
+			return key.Value, nil
+		}
+	}
+	return "", fmt.Errorf("storage account %s has no key with full permissions", accountName)
+}
@@ -0,0 +1,41 @@
+package sync
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest"
+)
+
+func TestListStorageAccountKey(t *testing.T) {
+	var requested string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = r.Method + " " + r.URL.Path + "?" + r.URL.RawQuery
+		if r.URL.Path == "/subscriptions/locks-sub/resourceGroups/missing-rg/providers/Microsoft.Storage/storageAccounts/locks/listKeys" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"keys":[{"keyName":"key1","value":"cmVhZG9ubHk=","permissions":"READ"},{"keyName":"key2","value":"ZnVsbA==","permissions":"FULL"}]}`)) //nolint: errcheck
+	}))
+	defer server.Close()
+	client := autorest.NewClientWithUserAgent("test")
+	client.Authorizer = autorest.NullAuthorizer{}
+	client.RetryDuration = time.Millisecond
+
+	key, err := listStorageAccountKey(context.Background(), client, server.URL, "locks-sub", "locks-rg", "locks")
+	if err != nil || key != "ZnVsbA==" {
+		t.Errorf("Expected the key with full permissions, got %q error %v", key, err)
+	}
+	expected := "POST /subscriptions/locks-sub/resourceGroups/locks-rg/providers/Microsoft.Storage/storageAccounts/locks/listKeys?api-version=" + storageAPIVersion
+	if requested != expected {
+		t.Errorf("Expected request %s, got %s", expected, requested)
+	}
+
+	if _, err := listStorageAccountKey(context.Background(), client, server.URL, "locks-sub", "missing-rg", "locks"); err == nil {
+		t.Error("Expected an error when the storage account isn't found")
+	}
+}
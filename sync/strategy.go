@@ -0,0 +1,101 @@
+package sync
+
+import (
+	"context"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/services/preview/frontdoor/mgmt/2018-08-01-preview/frontdoor"
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// keepsRoutingRules returns true if syncs never delete routing rules, as another cluster is authoritative
+// or the merge sync strategy is used
+func (p *Synchronizer) keepsRoutingRules() bool {
+	return p.follower || p.syncStrategy == utils.SyncStrategyMerge
+}
+
+// keptRuleMessage is logged for a routing rule a sync would have deleted but keeps
+func (p *Synchronizer) keptRuleMessage() string {
+	if p.syncStrategy == utils.SyncStrategyMerge {
+		return "Leaving routing rule as the merge sync strategy never removes rules"
+	}
+	return "Leaving routing rule for the authoritative cluster to remove"
+}
+
+// pruneRoutingRules removes, with the replace sync strategy, each rule named with the controller's prefix
+// which routes to the cluster's pools and which no ingress that exists generates, including ingresses
+// which weren't synced, such as those waiting to retry, whose rules for any host are kept. An ingress
+// which was synced only keeps the rules it generated, so the rule for a host it no longer has is pruned.
+// Nothing is pruned when the sync isn't told which ingresses exist, as the rules of ingresses which
+// weren't synced couldn't be told apart. Protected rules are never pruned.
+func (p *Synchronizer) pruneRoutingRules(ctx context.Context, fd frontdoor.FrontDoor, rules []frontdoor.RoutingRule, ruleOwners map[string]string) []frontdoor.RoutingRule {
+	if p.syncStrategy != utils.SyncStrategyReplace {
+		return rules
+	}
+	logger := utils.GetLogger(ctx)
+	live, known := ctx.Value(liveIngressesKey{}).(map[types.UID]string)
+	if !known {
+		logger.Debug("Not pruning routing rules as the ingresses which exist aren't known")
+		return rules
+	}
+
+	synced := map[string]bool{}
+	for _, owner := range ruleOwners {
+		synced[owner] = true
+	}
+	// liveNames holds the names of the rules of every ingress which exists, including legacy names
+	// which are renamed by the sync, and liveHostRules the start of the names of the rules for a host
+	// of those which weren't synced
+	liveNames := map[string]bool{}
+	liveHostRules := map[string]bool{}
+	for _, key := range live {
+		parts := strings.SplitN(key, "/", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		ingress := &v1beta1.Ingress{}
+		ingress.Namespace, ingress.Name = parts[0], parts[1]
+		liveNames[legacyRoutingRuleName(ingress)] = true
+		if !synced[key] {
+			liveNames[routingRuleName(ingress)] = true
+			liveHostRules[hostRoutingRulePrefix(ingress)] = true
+		}
+	}
+
+	kept := make([]frontdoor.RoutingRule, 0, len(rules))
+	for _, rule := range rules {
+		if rule.Name == nil || !strings.HasPrefix(*rule.Name, routingRulePrefix) || ruleOwners[*rule.Name] != "" ||
+			liveNames[*rule.Name] || liveHostRules[hostRoutingRuleKey(*rule.Name)] || !p.routesToClusterPool(fd, rule) {
+			kept = append(kept, rule)
+			continue
+		}
+		if p.isProtectedRule(*rule.Name) {
+			logger.WithField("ruleName", *rule.Name).Debug("Not pruning routing rule no ingress generates as it's protected by " + pruneAnnotation)
+			kept = append(kept, rule)
+			continue
+		}
+		logger.WithField("ruleName", *rule.Name).Info("Pruning routing rule no ingress generates")
+	}
+	return kept
+}
+
+// routesToClusterPool returns true if the rule routes to the cluster's backend pool, or to the cluster's
+// pool for the namespace in the rule's name
+func (p *Synchronizer) routesToClusterPool(fd frontdoor.FrontDoor, rule frontdoor.RoutingRule) bool {
+	if rule.RoutingRuleProperties == nil {
+		return false
+	}
+	pool := findBackendPoolByID(fd.BackendPools, subResourceID(rule.BackendPool))
+	if pool == nil || pool.Name == nil {
+		return false
+	}
+	if *pool.Name == p.clusterName {
+		return true
+	}
+	// Another cluster's name may start with this cluster's, so the namespace must match the rule's too
+	namespace := strings.TrimPrefix(*pool.Name, p.clusterName+"-")
+	return namespace != *pool.Name && *pool.Name == namespaceBackendPoolName(p.clusterName, namespace) &&
+		strings.HasPrefix(*rule.Name, routingRulePrefix+invalidRuleNameChars.ReplaceAllString(namespace, "-")+"-")
+}
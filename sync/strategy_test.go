@@ -0,0 +1,86 @@
+package sync
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/preview/frontdoor/mgmt/2018-08-01-preview/frontdoor"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+	log "github.com/sirupsen/logrus"
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestPruneRoutingRules(t *testing.T) {
+	ctx := utils.WithLogger(context.Background(), log.WithField("test", t.Name()))
+	pools := []frontdoor.BackendPool{}
+	for _, name := range []string{"cluster1", "cluster1-web", "cluster1-b", "cluster1-b-web"} {
+		pool := testBackendPool(name, "10.0.0.1")
+		pool.ID = to.StringPtr("/frontDoors/fd1/backendPools/" + name)
+		pools = append(pools, pool)
+	}
+	fd := frontdoor.FrontDoor{Properties: &frontdoor.Properties{BackendPools: &pools}}
+
+	app := testIngress("app", "/app")
+	waiting := testIngress("waiting", "/waiting")
+	waiting.Namespace = "web"
+	existing := []frontdoor.RoutingRule{
+		testRoutingRule(routingRuleName(app), *pools[0].ID, "/app"),
+		testRoutingRule(routingRuleName(waiting), *pools[1].ID, "/waiting"),
+		// The rule for a host the synced ingress no longer has, and one for a host of the ingress waiting to retry
+		testRoutingRule(hostRoutingRuleName(app, "old.example.com"), *pools[0].ID, "/app"),
+		testRoutingRule(hostRoutingRuleName(waiting, "waiting.example.com"), *pools[1].ID, "/waiting"),
+		testRoutingRule("Ingress-default-deleted-1a2b3c4d", *pools[0].ID, "/deleted"),
+		testRoutingRule("Ingress-web-deleted-1a2b3c4d", *pools[1].ID, "/deleted"),
+		testRoutingRule("Ingress-web-other-1a2b3c4d", *pools[3].ID, "/other"),
+		testRoutingRule("Manual", *pools[0].ID, "/manual"),
+	}
+	ruleOwners := map[string]string{routingRuleName(app): "default/app"}
+	live := WithLiveIngresses(ctx, map[types.UID]string{"uid-app": "default/app", "uid-waiting": "web/waiting"})
+
+	names := func(rules []frontdoor.RoutingRule) string {
+		names := []string{}
+		for _, rule := range rules {
+			names = append(names, *rule.Name)
+		}
+		return strings.Join(names, ",")
+	}
+
+	p := &Synchronizer{clusterName: "cluster1", syncStrategy: utils.SyncStrategyReplace}
+	kept := p.pruneRoutingRules(live, fd, existing, ruleOwners)
+	expected := strings.Join([]string{routingRuleName(app), routingRuleName(waiting), hostRoutingRuleName(waiting, "waiting.example.com"),
+		"Ingress-web-other-1a2b3c4d", "Manual"}, ",")
+	if names(kept) != expected {
+		t.Errorf("Expected the rules of deleted ingresses routing to the cluster's pools to be pruned, got %s", names(kept))
+	}
+
+	if kept := p.pruneRoutingRules(ctx, fd, existing, ruleOwners); len(kept) != len(existing) {
+		t.Errorf("Expected nothing to be pruned without the live ingresses, got %s", names(kept))
+	}
+	p.syncStrategy = ""
+	if kept := p.pruneRoutingRules(live, fd, existing, ruleOwners); len(kept) != len(existing) {
+		t.Errorf("Expected nothing to be pruned without the replace strategy, got %s", names(kept))
+	}
+}
+
+func TestMergeStrategyKeepsRoutingRules(t *testing.T) {
+	ctx := utils.WithLogger(context.Background(), log.WithField("test", t.Name()))
+	pool := testBackendPool("cluster1", "10.0.0.1")
+	pool.ID = to.StringPtr("/frontDoors/fd1/backendPools/cluster1")
+	fd := frontdoor.FrontDoor{Properties: &frontdoor.Properties{BackendPools: &[]frontdoor.BackendPool{pool}}}
+	app := testIngress("app", "/app")
+	existing := []frontdoor.RoutingRule{
+		testRoutingRule("Ingress-default-deleted-1a2b3c4d", *pool.ID, "/deleted"),
+		testRoutingRule(staticRouteName("cluster1", "maintenance"), *pool.ID, "/maintenance"),
+	}
+	merged := []frontdoor.RoutingRule{testRoutingRule(routingRuleName(app), *pool.ID, "/app")}
+
+	p := &Synchronizer{clusterName: "cluster1", syncStrategy: utils.SyncStrategyMerge}
+	kept := p.keepSharedRoutingRules(ctx, fd, existing, merged, []*v1beta1.Ingress{app}, &SyncResult{})
+	kept = p.applyStaticRoutes(ctx, fd, kept)
+	if len(kept) != 3 {
+		t.Errorf("Expected the merge strategy to keep every rule, got %d rules", len(kept))
+	}
+}
@@ -0,0 +1,31 @@
+package sync
+
+import (
+	"github.com/Azure/azure-sdk-for-go/services/preview/frontdoor/mgmt/2018-08-01-preview/frontdoor"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+)
+
+// Tags set on the Frontdoor so governance tooling can identify it's managed by the controller
+const (
+	managedByTag         = "managed-by"
+	managedByValue       = "azurefrontdooringress"
+	controllerVersionTag = "azurefrontdooringress-version"
+	// clusterTag is the cluster whose controller last updated the Frontdoor
+	clusterTag = "azurefrontdooringress-cluster"
+	// instanceTag is the identity of the controller instance which last updated the Frontdoor
+	instanceTag = "azurefrontdooringress-instance"
+)
+
+// setManagedTags adds, or updates, the controller's tags on the Frontdoor leaving any other tags unchanged
+func setManagedTags(fd *frontdoor.FrontDoor, clusterName, identity string) {
+	tags := map[string]*string{}
+	for name, value := range fd.Tags {
+		tags[name] = value
+	}
+	tags[managedByTag] = to.StringPtr(managedByValue)
+	tags[controllerVersionTag] = to.StringPtr(utils.Version)
+	tags[clusterTag] = to.StringPtr(clusterName)
+	tags[instanceTag] = to.StringPtr(identity)
+	fd.Tags = tags
+}
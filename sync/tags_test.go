@@ -0,0 +1,61 @@
+package sync
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/preview/frontdoor/mgmt/2018-08-01-preview/frontdoor"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+)
+
+func TestSetManagedTagsKeepsOtherTags(t *testing.T) {
+	fd := frontdoor.FrontDoor{Tags: map[string]*string{
+		"cost-centre": to.StringPtr("1234"),
+		clusterTag:    to.StringPtr("cluster2"),
+	}}
+
+	setManagedTags(&fd, "cluster1", "cluster1/pod1@dev")
+
+	expected := map[string]string{
+		"cost-centre":        "1234",
+		managedByTag:         "azurefrontdooringress",
+		controllerVersionTag: utils.Version,
+		clusterTag:           "cluster1",
+		instanceTag:          "cluster1/pod1@dev",
+	}
+	if len(fd.Tags) != len(expected) {
+		t.Errorf("Expected tags %v, got %d tags", expected, len(fd.Tags))
+	}
+	for name, value := range expected {
+		if to.String(fd.Tags[name]) != value {
+			t.Errorf("Expected tag %s to be %q, got %q", name, value, to.String(fd.Tags[name]))
+		}
+	}
+}
+
+func TestIntegrationUpdateTagsFrontDoor(t *testing.T) {
+	ctx := integrationContext(t)
+	server := newFakeFrontDoorServer(t, testIntegrationFrontDoor("cluster1"))
+	defer server.Close()
+	p := newIntegrationSynchronizer(ctx, t, server, &fakeLockService{}, "cluster1")
+
+	if _, err := p.Sync(ctx, []*v1beta1.Ingress{testIngress("app", "/app")}, nil); err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	fd := frontdoor.FrontDoor{}
+	server.mu.Lock()
+	err := json.Unmarshal(server.state, &fd)
+	server.mu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if to.String(fd.Tags[managedByTag]) != managedByValue || to.String(fd.Tags[clusterTag]) != "cluster1" {
+		t.Errorf("Expected the Frontdoor to be tagged as managed by the controller, got %v", fd.Tags)
+	}
+	if to.String(fd.Tags[instanceTag]) != "cluster1/unknown@"+utils.Version {
+		t.Errorf("Expected the Frontdoor to be tagged with the instance which updated it, got %v", fd.Tags)
+	}
+}
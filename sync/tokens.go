@@ -0,0 +1,130 @@
+package sync
+
+import (
+	"context"
+	"net/http"
+	gosync "sync"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest"
+	"github.com/Azure/go-autorest/autorest/adal"
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+)
+
+const (
+	// tokenRefreshBefore is how long before a token expires it's refreshed, leaving time to retry
+	// over several syncs if Azure AD or the instance metadata service is briefly unavailable
+	tokenRefreshBefore = 10 * time.Minute
+	// tokenRefreshAttempts is how many times a token refresh is tried before it's given up on
+	tokenRefreshAttempts = 3
+)
+
+// tokenRetryDelay is multiplied by the attempt to give the wait before retrying a token refresh
+var tokenRetryDelay = 2 * time.Second
+
+// azureToken is the part of adal.ServicePrincipalToken used by refreshingToken
+type azureToken interface {
+	adal.OAuthTokenProvider
+	RefreshWithContext(ctx context.Context) error
+	RefreshExchangeWithContext(ctx context.Context, resource string) error
+	Token() adal.Token
+}
+
+// refreshingToken caches an Azure AD token for the lifetime of the process, refreshing it ahead of
+// expiry with retries. A refresh which fails while the cached token is still valid is logged and the
+// cached token used, so a brief outage doesn't fail the sync.
+type refreshingToken struct {
+	mutex gosync.Mutex
+	token azureToken
+	// resource names what the token is used for in logs and metrics
+	resource string
+	now      func() time.Time
+}
+
+// newRefreshingAuthorizer authorizes requests with the token, which is refreshed by refreshingToken
+// rather than by adal
+func newRefreshingAuthorizer(resource string, token *adal.ServicePrincipalToken) autorest.Authorizer {
+	token.SetAutoRefresh(false)
+	return autorest.NewBearerAuthorizer(&refreshingToken{token: token, resource: resource, now: time.Now})
+}
+
+// OAuthToken returns the cached token
+func (t *refreshingToken) OAuthToken() string {
+	return t.token.OAuthToken()
+}
+
+// EnsureFresh refreshes the token if it expires within tokenRefreshBefore
+func (t *refreshingToken) EnsureFresh() error {
+	return t.EnsureFreshWithContext(context.Background())
+}
+
+// EnsureFreshWithContext refreshes the token if it expires within tokenRefreshBefore, only returning
+// an error if it couldn't be refreshed and has expired
+func (t *refreshingToken) EnsureFreshWithContext(ctx context.Context) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	expires := t.token.Token().Expires()
+	if t.now().Add(tokenRefreshBefore).Before(expires) {
+		return nil
+	}
+	err := t.refreshWithRetries(ctx)
+	if err == nil {
+		return nil
+	}
+	azureAuthFailures.Inc(t.resource)
+	if t.now().Before(expires) {
+		utils.GetLogger(ctx).
+			WithError(err).
+			WithField("resource", t.resource).
+			WithField("expires", expires).
+			Warn("Failed to refresh Azure token, using the cached token until it expires")
+		return nil
+	}
+	return err
+}
+
+// refreshWithRetries refreshes the token, retrying failures which may be temporary, the mutex must be held
+func (t *refreshingToken) refreshWithRetries(ctx context.Context) error {
+	for attempt := 1; ; attempt++ {
+		err := t.token.RefreshWithContext(ctx)
+		if err == nil || attempt == tokenRefreshAttempts || !isTemporaryTokenError(err) {
+			return err
+		}
+		utils.GetLogger(ctx).
+			WithError(err).
+			WithField("resource", t.resource).
+			WithField("attempt", attempt).
+			Debug("Failed to refresh Azure token, retrying")
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(tokenRetryDelay * time.Duration(attempt)):
+		}
+	}
+}
+
+// isTemporaryTokenError returns false if Azure AD rejected the request for a token, such as for an
+// invalid secret, as retrying won't help
+func isTemporaryTokenError(err error) bool {
+	refreshErr, ok := err.(adal.TokenRefreshError)
+	if !ok || refreshErr.Response() == nil {
+		return true
+	}
+	code := refreshErr.Response().StatusCode
+	return code >= http.StatusInternalServerError || code == http.StatusTooManyRequests
+}
+
+// RefreshWithContext refreshes the token
+func (t *refreshingToken) RefreshWithContext(ctx context.Context) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.token.RefreshWithContext(ctx)
+}
+
+// RefreshExchangeWithContext refreshes the token for another resource
+func (t *refreshingToken) RefreshExchangeWithContext(ctx context.Context, resource string) error {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.token.RefreshExchangeWithContext(ctx, resource)
+}
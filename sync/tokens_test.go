@@ -0,0 +1,114 @@
+package sync
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/Azure/go-autorest/autorest/adal"
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+	log "github.com/sirupsen/logrus"
+)
+
+// fakeToken is refreshed to expire an hour after now, failing with the errors first
+type fakeToken struct {
+	token     adal.Token
+	now       time.Time
+	errs      []error
+	refreshes int
+}
+
+func (f *fakeToken) OAuthToken() string { return f.token.AccessToken }
+func (f *fakeToken) Token() adal.Token  { return f.token }
+
+func (f *fakeToken) RefreshWithContext(ctx context.Context) error {
+	f.refreshes++
+	if len(f.errs) > 0 {
+		err := f.errs[0]
+		f.errs = f.errs[1:]
+		return err
+	}
+	f.token = adal.Token{AccessToken: strconv.Itoa(f.refreshes), ExpiresOn: strconv.FormatInt(f.now.Add(time.Hour).Unix(), 10)}
+	return nil
+}
+
+func (f *fakeToken) RefreshExchangeWithContext(ctx context.Context, resource string) error {
+	return f.RefreshWithContext(ctx)
+}
+
+// rejectedRefresh is a refresh Azure AD responded to with the status code
+type rejectedRefresh int
+
+func (r rejectedRefresh) Error() string { return "refresh rejected" }
+func (r rejectedRefresh) Response() *http.Response {
+	return &http.Response{StatusCode: int(r)}
+}
+
+func TestRefreshingTokenRefreshesBeforeExpiry(t *testing.T) {
+	ctx := utils.WithLogger(context.Background(), log.WithField("test", t.Name()))
+	defer func(delay time.Duration) { tokenRetryDelay = delay }(tokenRetryDelay)
+	tokenRetryDelay = 0
+	now := time.Now()
+	fake := &fakeToken{now: now}
+	token := &refreshingToken{token: fake, resource: "Frontdoor", now: func() time.Time { return now }}
+
+	if err := token.EnsureFreshWithContext(ctx); err != nil || fake.refreshes != 1 {
+		t.Fatalf("Expected the token to be fetched got %v after %d refreshes", err, fake.refreshes)
+	}
+	if err := token.EnsureFreshWithContext(ctx); err != nil || fake.refreshes != 1 {
+		t.Errorf("Expected the cached token to be used got %v after %d refreshes", err, fake.refreshes)
+	}
+
+	now = now.Add(55 * time.Minute)
+	fake.errs = []error{errors.New("IMDS unavailable"), errors.New("IMDS unavailable")}
+	if err := token.EnsureFreshWithContext(ctx); err != nil || fake.refreshes != 4 || token.OAuthToken() != "4" {
+		t.Errorf("Expected the token to be refreshed after retrying got %v after %d refreshes", err, fake.refreshes)
+	}
+}
+
+func TestRefreshingTokenUsesCachedTokenUntilExpiry(t *testing.T) {
+	ctx := utils.WithLogger(context.Background(), log.WithField("test", t.Name()))
+	defer func(delay time.Duration) { tokenRetryDelay = delay }(tokenRetryDelay)
+	tokenRetryDelay = 0
+	now := time.Now()
+	fake := &fakeToken{now: now}
+	token := &refreshingToken{token: fake, resource: "Frontdoor", now: func() time.Time { return now }}
+	if err := token.EnsureFreshWithContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	now = now.Add(55 * time.Minute)
+	fake.errs = []error{errors.New("AAD unavailable"), errors.New("AAD unavailable"), errors.New("AAD unavailable")}
+	if err := token.EnsureFreshWithContext(ctx); err != nil || token.OAuthToken() != "1" {
+		t.Errorf("Expected the cached token to be used while valid got %v", err)
+	}
+
+	now = now.Add(10 * time.Minute)
+	fake.errs = []error{rejectedRefresh(http.StatusUnauthorized)}
+	refreshes := fake.refreshes
+	if err := token.EnsureFreshWithContext(ctx); err == nil {
+		t.Error("Expected an error once the cached token has expired")
+	}
+	if fake.refreshes != refreshes+1 {
+		t.Errorf("Expected a rejected refresh not to be retried got %d attempts", fake.refreshes-refreshes)
+	}
+}
+
+func TestServicePrincipalAuthorizerIsCached(t *testing.T) {
+	ctx := utils.WithLogger(context.Background(), log.WithField("test", t.Name()))
+	first, err := newServicePrincipalAuthorizer(ctx, utils.Config{}, "storage account", "client", "secret", "tenant")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _ := newServicePrincipalAuthorizer(ctx, utils.Config{}, "storage account", "client", "secret", "tenant")
+	other, _ := newServicePrincipalAuthorizer(ctx, utils.Config{}, "storage account", "other", "secret", "tenant")
+	if first != second {
+		t.Error("Expected the authorizer to be reused for the same identity")
+	}
+	if first == other {
+		t.Error("Expected a different authorizer for another identity")
+	}
+}
@@ -0,0 +1,45 @@
+package sync
+
+import (
+	"sort"
+	"strings"
+
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+)
+
+// UnreadyServicesAnnotation is set by the controller, on its copy of an ingress, to the comma separated
+// services which have had no ready endpoints for too long. The paths routed to them are left out of
+// the ingress's routes, and a route left without paths is disabled, until they recover.
+const UnreadyServicesAnnotation = "azure/frontdoor-unready-services"
+
+// WithUnreadyServices returns a copy of the ingress whose routes leave out the paths to the services,
+// replacing any value the ingress set itself. The ingress is returned unchanged if there are none.
+func WithUnreadyServices(ingress *v1beta1.Ingress, services []string) *v1beta1.Ingress {
+	_, set := ingress.Annotations[UnreadyServicesAnnotation]
+	if len(services) == 0 && !set {
+		return ingress
+	}
+	updated := ingress.DeepCopy()
+	if updated.Annotations == nil {
+		updated.Annotations = map[string]string{}
+	}
+	if len(services) == 0 {
+		delete(updated.Annotations, UnreadyServicesAnnotation)
+		return updated
+	}
+	sorted := append([]string{}, services...)
+	sort.Strings(sorted)
+	updated.Annotations[UnreadyServicesAnnotation] = strings.Join(sorted, ",")
+	return updated
+}
+
+// unreadyServices returns the services the controller found without ready endpoints
+func unreadyServices(ingress *v1beta1.Ingress) map[string]bool {
+	services := map[string]bool{}
+	for _, service := range strings.Split(ingress.Annotations[UnreadyServicesAnnotation], ",") {
+		if service = strings.TrimSpace(service); service != "" {
+			services[service] = true
+		}
+	}
+	return services
+}
@@ -0,0 +1,52 @@
+package sync
+
+import (
+	"testing"
+	"time"
+
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+)
+
+func TestRoutesForIngressWithUnreadyServices(t *testing.T) {
+	ingress := testIngress("app", "/api", "/web")
+	ingress.Spec.Rules[0].HTTP.Paths[0].Backend.ServiceName = "api"
+	ingress.Spec.Rules[0].HTTP.Paths[1].Backend.ServiceName = "web"
+	ingress.Spec.Rules = append(ingress.Spec.Rules, v1beta1.IngressRule{
+		Host: "api.contoso.com",
+		IngressRuleValue: v1beta1.IngressRuleValue{HTTP: &v1beta1.HTTPIngressRuleValue{
+			Paths: []v1beta1.HTTPIngressPath{{Path: "/", Backend: v1beta1.IngressBackend{ServiceName: "api"}}},
+		}},
+	})
+
+	routes, err := routesForIngress(WithUnreadyServices(ingress, []string{"api"}), time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(routes) != 2 {
+		t.Fatalf("Expected both routes to be kept got %+v", routes)
+	}
+	if !routes[0].Enabled || len(routes[0].Paths) != 1 || routes[0].Paths[0] != "/web" {
+		t.Errorf("Expected only the path to the ready service to be routed got %+v", routes[0])
+	}
+	if routes[1].Enabled || len(routes[1].Paths) != 1 || routes[1].Paths[0] != "/" {
+		t.Errorf("Expected the route with only unready services to be disabled got %+v", routes[1])
+	}
+	if _, set := ingress.Annotations[UnreadyServicesAnnotation]; set {
+		t.Error("Expected the ingress passed in to be unchanged")
+	}
+}
+
+func TestWithUnreadyServicesReplacesAnnotation(t *testing.T) {
+	ingress := testIngress("app", "/")
+	if WithUnreadyServices(ingress, nil) != ingress {
+		t.Error("Expected the ingress to be returned unchanged without unready services")
+	}
+
+	ingress.Annotations = map[string]string{UnreadyServicesAnnotation: "web"}
+	if updated := WithUnreadyServices(ingress, nil); len(unreadyServices(updated)) != 0 {
+		t.Errorf("Expected an annotation set by the ingress to be removed got %q", updated.Annotations[UnreadyServicesAnnotation])
+	}
+	if updated := WithUnreadyServices(ingress, []string{"web", "api"}); updated.Annotations[UnreadyServicesAnnotation] != "api,web" {
+		t.Errorf("Expected the sorted services got %q", updated.Annotations[UnreadyServicesAnnotation])
+	}
+}
@@ -2,21 +2,54 @@ package sync
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
+	gosync "sync"
 	"time"
 
 	"github.com/Azure/azure-sdk-for-go/services/preview/frontdoor/mgmt/2018-08-01-preview/frontdoor"
-	"github.com/Azure/go-autorest/autorest/azure/auth"
 	"github.com/Azure/go-autorest/autorest/to"
 	"github.com/lawrencegripper/azurefrontdooringress/utils"
 	azlock "github.com/lawrencegripper/goazurelocking"
-	// log "github.com/sirupsen/logrus"
+	log "github.com/sirupsen/logrus"
 	v1beta1 "k8s.io/api/extensions/v1beta1"
 )
 
+// routingRulePrefix is the start of the name of every routing rule created by the controller
+const routingRulePrefix = "Ingress-"
+
 // Provider the interface any Syncronizers are required to meet
 type Provider interface {
-	Sync(ctx context.Context, ingressToSync []*v1beta1.Ingress) error
+	// Sync routes the ingresses to the cluster's backends, if there are no backends
+	// those already in Frontdoor are kept
+	Sync(ctx context.Context, ingressToSync []*v1beta1.Ingress, backends []ClusterBackend) (*SyncResult, error)
+}
+
+// SyncResult describes the outcome of a successful sync
+type SyncResult struct {
+	// Time the update to Frontdoor completed
+	Time time.Time
+	// RulesHash is a hash of the routing rules applied for each ingress
+	// keyed by 'namespace/name'
+	RulesHash map[string]string
+	// Failed holds the error for each ingress which couldn't be synced
+	// keyed by 'namespace/name', other ingresses are still synced
+	Failed map[string]error
+	// Diverged holds the differences found when reading back the rules for each
+	// ingress after the update, keyed by 'namespace/name'
+	Diverged map[string][]string
+	// RulesCreated and RulesUpdated count the routing rules added to, or changed in, Frontdoor
+	RulesCreated int
+	RulesUpdated int
+	// RolledBack is set when the frontend was unhealthy after the update so the
+	// previous configuration was re-applied, every ingress is then in Failed
+	RolledBack bool
+	// Providers reports the outcome for each provider when syncing to several, it's
+	// empty for a single provider
+	Providers []ProviderReport
+	// notification describes the rules changed by the update, nil if none changed or it was rolled back
+	notification *SyncNotification
 }
 
 // Synchronizer is used to communicate with the frontdoor instance
@@ -27,25 +60,271 @@ type Synchronizer struct {
 	backendPool     frontdoor.BackendPool
 	endPoint        frontdoor.FrontendEndpoint
 	client          frontdoor.FrontDoorsClient
+	ownershipMode   string
+	clusterName     string
+	// detectConflicts re-reads the Frontdoor before updating it, failing the sync if it changed, as no
+	// lock is held to stop other controllers changing it
+	detectConflicts bool
+	// identity is the controller instance, '<cluster>/<pod>@<version>', recorded with the changes it makes
+	identity string
+	// poolPerNamespace binds the routes of each namespace to its own backend pool
+	poolPerNamespace bool
+	// lastApplied holds the rules last applied by the controller, keyed by name
+	lastApplied map[string]frontdoor.RoutingRule
+	// appliedRules persists lastApplied in merge mode, nil when it's only kept in memory
+	appliedRules appliedRulesStore
+	// appliedChanged is set while lastApplied differs from the rules last saved
+	appliedChanged bool
+	// desired holds the rules generated for each ingress keyed by 'namespace/name'
+	desired      map[string]*desiredRules
+	desiredMutex gosync.Mutex
+	// concurrency is how many namespaces' routing rules are generated at once
+	concurrency int
+	// snapshots saves the Frontdoor before each update, nil if snapshots are disabled
+	snapshots snapshotStore
+	// snapshotRetention is the number of snapshots kept, all are kept if it's zero
+	snapshotRetention int
+	// lockHistory records each sync made while holding the lock, nil if it's disabled
+	lockHistory lockHistory
+	// customDomains adds a frontend endpoint for each ingress host
+	customDomains        bool
+	validateCustomDomain func(ctx context.Context, host string) (frontdoor.ValidateCustomDomainOutput, error)
+	// rollbackWindow is how long the frontend is probed after an update, zero disables rollback
+	rollbackWindow time.Duration
+	probe          func(context.Context) error
+	// webhook is posted the changes made by each update, nil if no webhook is configured
+	webhook func(context.Context, SyncNotification) error
+	// follower is set when another cluster is authoritative, routing rules other clusters could
+	// have created are then never deleted
+	follower bool
+	// backendPriority is the priority of the cluster's backends in its pools
+	backendPriority int32
+	// defaultRoute is whether the catch-all route to the cluster's pool is maintained, 'enabled' or
+	// 'disabled', it's left alone if empty
+	defaultRoute string
+	// updateChildResources applies changes to backend pools and routing rules without replacing
+	// the whole Frontdoor, nil if differential updates are disabled
+	updateChildResources func(context.Context, frontDoorChanges) error
+	// unusedFrontendGracePeriod is how long a custom domain's frontend endpoint is kept once no rule
+	// uses it, zero keeps them forever. unusedFrontends holds when each was first seen unused.
+	unusedFrontendGracePeriod time.Duration
+	unusedFrontends           map[string]time.Time
+	// staticRoutes are the routing rules from the config managed alongside the ingresses' rules
+	staticRoutes []utils.StaticRoute
+	// ruleRegistry records the rules generated for each ingress, nil if it's disabled
+	ruleRegistry *ruleRegistry
+	// protection holds the routing rules protected from being deleted
+	protection *protectedRules
+	// ingressPools holds the backend pools created for single ingresses, which are removed once unused
+	ingressPools *ingressPools
+	// syncStrategy is 'replace' to prune the controller's rules no ingress generates, 'merge' to never
+	// delete rules, or empty
+	syncStrategy string
+	// protocols are those the routing rules accept from clients, both if empty
+	protocols []string
 }
 
 // Sync Acquire a lock and update Frontdoor with the ingress information provided
-func (p *Synchronizer) Sync(ctx context.Context, ingressToSync []*v1beta1.Ingress) error {
+func (p *Synchronizer) Sync(ctx context.Context, ingressToSync []*v1beta1.Ingress, backends []ClusterBackend) (*SyncResult, error) {
 	logger := utils.GetLogger(ctx)
-	logger.Info("Starting sync of routing rules")
+	logger.Debug("Starting sync of routing rules")
 
 	lock, err := p.getLock()
 	if err != nil {
-		return err
+		return nil, &LockError{Err: err}
 	}
-	defer lock.Unlock() //nolint: errcheck
+	acquired := time.Now()
+
+	result, err := p.syncLocked(ctx, ingressToSync, backends, lock.Renew)
+	lock.Unlock() //nolint: errcheck
+	p.recordLockHistory(ctx, acquired, result, err)
+	if err == nil {
+		p.notifyWebhook(ctx, result)
+	}
+	return result, err
+}
+
+// syncLocked updates Frontdoor with the ingresses, the lock must be held. renewLock is called
+// before Frontdoor is updated so the update isn't made if the lock was lost while the rules were generated,
+// and again once the update completes to catch the lock being lost while it was in flight.
+func (p *Synchronizer) syncLocked(ctx context.Context, ingressToSync []*v1beta1.Ingress, backends []ClusterBackend, renewLock func() error) (*SyncResult, error) {
+	logger := utils.GetLogger(ctx)
 
 	fdState, err := p.getCurrentState(ctx)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	// Backend pools are modified in place so copy the state before adding the ingresses
+	snapshot, err := copyFrontDoor(fdState)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set before the ingresses are added so pools created for them copy the current backends
+	p.setClusterBackends(&fdState, backends, ingressToSync)
+	result, rulesToAdd, ruleOwners := p.addIngresses(ctx, &fdState, ingressToSync)
+
+	existingRules := []frontdoor.RoutingRule{}
+	if fdState.RoutingRules != nil {
+		existingRules = *fdState.RoutingRules
+	}
+	renamedRules := p.renameLegacyRoutingRules(ctx, fdState, existingRules, ingressToSync, result)
+	mergedRules := p.mergeRoutingRules(ctx, renamedRules, rulesToAdd)
+	p.updateProtectedRules(ctx, renamedRules, ingressToSync, result, ruleOwners)
+	mergedRules, registry, migrated := p.releaseRules(ctx, fdState, mergedRules, ingressToSync, result, ruleOwners)
+	mergedRules = p.pruneRoutingRules(ctx, fdState, mergedRules, ruleOwners)
+	mergedRules = p.keepSharedRoutingRules(ctx, fdState, existingRules, mergedRules, ingressToSync, result)
+	mergedRules = p.applyDefaultRoute(ctx, mergedRules)
+	mergedRules = p.applyStaticRoutes(ctx, fdState, mergedRules)
+	fdState.RoutingRules = &mergedRules
+	p.removeUnusedIngressPools(ctx, &fdState, mergedRules)
+	p.removeUnusedIngressProbes(ctx, &fdState)
+	p.removeUnusedFrontends(ctx, &fdState, mergedRules, time.Now())
+
+	countRuleChanges(result, existingRules, mergedRules, ruleOwners)
+	if logger.Logger.IsLevelEnabled(log.DebugLevel) {
+		logger.WithField("changes", DiffFrontDoor(snapshot, fdState).Strings()).Debug("Changes to be applied to Frontdoor")
+	}
+	notification := p.newSyncNotification(ctx, fdState, existingRules, mergedRules, ruleOwners)
+
+	if p.detectConflicts {
+		if err = p.checkForConflicts(ctx, snapshot); err != nil {
+			return nil, err
+		}
+	}
+	err = renewLock()
+	if err != nil {
+		utils.GetLogger(ctx).WithError(err).WithField(utils.EventField, "LockLost").Warn("Lost the Frontdoor lock before updating, not updating Frontdoor")
+		return nil, fmt.Errorf("lost the Frontdoor lock before updating, another controller may be updating it: %v", err)
+	}
+
+	updated := true
+	if migrated > 0 {
+		// Updated individually the new rules would be created before the old ones are deleted, leaving
+		// both routing the same traffic, so the whole Frontdoor is replaced to rename them in one update
+		logger.WithField("migrated", migrated).Debug("Routing rules renamed, replacing the whole Frontdoor")
+		if err = p.saveSnapshot(ctx, snapshot); err == nil {
+			_, err = p.updateState(ctx, fdState)
+		}
+	} else {
+		updated, err = p.applyUpdate(ctx, snapshot, fdState)
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = renewLock()
+	if err != nil {
+		return nil, p.lockLostDuringUpdate(ctx, mergedRules, err)
+	}
+	result.Time = time.Now()
+
+	// Only an update which changed Frontdoor can have made the frontend unhealthy
+	rolledBack := ""
+	if updated {
+		rolledBack, err = p.rollbackIfUnhealthy(ctx, snapshot)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if rolledBack != "" {
+		result.RolledBack = true
+		for _, desired := range p.desired {
+			desired.verifiedHash = ""
+		}
+		for key := range result.RulesHash {
+			result.Failed[key] = errors.New(rolledBack)
+		}
+		return result, nil
+	}
+	p.recordApplied(rulesToAdd)
+	p.commitAppliedRules(ctx)
+	p.commitRuleRegistry(ctx, registry)
+	p.commitProtectedRules(ctx)
+	p.commitIngressPools(ctx)
+	result.notification = notification
+
+	// The rules sent for each ingress, in merge mode these may keep externally modified fields
+	sentByOwner := map[string][]frontdoor.RoutingRule{}
+	for _, rule := range mergedRules {
+		if rule.Name != nil && ruleOwners[*rule.Name] != "" {
+			owner := ruleOwners[*rule.Name]
+			sentByOwner[owner] = append(sentByOwner[owner], rule)
+		}
+	}
+	// Rules already read back without differences don't need checking again
+	rulesSent := []frontdoor.RoutingRule{}
+	sentHashes := map[string]string{}
+	for owner, rules := range sentByOwner {
+		sentHashes[owner] = hashRoutingRules(rules)
+		if p.desired[owner].verifiedHash == sentHashes[owner] {
+			continue
+		}
+		rulesSent = append(rulesSent, rules...)
+	}
+	if len(rulesSent) == 0 {
+		return result, nil
+	}
+
+	// Read back the Frontdoor to catch rules Azure accepted but dropped or normalized
+	appliedState, err := p.getCurrentState(ctx)
+	if err != nil {
+		// The update succeeded so don't fail the sync
+		logger.WithError(err).Warn("Failed to read back Frontdoor to verify update")
+		return result, nil
+	}
+	for ruleName, diffs := range verifyRoutingRules(rulesSent, appliedState) {
+		logger.WithField("ruleName", ruleName).WithField("differences", diffs).Warn("Routing rule in Frontdoor differs from desired state after update")
+		verificationMismatches.Inc()
+		owner := ruleOwners[ruleName]
+		result.Diverged[owner] = append(result.Diverged[owner], fmt.Sprintf("%s: %s", ruleName, strings.Join(diffs, ", ")))
 	}
+	for owner, hash := range sentHashes {
+		if _, diverged := result.Diverged[owner]; diverged {
+			hash = ""
+		}
+		p.desired[owner].verifiedHash = hash
+	}
+
+	return result, nil
+}
+
+// lockLostDuringUpdate reports the lock being lost while Frontdoor was being updated, when another
+// controller may have read the Frontdoor before the update completed and overwrite it with stale rules.
+// The Frontdoor is read back to log the rules sent which aren't there. The error returned fails the sync
+// so the next sync applies the rules again.
+func (p *Synchronizer) lockLostDuringUpdate(ctx context.Context, rulesSent []frontdoor.RoutingRule, lockErr error) error {
+	logger := utils.GetLogger(ctx)
+	lockLossesDuringUpdate.Inc()
+	logger.WithError(lockErr).WithField(utils.EventField, "LockLostDuringUpdate").Error("Lost the Frontdoor lock while updating, another controller may have overwritten the update")
+
+	appliedState, err := p.getCurrentState(ctx)
+	if err != nil {
+		logger.WithError(err).Warn("Failed to read back Frontdoor to verify update made after the lock was lost")
+	} else {
+		for ruleName, diffs := range verifyRoutingRules(rulesSent, appliedState) {
+			logger.WithField("ruleName", ruleName).WithField("differences", diffs).Warn("Routing rule in Frontdoor differs from the update made as the lock was lost")
+			verificationMismatches.Inc()
+		}
+	}
+	return fmt.Errorf("lost the Frontdoor lock while updating, another controller may have overwritten the update: %v", lockErr)
+}
+
+// addIngresses adds the backend pools and frontends the ingresses need to the Frontdoor and returns
+// their routing rules, along with the ingress each rule was created for
+func (p *Synchronizer) addIngresses(ctx context.Context, fd *frontdoor.FrontDoor, ingressToSync []*v1beta1.Ingress) (*SyncResult, []frontdoor.RoutingRule, map[string]string) {
+	logger := utils.GetLogger(ctx)
 
+	result := &SyncResult{
+		RulesHash: map[string]string{},
+		Failed:    map[string]error{},
+		Diverged:  map[string][]string{},
+	}
 	rulesToAdd := []frontdoor.RoutingRule{}
+	// ruleOwners maps rule names to the ingress they were created for
+	ruleOwners := map[string]string{}
+	synced := map[string]bool{}
+	reused := 0
+	pending := []*pendingIngress{}
 
 	for _, ingress := range ingressToSync {
 		if ingress == nil {
@@ -53,68 +332,225 @@ func (p *Synchronizer) Sync(ctx context.Context, ingressToSync []*v1beta1.Ingres
 			continue
 		}
 
-		for _, rule := range ingress.Spec.Rules {
-			patternsToMatch := []string{}
-			for _, path := range rule.HTTP.Paths {
-				patternsToMatch = append(patternsToMatch, path.Path)
-			}
-			rulesToAdd = append(rulesToAdd, frontdoor.RoutingRule{
-				Name: to.StringPtr(fmt.Sprintf("Ingress-%s", ingress.Name)),
-				RoutingRuleProperties: &frontdoor.RoutingRuleProperties{
-					AcceptedProtocols: &[]frontdoor.Protocol{frontdoor.HTTP, frontdoor.HTTPS},
-					BackendPool: &frontdoor.SubResource{
-						ID: p.backendPool.ID,
-					},
-					PatternsToMatch: &patternsToMatch,
-					EnabledState:    frontdoor.EnabledStateEnumEnabled,
-					FrontendEndpoints: &[]frontdoor.SubResource{
-						{
-							ID: p.endPoint.ID,
-						},
-					},
-				},
-			})
+		key := ingress.Namespace + "/" + ingress.Name
+		backendPoolID, err := p.backendPoolForIngress(fd, ingress)
+		if err != nil {
+			logger.WithError(err).WithField("ingressName", ingress.Name).Warn("Unable to get backend pool for ingress")
+			result.Failed[key] = err
+			continue
 		}
-	}
 
-	if fdState.RoutingRules != nil {
-		rulesDeref := *fdState.RoutingRules
-		rulesDeref = append(rulesDeref, rulesToAdd...)
-		fdState.RoutingRules = &rulesDeref
-	} else {
-		fdState.RoutingRules = &rulesToAdd
+		err = checkRulesEngineForIngress(ingress)
+		if err != nil {
+			logger.WithError(err).WithField("ingressName", ingress.Name).Warn("Unable to bind rules engine for ingress")
+			result.Failed[key] = err
+			continue
+		}
+
+		frontendIDs, err := p.frontendsForIngress(ctx, fd, ingress)
+		if err != nil {
+			logger.WithError(err).WithField("ingressName", ingress.Name).Warn("Unable to get frontend endpoints for ingress")
+			result.Failed[key] = err
+			continue
+		}
+
+		pending = append(pending, &pendingIngress{key: key, ingress: ingress, backendPoolID: backendPoolID, frontendIDs: frontendIDs})
 	}
 
-	_, err = p.updateState(ctx, fdState)
+	// Generating the rules only reads the ingresses so it's done in parallel, the Frontdoor was updated above
+	p.generateDesiredRules(pending)
+	for _, ingress := range pending {
+		if ingress.err != nil {
+			logger.WithError(ingress.err).WithField("ingressName", ingress.ingress.Name).Warn("Unable to create routing rules for ingress")
+			result.Failed[ingress.key] = ingress.err
+			continue
+		}
+		if ingress.cached {
+			reused++
+		}
+		synced[ingress.key] = true
+		result.RulesHash[ingress.key] = ingress.desired.hash
+		for _, rule := range ingress.desired.rules {
+			ruleOwners[*rule.Name] = ingress.key
+		}
+		rulesToAdd = append(rulesToAdd, ingress.desired.rules...)
+	}
+	p.forgetDesiredRules(synced)
+	logger.WithField("unchanged", reused).WithField("ingresses", len(synced)).Debug("Generated routing rules")
 
-	return err
+	return result, rulesToAdd, ruleOwners
 }
 
-// NewFontDoorSyncer creates a new FrontDoor provider with require configuration
-// for use when updating frontdoor0
-func NewFontDoorSyncer(ctx context.Context, config utils.Config) (*Synchronizer, error) {
-	fdSynchronizer := Synchronizer{}
+// countRuleChanges records how many of the controller's rules are new or differ from those in Frontdoor
+func countRuleChanges(result *SyncResult, existing, merged []frontdoor.RoutingRule, ruleOwners map[string]string) {
+	created, updated := changedRoutingRules(existing, merged, ruleOwners)
+	result.RulesCreated += len(created)
+	result.RulesUpdated += len(updated)
+}
 
-	// Create a Azure lockInstance (using blob) and lock it
-	// lock on the name of the frontdoor so that
-	// other ingress instances can't update while
-	// this instance is making changes
-	fdSynchronizer.getLock = func() (*azlock.Lock, error) {
-		lock, err := azlock.NewLockInstance(ctx,
-			config.StorageAccountURL,
-			config.StorageAccountKey,
-			config.FrontDoorName,
-			time.Duration(time.Second*15))
+// changedRoutingRules returns the controller's rules which are new, and those which differ from the rule in Frontdoor
+func changedRoutingRules(existing, merged []frontdoor.RoutingRule, ruleOwners map[string]string) ([]frontdoor.RoutingRule, []frontdoor.RoutingRule) {
+	existingByName := map[string]frontdoor.RoutingRule{}
+	for _, rule := range existing {
+		if rule.Name != nil {
+			existingByName[*rule.Name] = rule
+		}
+	}
+	created := []frontdoor.RoutingRule{}
+	updated := []frontdoor.RoutingRule{}
+	for _, rule := range merged {
+		if rule.Name == nil || ruleOwners[*rule.Name] == "" {
+			continue
+		}
+		current, exists := existingByName[*rule.Name]
+		if !exists {
+			created = append(created, rule)
+		} else if len(diffRoutingRule(rule, current)) > 0 {
+			updated = append(updated, rule)
+		}
+	}
+	return created, updated
+}
 
+// backendPoolForIngress returns the ID of the backend pool the ingress's routes are bound to,
+// adding the namespace, canary or health probe pool it requires if needed
+func (p *Synchronizer) backendPoolForIngress(fd *frontdoor.FrontDoor, ingress *v1beta1.Ingress) (*string, error) {
+	poolName := p.clusterName
+	poolID := p.backendPool.ID
+	if p.poolPerNamespace {
+		var err error
+		poolName = namespaceBackendPoolName(p.clusterName, ingress.Namespace)
+		poolID, err = p.ensureNamespaceBackendPool(fd, ingress.Namespace)
 		if err != nil {
 			return nil, err
 		}
+	}
 
-		err = lock.Lock()
-		if err != nil {
-			return nil, err
+	canaryPool, canaryWeight, err := canarySettings(ingress)
+	if err != nil {
+		return nil, err
+	}
+	probe, err := probeSettings(ingress)
+	if err != nil {
+		return nil, err
+	}
+	if canaryPool != "" {
+		canaryPoolID, err := p.ensureCanaryBackendPool(fd, ingress, poolName, canaryPool, canaryWeight)
+		if err != nil || probe == nil {
+			return canaryPoolID, err
 		}
-		return lock, nil
+		// The canary pool is already the ingress's own so the probe is bound to it
+		return canaryPoolID, p.setIngressProbe(fd, ingress, findBackendPool(*fd, canaryBackendPoolName(ingress)), probe)
+	}
+	if probe != nil {
+		return p.ensureProbeBackendPool(fd, ingress, poolName, probe)
+	}
+	return poolID, nil
+}
+
+// routingRulesForIngress builds the Frontdoor routing rules for the ingress's routes, binding
+// each rule to the frontend endpoint for its host
+func (p *Synchronizer) routingRulesForIngress(ingress *v1beta1.Ingress, backendPoolID *string, frontendIDs map[string]*string) ([]frontdoor.RoutingRule, error) {
+	routes, err := routesForIngress(ingress, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	rules := []frontdoor.RoutingRule{}
+	for _, route := range routes {
+		route.Protocols = p.acceptedProtocols()
+		rules = append(rules, classicRoutingRule(route, backendPoolID, frontendIDs[route.Host]))
+	}
+	return rules, nil
+}
+
+// acceptedProtocols returns the protocols the routing rules accept, both unless others are configured
+func (p *Synchronizer) acceptedProtocols() []string {
+	if len(p.protocols) == 0 {
+		return []string{ProtocolHTTP, ProtocolHTTPS}
+	}
+	return p.protocols
+}
+
+// newSynchronizer creates a provider for the configured Frontdoor without reading or changing it
+func newSynchronizer(ctx context.Context, config utils.Config) (*Synchronizer, error) {
+	// create clients for frontdoor
+	fdClient, err := newFrontDoorsClient(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	return newSynchronizerForClient(ctx, config, fdClient), nil
+}
+
+// newSynchronizerForClient creates a provider which uses the client to read and update the configured Frontdoor
+func newSynchronizerForClient(ctx context.Context, config utils.Config, fdClient frontdoor.FrontDoorsClient) *Synchronizer {
+	fdSynchronizer := &Synchronizer{
+		client:           fdClient,
+		ownershipMode:    config.OwnershipMode,
+		clusterName:      config.ClusterName,
+		identity:         config.Identity(),
+		poolPerNamespace: config.BackendPoolPerNamespace,
+		rollbackWindow:   config.RollbackProbeWindow,
+		customDomains:    config.CustomDomains,
+		probe:            newFrontendProbe(config),
+		concurrency:      config.ConcurrentReconciles,
+		follower:         !config.Authoritative(),
+		backendPriority:  int32(config.BackendPriority),
+		defaultRoute:     config.DefaultRoute,
+		syncStrategy:     config.SyncStrategy,
+		protocols:        config.AcceptedProtocols(),
+
+		unusedFrontendGracePeriod: config.UnusedFrontendGracePeriod,
+		staticRoutes:              config.ParsedStaticRoutes(),
+		snapshotRetention:         config.SnapshotRetention,
+	}
+
+	if config.WebhookURL != "" {
+		fdSynchronizer.webhook = newWebhook(config)
+	}
+	fdSynchronizer.getLock = func() (*azlock.Lock, error) {
+		return lockFrontDoor(ctx, config)
+	}
+	if config.LockingMode == utils.LockingModeNone {
+		fdSynchronizer.getLock = newLocalLock()
+		fdSynchronizer.detectConflicts = true
+	}
+	fdSynchronizer.validateCustomDomain = func(ctx context.Context, host string) (frontdoor.ValidateCustomDomainOutput, error) {
+		return fdClient.ValidateCustomDomain(ctx, config.ResourceGroupName, config.FrontDoorName, frontdoor.ValidateCustomDomainInput{HostName: to.StringPtr(host)})
+	}
+	fdSynchronizer.getCurrentState = func(ctx context.Context) (frontdoor.FrontDoor, error) {
+		return waitForProvisioning(ctx, func(ctx context.Context) (frontdoor.FrontDoor, error) {
+			return fdClient.Get(ctx, config.ResourceGroupName, config.FrontDoorName)
+		}, provisioningPollInterval, provisioningTimeout)
+	}
+	fdSynchronizer.updateState = func(ctx context.Context, fd frontdoor.FrontDoor) (frontdoor.FrontDoor, error) {
+		return updateFrontDoor(ctx, fdClient, config, fd)
+	}
+	if config.DifferentialUpdates {
+		fdSynchronizer.updateChildResources = func(ctx context.Context, changes frontDoorChanges) error {
+			return updateChildResources(ctx, fdClient, config, changes)
+		}
+	}
+	return fdSynchronizer
+}
+
+// loadRequiredResources checks the Frontdoor has the backend pool and frontend endpoint
+// the controller requires and binds the provider to them
+func (p *Synchronizer) loadRequiredResources(fd frontdoor.FrontDoor, config utils.Config) error {
+	err := checkRequiredResources(fd, config)
+	if err != nil {
+		return err
+	}
+	p.backendPool = *findBackendPool(fd, config.ClusterName)
+	p.endPoint = *findFrontendEndpoint(fd, config.FrontDoorHostname)
+	return nil
+}
+
+// NewFontDoorSyncer creates a new FrontDoor provider with require configuration
+// for use when updating frontdoor0
+func NewFontDoorSyncer(ctx context.Context, config utils.Config) (*Synchronizer, error) {
+	fdSynchronizer, err := newSynchronizer(ctx, config)
+	if err != nil {
+		return nil, err
 	}
 
 	lock, err := fdSynchronizer.getLock()
@@ -123,24 +559,47 @@ func NewFontDoorSyncer(ctx context.Context, config utils.Config) (*Synchronizer,
 	}
 	defer lock.Unlock() //nolint: errcheck
 
-	// create clients for frontdoor
-	fdClient := frontdoor.NewFrontDoorsClient(config.SubscriptionID)
+	if config.LockingMode == utils.LockingModeNone {
+		utils.GetLogger(ctx).Warn("Not locking the Frontdoor as LOCKING_MODE is none, only one controller replica in one cluster may update it")
+	}
+	if config.CustomDomains {
+		logger := utils.GetLogger(ctx)
+		logger.WithField("minimumTLSVersion", config.MinimumTLSVersion).
+			Warn("Frontdoor API version " + frontdoorAPIVersion + " can't set the minimum TLS version, frontend endpoints created for custom domains use Frontdoor's default")
+	}
 
-	if config.DebugAPICalls {
-		fdClient.RequestInspector = logRequest()
-		fdClient.ResponseInspector = logResponse()
+	fdSynchronizer.snapshots, err = newSnapshotStore(ctx, config)
+	if err != nil {
+		return nil, err
 	}
 
-	// create an authorizer from env vars or Azure Managed Service Idenity
-	authorizer, err := auth.NewAuthorizerFromEnvironment()
-	if err == nil {
-		fdClient.Authorizer = authorizer
+	fdSynchronizer.lockHistory, err = newLockHistory(ctx, config)
+	if err != nil {
+		return nil, err
 	}
 
-	fdSynchronizer.client = fdClient
+	fdSynchronizer.ruleRegistry, err = newRuleRegistry(ctx, config)
+	if err != nil {
+		return nil, err
+	}
 
-	fdSynchronizer.getCurrentState = func(ctx context.Context) (frontdoor.FrontDoor, error) {
-		return fdClient.Get(ctx, config.ResourceGroupName, config.FrontDoorName)
+	fdSynchronizer.protection, err = newProtectedRules(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+
+	fdSynchronizer.ingressPools, err = newIngressPools(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+
+	fdSynchronizer.appliedRules, err = newAppliedRulesStore(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+	err = fdSynchronizer.loadAppliedRules(ctx)
+	if err != nil {
+		return nil, err
 	}
 
 	currentConfig, err := fdSynchronizer.getCurrentState(ctx)
@@ -148,76 +607,98 @@ func NewFontDoorSyncer(ctx context.Context, config utils.Config) (*Synchronizer,
 		return nil, err
 	}
 
+	err = fdSynchronizer.loadRequiredResources(currentConfig, config)
+	if err != nil {
+		return nil, err
+	}
+
+	err = fdSynchronizer.saveSnapshot(ctx, currentConfig)
+	if err != nil {
+		return nil, err
+	}
+
 	clusterBackend := frontdoor.Backend{
 		Address:      to.StringPtr(config.PrimaryIngressPublicIP),
 		HTTPPort:     to.Int32Ptr(80),
 		HTTPSPort:    to.Int32Ptr(443),
 		EnabledState: frontdoor.EnabledStateEnumEnabled,
 		Weight:       to.Int32Ptr(50),
-		Priority:     to.Int32Ptr(1),
+		// A standby cluster in an active-passive pair only gets traffic when the primary's backends are unhealthy
+		Priority: to.Int32Ptr(int32(config.BackendPriority)),
 	}
 
-	// Check for existing backend
-	backendExists := false
-	if currentConfig.BackendPools != nil && len(*currentConfig.BackendPools) > 0 {
-		for _, pool := range *currentConfig.BackendPools {
-			// Find the pool for the cluster and update
-			if *pool.Name == config.ClusterName {
-				backendExists = true
-				addFrontdoor := append(*pool.BackendPoolProperties.Backends, clusterBackend)
-				pool.BackendPoolProperties.Backends = &addFrontdoor
-			}
-		}
-	}
+	// Add the cluster to its backend pool
+	pool := findBackendPool(currentConfig, config.ClusterName)
+	setBackend(pool, clusterBackend)
 
-	if !backendExists {
-		return nil, fmt.Errorf("Frontdoor instance doesn't have a backendPool for cluster, require a configured pool named %s to exist", config.ClusterName)
+	state, err := fdSynchronizer.updateState(ctx, currentConfig)
+	if err != nil {
+		return nil, err
 	}
 
-	// Check for existing frontend
-	foundEndPoint := false
-	if currentConfig.FrontendEndpoints != nil {
-		for _, fe := range *currentConfig.FrontendEndpoints {
-			if fe.HostName != nil && *fe.HostName == config.FrontDoorHostname {
-				foundEndPoint = true
-				fdSynchronizer.endPoint = fe
-			}
-		}
-	}
-	if !foundEndPoint {
-		return nil, fmt.Errorf("Frontdoor instance doesn't have a frontend which matches the provided hostname, require a configured pool named %s to exist", config.FrontDoorHostname)
+	if updatedPool := findBackendPool(state, config.ClusterName); updatedPool != nil {
+		fdSynchronizer.backendPool = *updatedPool
 	}
 
-	fdSynchronizer.updateState = func(ctx context.Context, fd frontdoor.FrontDoor) (frontdoor.FrontDoor, error) {
-		updatedFd, err := fdClient.CreateOrUpdate(ctx, config.ResourceGroupName, config.FrontDoorName, fd)
-		if err != nil {
-			return frontdoor.FrontDoor{}, err
-		}
+	return fdSynchronizer, nil
 
-		err = updatedFd.WaitForCompletion(ctx, fdClient.Client)
-		if err != nil {
-			return frontdoor.FrontDoor{}, err
-		}
+}
 
-		res, err := updatedFd.Result(fdClient)
-		if err != nil {
-			return frontdoor.FrontDoor{}, err
-		}
-		return res, nil
-	}
+// newLockInstance creates the blob lock, its behaviors run goroutines until the context is cancelled
+var newLockInstance = azlock.NewLockInstance
+
+// lockFrontDoor creates an Azure lockInstance (using blob) and locks it.
+// It locks on the name of the frontdoor so that other ingress instances
+// can't update while this instance is making changes.
+// The locking library requires an https storage account URL so can't be used with the Azurite emulator.
+func lockFrontDoor(ctx context.Context, config utils.Config) (*azlock.Lock, error) {
+	// The lock's behaviors run until its context is cancelled, so each lock gets its own context which is
+	// cancelled once it's released or couldn't be acquired, rather than leaving them running until the
+	// controller stops
+	lockCtx, cancel := context.WithCancel(ctx)
+	// The default behaviors panic when the lease is lost, it's instead noticed by the sync renewing the
+	// lock before and after updating Frontdoor
+	lock, err := newLockInstance(lockCtx,
+		config.StorageAccountURL,
+		config.StorageAccountKey,
+		config.FrontDoorName,
+		time.Duration(time.Second*15),
+		azlock.AutoRenewLock, azlock.UnlockWhenContextCancelled, azlock.RetryObtainingLock)
 
-	state, err := fdSynchronizer.updateState(ctx, currentConfig)
 	if err != nil {
+		cancel()
 		return nil, err
 	}
 
-	for _, pool := range *state.BackendPools {
-		// Find the pool for the cluster and update
-		if *pool.Name == config.ClusterName {
-			fdSynchronizer.backendPool = pool
-		}
+	err = lock.Lock()
+	if err != nil {
+		cancel()
+		return nil, err
 	}
+	unlock := lock.Unlock
+	lock.Unlock = func() error {
+		defer cancel()
+		return unlock()
+	}
+	return lock, nil
+}
 
-	return &fdSynchronizer, nil
+// updateFrontDoor replaces the configuration of the Frontdoor, tagged as managed by the controller,
+// and waits for the update to complete
+func updateFrontDoor(ctx context.Context, fdClient frontdoor.FrontDoorsClient, config utils.Config, fd frontdoor.FrontDoor) (frontdoor.FrontDoor, error) {
+	setManagedTags(&fd, config.ClusterName, config.Identity())
+	updatedFd, err := fdClient.CreateOrUpdate(ctx, config.ResourceGroupName, config.FrontDoorName, fd)
+	if err == nil {
+		err = updatedFd.WaitForCompletion(ctx, fdClient.Client)
+	}
+	auditMutation(ctx, config, mutationReplace, config.FrontDoorName, err)
+	if err != nil {
+		return frontdoor.FrontDoor{}, err
+	}
 
+	res, err := updatedFd.Result(fdClient)
+	if err != nil {
+		return frontdoor.FrontDoor{}, err
+	}
+	return res, nil
 }
@@ -0,0 +1,143 @@
+package sync
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+)
+
+// InvalidAnnotation is an ingress annotation whose value can't be used
+type InvalidAnnotation struct {
+	Name  string
+	Value string
+	// Expected describes the values which are valid
+	Expected string
+}
+
+func (a InvalidAnnotation) String() string {
+	return fmt.Sprintf("%s: %q must be %s", a.Name, a.Value, a.Expected)
+}
+
+// annotationValidators check the value of each annotation on its own, returning what's expected
+// if the value is invalid or an empty string if it's valid
+var annotationValidators = map[string]func(value string) string{
+	excludePathsAnnotation: func(value string) string {
+		for _, path := range strings.Split(value, ",") {
+			if path = strings.TrimSpace(path); path != "" && !strings.HasPrefix(path, "/") {
+				return "a comma separated list of paths starting with '/', for example '/admin,/internal'"
+			}
+		}
+		return ""
+	},
+	cacheDurationAnnotation: func(value string) string {
+		if duration, err := time.ParseDuration(value); err != nil || duration <= 0 {
+			return "a positive duration, for example '1h'"
+		}
+		return fmt.Sprintf("unset as setting the cache duration isn't supported by Frontdoor API version %s", frontdoorAPIVersion)
+	},
+	dynamicCompressionAnnotation: func(value string) string {
+		if !strings.EqualFold(value, "enabled") && !strings.EqualFold(value, "disabled") {
+			return "'Enabled' or 'Disabled'"
+		}
+		return ""
+	},
+	queryStringCachingAnnotation: func(value string) string {
+		if _, err := ignoreQueryString(value); err != nil {
+			return "'StripAll' or 'StripNone'"
+		}
+		return ""
+	},
+	sessionAffinityAnnotation: func(value string) string {
+		if !strings.EqualFold(value, "enabled") && !strings.EqualFold(value, "disabled") {
+			return "'enabled' or 'disabled'"
+		}
+		return ""
+	},
+	sessionAffinityTTLAnnotation: func(value string) string {
+		return "unset as " + sessionAffinityTTLUnsupported
+	},
+	pruneAnnotation: func(value string) string {
+		if !strings.EqualFold(value, "true") && !strings.EqualFold(value, "false") {
+			return "'true' or 'false'"
+		}
+		return ""
+	},
+	probePathAnnotation: func(value string) string {
+		if !strings.HasPrefix(value, "/") {
+			return "a path starting with '/', for example '/healthz'"
+		}
+		return ""
+	},
+	probeProtocolAnnotation: func(value string) string {
+		if !strings.EqualFold(value, ProtocolHTTP) && !strings.EqualFold(value, ProtocolHTTPS) {
+			return "'Http' or 'Https'"
+		}
+		return ""
+	},
+	canaryWeightAnnotation: func(value string) string {
+		if weight, err := strconv.Atoi(value); err != nil || weight < 1 || weight > 99 {
+			return "a percentage between 1 and 99"
+		}
+		return ""
+	},
+	rulesEngineAnnotation: func(value string) string {
+		return "unset as " + rulesEngineUnsupported
+	},
+	enabledScheduleAnnotation:  validateScheduleAnnotation,
+	disabledScheduleAnnotation: validateScheduleAnnotation,
+}
+
+func validateScheduleAnnotation(value string) string {
+	if _, err := parseSchedule(value); err != nil {
+		return fmt.Sprintf("';' separated windows such as 'Mon-Fri 08:00-18:00' or '2019-12-24T00:00:00Z/2019-12-27T00:00:00Z', %v", err)
+	}
+	return ""
+}
+
+// RemoveInvalidAnnotations returns the ingress without the annotations whose values are invalid, so
+// their defaults are used rather than the ingress failing to sync, and the annotations removed sorted by
+// name. The canary annotations only work together so both are removed if either is invalid or missing.
+// The ingress is owned by the informer cache so it's copied if anything is removed.
+func RemoveInvalidAnnotations(ingress *v1beta1.Ingress) (*v1beta1.Ingress, []InvalidAnnotation) {
+	invalid := []InvalidAnnotation{}
+	for name, validate := range annotationValidators {
+		value, exists := ingress.Annotations[name]
+		if !exists {
+			continue
+		}
+		if expected := validate(value); expected != "" {
+			invalid = append(invalid, InvalidAnnotation{Name: name, Value: value, Expected: expected})
+		}
+	}
+
+	pool, hasPool := ingress.Annotations[canaryPoolAnnotation]
+	weight, hasWeight := ingress.Annotations[canaryWeightAnnotation]
+	switch {
+	case hasPool && !hasWeight:
+		invalid = append(invalid, InvalidAnnotation{Name: canaryPoolAnnotation, Value: pool,
+			Expected: fmt.Sprintf("set with %s", canaryWeightAnnotation)})
+	case hasWeight && pool == "":
+		if annotationValidators[canaryWeightAnnotation](weight) == "" {
+			invalid = append(invalid, InvalidAnnotation{Name: canaryWeightAnnotation, Value: weight,
+				Expected: fmt.Sprintf("set with %s", canaryPoolAnnotation)})
+		}
+	}
+	if len(invalid) == 0 {
+		return ingress, nil
+	}
+	sort.Slice(invalid, func(i, j int) bool { return invalid[i].Name < invalid[j].Name })
+
+	filtered := ingress.DeepCopy()
+	for _, annotation := range invalid {
+		delete(filtered.Annotations, annotation.Name)
+		if annotation.Name == canaryPoolAnnotation || annotation.Name == canaryWeightAnnotation {
+			delete(filtered.Annotations, canaryPoolAnnotation)
+			delete(filtered.Annotations, canaryWeightAnnotation)
+		}
+	}
+	return filtered, invalid
+}
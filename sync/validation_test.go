@@ -0,0 +1,77 @@
+package sync
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRemoveInvalidAnnotations(t *testing.T) {
+	ingress := testIngress("app", "/")
+	ingress.Annotations = map[string]string{
+		"azure/frontdoor":             "true",
+		excludePathsAnnotation:        "/admin,internal",
+		dynamicCompressionAnnotation:  "enabled",
+		queryStringCachingAnnotation:  "StripSome",
+		probeProtocolAnnotation:       "Https",
+		canaryPoolAnnotation:          "canary",
+		canaryWeightAnnotation:        "150",
+		disabledScheduleAnnotation:    "weekends",
+		cacheDurationAnnotation:       "1h",
+		rulesEngineAnnotation:         "headers",
+		enabledScheduleAnnotation:     "Mon-Fri 08:00-18:00",
+		probePathAnnotation:           "/healthz",
+		"kubernetes.io/ingress.class": "nginx",
+	}
+
+	filtered, invalid := RemoveInvalidAnnotations(ingress)
+	names := []string{}
+	for _, annotation := range invalid {
+		names = append(names, annotation.Name)
+		if annotation.Expected == "" {
+			t.Errorf("Expected %s to describe the expected format", annotation.Name)
+		}
+	}
+	expected := []string{
+		cacheDurationAnnotation,
+		canaryWeightAnnotation,
+		disabledScheduleAnnotation,
+		excludePathsAnnotation,
+		queryStringCachingAnnotation,
+		rulesEngineAnnotation,
+	}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("Expected invalid annotations %v got %v", expected, names)
+	}
+
+	for _, name := range append(expected, canaryPoolAnnotation) {
+		if _, exists := filtered.Annotations[name]; exists {
+			t.Errorf("Expected %s to be removed", name)
+		}
+	}
+	for _, name := range []string{dynamicCompressionAnnotation, probeProtocolAnnotation, probePathAnnotation, enabledScheduleAnnotation, "kubernetes.io/ingress.class"} {
+		if _, exists := filtered.Annotations[name]; !exists {
+			t.Errorf("Expected valid annotation %s to be kept", name)
+		}
+	}
+	if len(ingress.Annotations) != 13 {
+		t.Error("Expected the ingress passed in to be unchanged")
+	}
+	if _, err := routesForIngress(filtered, time.Now()); err != nil {
+		t.Errorf("Expected the ingress to route with the defaults got %v", err)
+	}
+}
+
+func TestRemoveInvalidAnnotationsKeepsValidIngress(t *testing.T) {
+	ingress := testIngress("app", "/")
+	ingress.Annotations = map[string]string{canaryPoolAnnotation: "canary", canaryWeightAnnotation: "10"}
+	filtered, invalid := RemoveInvalidAnnotations(ingress)
+	if len(invalid) != 0 || filtered != ingress {
+		t.Errorf("Expected no invalid annotations got %v", invalid)
+	}
+
+	delete(ingress.Annotations, canaryWeightAnnotation)
+	if _, invalid = RemoveInvalidAnnotations(ingress); len(invalid) != 1 || invalid[0].Name != canaryPoolAnnotation {
+		t.Errorf("Expected the canary pool without a weight to be invalid got %v", invalid)
+	}
+}
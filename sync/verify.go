@@ -0,0 +1,85 @@
+package sync
+
+import (
+	"sort"
+
+	"github.com/Azure/azure-sdk-for-go/services/preview/frontdoor/mgmt/2018-08-01-preview/frontdoor"
+)
+
+// verifyRoutingRules compares the desired rules with those read back from Frontdoor after an update,
+// returning the differences for each rule Azure dropped or normalized, keyed by rule name
+func verifyRoutingRules(desired []frontdoor.RoutingRule, actual frontdoor.FrontDoor) map[string][]string {
+	actualRules := map[string]frontdoor.RoutingRule{}
+	if actual.RoutingRules != nil {
+		for _, rule := range *actual.RoutingRules {
+			if rule.Name != nil {
+				actualRules[*rule.Name] = rule
+			}
+		}
+	}
+
+	divergence := map[string][]string{}
+	for _, want := range desired {
+		name := *want.Name
+		got, exists := actualRules[name]
+		if !exists {
+			divergence[name] = []string{"rule missing from Frontdoor after update"}
+			continue
+		}
+		if diffs := diffRoutingRule(want, got); len(diffs) > 0 {
+			divergence[name] = diffs
+		}
+	}
+	return divergence
+}
+
+// diffRoutingRule returns a description of the change from got to want of each field managed by the controller
+func diffRoutingRule(want, got frontdoor.RoutingRule) []string {
+	if got.RoutingRuleProperties == nil {
+		return []string{"rule has no properties"}
+	}
+	wantFields, gotFields := map[string]interface{}{}, map[string]interface{}{}
+	for _, field := range managedRoutingRuleFields {
+		wantFields[field.name] = field.get(want.RoutingRuleProperties)
+		gotFields[field.name] = field.get(got.RoutingRuleProperties)
+	}
+	return diffValues(gotFields, wantFields).Strings()
+}
+
+func sortedStrings(values *[]string) []string {
+	if values == nil {
+		return []string{}
+	}
+	sorted := append([]string{}, *values...)
+	sort.Strings(sorted)
+	return sorted
+}
+
+func protocolStrings(protocols *[]frontdoor.Protocol) []string {
+	result := []string{}
+	if protocols != nil {
+		for _, p := range *protocols {
+			result = append(result, string(p))
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+func subResourceID(resource *frontdoor.SubResource) string {
+	if resource == nil || resource.ID == nil {
+		return ""
+	}
+	return *resource.ID
+}
+
+func subResourceIDs(resources *[]frontdoor.SubResource) []string {
+	result := []string{}
+	if resources != nil {
+		for i := range *resources {
+			result = append(result, subResourceID(&(*resources)[i]))
+		}
+	}
+	sort.Strings(result)
+	return result
+}
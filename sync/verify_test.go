@@ -0,0 +1,49 @@
+package sync
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/services/preview/frontdoor/mgmt/2018-08-01-preview/frontdoor"
+	"github.com/Azure/go-autorest/autorest/to"
+)
+
+func testRoutingRule(name, poolID string, patterns ...string) frontdoor.RoutingRule {
+	return frontdoor.RoutingRule{
+		Name: to.StringPtr(name),
+		RoutingRuleProperties: &frontdoor.RoutingRuleProperties{
+			AcceptedProtocols: &[]frontdoor.Protocol{frontdoor.HTTP, frontdoor.HTTPS},
+			BackendPool:       &frontdoor.SubResource{ID: to.StringPtr(poolID)},
+			PatternsToMatch:   &patterns,
+			EnabledState:      frontdoor.EnabledStateEnumEnabled,
+		},
+	}
+}
+
+func TestVerifyRoutingRules(t *testing.T) {
+	desired := []frontdoor.RoutingRule{
+		testRoutingRule("Ingress-match", "/pools/cluster1", "/a", "/b"),
+		testRoutingRule("Ingress-normalized", "/pools/cluster1", "/c"),
+		testRoutingRule("Ingress-dropped", "/pools/cluster1", "/d"),
+	}
+	actual := frontdoor.FrontDoor{
+		Properties: &frontdoor.Properties{
+			RoutingRules: &[]frontdoor.RoutingRule{
+				// Order of patterns and case of IDs can change without a difference
+				testRoutingRule("Ingress-match", "/POOLS/cluster1", "/b", "/a"),
+				testRoutingRule("Ingress-normalized", "/pools/cluster1", "/c/*"),
+			},
+		},
+	}
+
+	divergence := verifyRoutingRules(desired, actual)
+
+	if _, exists := divergence["Ingress-match"]; exists {
+		t.Errorf("Expected no divergence for matching rule, got: %v", divergence["Ingress-match"])
+	}
+	if len(divergence["Ingress-normalized"]) != 1 {
+		t.Errorf("Expected one difference for normalized rule, got: %v", divergence["Ingress-normalized"])
+	}
+	if len(divergence["Ingress-dropped"]) != 1 {
+		t.Errorf("Expected dropped rule to be reported, got: %v", divergence["Ingress-dropped"])
+	}
+}
@@ -0,0 +1,164 @@
+package sync
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/services/preview/frontdoor/mgmt/2018-08-01-preview/frontdoor"
+	"github.com/Azure/go-autorest/autorest/to"
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+)
+
+// webhookTimeout limits how long posting to the webhook can take
+const webhookTimeout = 10 * time.Second
+
+// SyncNotification is posted to the webhook after an update to Frontdoor changed routing rules
+type SyncNotification struct {
+	FrontDoor string    `json:"frontDoor"`
+	Cluster   string    `json:"cluster"`
+	SyncID    string    `json:"syncID,omitempty"`
+	Time      time.Time `json:"time"`
+	// RulesCreated and RulesUpdated are the controller's routing rules which were added or changed
+	RulesCreated []NotifiedRule `json:"rulesCreated"`
+	RulesUpdated []NotifiedRule `json:"rulesUpdated"`
+	// FrontendHostnames are the hostnames the changed rules are served on
+	FrontendHostnames []string `json:"frontendHostnames"`
+	// Ingresses are the 'namespace/name' of the ingresses whose rules changed
+	Ingresses []string `json:"ingresses"`
+}
+
+// NotifiedRule is a routing rule changed by an update
+type NotifiedRule struct {
+	Name              string   `json:"name"`
+	Ingress           string   `json:"ingress"`
+	PatternsToMatch   []string `json:"patternsToMatch"`
+	FrontendHostnames []string `json:"frontendHostnames"`
+}
+
+// newWebhook returns a func which posts the notification as JSON to the webhook URL,
+// failing on errors and non-2xx responses
+func newWebhook(config utils.Config) func(context.Context, SyncNotification) error {
+	client := &http.Client{Timeout: webhookTimeout}
+	return func(ctx context.Context, notification SyncNotification) error {
+		return postJSON(ctx, client, config.WebhookURL, notification)
+	}
+}
+
+// postJSON posts the value as JSON to the URL, failing on errors and non-2xx responses
+func postJSON(ctx context.Context, client *http.Client, url string, value interface{}) error {
+	body, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close() //nolint: errcheck
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return nil
+}
+
+// newSyncNotification describes the controller's rules which are new or differ from those in Frontdoor,
+// returning nil if none changed
+func (p *Synchronizer) newSyncNotification(ctx context.Context, fd frontdoor.FrontDoor, existing, merged []frontdoor.RoutingRule, ruleOwners map[string]string) *SyncNotification {
+	created, updated := changedRoutingRules(existing, merged, ruleOwners)
+	if len(created)+len(updated) == 0 {
+		return nil
+	}
+
+	notification := &SyncNotification{
+		FrontDoor:         to.String(fd.Name),
+		Cluster:           p.clusterName,
+		SyncID:            utils.GetSyncID(ctx),
+		RulesCreated:      []NotifiedRule{},
+		RulesUpdated:      []NotifiedRule{},
+		FrontendHostnames: []string{},
+		Ingresses:         []string{},
+	}
+	hostnames := map[string]bool{}
+	ingresses := map[string]bool{}
+	notify := func(rule frontdoor.RoutingRule) NotifiedRule {
+		notified := NotifiedRule{
+			Name:              *rule.Name,
+			Ingress:           ruleOwners[*rule.Name],
+			PatternsToMatch:   []string{},
+			FrontendHostnames: []string{},
+		}
+		ingresses[notified.Ingress] = true
+		if rule.RoutingRuleProperties == nil {
+			return notified
+		}
+		if rule.PatternsToMatch != nil {
+			notified.PatternsToMatch = *rule.PatternsToMatch
+		}
+		if rule.FrontendEndpoints != nil {
+			for _, frontend := range *rule.FrontendEndpoints {
+				if hostname := frontendHostname(fd, frontend.ID); hostname != "" {
+					notified.FrontendHostnames = append(notified.FrontendHostnames, hostname)
+					hostnames[hostname] = true
+				}
+			}
+		}
+		return notified
+	}
+	for _, rule := range created {
+		notification.RulesCreated = append(notification.RulesCreated, notify(rule))
+	}
+	for _, rule := range updated {
+		notification.RulesUpdated = append(notification.RulesUpdated, notify(rule))
+	}
+	for hostname := range hostnames {
+		notification.FrontendHostnames = append(notification.FrontendHostnames, hostname)
+	}
+	for ingress := range ingresses {
+		notification.Ingresses = append(notification.Ingresses, ingress)
+	}
+	sort.Strings(notification.FrontendHostnames)
+	sort.Strings(notification.Ingresses)
+	return notification
+}
+
+// frontendHostname returns the hostname of the Frontdoor's frontend endpoint with the ID
+func frontendHostname(fd frontdoor.FrontDoor, id *string) string {
+	if id == nil || fd.FrontendEndpoints == nil {
+		return ""
+	}
+	for _, frontend := range *fd.FrontendEndpoints {
+		if frontend.ID != nil && strings.EqualFold(*frontend.ID, *id) && frontend.FrontendEndpointProperties != nil {
+			return to.String(frontend.HostName)
+		}
+	}
+	return ""
+}
+
+// notifyWebhook posts the notification of the sync's changes to the webhook, failures are logged
+// and don't fail the sync as Frontdoor has already been updated
+func (p *Synchronizer) notifyWebhook(ctx context.Context, result *SyncResult) {
+	if p.webhook == nil || result == nil || result.notification == nil {
+		return
+	}
+	notification := *result.notification
+	notification.Time = result.Time
+
+	err := p.webhook(ctx, notification)
+	if err != nil {
+		webhookFailures.Inc()
+		utils.GetLogger(ctx).WithError(err).Warn("Failed to notify webhook of Frontdoor update")
+		return
+	}
+	utils.GetLogger(ctx).WithField("ingresses", notification.Ingresses).Debug("Notified webhook of Frontdoor update")
+}
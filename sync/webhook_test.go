@@ -0,0 +1,71 @@
+package sync
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lawrencegripper/azurefrontdooringress/utils"
+	v1beta1 "k8s.io/api/extensions/v1beta1"
+)
+
+func TestWebhookPostsNotification(t *testing.T) {
+	received := SyncNotification{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body) //nolint: errcheck
+		if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" || json.Unmarshal(body, &received) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	}))
+	defer server.Close()
+
+	webhook := newWebhook(utils.Config{WebhookURL: server.URL})
+	err := webhook(context.Background(), SyncNotification{FrontDoor: "frontdoor1", Ingresses: []string{"default/app"}})
+	if err != nil || received.FrontDoor != "frontdoor1" || len(received.Ingresses) != 1 {
+		t.Errorf("Expected the notification to be posted, got %+v error %v", received, err)
+	}
+
+	unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer unavailable.Close()
+	webhook = newWebhook(utils.Config{WebhookURL: unavailable.URL})
+	if err := webhook(context.Background(), SyncNotification{}); err == nil {
+		t.Error("Expected an error for a non-2xx response")
+	}
+}
+
+func TestSyncNotifiesWebhookOfChangedRules(t *testing.T) {
+	ctx := integrationContext(t)
+	server := newFakeFrontDoorServer(t, testIntegrationFrontDoor("cluster1"))
+	defer server.Close()
+	p := newIntegrationSynchronizer(ctx, t, server, &fakeLockService{}, "cluster1")
+	notifications := []SyncNotification{}
+	p.webhook = func(ctx context.Context, notification SyncNotification) error {
+		notifications = append(notifications, notification)
+		return nil
+	}
+
+	app := testIngress("app", "/app")
+	for i := 0; i < 2; i++ {
+		if _, err := p.Sync(ctx, []*v1beta1.Ingress{app}, nil); err != nil {
+			t.Fatalf("unexpected error: %+v", err)
+		}
+	}
+
+	if len(notifications) != 1 {
+		t.Fatalf("Expected only the sync which created the rule to notify, got %+v", notifications)
+	}
+	notification := notifications[0]
+	if len(notification.RulesCreated) != 1 || notification.RulesCreated[0].Name != routingRuleName(app) ||
+		notification.RulesCreated[0].Ingress != "default/app" || notification.RulesCreated[0].PatternsToMatch[0] != "/app" {
+		t.Errorf("Unexpected rules in notification: %+v", notification.RulesCreated)
+	}
+	if len(notification.FrontendHostnames) != 1 || notification.FrontendHostnames[0] != "fd1.azurefd.net" ||
+		notification.FrontDoor != "frontdoor1" || notification.Cluster != "cluster1" || notification.Time.IsZero() {
+		t.Errorf("Unexpected notification: %+v", notification)
+	}
+}
@@ -0,0 +1,220 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	gosync "sync"
+	"time"
+
+	logrus "github.com/sirupsen/logrus"
+)
+
+// EventField marks a log entry as a key event, such as a sync summary, drift being reverted or the
+// lock being lost. The field's value names the event, which is also sent to Application Insights
+// as a custom event so it can be alerted on.
+const EventField = "event"
+
+const (
+	// appInsightsDefaultEndpoint receives telemetry when the connection string doesn't name an endpoint
+	appInsightsDefaultEndpoint = "https://dc.services.visualstudio.com"
+	// appInsightsFlushPeriod is how often buffered log entries are sent
+	appInsightsFlushPeriod = 5 * time.Second
+	// appInsightsBatchSize is how many entries are buffered before they're sent without waiting
+	appInsightsBatchSize = 100
+	// appInsightsMaxPending limits the entries buffered while Application Insights can't be reached,
+	// further entries are dropped rather than blocking logging
+	appInsightsMaxPending = 10 * appInsightsBatchSize
+	appInsightsTimeout    = 10 * time.Second
+	appInsightsRole       = "azurefrontdooringress"
+)
+
+// appInsightsSeverity maps logrus levels to Application Insights severity levels
+var appInsightsSeverity = map[logrus.Level]int{
+	logrus.InfoLevel:  1,
+	logrus.WarnLevel:  2,
+	logrus.ErrorLevel: 3,
+	logrus.FatalLevel: 4,
+	logrus.PanicLevel: 4,
+}
+
+// appInsightsEnvelope is a telemetry item in the Application Insights ingestion format
+type appInsightsEnvelope struct {
+	Name string            `json:"name"`
+	Time string            `json:"time"`
+	IKey string            `json:"iKey"`
+	Tags map[string]string `json:"tags"`
+	Data struct {
+		BaseType string                 `json:"baseType"`
+		BaseData map[string]interface{} `json:"baseData"`
+	} `json:"data"`
+}
+
+// AppInsightsHook is a logrus hook which sends log entries at info level and above to Application
+// Insights as traces, with their fields as custom properties. Entries are batched and sent in the
+// background so logging isn't slowed down by Azure.
+type AppInsightsHook struct {
+	instrumentationKey string
+	endpoint           string
+	roleInstance       string
+	client             *http.Client
+
+	mu      gosync.Mutex
+	pending []appInsightsEnvelope
+	dropped int
+}
+
+// NewAppInsightsHook creates a hook sending to the Application Insights resource in the connection string,
+// or instrumentation key, and starts sending its buffered entries periodically
+func NewAppInsightsHook(connectionString string) (*AppInsightsHook, error) {
+	instrumentationKey, endpoint, err := parseAppInsightsConnectionString(connectionString)
+	if err != nil {
+		return nil, err
+	}
+	hostname, _ := os.Hostname() //nolint: errcheck
+	hook := &AppInsightsHook{
+		instrumentationKey: instrumentationKey,
+		endpoint:           endpoint,
+		roleInstance:       hostname,
+		client:             &http.Client{Timeout: appInsightsTimeout},
+	}
+	go func() {
+		for range time.Tick(appInsightsFlushPeriod) {
+			hook.Flush()
+		}
+	}()
+	return hook, nil
+}
+
+// parseAppInsightsConnectionString returns the instrumentation key and ingestion endpoint from a
+// connection string such as 'InstrumentationKey=<guid>;IngestionEndpoint=https://...', a bare
+// instrumentation key is also accepted
+func parseAppInsightsConnectionString(connectionString string) (string, string, error) {
+	instrumentationKey, endpoint := "", appInsightsDefaultEndpoint
+	if !strings.Contains(connectionString, "=") {
+		instrumentationKey = connectionString
+	}
+	for _, part := range strings.Split(connectionString, ";") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch strings.ToLower(strings.TrimSpace(kv[0])) {
+		case "instrumentationkey":
+			instrumentationKey = strings.TrimSpace(kv[1])
+		case "ingestionendpoint":
+			endpoint = strings.TrimSuffix(strings.TrimSpace(kv[1]), "/")
+		}
+	}
+	if !subscriptionIDRegex.MatchString(instrumentationKey) {
+		return "", "", fmt.Errorf("instrumentation key %q must be a GUID", instrumentationKey)
+	}
+	if !strings.HasPrefix(endpoint, "https://") {
+		return "", "", fmt.Errorf("ingestion endpoint %q must be an https URL", endpoint)
+	}
+	return instrumentationKey, endpoint, nil
+}
+
+// Levels returns the levels sent, debug logs such as API calls are too verbose to ship
+func (h *AppInsightsHook) Levels() []logrus.Level {
+	return []logrus.Level{logrus.PanicLevel, logrus.FatalLevel, logrus.ErrorLevel, logrus.WarnLevel, logrus.InfoLevel}
+}
+
+// Fire buffers the entry as a trace, and a custom event if it has an EventField. Fatal and panic
+// entries are sent immediately as the process is about to exit.
+func (h *AppInsightsHook) Fire(entry *logrus.Entry) error {
+	properties := map[string]string{}
+	for key, value := range entry.Data {
+		if err, ok := value.(error); ok {
+			properties[key] = err.Error()
+			continue
+		}
+		properties[key] = fmt.Sprint(value)
+	}
+
+	envelopes := []appInsightsEnvelope{h.envelope(entry, "Message", "MessageData", map[string]interface{}{
+		"ver":           2,
+		"message":       entry.Message,
+		"severityLevel": appInsightsSeverity[entry.Level],
+		"properties":    properties,
+	})}
+	if event, ok := entry.Data[EventField].(string); ok && event != "" {
+		envelopes = append(envelopes, h.envelope(entry, "Event", "EventData", map[string]interface{}{
+			"ver":        2,
+			"name":       event,
+			"properties": properties,
+		}))
+	}
+
+	h.mu.Lock()
+	if len(h.pending)+len(envelopes) > appInsightsMaxPending {
+		h.dropped += len(envelopes)
+	} else {
+		h.pending = append(h.pending, envelopes...)
+	}
+	flush := len(h.pending) >= appInsightsBatchSize || entry.Level <= logrus.FatalLevel
+	h.mu.Unlock()
+
+	if flush {
+		h.Flush()
+	}
+	return nil
+}
+
+// envelope wraps the telemetry data, the sync ID is sent as the operation ID so every entry
+// for a sync cycle can be queried together
+func (h *AppInsightsHook) envelope(entry *logrus.Entry, telemetryType, baseType string, baseData map[string]interface{}) appInsightsEnvelope {
+	envelope := appInsightsEnvelope{
+		Name: fmt.Sprintf("Microsoft.ApplicationInsights.%s.%s", strings.Replace(h.instrumentationKey, "-", "", -1), telemetryType),
+		Time: entry.Time.UTC().Format(time.RFC3339Nano),
+		IKey: h.instrumentationKey,
+		Tags: map[string]string{
+			"ai.cloud.role":         appInsightsRole,
+			"ai.cloud.roleInstance": h.roleInstance,
+			"ai.application.ver":    Version,
+		},
+	}
+	if syncID, ok := entry.Data["syncID"].(string); ok {
+		envelope.Tags["ai.operation.id"] = syncID
+	}
+	envelope.Data.BaseType = baseType
+	envelope.Data.BaseData = baseData
+	return envelope
+}
+
+// Flush sends the buffered entries. Failures are written to stderr, not logged, as logging
+// them would be sent back through the hook.
+func (h *AppInsightsHook) Flush() {
+	h.mu.Lock()
+	pending, dropped := h.pending, h.dropped
+	h.pending, h.dropped = nil, 0
+	h.mu.Unlock()
+	if dropped > 0 {
+		fmt.Fprintf(os.Stderr, "Dropped %d log entries as Application Insights couldn't keep up\n", dropped)
+	}
+	if len(pending) == 0 {
+		return
+	}
+
+	// The ingestion API accepts newline delimited JSON
+	body := &bytes.Buffer{}
+	encoder := json.NewEncoder(body)
+	for _, envelope := range pending {
+		if err := encoder.Encode(envelope); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to encode log entry for Application Insights: %v\n", err)
+			return
+		}
+	}
+	resp, err := h.client.Post(h.endpoint+"/v2/track", "application/x-json-stream", body)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to send %d log entries to Application Insights: %v\n", len(pending), err)
+		return
+	}
+	resp.Body.Close() //nolint: errcheck
+	if resp.StatusCode != http.StatusOK {
+		fmt.Fprintf(os.Stderr, "Failed to send %d log entries to Application Insights: %s\n", len(pending), resp.Status)
+	}
+}
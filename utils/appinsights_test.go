@@ -0,0 +1,91 @@
+package utils
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	logrus "github.com/sirupsen/logrus"
+)
+
+func TestParseAppInsightsConnectionString(t *testing.T) {
+	testCases := map[string]struct {
+		key      string
+		endpoint string
+	}{
+		"33333333-3333-3333-3333-333333333333": {"33333333-3333-3333-3333-333333333333", appInsightsDefaultEndpoint},
+		"InstrumentationKey=33333333-3333-3333-3333-333333333333;IngestionEndpoint=https://westeurope-1.in.applicationinsights.azure.com/": {
+			"33333333-3333-3333-3333-333333333333", "https://westeurope-1.in.applicationinsights.azure.com",
+		},
+	}
+	for connectionString, expected := range testCases {
+		key, endpoint, err := parseAppInsightsConnectionString(connectionString)
+		if err != nil || key != expected.key || endpoint != expected.endpoint {
+			t.Errorf("Expected %q to be key %q endpoint %q, got %q %q error %v", connectionString, expected.key, expected.endpoint, key, endpoint, err)
+		}
+	}
+
+	for _, invalid := range []string{"", "not-a-key", "InstrumentationKey=33333333-3333-3333-3333-333333333333;IngestionEndpoint=http://localhost"} {
+		if _, _, err := parseAppInsightsConnectionString(invalid); err == nil {
+			t.Errorf("Expected %q to be rejected", invalid)
+		}
+	}
+}
+
+func TestAppInsightsHookSendsTracesAndEvents(t *testing.T) {
+	received := []appInsightsEnvelope{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v2/track" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			envelope := appInsightsEnvelope{}
+			if err := json.Unmarshal(scanner.Bytes(), &envelope); err != nil {
+				t.Errorf("Failed to decode envelope: %v", err)
+			}
+			received = append(received, envelope)
+		}
+	}))
+	defer server.Close()
+	hook := &AppInsightsHook{
+		instrumentationKey: "33333333-3333-3333-3333-333333333333",
+		endpoint:           server.URL,
+		client:             server.Client(),
+	}
+
+	logger := logrus.New()
+	logger.AddHook(hook)
+	logger.WithField("syncID", "0f39878c-5f76-4db8-a25d-61d2c193c3ca").WithError(errors.New("lease expired")).WithField(EventField, "LockLost").Warn("Lost the Frontdoor lock")
+	logger.Debug("Not sent")
+	if len(received) != 0 {
+		t.Errorf("Expected entries to be buffered until flushed, got %+v", received)
+	}
+	hook.Flush()
+
+	if len(received) != 2 {
+		t.Fatalf("Expected a trace and an event, got %+v", received)
+	}
+	trace, event := received[0], received[1]
+	if trace.Data.BaseType != "MessageData" || trace.Data.BaseData["message"] != "Lost the Frontdoor lock" || trace.Data.BaseData["severityLevel"] != float64(2) {
+		t.Errorf("Unexpected trace %+v", trace)
+	}
+	if properties, ok := trace.Data.BaseData["properties"].(map[string]interface{}); !ok || properties["error"] != "lease expired" {
+		t.Errorf("Expected the entry's fields as properties, got %+v", trace.Data.BaseData["properties"])
+	}
+	if trace.Tags["ai.operation.id"] != "0f39878c-5f76-4db8-a25d-61d2c193c3ca" {
+		t.Errorf("Expected the sync ID as the operation ID, got %v", trace.Tags)
+	}
+	if event.Data.BaseType != "EventData" || event.Data.BaseData["name"] != "LockLost" ||
+		event.Name != "Microsoft.ApplicationInsights.33333333333333333333333333333333.Event" {
+		t.Errorf("Unexpected event %+v", event)
+	}
+	if _, err := time.Parse(time.RFC3339Nano, event.Time); err != nil {
+		t.Errorf("Expected an RFC3339 time, got %q", event.Time)
+	}
+}
@@ -1,16 +1,382 @@
 package utils
 
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
 // Config provides the setup used by the Frontdoor provider
 type Config struct {
-	ResourceGroupName      string
-	FrontDoorName          string
-	FrontDoorHostname      string
-	ClusterName            string
-	BackendPoolName        string
-	PrimaryIngressPublicIP string
-	SubscriptionID         string
-	KubernetesNamespace    string
-	DebugAPICalls          bool
-	StorageAccountURL      string
-	StorageAccountKey      string
+	ResourceGroupName                   string
+	FrontDoorName                       string
+	FrontDoorHostname                   string
+	ClusterName                         string
+	BackendPoolName                     string
+	PrimaryIngressPublicIP              string
+	SubscriptionID                      string
+	KubernetesNamespace                 string
+	DebugAPICalls                       bool
+	StorageAccountURL                   string
+	StorageAccountKey                   string
+	MetricsAddress                      string
+	AuthFileLocation                    string
+	UseDeviceCode                       bool
+	SyncDebounce                        time.Duration
+	OwnershipMode                       string
+	BackendPoolPerNamespace             bool
+	SnapshotLocation                    string
+	SnapshotRetention                   int
+	RollbackProbeWindow                 time.Duration
+	RollbackProbePath                   string
+	CustomDomains                       bool
+	MinimumTLSVersion                   string
+	FrontDoorID                         string
+	AccessRestrictionConfigMap          string
+	ServiceTagsConfigMap                string
+	ServiceTagsLoadBalancerSourceRanges bool
+	APIRecordMode                       string
+	APIRecordingDir                     string
+	WriteIngressStatus                  bool
+	BackendPriority                     int
+	LockHistory                         bool
+	LockGCAfter                         time.Duration
+	// LockAlertAfter is how long acquiring the Frontdoor lock must fail for before it's alerted on,
+	// zero disables the alert
+	LockAlertAfter time.Duration
+	// LockAlertWebhookURL is posted an alert when the lock can't be acquired for LockAlertAfter
+	LockAlertWebhookURL string
+	// ConcurrentReconciles is how many namespaces' routing rules are generated at once
+	ConcurrentReconciles int
+	// WebhookURL is posted the routing rules changed by each update to Frontdoor
+	WebhookURL string
+	// AdminAddress is where the admin API is served, it's disabled if empty
+	AdminAddress string
+	AdminToken   string
+	// AdditionalFrontDoors are other Front Doors, in the same resource group, synced
+	// with the same ingresses, each given as 'name=hostname'
+	AdditionalFrontDoors []string
+	// AllowedAnnotations are the frontdoor annotations ingresses may use, all are allowed if empty
+	AllowedAnnotations []string
+	// IMDSResourceGroup defaults the resource group to that of the VM the controller runs on
+	IMDSResourceGroup bool
+	// PublicIPProbeURL responds with the cluster's public IP, used when no service is annotated
+	PublicIPProbeURL string
+	// AuthoritativeCluster is the only cluster allowed to delete state shared with other clusters,
+	// every cluster is if it's empty
+	AuthoritativeCluster string
+	// StorageSubscriptionID and StorageResourceGroupName locate the storage account so its key can be
+	// listed when StorageAccountKey isn't set, optionally with its own service principal
+	StorageSubscriptionID    string
+	StorageResourceGroupName string
+	StorageClientID          string
+	StorageClientSecret      string
+	StorageTenantID          string
+	// FrontDoorSubscriptionID is the Frontdoor's subscription when it differs from the cluster's, the
+	// Frontdoor can also be managed with its own service principal, for example in another tenant
+	FrontDoorSubscriptionID string
+	FrontDoorClientID       string
+	FrontDoorClientSecret   string
+	FrontDoorTenantID       string
+	// BackendHealthInterval is how often Frontdoor's health probe results are read, disabled if zero
+	BackendHealthInterval time.Duration
+	// AppInsightsConnectionString sends logs to Application Insights when it's set
+	AppInsightsConnectionString string
+	// DefaultRoute adds, or removes, a catch-all route to the cluster's pool
+	DefaultRoute string
+	// DifferentialUpdates sends only the changed backend pools and routing rules rather than
+	// replacing the whole Frontdoor when nothing else changed
+	DifferentialUpdates bool
+	// UnusedFrontendGracePeriod is how long a frontend endpoint created for a custom domain is kept
+	// once no ingress uses it, they're never removed if it's zero
+	UnusedFrontendGracePeriod time.Duration
+	// StaticRoutes are routing rules managed alongside those of the ingresses, each given as
+	// 'name=backendPool:/path|/path'
+	StaticRoutes []string
+	// WaitForReadyEndpoints holds back routing a new ingress through Frontdoor until its services
+	// have ready endpoints
+	WaitForReadyEndpoints bool
+	// DisableUnreadyRoutesAfter is how long a service can have no ready endpoints before the routes
+	// to it are disabled, until it recovers, they're never disabled if it's zero
+	DisableUnreadyRoutesAfter time.Duration
+	// KubernetesAPIQPS and KubernetesAPIBurst rate limit requests to the Kubernetes API server,
+	// client-go's defaults are used if they're zero
+	KubernetesAPIQPS   int
+	KubernetesAPIBurst int
+	// RuleRegistry records the routing rules generated for each ingress, by UID, in the storage account
+	// so those no longer generated, such as for a deleted ingress, are removed
+	RuleRegistry bool
+	// SyncStrategy is whether syncs prune the controller's routing rules, 'replace', or never delete
+	// them, 'merge', when empty only the rules described by the other settings are removed
+	SyncStrategy string
+	// FrontendProtocols are the protocols, 'Http' and 'Https', the controller's routing rules accept
+	// from clients, both if empty
+	FrontendProtocols []string
+	// RouteVerificationWindow is how long the paths newly routed by a sync are requested through the
+	// Frontdoor hostname until they answer, they aren't requested if it's zero
+	RouteVerificationWindow time.Duration
+	// AwaitPropagationTimeout is how long a sync waits for the paths it newly routed to answer through
+	// the Frontdoor hostname before it's reported as successful, it doesn't wait if it's zero
+	AwaitPropagationTimeout time.Duration
+	// PodName is the pod the controller is running in, identifying the instance which made a change
+	PodName string
+	// LockingMode is how syncs are kept from overwriting each other, 'storage' leases a blob in the
+	// storage account and 'none' only detects changes made to the Frontdoor while a sync was running
+	LockingMode string
+}
+
+// StaticRoute is a routing rule declared in the config rather than by an ingress, for endpoints which
+// only exist at the edge such as a maintenance page
+type StaticRoute struct {
+	Name        string
+	BackendPool string
+	Paths       []string
+}
+
+// annotationPrefix starts the name of every frontdoor annotation which can be set on an ingress
+const annotationPrefix = "azure/frontdoor-"
+
+// Ownership modes control how the controller handles changes made outside it to the rules it created
+const (
+	// OwnershipModeStrict reverts changes made outside the controller
+	OwnershipModeStrict = "strict"
+	// OwnershipModeMerge leaves fields changed outside the controller alone
+	OwnershipModeMerge = "merge"
+)
+
+// Sync strategies control which of the controller's routing rules a sync deletes
+const (
+	// SyncStrategyReplace removes every rule the controller named which no existing ingress generates
+	SyncStrategyReplace = "replace"
+	// SyncStrategyMerge only adds and updates rules, never deleting any
+	SyncStrategyMerge = "merge"
+)
+
+// Locking modes control how a controller stops other controllers updating the Frontdoor while it syncs
+const (
+	// LockingModeStorage leases a blob in the storage account for the duration of each sync
+	LockingModeStorage = "storage"
+	// LockingModeNone takes no lock, for a single cluster running one replica, so no storage account is needed
+	LockingModeNone = "none"
+)
+
+// Frontdoor only sends traffic to backends with a lower priority when all those with a higher priority are unhealthy
+const (
+	// MinBackendPriority is the highest priority a backend can have
+	MinBackendPriority = 1
+	// MaxBackendPriority is the lowest priority a backend can have
+	MaxBackendPriority = 5
+)
+
+// Default route settings control the catch-all route to the cluster's backend pool, it's left alone if neither is set
+const (
+	// DefaultRouteEnabled routes paths no ingress matches to the cluster
+	DefaultRouteEnabled = "enabled"
+	// DefaultRouteDisabled removes the route so Frontdoor returns 404 for paths no ingress matches
+	DefaultRouteDisabled = "disabled"
+)
+
+// SnapshotLocationBlob stores snapshots in the storage account used for locking,
+// any other non-empty snapshot location is a local directory
+const SnapshotLocationBlob = "blob"
+
+// DefaultSnapshotRetention is the number of snapshots kept for each Frontdoor unless another is set
+const DefaultSnapshotRetention = 100
+
+// API record modes save responses from the Frontdoor API or answer requests with saved responses
+const (
+	// APIRecordModeRecord saves every response to the recording directory
+	APIRecordModeRecord = "record"
+	// APIRecordModeReplay answers requests from the recording directory without calling Azure
+	APIRecordModeReplay = "replay"
+)
+
+// FrontDoorSubscription returns the subscription of the Frontdoor, AZURE_SUBSCRIPTION_ID unless one is configured
+func (c Config) FrontDoorSubscription() string {
+	if c.FrontDoorSubscriptionID != "" {
+		return c.FrontDoorSubscriptionID
+	}
+	return c.SubscriptionID
+}
+
+// StorageSubscription returns the subscription of the storage account, AZURE_SUBSCRIPTION_ID unless one is configured
+func (c Config) StorageSubscription() string {
+	if c.StorageSubscriptionID != "" {
+		return c.StorageSubscriptionID
+	}
+	return c.SubscriptionID
+}
+
+// Authoritative returns true if the cluster may delete state shared with other clusters
+func (c Config) Authoritative() bool {
+	return c.AuthoritativeCluster == "" || c.AuthoritativeCluster == c.ClusterName
+}
+
+// Namespaces returns the namespaces the controller watches, KubernetesNamespace is a comma
+// separated list and if it's empty a single empty namespace, meaning every namespace, is returned
+func (c Config) Namespaces() []string {
+	namespaces := []string{}
+	for _, namespace := range strings.Split(c.KubernetesNamespace, ",") {
+		if namespace = strings.TrimSpace(namespace); namespace != "" {
+			namespaces = append(namespaces, namespace)
+		}
+	}
+	if len(namespaces) == 0 {
+		return []string{""}
+	}
+	return namespaces
+}
+
+// FrontDoors returns a config for each Front Door the controller syncs, the configured
+// Front Door followed by each of the additional Front Doors
+func (c Config) FrontDoors() []Config {
+	additional := c.AdditionalFrontDoors
+	c.AdditionalFrontDoors = nil
+	configs := []Config{c}
+	for _, frontDoor := range additional {
+		name, hostname, ok := parseAdditionalFrontDoor(frontDoor)
+		if !ok {
+			continue
+		}
+		fdConfig := c
+		fdConfig.FrontDoorName = name
+		fdConfig.FrontDoorHostname = hostname
+		configs = append(configs, fdConfig)
+	}
+	return configs
+}
+
+// frontendProtocols are the protocols a routing rule can accept, in the case Frontdoor uses
+var frontendProtocols = []string{"Http", "Https"}
+
+// AcceptedProtocols returns the protocols the controller's routing rules accept, in the case Frontdoor
+// uses, leaving out any which aren't valid. Both are accepted if none are configured.
+func (c Config) AcceptedProtocols() []string {
+	accepted := []string{}
+	for _, protocol := range frontendProtocols {
+		for _, value := range c.FrontendProtocols {
+			if strings.EqualFold(value, protocol) {
+				accepted = append(accepted, protocol)
+				break
+			}
+		}
+	}
+	if len(accepted) == 0 {
+		return frontendProtocols
+	}
+	return accepted
+}
+
+// NeedsStorageAccount returns true if the locking mode or a feature which keeps blobs needs the storage account
+func (c Config) NeedsStorageAccount() bool {
+	return c.LockingMode != LockingModeNone || c.LockHistory || c.RuleRegistry || c.SnapshotLocation == SnapshotLocationBlob
+}
+
+// Identity identifies the instance of the controller, '<cluster>/<pod>@<version>', so changes it makes
+// to a shared Frontdoor can be attributed to it
+func (c Config) Identity() string {
+	pod := c.PodName
+	if pod == "" {
+		pod = "unknown"
+	}
+	return fmt.Sprintf("%s/%s@%s", c.ClusterName, pod, Version)
+}
+
+// ParsedStaticRoutes returns the static routes, leaving out any which can't be parsed
+func (c Config) ParsedStaticRoutes() []StaticRoute {
+	routes := []StaticRoute{}
+	for _, value := range c.StaticRoutes {
+		if route, ok := parseStaticRoute(value); ok {
+			routes = append(routes, route)
+		}
+	}
+	return routes
+}
+
+// parseStaticRoute splits a 'name=backendPool:/path|/path' static route
+func parseStaticRoute(value string) (StaticRoute, bool) {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return StaticRoute{}, false
+	}
+	target := strings.SplitN(parts[1], ":", 2)
+	if len(target) != 2 || target[0] == "" {
+		return StaticRoute{}, false
+	}
+	route := StaticRoute{Name: parts[0], BackendPool: target[0], Paths: []string{}}
+	for _, path := range strings.Split(target[1], "|") {
+		if path = strings.TrimSpace(path); path != "" {
+			route.Paths = append(route.Paths, path)
+		}
+	}
+	return route, len(route.Paths) > 0
+}
+
+// parseAdditionalFrontDoor splits a 'name=hostname' additional Front Door
+func parseAdditionalFrontDoor(value string) (string, string, bool) {
+	parts := strings.Split(value, "=")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
+
+// configAlias has the same fields as Config but none of its methods
+// so it can be formatted without recursing into String/MarshalJSON
+type configAlias Config
+
+const redactedValue = "REDACTED"
+
+// Redacted returns a copy of the config with secrets removed, safe for logging
+func (c Config) Redacted() Config {
+	if c.StorageAccountKey != "" {
+		c.StorageAccountKey = redactedValue
+	}
+	if c.AdminToken != "" {
+		c.AdminToken = redactedValue
+	}
+	if c.StorageClientSecret != "" {
+		c.StorageClientSecret = redactedValue
+	}
+	if c.FrontDoorClientSecret != "" {
+		c.FrontDoorClientSecret = redactedValue
+	}
+	// The instrumentation key allows anyone to send telemetry to the Application Insights resource
+	if c.AppInsightsConnectionString != "" {
+		c.AppInsightsConnectionString = redactedValue
+	}
+	// Webhook URLs often carry a token, such as chat webhooks
+	if c.WebhookURL != "" {
+		c.WebhookURL = redactedValue
+	}
+	if c.LockAlertWebhookURL != "" {
+		c.LockAlertWebhookURL = redactedValue
+	}
+	return c
+}
+
+// RedactSecrets replaces the values of the settings Redacted removes wherever they appear in the
+// text, such as logs collected for a support bundle
+func (c Config) RedactSecrets(text []byte) []byte {
+	original, redacted := reflect.ValueOf(c), reflect.ValueOf(c.Redacted())
+	for i := 0; i < original.NumField(); i++ {
+		value, ok := original.Field(i).Interface().(string)
+		if ok && value != "" && value != redacted.Field(i).Interface() {
+			text = bytes.Replace(text, []byte(value), []byte(redactedValue), -1)
+		}
+	}
+	return text
+}
+
+// String formats the config with secrets redacted
+func (c Config) String() string {
+	return fmt.Sprintf("%+v", configAlias(c.Redacted()))
+}
+
+// MarshalJSON marshals the config with secrets redacted
+func (c Config) MarshalJSON() ([]byte, error) {
+	return json.Marshal(configAlias(c.Redacted()))
 }
@@ -0,0 +1,380 @@
+package utils
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfigRedactsSecrets(t *testing.T) {
+	config := Config{
+		FrontDoorName:               "myfrontdoor",
+		StorageAccountKey:           "c2VjcmV0a2V5",
+		AdminToken:                  "YWRtaW50b2tlbg",
+		WebhookURL:                  "https://hooks.example.com/c2VjcmV0cGF0aA",
+		StorageClientSecret:         "c3RvcmFnZXNlY3JldA",
+		FrontDoorClientSecret:       "ZnJvbnRkb29yc2VjcmV0",
+		AppInsightsConnectionString: "InstrumentationKey=33333333-3333-3333-3333-333333333333",
+	}
+
+	jsonBytes, err := json.Marshal(config)
+	if err != nil {
+		t.Fatalf("unexpected error: %+v", err)
+	}
+
+	outputs := map[string]string{
+		"String":      config.String(),
+		"Sprint":      fmt.Sprint(config),
+		"MarshalJSON": string(jsonBytes),
+		// Logged values, as collected by a support bundle
+		"RedactSecrets": string(config.RedactSecrets([]byte(strings.Join([]string{config.FrontDoorName, config.StorageAccountKey,
+			config.AdminToken, config.WebhookURL, config.StorageClientSecret, config.FrontDoorClientSecret, config.AppInsightsConnectionString}, " ")))),
+	}
+	for name, output := range outputs {
+		if strings.Contains(output, config.StorageAccountKey) {
+			t.Errorf("%s output contains the storage account key: %s", name, output)
+		}
+		if strings.Contains(output, config.AdminToken) {
+			t.Errorf("%s output contains the admin token: %s", name, output)
+		}
+		if strings.Contains(output, config.WebhookURL) {
+			t.Errorf("%s output contains the webhook URL: %s", name, output)
+		}
+		if strings.Contains(output, config.StorageClientSecret) {
+			t.Errorf("%s output contains the storage client secret: %s", name, output)
+		}
+		if strings.Contains(output, config.FrontDoorClientSecret) {
+			t.Errorf("%s output contains the Front Door client secret: %s", name, output)
+		}
+		if strings.Contains(output, "33333333-3333-3333-3333-333333333333") {
+			t.Errorf("%s output contains the Application Insights instrumentation key: %s", name, output)
+		}
+		if !strings.Contains(output, "myfrontdoor") || !strings.Contains(output, redactedValue) {
+			t.Errorf("%s output missing expected fields: %s", name, output)
+		}
+	}
+
+	if config.StorageAccountKey != "c2VjcmV0a2V5" {
+		t.Error("Redaction modified the original config")
+	}
+}
+
+func TestConfigValidate(t *testing.T) {
+	validConfig := Config{
+		SubscriptionID:       "00000000-0000-0000-0000-000000000000",
+		ResourceGroupName:    "my-rg",
+		FrontDoorName:        "myfrontdoor",
+		FrontDoorHostname:    "myfrontdoor.azurefd.net",
+		ClusterName:          "cluster1",
+		StorageAccountURL:    "https://mystorage.blob.core.windows.net",
+		StorageAccountKey:    "c2VjcmV0a2V5",
+		OwnershipMode:        OwnershipModeStrict,
+		BackendPriority:      1,
+		ConcurrentReconciles: 1,
+	}
+
+	testCases := []struct {
+		name             string
+		mutate           func(*Config)
+		expectedSettings []string
+	}{
+		{
+			name:   "valid",
+			mutate: func(c *Config) {},
+		},
+		{
+			name:             "missing required",
+			mutate:           func(c *Config) { c.ClusterName = ""; c.StorageAccountKey = "" },
+			expectedSettings: []string{"CLUSTER_NAME", "STORAGE_ACCOUNT_KEY"},
+		},
+		{
+			name: "no storage account without locking",
+			mutate: func(c *Config) {
+				c.LockingMode = LockingModeNone
+				c.StorageAccountURL, c.StorageAccountKey = "", ""
+			},
+			expectedSettings: []string{},
+		},
+		{
+			name: "storage account needed by features without locking",
+			mutate: func(c *Config) {
+				c.LockingMode = LockingModeNone
+				c.StorageAccountURL, c.StorageAccountKey = "", ""
+				c.RuleRegistry, c.LockHistory = true, true
+			},
+			expectedSettings: []string{"STORAGE_ACCOUNT_URL", "STORAGE_ACCOUNT_KEY", "LOCK_HISTORY"},
+		},
+		{
+			name:             "invalid locking mode",
+			mutate:           func(c *Config) { c.LockingMode = "lease" },
+			expectedSettings: []string{"LOCKING_MODE"},
+		},
+		{
+			name: "invalid lock alert",
+			mutate: func(c *Config) {
+				c.LockAlertAfter = -time.Minute
+				c.LockAlertWebhookURL = "alerts.example.com"
+			},
+			expectedSettings: []string{"LOCK_ALERT_AFTER", "LOCK_ALERT_WEBHOOK_URL"},
+		},
+		{
+			name: "invalid formats",
+			mutate: func(c *Config) {
+				c.SubscriptionID = "not-a-guid"
+				c.StorageAccountURL = "http://mystorage.blob.core.windows.net/container"
+				c.FrontDoorName = "fd_1"
+				c.MetricsAddress = "8080"
+				c.MinimumTLSVersion = "1.1"
+				c.BackendPriority = 6
+			},
+			expectedSettings: []string{"AZURE_SUBSCRIPTION_ID", "STORAGE_ACCOUNT_URL", "AZURE_FRONTDOOR_NAME", "METRICS_ADDRESS", "MINIMUM_TLS_VERSION", "BACKEND_PRIORITY"},
+		},
+		{
+			name:             "negative snapshot retention",
+			mutate:           func(c *Config) { c.SnapshotRetention = -1 },
+			expectedSettings: []string{"SNAPSHOT_RETENTION"},
+		},
+		{
+			name:             "concurrent reconciles in a single namespace",
+			mutate:           func(c *Config) { c.ConcurrentReconciles = 4; c.KubernetesNamespace = "default" },
+			expectedSettings: []string{"CONCURRENT_RECONCILES"},
+		},
+		{
+			name:             "concurrent reconciles in several namespaces",
+			mutate:           func(c *Config) { c.ConcurrentReconciles = 4; c.KubernetesNamespace = "team-a,team-b" },
+			expectedSettings: []string{},
+		},
+		{
+			name:             "invalid and repeated namespaces",
+			mutate:           func(c *Config) { c.KubernetesNamespace = "team-a,Team_B,team-a" },
+			expectedSettings: []string{"KUBERNETES_NAMESPACE"},
+		},
+		{
+			name:             "storage key listed from resource group",
+			mutate:           func(c *Config) { c.StorageAccountKey = ""; c.StorageResourceGroupName = "locks-rg" },
+			expectedSettings: []string{},
+		},
+		{
+			name: "invalid storage account location",
+			mutate: func(c *Config) {
+				c.StorageSubscriptionID = "locks"
+				c.StorageResourceGroupName = "locks-rg."
+				c.StorageClientID = "11111111-1111-1111-1111-111111111111"
+			},
+			expectedSettings: []string{"STORAGE_AZURE_SUBSCRIPTION_ID", "STORAGE_AZURE_RESOURCE_GROUP_NAME", "STORAGE_AZURE_CLIENT_ID"},
+		},
+		{
+			name: "invalid Front Door credentials",
+			mutate: func(c *Config) {
+				c.FrontDoorSubscriptionID = "frontdoor"
+				c.FrontDoorClientID = "11111111-1111-1111-1111-111111111111"
+				c.FrontDoorTenantID = "22222222-2222-2222-2222-222222222222"
+			},
+			expectedSettings: []string{"FRONTDOOR_AZURE_SUBSCRIPTION_ID", "FRONTDOOR_AZURE_CLIENT_ID"},
+		},
+		{
+			name: "Application Insights connection string without instrumentation key",
+			mutate: func(c *Config) {
+				c.AppInsightsConnectionString = "IngestionEndpoint=https://westeurope-1.in.applicationinsights.azure.com/"
+			},
+			expectedSettings: []string{"APPLICATIONINSIGHTS_CONNECTION_STRING"},
+		},
+		{
+			name:             "invalid default route",
+			mutate:           func(c *Config) { c.DefaultRoute = "true" },
+			expectedSettings: []string{"DEFAULT_ROUTE"},
+		},
+		{
+			name:             "negative route verification window",
+			mutate:           func(c *Config) { c.RouteVerificationWindow = -time.Minute },
+			expectedSettings: []string{"ROUTE_VERIFICATION_WINDOW"},
+		},
+		{
+			name:             "negative await propagation timeout",
+			mutate:           func(c *Config) { c.AwaitPropagationTimeout = -time.Minute },
+			expectedSettings: []string{"AWAIT_PROPAGATION_TIMEOUT"},
+		},
+		{
+			name:             "invalid frontend protocol",
+			mutate:           func(c *Config) { c.FrontendProtocols = []string{"Https", "Http2"} },
+			expectedSettings: []string{"FRONTEND_PROTOCOLS"},
+		},
+		{
+			name:             "invalid sync strategy",
+			mutate:           func(c *Config) { c.SyncStrategy = "prune" },
+			expectedSettings: []string{"SYNC_STRATEGY"},
+		},
+		{
+			name:             "backend health read too often",
+			mutate:           func(c *Config) { c.BackendHealthInterval = 30 * time.Second },
+			expectedSettings: []string{"BACKEND_HEALTH_INTERVAL"},
+		},
+		{
+			name:             "static routes",
+			mutate:           func(c *Config) { c.StaticRoutes = []string{"maintenance=maintenance-pool:/maintenance/*|/status"} },
+			expectedSettings: []string{},
+		},
+		{
+			name: "invalid static routes",
+			mutate: func(c *Config) {
+				c.StaticRoutes = []string{"maintenance=pool:maintenance", "maintenance=pool:/a", "no-pool:/a"}
+			},
+			expectedSettings: []string{"STATIC_ROUTES"},
+		},
+		{
+			name:             "unused frontend grace period without custom domains",
+			mutate:           func(c *Config) { c.UnusedFrontendGracePeriod = time.Hour },
+			expectedSettings: []string{"UNUSED_FRONTEND_GRACE_PERIOD"},
+		},
+		{
+			name:             "negative unready routes period",
+			mutate:           func(c *Config) { c.DisableUnreadyRoutesAfter = -time.Minute },
+			expectedSettings: []string{"DISABLE_UNREADY_ROUTES_AFTER"},
+		},
+		{
+			name:             "Kubernetes API burst below QPS",
+			mutate:           func(c *Config) { c.KubernetesAPIQPS, c.KubernetesAPIBurst = 20, 10 },
+			expectedSettings: []string{"KUBERNETES_API_BURST"},
+		},
+		{
+			name:             "admin API without token",
+			mutate:           func(c *Config) { c.AdminAddress = ":8081" },
+			expectedSettings: []string{"ADMIN_TOKEN"},
+		},
+		{
+			name:             "additional frontdoors",
+			mutate:           func(c *Config) { c.AdditionalFrontDoors = []string{"otherfrontdoor=other.azurefd.net"} },
+			expectedSettings: []string{},
+		},
+		{
+			name:             "invalid additional frontdoors",
+			mutate:           func(c *Config) { c.AdditionalFrontDoors = []string{"myfrontdoor=other.azurefd.net", "no-hostname"} },
+			expectedSettings: []string{"ADDITIONAL_FRONTDOORS"},
+		},
+		{
+			name: "allowed annotations",
+			mutate: func(c *Config) {
+				c.AllowedAnnotations = []string{"azure/frontdoor-exclude-paths", "nginx.ingress.kubernetes.io/rewrite-target"}
+			},
+			expectedSettings: []string{"ALLOWED_ANNOTATIONS"},
+		},
+	}
+
+	for _, test := range testCases {
+		test := test
+		t.Run(test.name, func(t *testing.T) {
+			config := validConfig
+			test.mutate(&config)
+			err := config.Validate()
+
+			if len(test.expectedSettings) == 0 {
+				if err != nil {
+					t.Errorf("Expected no error, got: %+v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatal("Expected error, got nil")
+			}
+			for _, setting := range test.expectedSettings {
+				if !strings.Contains(err.Error(), setting) {
+					t.Errorf("Expected error to name %s, got: %v", setting, err)
+				}
+			}
+		})
+	}
+}
+
+func TestConfigFrontDoors(t *testing.T) {
+	config := Config{
+		FrontDoorName:        "myfrontdoor",
+		FrontDoorHostname:    "myfrontdoor.azurefd.net",
+		ClusterName:          "cluster1",
+		AdditionalFrontDoors: []string{"otherfrontdoor=other.azurefd.net"},
+	}
+
+	frontDoors := config.FrontDoors()
+
+	if len(frontDoors) != 2 {
+		t.Fatalf("Expected 2 Front Doors, got %+v", frontDoors)
+	}
+	if frontDoors[0].FrontDoorName != "myfrontdoor" || frontDoors[1].FrontDoorName != "otherfrontdoor" ||
+		frontDoors[1].FrontDoorHostname != "other.azurefd.net" || frontDoors[1].ClusterName != "cluster1" {
+		t.Errorf("Unexpected Front Door configs: %+v", frontDoors)
+	}
+	for _, fdConfig := range frontDoors {
+		if len(fdConfig.AdditionalFrontDoors) != 0 {
+			t.Errorf("Expected each Front Door config to sync only its own Front Door, got %v", fdConfig.AdditionalFrontDoors)
+		}
+	}
+}
+
+func TestConfigParsedStaticRoutes(t *testing.T) {
+	config := Config{StaticRoutes: []string{"maintenance=maintenance-pool:/maintenance/*| /status", "invalid"}}
+
+	routes := config.ParsedStaticRoutes()
+	expected := []StaticRoute{{Name: "maintenance", BackendPool: "maintenance-pool", Paths: []string{"/maintenance/*", "/status"}}}
+	if !reflect.DeepEqual(routes, expected) {
+		t.Errorf("Expected static routes %+v got %+v", expected, routes)
+	}
+}
+
+func TestConfigAcceptedProtocols(t *testing.T) {
+	testCases := map[string][]string{
+		"":           {"Http", "Https"},
+		"https":      {"Https"},
+		"Https,HTTP": {"Http", "Https"},
+	}
+	for value, expected := range testCases {
+		config := Config{}
+		if value != "" {
+			config.FrontendProtocols = strings.Split(value, ",")
+		}
+		if protocols := config.AcceptedProtocols(); !reflect.DeepEqual(protocols, expected) {
+			t.Errorf("Expected %q to accept %q, got %q", value, expected, protocols)
+		}
+	}
+}
+
+func TestConfigIdentity(t *testing.T) {
+	config := Config{ClusterName: "cluster1", PodName: "controller-7d9f8-abcde"}
+	if identity := config.Identity(); identity != "cluster1/controller-7d9f8-abcde@"+Version {
+		t.Errorf("Expected the identity to include the cluster, pod and version, got %q", identity)
+	}
+	config.PodName = ""
+	if identity := config.Identity(); identity != "cluster1/unknown@"+Version {
+		t.Errorf("Expected an unknown pod to be named, got %q", identity)
+	}
+}
+
+func TestConfigNamespaces(t *testing.T) {
+	testCases := map[string][]string{
+		"":                {""},
+		"default":         {"default"},
+		"team-a, team-b,": {"team-a", "team-b"},
+		" , ":             {""},
+	}
+	for value, expected := range testCases {
+		if namespaces := (Config{KubernetesNamespace: value}).Namespaces(); !reflect.DeepEqual(namespaces, expected) {
+			t.Errorf("Expected %q to be namespaces %q, got %q", value, expected, namespaces)
+		}
+	}
+}
+
+func TestConfigFrontDoorSubscription(t *testing.T) {
+	config := Config{SubscriptionID: "11111111-1111-1111-1111-111111111111"}
+	if subscription := config.FrontDoorSubscription(); subscription != config.SubscriptionID {
+		t.Errorf("Expected the Front Door to default to AZURE_SUBSCRIPTION_ID, got %q", subscription)
+	}
+
+	config.FrontDoorSubscriptionID = "22222222-2222-2222-2222-222222222222"
+	if subscription := config.FrontDoorSubscription(); subscription != config.FrontDoorSubscriptionID {
+		t.Errorf("Expected the Front Door's own subscription, got %q", subscription)
+	}
+	if subscription := config.StorageSubscription(); subscription != config.SubscriptionID {
+		t.Errorf("Expected the storage account to stay in AZURE_SUBSCRIPTION_ID, got %q", subscription)
+	}
+}
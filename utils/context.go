@@ -3,6 +3,7 @@ package utils
 import (
 	"context"
 
+	uuid "github.com/satori/go.uuid"
 	logrus "github.com/sirupsen/logrus"
 )
 
@@ -10,6 +11,7 @@ import (
 
 type (
 	loggerKey struct{}
+	syncIDKey struct{}
 )
 
 var defaultLogger = logrus.NewEntry(logrus.StandardLogger())
@@ -32,3 +34,23 @@ func GetLogger(ctx context.Context) *logrus.Entry {
 
 	return logger.(*logrus.Entry)
 }
+
+// NewSyncID generates an ID for a sync cycle, it's a UUID so it can be sent to Azure
+// as the client request ID
+func NewSyncID() string {
+	return uuid.NewV4().String()
+}
+
+// WithSyncID returns a new context carrying the ID of the sync cycle, the ID is
+// added to the context's logger so every log line for the cycle includes it
+func WithSyncID(ctx context.Context, syncID string) context.Context {
+	ctx = context.WithValue(ctx, syncIDKey{}, syncID)
+	return WithLogger(ctx, GetLogger(ctx).WithField("syncID", syncID))
+}
+
+// GetSyncID retrieves the ID of the sync cycle from the context, or an empty string if
+// the context isn't part of a sync cycle
+func GetSyncID(ctx context.Context) string {
+	syncID, _ := ctx.Value(syncIDKey{}).(string)
+	return syncID
+}
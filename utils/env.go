@@ -0,0 +1,92 @@
+package utils
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+// DefaultEnvFile is the env file loaded from the working directory when ENV_FILE isn't set
+const DefaultEnvFile = ".env"
+
+// LoadEnvFile sets the env vars in the file which aren't already set, returning false if the file
+// doesn't exist. The file is optional so the controller can run from a read-only or empty filesystem,
+// such as a distroless image, with all its config in env vars and flags.
+func LoadEnvFile(path string) (bool, error) {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return false, nil
+	}
+	if err := godotenv.Load(path); err != nil {
+		return false, fmt.Errorf("failed to load env file %s: %v", path, err)
+	}
+	return true, nil
+}
+
+// EnvReader reads typed config values from environment variables, collecting
+// any parse errors so they can be reported together with Config.Validate
+type EnvReader struct {
+	errs []error
+}
+
+// Bool reads a boolean env var, returning the default if it isn't set
+func (e *EnvReader) Bool(name string, defaultValue bool) bool {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		e.errs = append(e.errs, fmt.Errorf("%s: %q must be 'true' or 'false'", name, value))
+		return defaultValue
+	}
+	return parsed
+}
+
+// Int reads an integer env var, returning the default if it isn't set
+func (e *EnvReader) Int(name string, defaultValue int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		e.errs = append(e.errs, fmt.Errorf("%s: %q must be a whole number", name, value))
+		return defaultValue
+	}
+	return parsed
+}
+
+// Duration reads a duration env var, for example '45s', returning the default if it isn't set
+func (e *EnvReader) Duration(name string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue
+	}
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		e.errs = append(e.errs, fmt.Errorf("%s: %q must be a duration such as '45s' or '5m'", name, value))
+		return defaultValue
+	}
+	return parsed
+}
+
+// List reads a comma separated env var, ignoring whitespace and empty items
+func (e *EnvReader) List(name string) []string {
+	items := []string{}
+	for _, item := range strings.Split(os.Getenv(name), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Err returns an aggregate of every env var which couldn't be parsed
+func (e *EnvReader) Err() error {
+	return utilerrors.NewAggregate(e.errs)
+}
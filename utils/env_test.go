@@ -0,0 +1,38 @@
+package utils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadEnvFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "envfile")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	loaded, err := LoadEnvFile(filepath.Join(dir, ".env"))
+	if loaded || err != nil {
+		t.Errorf("Expected a missing env file to be skipped, got %v %v", loaded, err)
+	}
+
+	path := filepath.Join(dir, ".env")
+	if err := ioutil.WriteFile(path, []byte("ENV_FILE_TEST_SETTING=fromfile\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Unsetenv("ENV_FILE_TEST_SETTING")
+	loaded, err = LoadEnvFile(path)
+	if !loaded || err != nil || os.Getenv("ENV_FILE_TEST_SETTING") != "fromfile" {
+		t.Errorf("Expected the env file to be loaded, got %v %v", loaded, err)
+	}
+
+	if err := ioutil.WriteFile(path, []byte("not an env var"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = LoadEnvFile(path); err == nil {
+		t.Error("Expected an env file which can't be parsed to fail")
+	}
+}
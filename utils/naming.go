@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"fmt"
+	"regexp"
+)
+
+const (
+	// MaxFrontDoorChildNameLength is the longest name allowed for resources inside a Frontdoor
+	MaxFrontDoorChildNameLength = 90
+)
+
+var (
+	// frontDoorNameRegex matches the naming rules for a Frontdoor instance: 5-64 alphanumerics or hyphens,
+	// starting and ending with an alphanumeric
+	frontDoorNameRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9-]{3,62}[a-zA-Z0-9]$`)
+	// frontDoorChildNameRegex matches the naming rules for resources inside a Frontdoor
+	// such as backend pools, frontend endpoints and routing rules
+	frontDoorChildNameRegex = regexp.MustCompile(`^[a-zA-Z0-9]+(-*[a-zA-Z0-9])*$`)
+)
+
+// ValidateFrontDoorName checks the name meets the naming rules for a Frontdoor instance
+func ValidateFrontDoorName(name string) error {
+	if !frontDoorNameRegex.MatchString(name) {
+		return fmt.Errorf("%q must be 5-64 alphanumerics or hyphens, starting and ending with an alphanumeric", name)
+	}
+	return nil
+}
+
+// ValidateFrontDoorChildName checks the name meets the naming rules for resources inside a Frontdoor,
+// such as routing rules, backend pools and frontend endpoints
+func ValidateFrontDoorChildName(name string) error {
+	if len(name) == 0 || len(name) > MaxFrontDoorChildNameLength {
+		return fmt.Errorf("%q must be 1-%d characters long", name, MaxFrontDoorChildNameLength)
+	}
+	if !frontDoorChildNameRegex.MatchString(name) {
+		return fmt.Errorf("%q must only contain alphanumerics or hyphens, starting and ending with an alphanumeric", name)
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateFrontDoorChildName(t *testing.T) {
+	testCases := map[string]bool{
+		"Ingress-app":            true,
+		"Ingress--app":           true,
+		"Ingress-my.app":         false,
+		"Ingress-app-":           false,
+		"-Ingress":               false,
+		"":                       false,
+		strings.Repeat("a", 90):  true,
+		strings.Repeat("a", 91):  false,
+		"Ingress-app_underscore": false,
+	}
+	for name, valid := range testCases {
+		err := ValidateFrontDoorChildName(name)
+		if valid && err != nil {
+			t.Errorf("Expected %q to be valid, got: %v", name, err)
+		}
+		if !valid && err == nil {
+			t.Errorf("Expected %q to be invalid", name)
+		}
+	}
+}
@@ -0,0 +1,374 @@
+package utils
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	azlock "github.com/lawrencegripper/goazurelocking"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+var (
+	// resourceGroupNameRegex matches the naming rules for an Azure resource group
+	resourceGroupNameRegex = regexp.MustCompile(`^[-\w\._\(\)]{0,89}[-\w_\(\)]$`)
+	// subscriptionIDRegex matches a GUID, also used for the Frontdoor ID
+	subscriptionIDRegex = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+)
+
+// Validate checks the config and returns an aggregate of every problem found,
+// each naming the environment variable used to set the invalid value
+func (c Config) Validate() error {
+	errs := []error{}
+	addErr := func(setting, format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("%s: %s", setting, fmt.Sprintf(format, args...)))
+	}
+
+	required := []struct {
+		setting string
+		value   string
+	}{
+		{"AZURE_SUBSCRIPTION_ID", c.SubscriptionID},
+		{"AZURE_RESOURCE_GROUP_NAME", c.ResourceGroupName},
+		{"AZURE_FRONTDOOR_NAME", c.FrontDoorName},
+		{"AZURE_FRONTDOOR_HOSTNAME", c.FrontDoorHostname},
+		{"CLUSTER_NAME", c.ClusterName},
+	}
+	if c.NeedsStorageAccount() {
+		required = append(required, struct {
+			setting string
+			value   string
+		}{"STORAGE_ACCOUNT_URL", c.StorageAccountURL})
+	}
+	for _, r := range required {
+		if r.value == "" {
+			addErr(r.setting, "required but not set")
+		}
+	}
+
+	// The key can be listed from the storage account's resource group instead
+	if c.NeedsStorageAccount() && c.StorageAccountKey == "" && c.StorageResourceGroupName == "" {
+		addErr("STORAGE_ACCOUNT_KEY", "required unless STORAGE_AZURE_RESOURCE_GROUP_NAME is set")
+	}
+	if c.StorageSubscriptionID != "" && !subscriptionIDRegex.MatchString(c.StorageSubscriptionID) {
+		addErr("STORAGE_AZURE_SUBSCRIPTION_ID", "%q must be a GUID", c.StorageSubscriptionID)
+	}
+	if c.StorageResourceGroupName != "" && !resourceGroupNameRegex.MatchString(c.StorageResourceGroupName) {
+		addErr("STORAGE_AZURE_RESOURCE_GROUP_NAME", "%q must be 1-90 alphanumerics, underscores, parentheses, hyphens or periods and can't end in a period", c.StorageResourceGroupName)
+	}
+	if c.StorageClientID != "" && (c.StorageClientSecret == "" || c.StorageTenantID == "") {
+		addErr("STORAGE_AZURE_CLIENT_ID", "requires STORAGE_AZURE_CLIENT_SECRET and STORAGE_AZURE_TENANT_ID")
+	}
+
+	if c.SubscriptionID != "" && !subscriptionIDRegex.MatchString(c.SubscriptionID) {
+		addErr("AZURE_SUBSCRIPTION_ID", "%q must be a GUID", c.SubscriptionID)
+	}
+	if c.FrontDoorSubscriptionID != "" && !subscriptionIDRegex.MatchString(c.FrontDoorSubscriptionID) {
+		addErr("FRONTDOOR_AZURE_SUBSCRIPTION_ID", "%q must be a GUID", c.FrontDoorSubscriptionID)
+	}
+	if c.FrontDoorClientID != "" && (c.FrontDoorClientSecret == "" || c.FrontDoorTenantID == "") {
+		addErr("FRONTDOOR_AZURE_CLIENT_ID", "requires FRONTDOOR_AZURE_CLIENT_SECRET and FRONTDOOR_AZURE_TENANT_ID")
+	}
+
+	if c.ResourceGroupName != "" && !resourceGroupNameRegex.MatchString(c.ResourceGroupName) {
+		addErr("AZURE_RESOURCE_GROUP_NAME", "%q must be 1-90 alphanumerics, underscores, parentheses, hyphens or periods and can't end in a period", c.ResourceGroupName)
+	}
+
+	if c.FrontDoorName != "" {
+		if err := ValidateFrontDoorName(c.FrontDoorName); err != nil {
+			addErr("AZURE_FRONTDOOR_NAME", "%v", err)
+		}
+		// The frontdoor name is also used to name the storage lock
+		if _, err := azlock.IsValidLockName(c.FrontDoorName); err != nil {
+			addErr("AZURE_FRONTDOOR_NAME", "can't be used as a lock name: %v", err)
+		}
+	}
+
+	if c.FrontDoorHostname != "" {
+		if msgs := validation.IsDNS1123Subdomain(c.FrontDoorHostname); len(msgs) > 0 {
+			addErr("AZURE_FRONTDOOR_HOSTNAME", "%q isn't a valid hostname: %v", c.FrontDoorHostname, msgs)
+		}
+	}
+
+	names := map[string]bool{c.FrontDoorName: true}
+	for _, frontDoor := range c.AdditionalFrontDoors {
+		name, hostname, ok := parseAdditionalFrontDoor(frontDoor)
+		if !ok {
+			addErr("ADDITIONAL_FRONTDOORS", "%q must be 'name=hostname'", frontDoor)
+			continue
+		}
+		if names[name] {
+			addErr("ADDITIONAL_FRONTDOORS", "%q is synced more than once", name)
+		}
+		names[name] = true
+		if err := ValidateFrontDoorName(name); err != nil {
+			addErr("ADDITIONAL_FRONTDOORS", "%v", err)
+		} else if _, err := azlock.IsValidLockName(name); err != nil {
+			addErr("ADDITIONAL_FRONTDOORS", "%q can't be used as a lock name: %v", name, err)
+		}
+		if msgs := validation.IsDNS1123Subdomain(hostname); len(msgs) > 0 {
+			addErr("ADDITIONAL_FRONTDOORS", "%q isn't a valid hostname: %v", hostname, msgs)
+		}
+	}
+
+	// The cluster name is used as the name of the backend pool in frontdoor
+	if c.ClusterName != "" {
+		if err := ValidateFrontDoorChildName(c.ClusterName); err != nil {
+			addErr("CLUSTER_NAME", "used as the backend pool name so %v", err)
+		}
+	}
+	if c.AuthoritativeCluster != "" {
+		if err := ValidateFrontDoorChildName(c.AuthoritativeCluster); err != nil {
+			addErr("AUTHORITATIVE_CLUSTER", "must be a CLUSTER_NAME so %v", err)
+		}
+	}
+
+	if c.StorageAccountURL != "" {
+		if err := validateStorageAccountURL(c.StorageAccountURL); err != nil {
+			addErr("STORAGE_ACCOUNT_URL", "%v", err)
+		}
+	}
+
+	namespaces := map[string]bool{}
+	for _, namespace := range c.Namespaces() {
+		if namespace == "" {
+			continue
+		}
+		if msgs := validation.IsDNS1123Label(namespace); len(msgs) > 0 {
+			addErr("KUBERNETES_NAMESPACE", "%q isn't a valid namespace: %v", namespace, msgs)
+		}
+		if namespaces[namespace] {
+			addErr("KUBERNETES_NAMESPACE", "%q is listed more than once", namespace)
+		}
+		namespaces[namespace] = true
+	}
+
+	if c.MetricsAddress != "" {
+		if _, _, err := net.SplitHostPort(c.MetricsAddress); err != nil {
+			addErr("METRICS_ADDRESS", "%q must be in the form 'host:port' or ':port': %v", c.MetricsAddress, err)
+		}
+	}
+
+	for _, annotation := range c.AllowedAnnotations {
+		if !strings.HasPrefix(annotation, annotationPrefix) {
+			addErr("ALLOWED_ANNOTATIONS", "%q isn't a frontdoor annotation, they start with %q", annotation, annotationPrefix)
+		}
+	}
+
+	if c.PublicIPProbeURL != "" {
+		if u, err := url.Parse(c.PublicIPProbeURL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			addErr("PUBLIC_IP_PROBE_URL", "%q must be an http or https URL", c.PublicIPProbeURL)
+		}
+	}
+
+	if c.WebhookURL != "" {
+		if u, err := url.Parse(c.WebhookURL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			addErr("WEBHOOK_URL", "%q must be an http or https URL", c.WebhookURL)
+		}
+	}
+
+	if c.LockAlertWebhookURL != "" {
+		if u, err := url.Parse(c.LockAlertWebhookURL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			addErr("LOCK_ALERT_WEBHOOK_URL", "%q must be an http or https URL", c.LockAlertWebhookURL)
+		}
+		if c.LockAlertAfter == 0 {
+			addErr("LOCK_ALERT_WEBHOOK_URL", "requires LOCK_ALERT_AFTER to be set")
+		}
+	}
+
+	if c.AdminAddress != "" {
+		if _, _, err := net.SplitHostPort(c.AdminAddress); err != nil {
+			addErr("ADMIN_ADDRESS", "%q must be in the form 'host:port' or ':port': %v", c.AdminAddress, err)
+		}
+		if c.AdminAddress == c.MetricsAddress {
+			addErr("ADMIN_ADDRESS", "%q is already used for METRICS_ADDRESS", c.AdminAddress)
+		}
+		if c.AdminToken == "" {
+			addErr("ADMIN_TOKEN", "required when ADMIN_ADDRESS is set")
+		}
+	}
+
+	if c.OwnershipMode != OwnershipModeStrict && c.OwnershipMode != OwnershipModeMerge {
+		addErr("OWNERSHIP_MODE", "%q must be %q or %q", c.OwnershipMode, OwnershipModeStrict, OwnershipModeMerge)
+	}
+	if c.LockingMode != "" && c.LockingMode != LockingModeStorage && c.LockingMode != LockingModeNone {
+		addErr("LOCKING_MODE", "%q must be %q or %q", c.LockingMode, LockingModeStorage, LockingModeNone)
+	}
+	if c.LockingMode == LockingModeNone && c.LockHistory {
+		addErr("LOCK_HISTORY", "records each hold of the lock so can't be used with LOCKING_MODE=%s", LockingModeNone)
+	}
+	if c.LockingMode == LockingModeNone && c.LockAlertAfter > 0 {
+		addErr("LOCK_ALERT_AFTER", "alerts on the lock in the storage account so can't be used with LOCKING_MODE=%s", LockingModeNone)
+	}
+	if c.LockingMode == LockingModeNone && c.LockGCAfter > 0 {
+		addErr("LOCK_GC_AFTER", "deletes locks in the storage account so can't be used with LOCKING_MODE=%s", LockingModeNone)
+	}
+	if c.SyncStrategy != "" && c.SyncStrategy != SyncStrategyReplace && c.SyncStrategy != SyncStrategyMerge {
+		addErr("SYNC_STRATEGY", "%q must be %q or %q", c.SyncStrategy, SyncStrategyReplace, SyncStrategyMerge)
+	}
+	if c.DefaultRoute != "" && c.DefaultRoute != DefaultRouteEnabled && c.DefaultRoute != DefaultRouteDisabled {
+		addErr("DEFAULT_ROUTE", "%q must be %q or %q", c.DefaultRoute, DefaultRouteEnabled, DefaultRouteDisabled)
+	}
+
+	if c.MinimumTLSVersion != "" && c.MinimumTLSVersion != "1.0" && c.MinimumTLSVersion != "1.2" {
+		addErr("MINIMUM_TLS_VERSION", "%q must be '1.0' or '1.2'", c.MinimumTLSVersion)
+	}
+
+	if c.FrontDoorID != "" && !subscriptionIDRegex.MatchString(c.FrontDoorID) {
+		addErr("AZURE_FRONTDOOR_ID", "%q must be a GUID", c.FrontDoorID)
+	}
+
+	if c.AccessRestrictionConfigMap != "" {
+		if !isNamespacedName(c.AccessRestrictionConfigMap) {
+			addErr("ACCESS_RESTRICTION_CONFIGMAP", "%q must be 'namespace/name'", c.AccessRestrictionConfigMap)
+		}
+		if c.FrontDoorID == "" {
+			addErr("AZURE_FRONTDOOR_ID", "required when ACCESS_RESTRICTION_CONFIGMAP is set")
+		}
+	}
+
+	if c.ServiceTagsConfigMap != "" && !isNamespacedName(c.ServiceTagsConfigMap) {
+		addErr("SERVICE_TAGS_CONFIGMAP", "%q must be 'namespace/name'", c.ServiceTagsConfigMap)
+	}
+
+	if c.APIRecordMode != "" {
+		if c.APIRecordMode != APIRecordModeRecord && c.APIRecordMode != APIRecordModeReplay {
+			addErr("API_RECORD_MODE", "%q must be %q or %q", c.APIRecordMode, APIRecordModeRecord, APIRecordModeReplay)
+		}
+		if c.APIRecordingDir == "" {
+			addErr("API_RECORDING_DIR", "required when API_RECORD_MODE is set")
+		}
+	}
+
+	if c.SnapshotRetention < 0 {
+		addErr("SNAPSHOT_RETENTION", "%d can't be negative", c.SnapshotRetention)
+	}
+
+	if c.BackendPriority < MinBackendPriority || c.BackendPriority > MaxBackendPriority {
+		addErr("BACKEND_PRIORITY", "%d must be between %d and %d", c.BackendPriority, MinBackendPriority, MaxBackendPriority)
+	}
+
+	if c.ConcurrentReconciles < 1 {
+		addErr("CONCURRENT_RECONCILES", "%d must be at least 1", c.ConcurrentReconciles)
+	} else if c.ConcurrentReconciles > 1 && len(namespaces) == 1 {
+		addErr("CONCURRENT_RECONCILES", "only used when watching several namespaces so KUBERNETES_NAMESPACE must not be a single namespace")
+	}
+
+	if c.SyncDebounce < 0 {
+		addErr("SYNC_DEBOUNCE", "%v can't be negative", c.SyncDebounce)
+	}
+
+	if c.AppInsightsConnectionString != "" {
+		if _, _, err := parseAppInsightsConnectionString(c.AppInsightsConnectionString); err != nil {
+			addErr("APPLICATIONINSIGHTS_CONNECTION_STRING", "%v", err)
+		}
+	}
+	// Azure Monitor publishes the backend health metric at most once a minute
+	if c.BackendHealthInterval != 0 && c.BackendHealthInterval < time.Minute {
+		addErr("BACKEND_HEALTH_INTERVAL", "%v must be at least 1m", c.BackendHealthInterval)
+	}
+	if c.LockAlertAfter < 0 {
+		addErr("LOCK_ALERT_AFTER", "%v must not be negative", c.LockAlertAfter)
+	}
+	// Locks in use are written every sync so an hour can't remove one another cluster is using
+	if c.LockGCAfter != 0 && c.LockGCAfter < time.Hour {
+		addErr("LOCK_GC_AFTER", "%v must be at least 1h", c.LockGCAfter)
+	}
+
+	staticRouteNames := map[string]bool{}
+	for _, value := range c.StaticRoutes {
+		route, ok := parseStaticRoute(value)
+		if !ok {
+			addErr("STATIC_ROUTES", "%q must be 'name=backendPool:/path|/path'", value)
+			continue
+		}
+		if staticRouteNames[route.Name] {
+			addErr("STATIC_ROUTES", "%q is declared more than once", route.Name)
+		}
+		staticRouteNames[route.Name] = true
+		if err := ValidateFrontDoorChildName(route.Name); err != nil {
+			addErr("STATIC_ROUTES", "name %v", err)
+		}
+		if err := ValidateFrontDoorChildName(route.BackendPool); err != nil {
+			addErr("STATIC_ROUTES", "backend pool %v", err)
+		}
+		for _, path := range route.Paths {
+			if !strings.HasPrefix(path, "/") {
+				addErr("STATIC_ROUTES", "path %q of %q must start with '/'", path, route.Name)
+			}
+		}
+	}
+
+	for _, value := range c.FrontendProtocols {
+		if !strings.EqualFold(value, frontendProtocols[0]) && !strings.EqualFold(value, frontendProtocols[1]) {
+			addErr("FRONTEND_PROTOCOLS", "%q must be 'Http' or 'Https'", value)
+		}
+	}
+
+	if c.RouteVerificationWindow < 0 {
+		addErr("ROUTE_VERIFICATION_WINDOW", "%v can't be negative", c.RouteVerificationWindow)
+	}
+	if c.AwaitPropagationTimeout < 0 {
+		addErr("AWAIT_PROPAGATION_TIMEOUT", "%v can't be negative", c.AwaitPropagationTimeout)
+	}
+
+	if c.UnusedFrontendGracePeriod < 0 {
+		addErr("UNUSED_FRONTEND_GRACE_PERIOD", "%v can't be negative", c.UnusedFrontendGracePeriod)
+	} else if c.UnusedFrontendGracePeriod > 0 && !c.CustomDomains {
+		addErr("UNUSED_FRONTEND_GRACE_PERIOD", "only used when CUSTOM_DOMAINS is enabled")
+	}
+
+	if c.DisableUnreadyRoutesAfter < 0 {
+		addErr("DISABLE_UNREADY_ROUTES_AFTER", "%v can't be negative", c.DisableUnreadyRoutesAfter)
+	}
+
+	if c.KubernetesAPIQPS < 0 {
+		addErr("KUBERNETES_API_QPS", "%d can't be negative", c.KubernetesAPIQPS)
+	}
+	if c.KubernetesAPIBurst < 0 {
+		addErr("KUBERNETES_API_BURST", "%d can't be negative", c.KubernetesAPIBurst)
+	} else if c.KubernetesAPIBurst > 0 && c.KubernetesAPIBurst < c.KubernetesAPIQPS {
+		addErr("KUBERNETES_API_BURST", "%d must be at least KUBERNETES_API_QPS", c.KubernetesAPIBurst)
+	}
+
+	if c.RollbackProbeWindow < 0 {
+		addErr("ROLLBACK_PROBE_WINDOW", "%v can't be negative", c.RollbackProbeWindow)
+	}
+
+	if c.RollbackProbePath != "" && !strings.HasPrefix(c.RollbackProbePath, "/") {
+		addErr("ROLLBACK_PROBE_PATH", "%q must start with '/'", c.RollbackProbePath)
+	}
+
+	if c.AuthFileLocation != "" {
+		if _, err := os.Stat(c.AuthFileLocation); err != nil {
+			addErr("AZURE_AUTH_LOCATION", "auth file can't be read: %v", err)
+		}
+	}
+
+	return utilerrors.NewAggregate(errs)
+}
+
+// isNamespacedName checks the value is a valid 'namespace/name' of a Kubernetes object
+func isNamespacedName(value string) bool {
+	parts := strings.Split(value, "/")
+	return len(parts) == 2 && len(validation.IsDNS1123Label(parts[0])) == 0 && len(validation.IsDNS1123Subdomain(parts[1])) == 0
+}
+
+func validateStorageAccountURL(storageAccountURL string) error {
+	u, err := url.Parse(storageAccountURL)
+	if err != nil {
+		return fmt.Errorf("failed to parse %q: %v", storageAccountURL, err)
+	}
+	if u.Scheme != "https" {
+		return fmt.Errorf("%q must use https, for example 'https://mystorageaccount.blob.core.windows.net'", storageAccountURL)
+	}
+	if u.Host == "" || u.Path != "" {
+		return fmt.Errorf("%q must be the root of the storage account, for example 'https://mystorageaccount.blob.core.windows.net'", storageAccountURL)
+	}
+	return nil
+}
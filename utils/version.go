@@ -0,0 +1,37 @@
+package utils
+
+import "runtime"
+
+// Build information, set when building with, for example,
+// -ldflags "-X github.com/lawrencegripper/azurefrontdooringress/utils.Version=<version>"
+var (
+	// Version of the controller
+	Version = "dev"
+	// Commit is the git commit the controller was built from
+	Commit = "unknown"
+	// BuildDate is when the controller was built, in RFC 3339 format
+	BuildDate = "unknown"
+)
+
+// BuildInfo describes the build of the controller so changes it makes can be traced to it
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"buildDate"`
+	GoVersion string `json:"goVersion"`
+}
+
+// GetBuildInfo returns the build information of the running controller
+func GetBuildInfo() BuildInfo {
+	return BuildInfo{
+		Version:   Version,
+		Commit:    Commit,
+		BuildDate: BuildDate,
+		GoVersion: runtime.Version(),
+	}
+}
+
+// UserAgent identifies the controller and its version in requests to Azure
+func UserAgent() string {
+	return "azurefrontdooringress/" + Version
+}
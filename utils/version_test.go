@@ -0,0 +1,16 @@
+package utils
+
+import "testing"
+
+func TestGetBuildInfo(t *testing.T) {
+	defer func(version, commit string) { Version, Commit = version, commit }(Version, Commit)
+	Version, Commit = "1.2.0", "abc1234"
+
+	info := GetBuildInfo()
+	if info.Version != "1.2.0" || info.Commit != "abc1234" || info.GoVersion == "" {
+		t.Errorf("Expected the injected build information, got %+v", info)
+	}
+	if agent := UserAgent(); agent != "azurefrontdooringress/1.2.0" {
+		t.Errorf("Expected the user agent to include the version, got %s", agent)
+	}
+}